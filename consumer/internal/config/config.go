@@ -1,28 +1,216 @@
 package config
 
 import (
-	"os"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"contracts/configload"
+	"contracts/kafkaconn"
+	"contracts/mongoconn"
+	"contracts/pgconn"
 )
 
+// Config is read by Load from, in increasing order of precedence: the defaults below, a YAML or
+// TOML file (--config or CONFIG_FILE), environment variables and flags (--kafka.brokers etc.)
 type Config struct {
-	Port          string
-	MongoURI      string
-	MongoDatabase string
-	KafkaBroker   string
+	HTTP       HTTPConfig       `yaml:"http"`
+	Storage    StorageConfig    `yaml:"storage"`
+	Mongo      mongoconn.Config `yaml:"mongo"`
+	Postgres   pgconn.Config    `yaml:"postgres"`
+	Kafka      KafkaConfig      `yaml:"kafka"`
+	Consumer   ConsumerConfig   `yaml:"consumer"`
+	Events     EventsConfig     `yaml:"events"`
+	Tracing    TracingConfig    `yaml:"tracing"`
+	Log        LogConfig        `yaml:"log"`
+	Health     HealthConfig     `yaml:"health"`
+	Migrations MigrationsConfig `yaml:"migrations"`
+	Seed       SeedConfig       `yaml:"seed"`
+
+	// ShutdownTimeout bounds the graceful shutdown that follows SIGTERM or SIGINT
+	ShutdownTimeout time.Duration `yaml:"shutdownTimeout" env:"SHUTDOWN_TIMEOUT" usage:"graceful shutdown deadline"`
+}
+
+type HTTPConfig struct {
+	Port string `yaml:"port" env:"PORT" usage:"HTTP listen port"`
+}
+
+// Storage backends
+const (
+	BackendMongo    = "mongo"
+	BackendPostgres = "postgres"
+)
+
+type StorageConfig struct {
+	// Backend keeps the orders, menus and daily aggregates, in the mongo or the postgres
+	// section's database; the producer reads them from the same one
+	Backend string `yaml:"backend" env:"STORAGE_BACKEND" usage:"database orders are kept in: mongo or postgres"`
+}
+
+type KafkaConfig struct {
+	// brokers, tls and sasl
+	kafkaconn.Config `yaml:",inline"`
+	OrdersTopic      string `yaml:"ordersTopic" env:"KAFKA_ORDERS_TOPIC" usage:"topic order events are read from"`
+	// LifecycleTopic feeds the producer's live order streams
+	LifecycleTopic string `yaml:"lifecycleTopic" env:"KAFKA_LIFECYCLE_TOPIC" usage:"topic order lifecycle events are written to"`
+	// DeadLetterTopic receives the order events that can't be read, with why in their headers
+	DeadLetterTopic string `yaml:"deadLetterTopic" env:"KAFKA_DEAD_LETTER_TOPIC" usage:"topic unreadable order events are moved to"`
+}
+
+// ConsumerConfig is how order events are read: in batches of up to BatchSize messages per
+// partition, waiting at most BatchWait to fill one, with Concurrency batches at a time
+type ConsumerConfig struct {
+	GroupID     string        `yaml:"groupId" env:"KAFKA_GROUP_ID" usage:"consumer group of the order event reader"`
+	BatchSize   int           `yaml:"batchSize" env:"KAFKA_BATCH_SIZE" usage:"most messages per partition handled together"`
+	BatchWait   time.Duration `yaml:"batchWait" env:"KAFKA_BATCH_WAIT" usage:"how long a partition waits to fill a batch"`
+	Concurrency int           `yaml:"concurrency" env:"KAFKA_CONSUMER_CONCURRENCY" usage:"batches handled at the same time"`
+	// CommitInterval is how often handled offsets are committed to Kafka
+	CommitInterval time.Duration `yaml:"commitInterval" env:"KAFKA_COMMIT_INTERVAL" usage:"how often offsets are committed"`
+	// StallTimeout is how long the loop may hold events without a heartbeat before the
+	// liveness check fails
+	StallTimeout time.Duration `yaml:"stallTimeout" env:"CONSUMER_STALL_TIMEOUT" usage:"time without progress after which the consumer is not live"`
+}
+
+type EventsConfig struct {
+	// SchemaRegistryURL is needed to read protobuf and avro events; JSON events don't use it
+	SchemaRegistryURL string `yaml:"schemaRegistryUrl" env:"SCHEMA_REGISTRY_URL" usage:"schema registry URL, needed to read binary events"`
+}
+
+type TracingConfig struct {
+	// Exporter sends spans with OTLP ("otlp"), prints them ("stdout") or drops them ("none");
+	// SampleRatio is the share of new traces recorded, from 0 to 1
+	Exporter    string  `yaml:"exporter" env:"OTEL_TRACES_EXPORTER" usage:"span exporter: none, otlp or stdout"`
+	SampleRatio float64 `yaml:"sampleRatio" env:"OTEL_TRACES_SAMPLER_ARG" usage:"share of new traces recorded, 0 to 1"`
+}
+
+type LogConfig struct {
+	Format string `yaml:"format" env:"LOG_FORMAT" usage:"log format: json or text"`
+	Level  string `yaml:"level" env:"LOG_LEVEL" usage:"minimum log level: debug, info, warn or error"`
+}
+
+type HealthConfig struct {
+	// CheckTimeout bounds each run of the health checks
+	CheckTimeout time.Duration `yaml:"checkTimeout" env:"HEALTH_CHECK_TIMEOUT" usage:"deadline of the health checks"`
+}
+
+type MigrationsConfig struct {
+	// OnStart applies pending migrations before serving; with it off, they're applied with
+	// "consumer migrate up" before the new version is deployed
+	OnStart bool `yaml:"onStart" env:"MIGRATE_ON_START" usage:"apply pending schema migrations at startup"`
+}
+
+type SeedConfig struct {
+	// OnStart loads the fixtures into a database without restaurants before serving
+	OnStart bool `yaml:"onStart" env:"SEED_ON_START" usage:"load the fixtures at startup when there are no restaurants"`
+	// Fixtures is a YAML or JSON file; the built-in demo restaurants are loaded when empty
+	Fixtures string         `yaml:"fixtures" env:"SEED_FIXTURES" usage:"YAML or JSON fixtures file, empty for the built-in restaurants"`
+	Generate GenerateConfig `yaml:"generate"`
+}
+
+// GenerateConfig sizes the synthetic data of "consumer seed generate". The same settings
+// always generate the same data.
+type GenerateConfig struct {
+	Restaurants  int   `yaml:"restaurants" env:"SEED_RESTAURANTS" usage:"restaurants to generate"`
+	Months       int   `yaml:"months" env:"SEED_MONTHS" usage:"months of orders to generate"`
+	OrdersPerDay int   `yaml:"ordersPerDay" env:"SEED_ORDERS_PER_DAY" usage:"average orders per restaurant and day"`
+	RandomSeed   int64 `yaml:"randomSeed" env:"SEED_RANDOM_SEED" usage:"seed of the random generator"`
+	// End is the UTC day the orders stop at, exclusive; empty for today
+	End string `yaml:"end" env:"SEED_END" usage:"day the generated orders stop at, YYYY-MM-DD, empty for today"`
 }
 
-func getEnv(key, fallback string) string {
-	if v := os.Getenv(key); v != "" {
-		return v
+// Default is the configuration of a consumer running on the host next to docker compose
+func Default() Config {
+	cfg := Config{
+		HTTP:     HTTPConfig{Port: "8080"},
+		Storage:  StorageConfig{Backend: BackendMongo},
+		Mongo:    mongoconn.Default("restaurantdb"),
+		Postgres: pgconn.Default("restaurantdb"),
+		Kafka: KafkaConfig{
+			Config:          kafkaconn.Default("localhost:9094"),
+			OrdersTopic:     "orders",
+			LifecycleTopic:  "order-events",
+			DeadLetterTopic: "orders.dead-letter",
+		},
+		Consumer: ConsumerConfig{
+			GroupID:        "consumer-orders-group",
+			BatchSize:      100,
+			BatchWait:      50 * time.Millisecond,
+			Concurrency:    4,
+			CommitInterval: time.Second,
+			StallTimeout:   2 * time.Minute,
+		},
+		Tracing:    TracingConfig{Exporter: "none", SampleRatio: 1},
+		Log:        LogConfig{Format: "json", Level: "info"},
+		Health:     HealthConfig{CheckTimeout: 2 * time.Second},
+		Migrations: MigrationsConfig{OnStart: true},
+		Seed: SeedConfig{
+			OnStart:  true,
+			Generate: GenerateConfig{Restaurants: 10, Months: 6, OrdersPerDay: 60, RandomSeed: 1},
+		},
+		ShutdownTimeout: 30 * time.Second,
 	}
-	return fallback
+	cfg.Mongo.AppName = "consumer"
+	cfg.Postgres.AppName = "consumer"
+	return cfg
 }
 
-func Load() Config {
-	return Config{
-		Port:          getEnv("PORT", "8080"),
-		MongoURI:      getEnv("MONGODB_URI", "mongodb://localhost:27017"),
-		MongoDatabase: getEnv("MONGODB_DATABASE", "restaurantdb"),
-		KafkaBroker:   getEnv("KAFKA_BROKER", "localhost:9092"),
+// Read reads the configuration from its sources and the flags in args, without validating it
+func Read(name string, args []string) (Config, error) {
+	cfg := Default()
+	err := configload.Load(&cfg, name, args)
+	return cfg, err
+}
+
+// Load reads the configuration and validates it
+func Load(name string, args []string) (Config, error) {
+	cfg, err := Read(name, args)
+	if err != nil {
+		return cfg, err
+	}
+	return cfg, cfg.Validate()
+}
+
+// Validate reports every invalid setting, by its key in config files
+func (c Config) Validate() error {
+	var errs configload.Errors
+	errs.Check("http.port", configload.Port(c.HTTP.Port))
+	errs.Check("storage.backend", configload.OneOf(c.Storage.Backend, BackendMongo, BackendPostgres))
+	// only the backend in use is connected to
+	switch c.Storage.Backend {
+	case BackendMongo:
+		c.Mongo.Validate(&errs, "mongo.")
+	case BackendPostgres:
+		c.Postgres.Validate(&errs, "postgres.")
+	}
+	c.Kafka.Validate(&errs, "kafka.")
+	errs.Check("kafka.ordersTopic", configload.Required(c.Kafka.OrdersTopic))
+	errs.Check("kafka.lifecycleTopic", configload.Required(c.Kafka.LifecycleTopic))
+	errs.Check("kafka.deadLetterTopic", configload.Required(c.Kafka.DeadLetterTopic))
+	if c.Kafka.DeadLetterTopic == c.Kafka.OrdersTopic {
+		errs.Check("kafka.deadLetterTopic", errors.New("must differ from kafka.ordersTopic"))
+	}
+	errs.Check("consumer.groupId", configload.Required(c.Consumer.GroupID))
+	errs.Check("consumer.batchSize", configload.AtLeast(c.Consumer.BatchSize, 1))
+	errs.Check("consumer.batchWait", configload.Positive(c.Consumer.BatchWait))
+	errs.Check("consumer.concurrency", configload.AtLeast(c.Consumer.Concurrency, 1))
+	errs.Check("consumer.commitInterval", configload.Positive(c.Consumer.CommitInterval))
+	errs.Check("consumer.stallTimeout", configload.Positive(c.Consumer.StallTimeout))
+	errs.Check("tracing.exporter", configload.OneOf(c.Tracing.Exporter, "none", "otlp", "stdout"))
+	if c.Tracing.SampleRatio < 0 || c.Tracing.SampleRatio > 1 {
+		errs.Check("tracing.sampleRatio", fmt.Errorf("%g is not between 0 and 1", c.Tracing.SampleRatio))
+	}
+	errs.Check("log.format", configload.OneOf(c.Log.Format, "json", "text"))
+	errs.Check("log.level", configload.OneOf(strings.ToLower(c.Log.Level), "debug", "info", "warn", "error"))
+	errs.Check("health.checkTimeout", configload.Positive(c.Health.CheckTimeout))
+	errs.Check("seed.generate.restaurants", configload.AtLeast(c.Seed.Generate.Restaurants, 1))
+	errs.Check("seed.generate.months", configload.AtLeast(c.Seed.Generate.Months, 1))
+	errs.Check("seed.generate.ordersPerDay", configload.AtLeast(c.Seed.Generate.OrdersPerDay, 1))
+	if c.Seed.Generate.End != "" {
+		if _, err := time.Parse(time.DateOnly, c.Seed.Generate.End); err != nil {
+			errs.Check("seed.generate.end", fmt.Errorf("%q is not a YYYY-MM-DD day", c.Seed.Generate.End))
+		}
 	}
+	errs.Check("shutdownTimeout", configload.Positive(c.ShutdownTimeout))
+	return errs.Err()
 }
@@ -2,55 +2,115 @@ package container
 
 import (
 	"context"
+	"log/slog"
+	"os"
 
 	"consumer/internal/config"
-	dbconn "consumer/internal/db"
 	items "consumer/internal/features/items"
 	orders "consumer/internal/features/orders"
-
-	"go.mongodb.org/mongo-driver/mongo"
+	"consumer/internal/storage"
+	"contracts/events"
+	"contracts/health"
+	"contracts/kafkaconn"
+	"contracts/logging"
+	"contracts/registry"
+	"contracts/telemetry"
 )
 
 type Container struct {
-	Config      config.Config
-	MongoClient *mongo.Client
-	DB          *mongo.Database
+	Config config.Config
+	Logger *slog.Logger
+	// Storage is the database of storage.backend
+	Storage *storage.Backend
+	// Kafka connects every Kafka reader and writer
+	Kafka *kafkaconn.Conn
 
 	Orders *orders.Service
 	Items  *items.Service
+	// Events decodes order events in whichever format they were written
+	Events *events.Codec
+	// DeadLetters keeps the order events that can't be read
+	DeadLetters *orders.DeadLetters
+	// ConsumerStatus is reported by the Kafka consumer loop to Health
+	ConsumerStatus *orders.ConsumerStatus
+	Health         *health.Service
 
-	// shutdown functions
-	ShutdownFns []func()
+	// shutdown functions, run by Close in reverse order within its context's deadline
+	ShutdownFns []func(ctx context.Context)
 }
 
 func New(ctx context.Context, cfg config.Config) (*Container, error) {
-	client, database, err := dbconn.Connect(ctx, cfg.MongoURI, cfg.MongoDatabase)
+	// the default logger too, so that libraries logging with log or slog write the same format
+	logger, err := logging.New(os.Stdout, cfg.Log.Format, cfg.Log.Level)
+	if err != nil {
+		return nil, err
+	}
+	slog.SetDefault(logger)
+
+	// Tracing first, so that the clients below report to it
+	shutdownTracing, err := telemetry.Setup(ctx, "consumer", cfg.Tracing.Exporter, cfg.Tracing.SampleRatio)
+	if err != nil {
+		return nil, err
+	}
+
+	backend, err := storage.Open(ctx, cfg, logger)
 	if err != nil {
 		return nil, err
 	}
 
 	container := &Container{
-		Config:      cfg,
-		MongoClient: client,
-		DB:          database,
+		Config:  cfg,
+		Logger:  logger,
+		Storage: backend,
 	}
+	// flushed last on shutdown
+	container.ShutdownFns = append(container.ShutdownFns, func(ctx context.Context) { _ = shutdownTracing(ctx) })
 
-	container.Items = items.NewService(database)
+	container.Items = items.NewService(backend.Items)
+
+	var reg *registry.Client
+	if cfg.Events.SchemaRegistryURL != "" {
+		if reg, err = registry.NewClient(cfg.Events.SchemaRegistryURL); err != nil {
+			return nil, err
+		}
+	}
+	if container.Events, err = events.NewCodec(events.FormatJSON, reg); err != nil {
+		return nil, err
+	}
+
+	if container.Kafka, err = kafkaconn.New(cfg.Kafka.Config); err != nil {
+		return nil, err
+	}
+	// closed after the writers below
+	container.ShutdownFns = append(container.ShutdownFns, func(context.Context) { container.Kafka.Close() })
+
+	// Order lifecycle events feed the producer's live order stream
+	orderEvents := orders.NewEventPublisher(container.Kafka, cfg.Kafka.LifecycleTopic)
+	container.ShutdownFns = append(container.ShutdownFns, func(context.Context) { _ = orderEvents.Close() })
+
+	container.DeadLetters = orders.NewDeadLetters(container.Kafka, cfg.Kafka.DeadLetterTopic)
+	container.ShutdownFns = append(container.ShutdownFns, func(context.Context) { _ = container.DeadLetters.Close() })
 
 	// Initialize feature services
-	container.Orders = orders.NewService(database, *container.Items)
+	container.Orders = orders.NewService(backend.Orders, orderEvents, logger)
+
+	container.ConsumerStatus = orders.NewConsumerStatus(cfg.Consumer.StallTimeout)
+	container.Health = health.NewService(cfg.Health.CheckTimeout)
+	container.Health.AddLiveness("consumer", container.ConsumerStatus.Live)
+	container.Health.AddReadiness("consumer", container.ConsumerStatus.Ready)
+	container.Health.AddReadiness(backend.Name, backend.Check)
+	container.Health.AddReadiness("kafka", health.KafkaCheck(container.Kafka))
 
 	return container, nil
 }
 
+// Close stops what was started last first: the Kafka consumer, then the writers, which flush
+// their pending messages, then tracing, and disconnects the database last
 func (c *Container) Close(ctx context.Context) error {
 	for i := len(c.ShutdownFns) - 1; i >= 0; i-- {
 		if c.ShutdownFns[i] != nil {
-			c.ShutdownFns[i]()
+			c.ShutdownFns[i](ctx)
 		}
 	}
-	if c.MongoClient != nil {
-		return c.MongoClient.Disconnect(ctx)
-	}
-	return nil
+	return c.Storage.Close(ctx)
 }
@@ -2,23 +2,17 @@ package db
 
 import (
 	"context"
-	"time"
+	"log/slog"
+
+	"contracts/metrics"
+	"contracts/mongoconn"
 
 	"go.mongodb.org/mongo-driver/mongo"
-	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.opentelemetry.io/contrib/instrumentation/go.mongodb.org/mongo-driver/mongo/otelmongo"
 )
 
-func Connect(ctx context.Context, uri string, database string) (*mongo.Client, *mongo.Database, error) {
-	clientOpts := options.Client().ApplyURI(uri)
-	client, err := mongo.NewClient(clientOpts)
-	if err != nil {
-		return nil, nil, err
-	}
-
-	connectCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
-	defer cancel()
-	if err := client.Connect(connectCtx); err != nil {
-		return nil, nil, err
-	}
-	return client, client.Database(database), nil
+// Connect waits for MongoDB as configured; every command is timed and becomes a span of the
+// operation that issued it
+func Connect(ctx context.Context, cfg mongoconn.Config, logger *slog.Logger) (*mongo.Client, *mongo.Database, error) {
+	return mongoconn.Connect(ctx, cfg, logger, metrics.MongoMonitor(), otelmongo.NewMonitor())
 }
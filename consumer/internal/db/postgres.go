@@ -0,0 +1,16 @@
+package db
+
+import (
+	"context"
+	"log/slog"
+
+	"contracts/metrics"
+	"contracts/pgconn"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// ConnectPostgres waits for PostgreSQL as configured; every query is timed
+func ConnectPostgres(ctx context.Context, cfg pgconn.Config, logger *slog.Logger) (*pgxpool.Pool, error) {
+	return pgconn.Connect(ctx, cfg, logger, metrics.PostgresHook())
+}
@@ -0,0 +1,45 @@
+package items
+
+import (
+	"context"
+
+	"consumer/internal/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Store keeps the restaurants' menu items
+type Store interface {
+	ListItems(ctx context.Context, ids []primitive.ObjectID) ([]models.Item, error)
+}
+
+type MongoStore struct {
+	collection *mongo.Collection
+}
+
+func NewMongoStore(database *mongo.Database) *MongoStore {
+	return &MongoStore{collection: database.Collection("items")}
+}
+
+func (s *MongoStore) ListItems(ctx context.Context, ids []primitive.ObjectID) ([]models.Item, error) {
+	var items []models.Item
+	cursor, err := s.collection.Find(ctx, bson.M{"_id": bson.M{"$in": ids}})
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+	for cursor.Next(ctx) {
+		var item models.Item
+		if err := cursor.Decode(&item); err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	if err := cursor.Err(); err != nil {
+		return nil, err
+	}
+
+	return items, nil
+}
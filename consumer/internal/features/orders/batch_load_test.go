@@ -0,0 +1,230 @@
+package orders_test
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"testing"
+	"time"
+
+	dbconn "consumer/internal/db"
+	"consumer/internal/features/orders"
+	"consumer/internal/memstore"
+	"consumer/internal/models"
+	"consumer/internal/seed"
+	"contracts/kafkaconn"
+	"contracts/kafkatest"
+	"contracts/mongoconn"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// throughputStores are the stores of the load test and how it reads back what they hold
+type throughputStores struct {
+	orders.Stores
+	seed    seed.Store
+	counted func(t *testing.T) int
+	stored  func(t *testing.T) int
+}
+
+// memStores keep the orders in memory, so that the load test runs everywhere
+func memStores() throughputStores {
+	db := memstore.New()
+	return throughputStores{
+		Stores: db.OrderStores(),
+		seed:   db,
+		counted: func(*testing.T) int {
+			counted := 0
+			for _, a := range db.Aggregates.All() {
+				counted += int(a.TotalOrders)
+			}
+			return counted
+		},
+		stored: func(*testing.T) int { return len(db.Orders.All()) },
+	}
+}
+
+// mongoStores use a throwaway database of the server at uri
+func mongoStores(t *testing.T, uri string) throughputStores {
+	ctx := context.Background()
+	mongoCfg := mongoconn.Default(fmt.Sprintf("loadtest_%d", time.Now().UnixNano()))
+	mongoCfg.URI = uri
+	client, database, err := dbconn.Connect(ctx, mongoCfg, slog.Default())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		_ = database.Drop(ctx)
+		_ = client.Disconnect(ctx)
+	})
+	return throughputStores{
+		Stores: orders.MongoStores(database),
+		seed:   seed.NewMongoStore(database),
+		counted: func(t *testing.T) int {
+			var aggregates []struct {
+				TotalOrders int `bson:"totalOrders"`
+			}
+			cursor, err := database.Collection("daily_aggregates").Find(ctx, bson.M{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := cursor.All(ctx, &aggregates); err != nil {
+				t.Fatal(err)
+			}
+			counted := 0
+			for _, a := range aggregates {
+				counted += a.TotalOrders
+			}
+			return counted
+		},
+		stored: func(t *testing.T) int {
+			stored, err := database.Collection("orders").CountDocuments(ctx, bson.M{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			return int(stored)
+		},
+	}
+}
+
+// menuRecorder keeps the menus seeded through it
+type menuRecorder struct {
+	seed.Store
+	menus seed.Menus
+}
+
+func (r *menuRecorder) InsertMenus(ctx context.Context, menus seed.Menus) error {
+	r.menus = menus
+	return r.Store.InsertMenus(ctx, menus)
+}
+
+// TestBatchThroughput is a load test comparing orders created one at a time, as the consumer
+// used to, with batches of CreateOrders, lifecycle events included. They are published to an
+// in-process broker. The orders are kept in memory, or in a throwaway database of the MongoDB
+// server at MONGODB_TEST_URI:
+//
+//	MONGODB_TEST_URI=mongodb://localhost:27017 go test ./internal/features/orders -run Throughput -v
+func TestBatchThroughput(t *testing.T) {
+	if testing.Short() {
+		t.Skip("load test")
+	}
+	const (
+		total          = 500
+		batchSize      = 100
+		lifecycleTopic = "order-events"
+		partitions     = 3
+	)
+	ctx := context.Background()
+
+	stores := memStores()
+	if uri := os.Getenv("MONGODB_TEST_URI"); uri != "" {
+		stores = mongoStores(t, uri)
+	}
+	recorder := &menuRecorder{Store: stores.seed}
+	if err := seed.SeedDatabase(ctx, recorder, seed.DefaultFixtures()); err != nil {
+		t.Fatal(err)
+	}
+	menu := orderableItems(t, recorder.menus.Items)
+
+	conn := kafkatest.Start(t, partitions, lifecycleTopic)
+	publisher := orders.NewEventPublisher(conn, lifecycleTopic)
+	t.Cleanup(func() { _ = publisher.Close() })
+	svc := orders.NewService(stores.Stores, publisher, slog.Default())
+
+	newOrders := func(run string) []*models.Order {
+		orders := make([]*models.Order, total)
+		for i := range orders {
+			item := menu[i%len(menu)]
+			orders[i] = &models.Order{
+				RestaurantID: item.RestaurantID,
+				Items:        []models.OrderItem{{ItemID: item.ID, Quantity: 1 + i%3}},
+				EventID:      fmt.Sprintf("%s-%d", run, i),
+			}
+		}
+		return orders
+	}
+
+	start := time.Now()
+	for _, order := range newOrders("single") {
+		if _, err := svc.CreateOrder(ctx, order); err != nil {
+			t.Fatal(err)
+		}
+	}
+	single := time.Since(start)
+
+	batch := newOrders("batched")
+	start = time.Now()
+	for i := 0; i < len(batch); i += batchSize {
+		rejected, err := svc.CreateOrders(ctx, batch[i:min(i+batchSize, len(batch))])
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, err := range rejected {
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	batched := time.Since(start)
+
+	t.Logf("one at a time: %d orders in %s (%.0f orders/s)", total, single, total/single.Seconds())
+	t.Logf("batches of %d: %d orders in %s (%.0f orders/s)", batchSize, total, batched, total/batched.Seconds())
+	if batched >= single {
+		t.Errorf("batching did not improve throughput: %s batched vs %s one at a time", batched, single)
+	}
+
+	// both runs must have counted and announced every order exactly once
+	if counted := stores.counted(t); counted != 2*total {
+		t.Errorf("daily aggregates count %d orders, want %d", counted, 2*total)
+	}
+	if published := publishedEvents(t, conn, lifecycleTopic, partitions); published != 2*total {
+		t.Errorf("%d lifecycle events published, want %d", published, 2*total)
+	}
+
+	// a redelivered batch is neither stored nor counted again
+	if _, err := svc.CreateOrders(ctx, newOrders("batched")[:batchSize]); err != nil {
+		t.Fatal(err)
+	}
+	if stored := stores.stored(t); stored != 2*total {
+		t.Errorf("%d orders stored after redelivery, want %d", stored, 2*total)
+	}
+}
+
+// publishedEvents is how many messages the topic's partitions hold
+func publishedEvents(t *testing.T, conn *kafkaconn.Conn, topic string, partitions int) int {
+	t.Helper()
+	published := 0
+	for partition := 0; partition < partitions; partition++ {
+		leader, err := conn.Dialer().DialLeader(context.Background(), "tcp", conn.Brokers[0], topic, partition)
+		if err != nil {
+			t.Fatal(err)
+		}
+		last, err := leader.ReadLastOffset()
+		_ = leader.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		published += int(last)
+	}
+	return published
+}
+
+// orderableItems returns the seeded items that can be ordered without choosing modifiers
+func orderableItems(t *testing.T, items []models.Item) []models.Item {
+	t.Helper()
+	var menu []models.Item
+	for _, item := range items {
+		required := false
+		for _, g := range item.ModifierGroups {
+			required = required || g.Required
+		}
+		if !required {
+			menu = append(menu, item)
+		}
+	}
+	if len(menu) == 0 {
+		t.Fatal("no seeded items without required modifiers")
+	}
+	return menu
+}
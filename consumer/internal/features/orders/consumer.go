@@ -2,83 +2,571 @@ package orders
 
 import (
 	"context"
-	"encoding/json"
-	"log"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"sync"
 	"time"
 
 	"consumer/internal/models"
+	"contracts/correlation"
+	"contracts/events"
+	"contracts/kafkaconn"
+	"contracts/logging"
+	"contracts/money"
+	"contracts/registry"
 
 	"github.com/segmentio/kafka-go"
 	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
 )
 
-type OrdersEvent struct {
-	RestaurantID string      `json:"restaurantId"`
-	Items        []eventItem `json:"items"`
-}
+var tracer = otel.Tracer("consumer/internal/features/orders")
+
+// Retries of a batch that couldn't be persisted back off exponentially up to maxRetryBackoff
+const (
+	retryBackoff    = 100 * time.Millisecond
+	maxRetryBackoff = 10 * time.Second
+)
 
-type eventItem struct {
-	ID       string `json:"id"`
-	Quantity int    `json:"quantity"`
+// ConsumerConfig configures StartKafkaConsumer
+type ConsumerConfig struct {
+	Kafka   *kafkaconn.Conn
+	Topic   string
+	GroupID string
+	// BatchSize caps how many of a partition's messages are handled together; BatchWait is how
+	// long a partition waits to fill a batch before handling what it has
+	BatchSize int
+	BatchWait time.Duration
+	// Concurrency is how many batches, across all partitions, are handled at the same time
+	Concurrency int
+	// CommitInterval is how often handled offsets are committed; Close commits the rest
+	CommitInterval time.Duration
+	// DeadLetters receives the events that can't be read; without it they are only logged
+	DeadLetters *DeadLetters
+	// Status is kept up to date for health checks
+	Status *ConsumerStatus
 }
 
-func StartKafkaConsumer(ctx context.Context, broker string, topic string, groupID string, svc *Service) func() {
+// StartKafkaConsumer joins the consumer group and applies order events in batches. Each partition
+// has its own batcher, so a partition's events, and with them each restaurant's (events are keyed
+// by restaurant), are applied in offset order while up to Concurrency batches of different
+// partitions are handled at once. A batch's offsets are committed once it has been persisted.
+//
+// The consumer stops fetching when ctx is done or the returned stop function is called. Stop then
+// waits for the batches being handled to be persisted and committed; events fetched but not yet
+// handled are left uncommitted for the next consumer. Batches still running when stop's context
+// is done are abandoned mid-way, like on a crash.
+func StartKafkaConsumer(ctx context.Context, cfg ConsumerConfig, svc *Service, codec *events.Codec) func(context.Context) {
 	r := kafka.NewReader(kafka.ReaderConfig{
-		Brokers: []string{broker},
-		Topic:   topic,
-		// GroupID:        groupID,
+		Brokers:        cfg.Kafka.Brokers,
+		Dialer:         cfg.Kafka.Dialer(),
+		Topic:          cfg.Topic,
+		GroupID:        cfg.GroupID,
 		MinBytes:       1,    // 1B
 		MaxBytes:       10e6, // 10MB
-		CommitInterval: time.Second,
+		CommitInterval: cfg.CommitInterval,
 	})
+	batchSize := max(cfg.BatchSize, 1)
+	slots := make(chan struct{}, max(cfg.Concurrency, 1))
+	status := cfg.Status
+	if status == nil {
+		status = NewConsumerStatus(0)
+	}
+	status.started()
 
-	runCtx, cancel := context.WithCancel(ctx)
+	// fetching stops with ctx, handling only when stop gives up
+	fetchCtx, stopFetching := context.WithCancel(ctx)
+	workCtx, abort := context.WithCancel(context.WithoutCancel(ctx))
+	done := make(chan struct{})
 	go func() {
+		defer close(done)
 		defer r.Close()
+		defer status.stopped()
+
+		var workers sync.WaitGroup
+		partitions := make(map[int]chan kafka.Message)
+		defer func() {
+			for _, queue := range partitions {
+				close(queue)
+			}
+			workers.Wait()
+		}()
+
 		for {
-			message, err := r.ReadMessage(runCtx)
+			message, err := r.FetchMessage(fetchCtx)
 			if err != nil {
-				if runCtx.Err() != nil {
+				if fetchCtx.Err() != nil {
 					return
 				}
-				log.Printf("kafka read error: %v", err)
+				svc.log.ErrorContext(fetchCtx, "kafka read error", "error", err)
+				status.fetchFailed()
 				continue
 			}
+			// the lag is kept current on every fetch, not only when a batch is committed
+			observeLag(message.Topic, message.Partition, status.fetched(message.Partition, message.Offset, message.HighWaterMark))
 
-			var evt OrdersEvent
-			if err := json.Unmarshal(message.Value, &evt); err != nil {
-				log.Printf("kafka unmarshal error: %v", err)
-				continue
+			queue, ok := partitions[message.Partition]
+			if !ok {
+				// room for the batch being handled and the next one
+				queue = make(chan kafka.Message, 2*batchSize)
+				partitions[message.Partition] = queue
+				workers.Add(1)
+				go func() {
+					defer workers.Done()
+					consumePartition(workCtx, fetchCtx.Done(), r, svc, codec, cfg.DeadLetters, status, queue, batchSize, cfg.BatchWait, slots)
+				}()
 			}
-			restaurantID, err := primitive.ObjectIDFromHex(evt.RestaurantID)
-			if err != nil {
-				log.Printf("invalid restaurant id: %v", err)
-				continue
+			select {
+			case queue <- message:
+			case <-fetchCtx.Done():
+				return
+			}
+		}
+	}()
+
+	return func(ctx context.Context) {
+		stopFetching()
+		select {
+		case <-done:
+		case <-ctx.Done():
+			svc.log.WarnContext(ctx, "kafka consumer did not finish its batches in time, abandoning them")
+			abort()
+			<-done
+		}
+		abort()
+	}
+}
+
+// consumePartition handles one partition's messages in order, one batch at a time. Once stopping
+// is closed it finishes the batch it is handling, if any, and returns.
+func consumePartition(ctx context.Context, stopping <-chan struct{}, r *kafka.Reader, svc *Service, codec *events.Codec, dlq *DeadLetters, status *ConsumerStatus, queue <-chan kafka.Message, batchSize int, wait time.Duration, slots chan struct{}) {
+	for {
+		batch, open := nextBatch(queue, batchSize, wait)
+		if len(batch) > 0 {
+			select {
+			case slots <- struct{}{}:
+			case <-stopping:
+				return
+			}
+			if isDone(stopping) {
+				<-slots
+				return
 			}
+			handleBatch(ctx, r, svc, codec, dlq, status, batch)
+			<-slots
+		}
+		if !open || isDone(stopping) {
+			return
+		}
+	}
+}
 
-			orderItems := make([]models.OrderItem, 0, len(evt.Items))
-			for _, it := range evt.Items {
-				oid, err := primitive.ObjectIDFromHex(it.ID)
-				if err != nil || it.Quantity <= 0 {
-					log.Printf("invalid item payload")
-					orderItems = nil
-					break
+func isDone(ch <-chan struct{}) bool {
+	select {
+	case <-ch:
+		return true
+	default:
+		return false
+	}
+}
+
+// nextBatch waits for a message, then collects more until the batch is full or wait has passed
+func nextBatch(queue <-chan kafka.Message, size int, wait time.Duration) ([]kafka.Message, bool) {
+	message, ok := <-queue
+	if !ok {
+		return nil, false
+	}
+	batch := append(make([]kafka.Message, 0, size), message)
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	for len(batch) < size {
+		select {
+		case message, ok := <-queue:
+			if !ok {
+				return batch, false
+			}
+			batch = append(batch, message)
+		case <-timer.C:
+			return batch, true
+		}
+	}
+	return batch, true
+}
+
+// handleBatch applies the batch and commits its offsets. When persisting fails, the messages
+// handled so far are committed and the rest is retried with backoff until ctx is done; orders
+// remember the event they came from, so retried creates aren't stored twice.
+func handleBatch(ctx context.Context, r *kafka.Reader, svc *Service, codec *events.Codec, dlq *DeadLetters, status *ConsumerStatus, batch []kafka.Message) {
+	backoff := retryBackoff
+	for {
+		handled, err := applyBatch(ctx, svc, codec, dlq, batch)
+		var next int64
+		if handled > 0 {
+			last := batch[handled-1]
+			if err := r.CommitMessages(ctx, last); err != nil && ctx.Err() == nil {
+				svc.log.ErrorContext(ctx, "kafka commit error", logging.KeyPartition, last.Partition, logging.KeyOffset, last.Offset, "error", err)
+			}
+			next = last.Offset + 1
+		}
+		lag := status.attempted(batch[0].Partition, handled, next, err)
+		observeLag(batch[0].Topic, batch[0].Partition, lag)
+		if err == nil {
+			return
+		}
+		batch = batch[handled:]
+		svc.log.WarnContext(ctx, "retrying events", logging.KeyPartition, batch[0].Partition, logging.KeyOffset, batch[0].Offset,
+			"events", len(batch), "backoff", backoff, "error", err)
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return
+		}
+		backoff = min(2*backoff, maxRetryBackoff)
+	}
+}
+
+// applyBatch applies the batch's events in order and returns how many of them are done with:
+// persisted, or rejected and logged. Events that can't be read are also sent to dlq; failing to
+// do so fails the batch like failing to persist. Runs of create events are stored together with
+// CreateOrders; a cancel or refund first flushes the creates before it, since it may refer to them.
+//
+// Each event is handled in a consumer span continuing the trace of its headers, with their
+// request ID, and logged with its partition, offset, restaurant and order. The bulk writes of a run of creates happen in a span of their own, linked from
+// the spans of the events it stores.
+func applyBatch(ctx context.Context, svc *Service, codec *events.Codec, dlq *DeadLetters, batch []kafka.Message) (int, error) {
+	var creates []*models.Order
+	var createSpans []trace.Span
+	var createMessages []kafka.Message
+	createCtxs := make(map[*models.Order]context.Context)
+	first := 0 // offset in batch of the first pending create
+	flush := func() error {
+		if len(creates) == 0 {
+			return nil
+		}
+		links := make([]trace.Link, len(createSpans))
+		for i, span := range createSpans {
+			links[i] = trace.Link{SpanContext: span.SpanContext()}
+		}
+		batchCtx, batchSpan := tracer.Start(ctx, "create orders",
+			trace.WithLinks(links...),
+			trace.WithAttributes(semconv.MessagingBatchMessageCount(len(creates))))
+		rejected, err := svc.createOrders(batchCtx, creates, createCtxs)
+		endSpan(batchSpan, err)
+		for i, span := range createSpans {
+			switch {
+			case err != nil:
+				endSpan(span, err)
+			case rejected[i] != nil:
+				endSpan(span, rejected[i])
+				if dlqErr := reject(createCtxs[creates[i]], svc.log, dlq, createMessages[i], events.TypeOrderCreate, rejected[i]); dlqErr != nil && err == nil {
+					err = dlqErr
 				}
-				orderItems = append(orderItems, models.OrderItem{ItemID: oid, Quantity: it.Quantity})
+			default:
+				svc.log.InfoContext(createCtxs[creates[i]], "created order", logging.KeyOrderID, creates[i].ID.Hex())
+				eventProcessed(events.TypeOrderCreate)
+				span.SetAttributes(attribute.String("order.id", creates[i].ID.Hex()))
+				span.End()
 			}
+		}
+		creates, createSpans, createMessages = creates[:0], createSpans[:0], createMessages[:0]
+		clear(createCtxs)
+		return err
+	}
 
-			if len(orderItems) == 0 {
-				continue
+	for i, message := range batch {
+		msgCtx, span := tracer.Start(correlation.FromKafkaHeaders(ctx, message.Headers), message.Topic+" process",
+			trace.WithSpanKind(trace.SpanKindConsumer),
+			trace.WithAttributes(
+				semconv.MessagingSystemKafka,
+				semconv.MessagingOperationTypeDeliver,
+				semconv.MessagingDestinationName(message.Topic),
+				semconv.MessagingDestinationPartitionID(strconv.Itoa(message.Partition)),
+				semconv.MessagingKafkaMessageOffset(int(message.Offset)),
+				semconv.MessagingKafkaMessageKey(string(message.Key)),
+			))
+		msgCtx = logging.With(msgCtx, logging.KeyPartition, message.Partition, logging.KeyOffset, message.Offset)
+		ids := correlation.FromContext(msgCtx)
+		env, err := codec.Unmarshal(msgCtx, message.Value, message.Headers)
+		if err != nil && !isRejected(err) {
+			// e.g. the schema registry is unreachable
+			endSpan(span, err)
+			if flushErr := flush(); flushErr != nil {
+				return first, flushErr
 			}
+			return i, err
+		}
+		if err != nil {
+			endSpan(span, err)
+			if err := reject(msgCtx, svc.log, dlq, message, unknownEventType, err); err != nil {
+				if flushErr := flush(); flushErr != nil {
+					return first, flushErr
+				}
+				return i, err
+			}
+			continue
+		}
+		if env.ID == "" {
+			// events written before the envelope have no ID; their position identifies them
+			env.ID = fmt.Sprintf("%s/%d/%d", message.Topic, message.Partition, message.Offset)
+		}
+		span.SetAttributes(semconv.MessagingMessageID(env.ID), attribute.String("event.type", env.Type))
+		msgCtx = logging.With(msgCtx, eventAttrs(env)...)
 
-			if _, err := svc.CreateOrderFromEvent(runCtx, restaurantID, orderItems); err != nil {
-				log.Printf("failed to create order from event: %v", err)
+		if env.Type == events.TypeOrderCreate {
+			order, err := orderFromEvent(env)
+			if err != nil {
+				err = fmt.Errorf("%w: %v", events.ErrInvalidEvent, err)
+				endSpan(span, err)
+				if err := reject(msgCtx, svc.log, dlq, message, env.Type, err); err != nil {
+					if flushErr := flush(); flushErr != nil {
+						return first, flushErr
+					}
+					return i, err
+				}
 				continue
 			}
+			order.RequestID, order.TraceID = ids.RequestID, ids.Trace.TraceID
+			if len(creates) == 0 {
+				first = i
+			}
+			creates = append(creates, order)
+			createSpans = append(createSpans, span)
+			createMessages = append(createMessages, message)
+			createCtxs[order] = msgCtx
+			continue
 		}
-	}()
 
-	return func() {
-		cancel()
+		if err := flush(); err != nil {
+			endSpan(span, err)
+			return first, err
+		}
+		err = handleEvent(msgCtx, svc, env)
+		endSpan(span, err)
+		if err != nil {
+			if !isRejected(err) {
+				return i, err
+			}
+			if err := reject(msgCtx, svc.log, dlq, message, env.Type, err); err != nil {
+				return i, err
+			}
+		} else {
+			svc.log.InfoContext(msgCtx, "applied event")
+			eventProcessed(env.Type)
+		}
+	}
+	if err := flush(); err != nil {
+		return first, err
+	}
+	return len(batch), nil
+}
+
+// endSpan ends span, recording err when there is one
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// unknownEventType labels the metrics of events whose type couldn't be read
+const unknownEventType = "unknown"
+
+// rejection is an error about the event itself, so that retrying it can't succeed. Events that
+// can't be read are dead-lettered; the others were read and are rejected by the order rules.
+type rejection struct {
+	err        error
+	reason     string
+	deadLetter bool
+}
+
+var rejections = []rejection{
+	{registry.ErrNotFound, "schema_not_found", true},
+	{events.ErrUnknownSchema, "unknown_schema", true},
+	{events.ErrNoRegistry, "no_registry", true},
+	{events.ErrInvalidEvent, "invalid_event", true},
+	{ErrInvalidOrder, "invalid_order", false},
+	{ErrOrderNotFound, "order_not_found", false},
+	{ErrOrderNotCancelable, "order_not_cancelable", false},
+	{ErrOrderChanged, "order_changed", false},
+	{ErrInvalidRefund, "invalid_refund", false},
+}
+
+func rejectionOf(err error) (rejection, bool) {
+	for _, r := range rejections {
+		if errors.Is(err, r.err) {
+			return r, true
+		}
+	}
+	return rejection{}, false
+}
+
+func isRejected(err error) bool {
+	_, ok := rejectionOf(err)
+	return ok
+}
+
+// reject logs and records the rejection of message and dead-letters it when it can't be read.
+// The returned error is the dead-letter write's, after which the message must be retried.
+func reject(ctx context.Context, logger *slog.Logger, dlq *DeadLetters, message kafka.Message, eventType string, err error) error {
+	r, ok := rejectionOf(err)
+	if !ok {
+		r.reason = "other"
+	}
+	deadLetter := r.deadLetter && dlq != nil
+	if deadLetter {
+		if err := dlq.Send(ctx, message, r.reason, err); err != nil {
+			return fmt.Errorf("failed to dead-letter event at partition %d offset %d: %w", message.Partition, message.Offset, err)
+		}
+	}
+	logger.WarnContext(ctx, "rejected event", "reason", r.reason, "deadLettered", deadLetter, "error", err)
+	eventRejected(eventType, r.reason, deadLetter)
+	return nil
+}
+
+// eventAttrs are the log attributes of an event: its ID and type, and the restaurant and
+// order it is about when its data names them
+func eventAttrs(env events.Envelope) []any {
+	attrs := []any{"eventId", env.ID, "eventType", env.Type}
+	var ref struct {
+		RestaurantID string `json:"restaurantId"`
+		OrderID      string `json:"orderId"`
+	}
+	if env.Decode(&ref) == nil {
+		if ref.RestaurantID != "" {
+			attrs = append(attrs, logging.KeyRestaurantID, ref.RestaurantID)
+		}
+		if ref.OrderID != "" {
+			attrs = append(attrs, logging.KeyOrderID, ref.OrderID)
+		}
+	}
+	return attrs
+}
+
+// handleEvent applies a cancel or refund event that already passed schema validation
+func handleEvent(ctx context.Context, svc *Service, env events.Envelope) error {
+	switch env.Type {
+	case events.TypeOrderCancel:
+		var evt events.OrderCancel
+		if err := env.Decode(&evt); err != nil {
+			return fmt.Errorf("%w: %v", events.ErrInvalidEvent, err)
+		}
+		return handleCancelEvent(ctx, svc, evt)
+	case events.TypeOrderRefund:
+		if env.Version == 1 {
+			var evt events.OrderRefundV1
+			if err := env.Decode(&evt); err != nil {
+				return fmt.Errorf("%w: %v", events.ErrInvalidEvent, err)
+			}
+			return handleRefundV1Event(ctx, svc, evt, env.ID)
+		}
+		var evt events.OrderRefund
+		if err := env.Decode(&evt); err != nil {
+			return fmt.Errorf("%w: %v", events.ErrInvalidEvent, err)
+		}
+		return handleRefundEvent(ctx, svc, evt, env.ID)
+	default:
+		return fmt.Errorf("%w: unhandled event type %q", events.ErrInvalidEvent, env.Type)
+	}
+}
+
+// orderFromEvent builds the order described by a create event
+func orderFromEvent(env events.Envelope) (*models.Order, error) {
+	var evt events.OrderCreate
+	if err := env.Decode(&evt); err != nil {
+		return nil, err
+	}
+	restaurantID, err := primitive.ObjectIDFromHex(evt.RestaurantID)
+	if err != nil {
+		return nil, err
+	}
+	orderItems := make([]models.OrderItem, 0, len(evt.Items))
+	for _, it := range evt.Items {
+		oid, err := primitive.ObjectIDFromHex(it.ID)
+		if err != nil {
+			return nil, err
+		}
+		line := models.OrderItem{ItemID: oid, Quantity: it.Quantity, Notes: it.Notes}
+		for _, m := range it.Modifiers {
+			line.Modifiers = append(line.Modifiers, models.OrderItemModifier{GroupID: m.GroupID, OptionID: m.OptionID})
+		}
+		orderItems = append(orderItems, line)
+	}
+	return &models.Order{
+		RestaurantID: restaurantID,
+		Items:        orderItems,
+		PromoCode:    evt.PromoCode,
+		Tip:          money.Amount(evt.Tip),
+		EventID:      env.ID,
+	}, nil
+}
+
+func handleCancelEvent(ctx context.Context, svc *Service, evt events.OrderCancel) error {
+	restaurantID, orderID, err := parseOrderRef(evt.RestaurantID, evt.OrderID)
+	if err != nil {
+		return fmt.Errorf("%w: %v", events.ErrInvalidEvent, err)
+	}
+	if _, err := svc.CancelOrder(ctx, restaurantID, orderID, evt.Reason); err != nil {
+		return fmt.Errorf("failed to cancel order %s: %w", evt.OrderID, err)
+	}
+	return nil
+}
+
+// handleRefundEvent applies an order.refund once; a redelivered one is skipped
+func handleRefundEvent(ctx context.Context, svc *Service, evt events.OrderRefund, eventID string) error {
+	restaurantID, orderID, err := parseOrderRef(evt.RestaurantID, evt.OrderID)
+	if err != nil {
+		return fmt.Errorf("%w: %v", events.ErrInvalidEvent, err)
+	}
+	lines := make([]RefundLine, 0, len(evt.Items))
+	for _, it := range evt.Items {
+		lines = append(lines, RefundLine{Line: it.Line, Quantity: it.Quantity})
+	}
+	if _, err := svc.RefundOrder(ctx, restaurantID, orderID, lines, evt.Reason, eventID); err != nil && !errors.Is(err, ErrRefundApplied) {
+		return fmt.Errorf("failed to refund order %s: %w", evt.OrderID, err)
+	}
+	return nil
+}
+
+// handleRefundV1Event applies an order.refund v1, which names items rather than lines
+func handleRefundV1Event(ctx context.Context, svc *Service, evt events.OrderRefundV1, eventID string) error {
+	restaurantID, orderID, err := parseOrderRef(evt.RestaurantID, evt.OrderID)
+	if err != nil {
+		return fmt.Errorf("%w: %v", events.ErrInvalidEvent, err)
+	}
+	if len(evt.Items) == 0 {
+		_, err = svc.RefundOrder(ctx, restaurantID, orderID, nil, evt.Reason, eventID)
+	} else {
+		items := make(map[primitive.ObjectID]int, len(evt.Items))
+		for _, it := range evt.Items {
+			oid, err := primitive.ObjectIDFromHex(it.ID)
+			if err != nil {
+				return fmt.Errorf("%w: %v", events.ErrInvalidEvent, err)
+			}
+			items[oid] += it.Quantity
+		}
+		_, err = svc.RefundItems(ctx, restaurantID, orderID, items, evt.Reason, eventID)
+	}
+	if err != nil && !errors.Is(err, ErrRefundApplied) {
+		return fmt.Errorf("failed to refund order %s: %w", evt.OrderID, err)
+	}
+	return nil
+}
+
+func parseOrderRef(restaurantHex string, orderHex string) (primitive.ObjectID, primitive.ObjectID, error) {
+	restaurantID, err := primitive.ObjectIDFromHex(restaurantHex)
+	if err != nil {
+		return primitive.NilObjectID, primitive.NilObjectID, err
+	}
+	orderID, err := primitive.ObjectIDFromHex(orderHex)
+	if err != nil {
+		return primitive.NilObjectID, primitive.NilObjectID, err
 	}
+	return restaurantID, orderID, nil
 }
@@ -1,12 +1,14 @@
 package orders
 
 import (
+	"errors"
 	"net/http"
 
 	"github.com/gin-gonic/gin"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 
 	"consumer/internal/models"
+	"contracts/money"
 )
 
 type Controller struct {
@@ -22,16 +24,37 @@ func (c *Controller) RegisterRoutes(router *gin.Engine) {
 	orders.POST("", c.CreateOrder)
 }
 
+type createOrderModifier struct {
+	GroupID  string `json:"groupId"`
+	OptionID string `json:"optionId"`
+}
+
 type createOrderItem struct {
-	ID       string `json:"id"`
-	Quantity int    `json:"quantity"`
+	ID        string                `json:"id"`
+	Quantity  int                   `json:"quantity"`
+	Modifiers []createOrderModifier `json:"modifiers"`
+	Notes     string                `json:"notes"`
 }
 
 type createOrderBody struct {
-	Items []createOrderItem `json:"items"`
+	Items     []createOrderItem `json:"items"`
+	PromoCode string            `json:"promoCode"`
+	// Tip is in minor units of the restaurant currency
+	Tip money.Amount `json:"tip"`
 }
 
 func (c *Controller) CreateOrder(ctx *gin.Context) {
+	restaurantIDHex := ctx.GetHeader("x-org")
+	if restaurantIDHex == "" {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "missing or invalid x-org header"})
+		return
+	}
+	restaurantID, err := primitive.ObjectIDFromHex(restaurantIDHex)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "invalid x-org header format"})
+		return
+	}
+
 	var body createOrderBody
 	if err := ctx.ShouldBindJSON(&body); err != nil {
 		ctx.JSON(http.StatusBadRequest, gin.H{"error": err})
@@ -54,12 +77,20 @@ func (c *Controller) CreateOrder(ctx *gin.Context) {
 			ctx.JSON(http.StatusBadRequest, gin.H{"error": "quantity must be > 0 for item: " + it.ID})
 			return
 		}
-		orderItems = append(orderItems, models.OrderItem{ItemID: oid, Quantity: it.Quantity})
+		line := models.OrderItem{ItemID: oid, Quantity: it.Quantity, Notes: it.Notes}
+		for _, m := range it.Modifiers {
+			line.Modifiers = append(line.Modifiers, models.OrderItemModifier{GroupID: m.GroupID, OptionID: m.OptionID})
+		}
+		orderItems = append(orderItems, line)
 	}
 
-	order := models.Order{Items: orderItems}
+	order := models.Order{RestaurantID: restaurantID, Items: orderItems, PromoCode: body.PromoCode, Tip: body.Tip}
 
 	id, err := c.service.CreateOrder(ctx, &order)
+	if errors.Is(err, ErrInvalidOrder) {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
 	if err != nil {
 		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -0,0 +1,62 @@
+package orders
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"contracts/kafkaconn"
+	"contracts/metrics"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// Headers a dead-lettered message gets next to its original ones
+const (
+	HeaderDeadLetterReason    = "dead-letter-reason"
+	HeaderDeadLetterError     = "dead-letter-error"
+	HeaderOriginalTopic       = "original-topic"
+	HeaderOriginalPartition   = "original-partition"
+	HeaderOriginalOffset      = "original-offset"
+	HeaderDeadLetterTimestamp = "dead-letter-timestamp"
+)
+
+// DeadLetters keeps the events that can't be read, so they can be inspected and replayed
+// instead of being lost once their offsets are committed
+type DeadLetters struct {
+	writer *kafka.Writer
+}
+
+func NewDeadLetters(conn *kafkaconn.Conn, topic string) *DeadLetters {
+	return &DeadLetters{
+		writer: &kafka.Writer{
+			Addr:                   conn.Addr(),
+			Transport:              conn.Transport(),
+			Topic:                  topic,
+			Balancer:               &kafka.Hash{},
+			AllowAutoTopicCreation: true,
+			BatchTimeout:           10 * time.Millisecond,
+		},
+	}
+}
+
+// Send copies the message, key, value and headers unchanged, to the dead-letter topic with why it was rejected
+func (d *DeadLetters) Send(ctx context.Context, message kafka.Message, reason string, cause error) error {
+	headers := append(make([]kafka.Header, 0, len(message.Headers)+6), message.Headers...)
+	headers = append(headers,
+		kafka.Header{Key: HeaderDeadLetterReason, Value: []byte(reason)},
+		kafka.Header{Key: HeaderDeadLetterError, Value: []byte(cause.Error())},
+		kafka.Header{Key: HeaderOriginalTopic, Value: []byte(message.Topic)},
+		kafka.Header{Key: HeaderOriginalPartition, Value: []byte(strconv.Itoa(message.Partition))},
+		kafka.Header{Key: HeaderOriginalOffset, Value: []byte(strconv.FormatInt(message.Offset, 10))},
+		kafka.Header{Key: HeaderDeadLetterTimestamp, Value: []byte(time.Now().UTC().Format(time.RFC3339Nano))},
+	)
+	start := time.Now()
+	err := d.writer.WriteMessages(ctx, kafka.Message{Key: message.Key, Value: message.Value, Headers: headers})
+	metrics.ObservePublish(d.writer.Topic, start, err)
+	return err
+}
+
+func (d *DeadLetters) Close() error {
+	return d.writer.Close()
+}
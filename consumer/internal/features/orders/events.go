@@ -0,0 +1,104 @@
+package orders
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"consumer/internal/models"
+	"contracts/correlation"
+	"contracts/kafkaconn"
+	"contracts/metrics"
+
+	"github.com/segmentio/kafka-go"
+	"go.opentelemetry.io/otel/attribute"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Order lifecycle event types
+const (
+	EventOrderCreated       = "order.created"
+	EventOrderStatusChanged = "order.status_changed"
+)
+
+// LifecycleEvent is published after an order has been persisted or its status has changed
+type LifecycleEvent struct {
+	Type         string       `json:"type"`
+	OrderID      string       `json:"orderId"`
+	RestaurantID string       `json:"restaurantId"`
+	Status       string       `json:"status"`
+	OccurredAt   time.Time    `json:"occurredAt"`
+	Order        models.Order `json:"order"`
+}
+
+type EventPublisher struct {
+	writer *kafka.Writer
+}
+
+func NewEventPublisher(conn *kafkaconn.Conn, topic string) *EventPublisher {
+	return &EventPublisher{
+		writer: &kafka.Writer{
+			Addr:                   conn.Addr(),
+			Transport:              conn.Transport(),
+			Topic:                  topic,
+			Balancer:               &kafka.Hash{},
+			AllowAutoTopicCreation: true,
+			BatchTimeout:           10 * time.Millisecond,
+		},
+	}
+}
+
+// Publish writes the events with one write, keyed by restaurant so every restaurant's events stay
+// ordered. Each event is traced as a producer span of its Context and carries its correlation headers.
+func (p *EventPublisher) Publish(ctx context.Context, events ...Lifecycle) (err error) {
+	if len(events) == 0 {
+		return nil
+	}
+	spans := make([]trace.Span, len(events))
+	defer func() {
+		for _, span := range spans {
+			if span != nil {
+				endSpan(span, err)
+			}
+		}
+	}()
+
+	messages := make([]kafka.Message, len(events))
+	for i, e := range events {
+		eventCtx := e.Context
+		if eventCtx == nil {
+			eventCtx = ctx
+		}
+		restaurantID := e.Order.RestaurantID.Hex()
+		eventCtx, spans[i] = tracer.Start(eventCtx, p.writer.Topic+" publish",
+			trace.WithSpanKind(trace.SpanKindProducer),
+			trace.WithAttributes(
+				semconv.MessagingSystemKafka,
+				semconv.MessagingOperationTypePublish,
+				semconv.MessagingDestinationName(p.writer.Topic),
+				semconv.MessagingKafkaMessageKey(restaurantID),
+				attribute.String("event.type", e.Type),
+			))
+		payload, err := json.Marshal(LifecycleEvent{
+			Type:         e.Type,
+			OrderID:      e.Order.ID.Hex(),
+			RestaurantID: restaurantID,
+			Status:       e.Order.Status,
+			OccurredAt:   time.Now().UTC(),
+			Order:        e.Order,
+		})
+		if err != nil {
+			return err
+		}
+		messages[i] = kafka.Message{Key: []byte(restaurantID), Value: payload, Headers: correlation.KafkaHeaders(eventCtx)}
+	}
+	start := time.Now()
+	err = p.writer.WriteMessages(ctx, messages...)
+	metrics.ObservePublish(p.writer.Topic, start, err)
+	return err
+}
+
+func (p *EventPublisher) Close() error {
+	return p.writer.Close()
+}
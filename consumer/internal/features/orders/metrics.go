@@ -0,0 +1,46 @@
+package orders
+
+import (
+	"strconv"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	kafkaConsumerLag = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "kafka_consumer_lag",
+		Help: "Messages of a partition not yet handled, as of the last fetch or commit.",
+	}, []string{"topic", "partition"})
+
+	eventsProcessed = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "events_processed_total",
+		Help: "Order events applied, by event type.",
+	}, []string{"type"})
+	eventsRejected = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "events_rejected_total",
+		Help: "Order events that could not be applied, by event type and reason; dead-lettered events included.",
+	}, []string{"type", "reason"})
+	eventsDeadLettered = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "events_dead_lettered_total",
+		Help: "Order events sent to the dead-letter topic, by event type and reason.",
+	}, []string{"type", "reason"})
+)
+
+// observeLag records how far the handled offset of a partition is behind its high water mark
+func observeLag(topic string, partition int, lag int64) {
+	kafkaConsumerLag.WithLabelValues(topic, strconv.Itoa(partition)).Set(float64(max(lag, 0)))
+}
+
+// eventProcessed counts an applied event
+func eventProcessed(eventType string) {
+	eventsProcessed.WithLabelValues(eventType).Inc()
+}
+
+// eventRejected counts an event that could not be applied, and whether it was dead-lettered
+func eventRejected(eventType string, reason string, deadLettered bool) {
+	eventsRejected.WithLabelValues(eventType, reason).Inc()
+	if deadLettered {
+		eventsDeadLettered.WithLabelValues(eventType, reason).Inc()
+	}
+}
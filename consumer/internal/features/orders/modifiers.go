@@ -0,0 +1,104 @@
+package orders
+
+import (
+	"errors"
+	"fmt"
+
+	"consumer/internal/models"
+)
+
+// maxNotesLength caps free-text line notes so tickets stay printable
+const maxNotesLength = 280
+
+// ErrInvalidOrder is wrapped by every validation failure of an incoming order
+var ErrInvalidOrder = errors.New("invalid order")
+
+type modifierKey struct {
+	groupID  string
+	optionID string
+}
+
+// applyModifiers checks the line's selected modifiers (group and option IDs) against the item's
+// modifier groups, snapshots their names and deltas on the line and sets the line's unit price
+// and cost including the deltas. The item must be priced in the order currency.
+func applyModifiers(item models.Item, currency string, line *models.OrderItem) error {
+	if len(line.Notes) > maxNotesLength {
+		return fmt.Errorf("%w: notes for item %s exceed %d characters", ErrInvalidOrder, item.ID.Hex(), maxNotesLength)
+	}
+	price, err := item.Price.In(currency)
+	if err != nil {
+		return fmt.Errorf("%w: item %s: %v", ErrInvalidOrder, item.ID.Hex(), err)
+	}
+	cost, err := item.Cost.In(currency)
+	if err != nil {
+		return fmt.Errorf("%w: item %s: %v", ErrInvalidOrder, item.ID.Hex(), err)
+	}
+
+	counts := make(map[string]int, len(item.ModifierGroups))
+	seen := make(map[modifierKey]bool, len(line.Modifiers))
+	selected := line.Modifiers
+	line.Modifiers = make([]models.OrderItemModifier, 0, len(selected))
+	line.UnitPrice = price.Amount
+	line.UnitCost = cost.Amount
+	for _, sel := range selected {
+		key := modifierKey{groupID: sel.GroupID, optionID: sel.OptionID}
+		if seen[key] {
+			return fmt.Errorf("%w: modifier %s/%s selected twice for item %s", ErrInvalidOrder, sel.GroupID, sel.OptionID, item.ID.Hex())
+		}
+		seen[key] = true
+		group, ok := findModifierGroup(item, sel.GroupID)
+		if !ok {
+			return fmt.Errorf("%w: item %s has no modifier group %q", ErrInvalidOrder, item.ID.Hex(), sel.GroupID)
+		}
+		option, ok := findModifierOption(group, sel.OptionID)
+		if !ok {
+			return fmt.Errorf("%w: modifier group %q has no option %q", ErrInvalidOrder, group.ID, sel.OptionID)
+		}
+		counts[group.ID]++
+		line.Modifiers = append(line.Modifiers, models.OrderItemModifier{
+			GroupID:    group.ID,
+			OptionID:   option.ID,
+			Name:       option.Name,
+			PriceDelta: option.PriceDelta,
+			CostDelta:  option.CostDelta,
+		})
+		line.UnitPrice += option.PriceDelta
+		line.UnitCost += option.CostDelta
+	}
+
+	for _, group := range item.ModifierGroups {
+		count := counts[group.ID]
+		minSelections := group.MinSelections
+		if group.Required && minSelections < 1 {
+			minSelections = 1
+		}
+		if (group.Required || count > 0) && count < minSelections {
+			return fmt.Errorf("%w: %q requires at least %d selection(s) for item %s", ErrInvalidOrder, group.Name, minSelections, item.ID.Hex())
+		}
+		if group.MaxSelections > 0 && count > group.MaxSelections {
+			return fmt.Errorf("%w: %q allows at most %d selection(s) for item %s", ErrInvalidOrder, group.Name, group.MaxSelections, item.ID.Hex())
+		}
+	}
+	if line.UnitPrice < 0 {
+		return fmt.Errorf("%w: modifiers make item %s negatively priced", ErrInvalidOrder, item.ID.Hex())
+	}
+	return nil
+}
+
+func findModifierGroup(item models.Item, id string) (models.ModifierGroup, bool) {
+	for _, g := range item.ModifierGroups {
+		if g.ID == id {
+			return g, true
+		}
+	}
+	return models.ModifierGroup{}, false
+}
+
+func findModifierOption(group models.ModifierGroup, id string) (models.ModifierOption, bool) {
+	for _, o := range group.Options {
+		if o.ID == id {
+			return o, true
+		}
+	}
+	return models.ModifierOption{}, false
+}
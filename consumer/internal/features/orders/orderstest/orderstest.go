@@ -0,0 +1,47 @@
+// Package orderstest records what the orders service publishes, for tests that run it without
+// Kafka; internal/memstore stands in for its stores
+package orderstest
+
+import (
+	"context"
+	"sync"
+
+	"consumer/internal/features/orders"
+	"consumer/internal/models"
+)
+
+// Event is a lifecycle event published by the service
+type Event struct {
+	Type  string
+	Order models.Order
+}
+
+// Publisher records the lifecycle events instead of publishing them
+type Publisher struct {
+	mu     sync.Mutex
+	events []Event
+	writes int
+}
+
+func (p *Publisher) Publish(_ context.Context, events ...orders.Lifecycle) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.writes++
+	for _, e := range events {
+		p.events = append(p.events, Event{Type: e.Type, Order: e.Order})
+	}
+	return nil
+}
+
+// Writes is how many times Publish was called
+func (p *Publisher) Writes() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.writes
+}
+
+func (p *Publisher) Events() []Event {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]Event(nil), p.events...)
+}
@@ -0,0 +1,316 @@
+package orders
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"consumer/internal/models"
+	"consumer/internal/pricing"
+	"contracts/money"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var (
+	ErrOrderNotFound      = errors.New("order not found")
+	ErrOrderNotCancelable = errors.New("order is already cancelled or fully refunded")
+	ErrOrderChanged       = errors.New("order was modified concurrently")
+	ErrInvalidRefund      = errors.New("invalid refund")
+	ErrRefundApplied      = errors.New("refund was already applied")
+)
+
+// RefundLine asks to refund a quantity of the order line at index Line
+type RefundLine struct {
+	Line     int
+	Quantity int
+}
+
+func (s *Service) findOrder(ctx context.Context, restaurantID, orderID primitive.ObjectID) (*models.Order, error) {
+	order, err := s.orders.FindOrder(ctx, restaurantID, orderID)
+	if err != nil {
+		return nil, err
+	}
+	if order.Currency == "" {
+		order.Currency = money.DefaultCurrency
+	}
+	if err := s.fillUnitPrices(ctx, order); err != nil {
+		return nil, err
+	}
+	return order, nil
+}
+
+// fillUnitPrices backfills unit prices on orders placed before they were recorded per line
+func (s *Service) fillUnitPrices(ctx context.Context, order *models.Order) error {
+	var missing []primitive.ObjectID
+	for _, it := range order.Items {
+		if it.UnitPrice == 0 {
+			missing = append(missing, it.ItemID)
+		}
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+	fetched, err := s.items.ListItems(ctx, missing)
+	if err != nil {
+		return err
+	}
+	for i, it := range order.Items {
+		for _, ref := range fetched {
+			if it.UnitPrice == 0 && ref.ID == it.ItemID {
+				order.Items[i].UnitPrice = ref.Price.Amount
+				order.Items[i].UnitCost = ref.Cost.Amount
+				break
+			}
+		}
+	}
+	return nil
+}
+
+// refundShare is what returning units [from, to) of an order line gives back
+type refundShare struct {
+	amount   money.Amount // paid by the customer, tax included
+	netSales money.Amount
+	discount money.Amount
+	tax      money.Amount
+	cost     money.Amount
+}
+
+func (r *refundShare) add(o refundShare) {
+	r.amount += o.amount
+	r.netSales += o.netSales
+	r.discount += o.discount
+	r.tax += o.tax
+	r.cost += o.cost
+}
+
+// lineShare uses the line's priced breakdown so discounts, service charge and tax are
+// returned in proportion; orders priced before breakdowns existed fall back to unit price
+func lineShare(order *models.Order, i int, from, to int) refundShare {
+	it := order.Items[i]
+	share := refundShare{cost: it.UnitCost.Mul(to - from)}
+	if order.Pricing != nil && i < len(order.Pricing.Lines) {
+		line := order.Pricing.Lines[i]
+		share.amount = pricing.Portion(line.Total, line.Quantity, from, to)
+		share.netSales = pricing.Portion(line.NetSales(), line.Quantity, from, to)
+		share.discount = pricing.Portion(line.Discount, line.Quantity, from, to)
+		share.tax = share.amount - share.netSales
+		return share
+	}
+	share.amount = it.UnitPrice.Mul(to - from)
+	share.netSales = share.amount
+	return share
+}
+
+// tip is given back once, when the order is cancelled or fully refunded
+func orderTip(order *models.Order) money.Amount {
+	if order.Pricing == nil {
+		return 0
+	}
+	return order.Pricing.Tip
+}
+
+func isClosed(status string) bool {
+	return status == models.OrderStatusCancelled || status == models.OrderStatusRefunded
+}
+
+// CancelOrder cancels the order and removes whatever has not been refunded yet from the
+// daily aggregate of the day it was placed on
+func (s *Service) CancelOrder(ctx context.Context, restaurantID, orderID primitive.ObjectID, reason string) (*models.Order, error) {
+	order, err := s.findOrder(ctx, restaurantID, orderID)
+	if err != nil {
+		return nil, err
+	}
+	if isClosed(order.Status) {
+		return nil, ErrOrderNotCancelable
+	}
+
+	var remaining refundShare
+	for i, it := range order.Items {
+		remaining.add(lineShare(order, i, it.RefundedQuantity, it.Quantity))
+	}
+	tip := orderTip(order)
+
+	now := time.Now().UTC()
+	previousVersion := order.Version
+	order.Version++
+	order.Status = models.OrderStatusCancelled
+	order.CancelledAt = &now
+	order.CancellationReason = reason
+
+	err = s.inTx(ctx, func(ctx context.Context) error {
+		// Only applies if nobody changed the order in the meantime
+		if err := s.orders.SaveCancellation(ctx, order, previousVersion); err != nil {
+			return err
+		}
+		return s.addToDailyAggregate(ctx, order, DailyTotals{
+			CancelledOrders: 1,
+			Revenue:         -remaining.netSales,
+			Discounts:       -remaining.discount,
+			Tax:             -remaining.tax,
+			Tips:            -tip,
+			Cost:            -remaining.cost,
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	s.publishLifecycle(ctx, Lifecycle{Context: ctx, Type: EventOrderStatusChanged, Order: *order})
+	return order, nil
+}
+
+// RefundOrder refunds the given lines, or everything not yet refunded when lines is empty.
+// It records the refund and nets it out of the daily aggregate of the day the order was placed on.
+// A refund is made once per eventID, when set; ErrRefundApplied reports a repeated one.
+func (s *Service) RefundOrder(ctx context.Context, restaurantID, orderID primitive.ObjectID, lines []RefundLine, reason, eventID string) (*models.Refund, error) {
+	order, err := s.refundableOrder(ctx, restaurantID, orderID, eventID)
+	if err != nil {
+		return nil, err
+	}
+	return s.refund(ctx, order, lines, reason, eventID)
+}
+
+// RefundItems refunds quantities of items rather than lines, as order.refund v1 asked; an item
+// on several lines (with different modifiers) is refunded from the first of them
+func (s *Service) RefundItems(ctx context.Context, restaurantID, orderID primitive.ObjectID, items map[primitive.ObjectID]int, reason, eventID string) (*models.Refund, error) {
+	order, err := s.refundableOrder(ctx, restaurantID, orderID, eventID)
+	if err != nil {
+		return nil, err
+	}
+	var lines []RefundLine
+	for itemID, qty := range items {
+		if qty <= 0 {
+			return nil, fmt.Errorf("%w: quantity must be > 0 for item %s", ErrInvalidRefund, itemID.Hex())
+		}
+		for i, it := range order.Items {
+			if it.ItemID != itemID || it.RemainingQuantity() == 0 {
+				continue
+			}
+			n := min(qty, it.RemainingQuantity())
+			lines = append(lines, RefundLine{Line: i, Quantity: n})
+			if qty -= n; qty == 0 {
+				break
+			}
+		}
+		if qty > 0 {
+			return nil, fmt.Errorf("%w: %d more of item %s than the order has left to refund", ErrInvalidRefund, qty, itemID.Hex())
+		}
+	}
+	if len(lines) == 0 {
+		return nil, fmt.Errorf("%w: nothing left to refund", ErrInvalidRefund)
+	}
+	return s.refund(ctx, order, lines, reason, eventID)
+}
+
+// refundableOrder finds the order to refund, unless the event's refund is already stored: once
+// it is, the order may have nothing left to refund
+func (s *Service) refundableOrder(ctx context.Context, restaurantID, orderID primitive.ObjectID, eventID string) (*models.Order, error) {
+	if eventID != "" {
+		applied, err := s.orders.RefundApplied(ctx, eventID)
+		if err != nil {
+			return nil, err
+		}
+		if applied {
+			return nil, ErrRefundApplied
+		}
+	}
+	order, err := s.findOrder(ctx, restaurantID, orderID)
+	if err != nil {
+		return nil, err
+	}
+	if isClosed(order.Status) {
+		return nil, ErrOrderNotCancelable
+	}
+	return order, nil
+}
+
+func (s *Service) refund(ctx context.Context, order *models.Order, lines []RefundLine, reason, eventID string) (*models.Refund, error) {
+	// Sum requested quantities per line; empty means refund all that remains
+	requested := make([]int, len(order.Items))
+	if len(lines) == 0 {
+		for i, it := range order.Items {
+			requested[i] = it.RemainingQuantity()
+		}
+	}
+	for _, l := range lines {
+		if l.Line < 0 || l.Line >= len(order.Items) {
+			return nil, fmt.Errorf("%w: the order has no line %d", ErrInvalidRefund, l.Line)
+		}
+		if l.Quantity <= 0 {
+			return nil, fmt.Errorf("%w: quantity must be > 0 for line %d", ErrInvalidRefund, l.Line)
+		}
+		requested[l.Line] += l.Quantity
+	}
+	for i, qty := range requested {
+		if left := order.Items[i].RemainingQuantity(); qty > left {
+			return nil, fmt.Errorf("%w: only %d of line %d can be refunded", ErrInvalidRefund, left, i)
+		}
+	}
+
+	refund := &models.Refund{
+		ID:           primitive.NewObjectID(),
+		OrderID:      order.ID,
+		RestaurantID: order.RestaurantID,
+		Reason:       reason,
+		CreationDate: time.Now().UTC(),
+		EventID:      eventID,
+	}
+	var total refundShare
+	fullyRefunded := true
+	for i, it := range order.Items {
+		if qty := requested[i]; qty > 0 {
+			share := lineShare(order, i, it.RefundedQuantity, it.RefundedQuantity+qty)
+			refund.Items = append(refund.Items, models.RefundItem{
+				Line:     i,
+				ItemID:   it.ItemID,
+				Quantity: qty,
+				Amount:   share.amount,
+				Cost:     share.cost,
+			})
+			total.add(share)
+			order.Items[i].RefundedQuantity += qty
+		}
+		if order.Items[i].RemainingQuantity() > 0 {
+			fullyRefunded = false
+		}
+	}
+	if len(refund.Items) == 0 {
+		return nil, fmt.Errorf("%w: nothing left to refund", ErrInvalidRefund)
+	}
+	var tip money.Amount
+	if fullyRefunded {
+		tip = orderTip(order)
+	}
+	refund.Amount = money.New(total.amount+tip, order.Currency)
+	refund.Tax = money.New(total.tax, order.Currency)
+	refund.Tip = money.New(tip, order.Currency)
+	refund.Cost = money.New(total.cost, order.Currency)
+
+	previousVersion := order.Version
+	order.Version++
+	order.RefundedTotal = money.New(order.RefundedTotal.Amount+refund.Amount.Amount, order.Currency)
+	order.Status = models.OrderStatusPartiallyRefunded
+	if fullyRefunded {
+		order.Status = models.OrderStatusRefunded
+	}
+
+	err := s.inTx(ctx, func(ctx context.Context) error {
+		if err := s.orders.SaveRefund(ctx, order, previousVersion, refund); err != nil {
+			return err
+		}
+		return s.addToDailyAggregate(ctx, order, DailyTotals{
+			Refunds:   refund.Amount.Amount,
+			Revenue:   -total.netSales,
+			Discounts: -total.discount,
+			Tax:       -total.tax,
+			Tips:      -tip,
+			Cost:      -total.cost,
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	s.publishLifecycle(ctx, Lifecycle{Context: ctx, Type: EventOrderStatusChanged, Order: *order})
+	return refund, nil
+}
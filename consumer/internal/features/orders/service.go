@@ -3,109 +3,273 @@ package orders
 import (
 	"context"
 	"errors"
+	"fmt"
+	"log/slog"
 	"time"
 
-	"consumer/internal/features/items"
 	"consumer/internal/models"
+	"consumer/internal/pricing"
+	"contracts/correlation"
+	"contracts/logging"
+	"contracts/money"
 
-	"github.com/gin-gonic/gin"
-	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
-	"go.mongodb.org/mongo-driver/mongo"
-	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.opentelemetry.io/otel/trace"
 )
 
 type Service struct {
-	db         *mongo.Database
-	collection *mongo.Collection
-	items      items.Service
+	orders     OrderStore
+	aggregates AggregateStore
+	items      ItemStore
+	pricing    Pricing
+	tx         Transactor
+	events     Publisher
+	log        *slog.Logger
 }
 
-func NewService(database *mongo.Database, items items.Service) *Service {
+// NewService publishes lifecycle events with events, unless it is nil
+func NewService(stores Stores, events Publisher, logger *slog.Logger) *Service {
 	return &Service{
-		db:         database,
-		collection: database.Collection("orders"),
-		items:      items,
+		orders:     stores.Orders,
+		aggregates: stores.Aggregates,
+		items:      stores.Items,
+		pricing:    stores.Pricing,
+		tx:         stores.Tx,
+		events:     events,
+		log:        logger,
 	}
 }
 
-func (s *Service) CreateOrder(ctx *gin.Context, order *models.Order) (primitive.ObjectID, error) {
-	restaurantIDHex := ctx.Request.Header.Get("x-org")
-	if restaurantIDHex == "" {
-		return primitive.NilObjectID, errors.New("missing or invalid x-org header")
+// CreateOrder validates, prices and persists a single order of order.RestaurantID
+func (s *Service) CreateOrder(ctx context.Context, order *models.Order) (primitive.ObjectID, error) {
+	rejected, err := s.CreateOrders(ctx, []*models.Order{order})
+	if err != nil {
+		return primitive.NilObjectID, err
 	}
-	restaurantID, restaurantIDErr := primitive.ObjectIDFromHex(restaurantIDHex)
-	if restaurantIDErr != nil {
-		return primitive.NilObjectID, errors.New("invalid x-org header format")
+	if rejected[0] != nil {
+		return primitive.NilObjectID, rejected[0]
 	}
+	return order.ID, nil
+}
 
-	order.RestaurantID = restaurantID
-	return s.createOrder(ctx.Request.Context(), order)
+// CreateOrders validates, prices and persists a batch of orders with one lookup each of their
+// items, restaurants and promotions, one InsertMany and one BulkWrite of the daily aggregates.
+// rejected holds each order's validation error (wrapping ErrInvalidOrder), nil for accepted ones.
+// err means the batch could not be persisted; the whole batch can then be retried, as orders
+// carrying an EventID are stored only once.
+func (s *Service) CreateOrders(ctx context.Context, orders []*models.Order) (rejected []error, err error) {
+	return s.createOrders(ctx, orders, nil)
 }
 
-// CreateOrderFromEvent allows creating an order from a background consumer using a std context and explicit restaurant id
-func (s *Service) CreateOrderFromEvent(ctx context.Context, restaurantID primitive.ObjectID, items []models.OrderItem) (primitive.ObjectID, error) {
-	order := &models.Order{
-		RestaurantID: restaurantID,
-		Items:        items,
+// createOrders is CreateOrders publishing each order's lifecycle event with its entry of
+// orderCtxs, the context of the event the order came from, so that it joins that event's trace
+func (s *Service) createOrders(ctx context.Context, orders []*models.Order, orderCtxs map[*models.Order]context.Context) (rejected []error, err error) {
+	rejected = make([]error, len(orders))
+	var itemIDs, restaurantIDs []primitive.ObjectID
+	seen := make(map[primitive.ObjectID]bool)
+	for _, order := range orders {
+		if order.ID.IsZero() {
+			order.ID = primitive.NewObjectID()
+		}
+		if order.CreationDate.IsZero() {
+			order.CreationDate = time.Now().UTC()
+		}
+		if order.Status == "" {
+			order.Status = models.OrderStatusPending
+		}
+		if order.RequestID == "" && order.TraceID == "" {
+			ids := correlation.FromContext(ctx)
+			order.RequestID, order.TraceID = ids.RequestID, ids.Trace.TraceID
+		}
+		if !seen[order.RestaurantID] {
+			seen[order.RestaurantID] = true
+			restaurantIDs = append(restaurantIDs, order.RestaurantID)
+		}
+		for _, it := range order.Items {
+			if !seen[it.ItemID] {
+				seen[it.ItemID] = true
+				itemIDs = append(itemIDs, it.ItemID)
+			}
+		}
+	}
+
+	fetchedItems, err := s.items.ListItems(ctx, itemIDs)
+	if err != nil {
+		return nil, err
+	}
+	itemsByID := make(map[primitive.ObjectID]models.Item, len(fetchedItems))
+	for _, ref := range fetchedItems {
+		itemsByID[ref.ID] = ref
+	}
+	restaurants, err := s.pricing.Restaurants(ctx, restaurantIDs)
+	if err != nil {
+		return nil, err
+	}
+	promotions, err := s.pricing.Promotions(ctx, restaurantIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	accepted := make([]*models.Order, 0, len(orders))
+	for i, order := range orders {
+		restaurant, ok := restaurants[order.RestaurantID]
+		if !ok {
+			rejected[i] = fmt.Errorf("%w: %v", ErrInvalidOrder, pricing.ErrUnknownRestaurant)
+			continue
+		}
+		if rejected[i] = priceOrder(order, restaurant, promotions[order.RestaurantID], itemsByID); rejected[i] == nil {
+			accepted = append(accepted, order)
+		}
+	}
+	if len(accepted) == 0 {
+		return rejected, nil
 	}
-	return s.createOrder(ctx, order)
+
+	var uncounted []*models.Order
+	err = s.inTx(ctx, func(ctx context.Context) error {
+		var err error
+		if uncounted, err = s.orders.InsertOrders(ctx, accepted); err != nil {
+			return err
+		}
+		return s.countOrders(ctx, uncounted)
+	})
+	if err != nil {
+		return nil, err
+	}
+	created := make([]Lifecycle, len(uncounted))
+	for i, order := range uncounted {
+		orderCtx, ok := orderCtxs[order]
+		if !ok {
+			orderCtx = orderContext(ctx, order)
+		}
+		created[i] = Lifecycle{Context: orderCtx, Type: EventOrderCreated, Order: *order}
+	}
+	s.publishLifecycle(ctx, created...)
+	return rejected, nil
 }
 
-// createOrder consolidates common steps to complete and persist an order
-func (s *Service) createOrder(ctx context.Context, order *models.Order) (primitive.ObjectID, error) {
-	if order.ID.IsZero() {
-		order.ID = primitive.NewObjectID()
-	}
-	if order.CreationDate.IsZero() {
-		order.CreationDate = time.Now().UTC()
-	}
-
-	// Build list of item IDs from order items
-	itemIDs := make([]primitive.ObjectID, 0, len(order.Items))
-	for _, it := range order.Items {
-		itemIDs = append(itemIDs, it.ItemID)
-	}
-	fetchedItems, itemsErr := s.items.ListItems(ctx, itemIDs)
-	if itemsErr != nil {
-		return primitive.NilObjectID, itemsErr
-	}
-	var totalCost float64
-	var totalPrice float64
-	// Map itemID -> item for price/cost lookup
-	for _, it := range order.Items {
-		for _, ref := range fetchedItems {
-			if ref.ID == it.ItemID {
-				totalCost += ref.Cost * float64(it.Quantity)
-				totalPrice += ref.Price * float64(it.Quantity)
-				break
-			}
+// priceOrder checks the order's lines against the restaurant's items and prices it
+func priceOrder(order *models.Order, restaurant models.Restaurant, promotions []models.Promotion, itemsByID map[primitive.ObjectID]models.Item) error {
+	order.Currency = restaurant.CurrencyOrDefault()
+
+	var totalCost money.Amount
+	for i, it := range order.Items {
+		ref, ok := itemsByID[it.ItemID]
+		if !ok || ref.RestaurantID != order.RestaurantID {
+			return fmt.Errorf("%w: unknown item %s", ErrInvalidOrder, it.ItemID.Hex())
+		}
+		// Keep the prices the order was placed at so refunds don't depend on later menu changes
+		if err := applyModifiers(ref, order.Currency, &order.Items[i]); err != nil {
+			return err
 		}
+		totalCost += order.Items[i].UnitCost.Mul(it.Quantity)
 	}
-	order.TotalCost = totalCost
-	order.TotalPrice = totalPrice
 
-	if _, err := s.collection.InsertOne(ctx, order); err != nil {
-		return primitive.NilObjectID, err
+	breakdown, err := pricing.PriceWith(restaurant, promotions, order)
+	if errors.Is(err, pricing.ErrInvalidPromoCode) || errors.Is(err, pricing.ErrNegativeTip) {
+		return fmt.Errorf("%w: %v", ErrInvalidOrder, err)
+	}
+	if err != nil {
+		return err
 	}
+	order.Pricing = &breakdown
+	order.TotalCost = money.New(totalCost, order.Currency)
+	order.TotalPrice = money.New(breakdown.Total, order.Currency)
+	return nil
+}
+
+type aggregateKey struct {
+	restaurantID primitive.ObjectID
+	day          time.Time
+}
 
-	// Update materialized daily aggregate (one document per day and restaurant)
-	dayUTC := time.Date(order.CreationDate.UTC().Year(), order.CreationDate.UTC().Month(), order.CreationDate.UTC().Day(), 0, 0, 0, 0, time.UTC)
-	filter := bson.M{
-		"restaurantId": order.RestaurantID,
-		"day":          dayUTC,
+// countOrders adds the orders to their daily aggregates at once, then clears their
+// AggregatePending flag. Revenue is net sales; tax and tips are tracked separately.
+// Should clearing the flag fail after the aggregates were written, a retry counts the orders again.
+func (s *Service) countOrders(ctx context.Context, orders []*models.Order) error {
+	if len(orders) == 0 {
+		return nil
 	}
-	update := bson.M{
-		"$setOnInsert": bson.M{
-			"restaurantId": order.RestaurantID,
-			"day":          dayUTC,
-		},
-		"$inc": bson.M{
-			"totalOrders": 1,
-			"revenue":     order.TotalPrice,
-		},
+	var totals []DailyTotals
+	byKey := make(map[aggregateKey]int)
+	ids := make([]primitive.ObjectID, len(orders))
+	for i, order := range orders {
+		ids[i] = order.ID
+		key := aggregateKey{restaurantID: order.RestaurantID, day: dayOf(order.CreationDate)}
+		j, ok := byKey[key]
+		if !ok {
+			j = len(totals)
+			byKey[key] = j
+			totals = append(totals, DailyTotals{RestaurantID: key.restaurantID, Day: key.day, Currency: order.Currency})
+		}
+		t := &totals[j]
+		t.TotalOrders++
+		t.Revenue += order.Pricing.NetSales()
+		t.Discounts += order.Pricing.Discount
+		t.Tax += order.Pricing.Tax
+		t.Tips += order.Pricing.Tip
+		t.Cost += order.TotalCost.Amount
+	}
+	if err := s.aggregates.Add(ctx, totals); err != nil {
+		return err
 	}
-	_, _ = s.db.Collection("daily_aggregates").UpdateOne(ctx, filter, update, options.Update().SetUpsert(true))
+	return s.orders.MarkCounted(ctx, ids)
+}
 
-	return order.ID, nil
+// orderContext carries the IDs of the request that created the order when ctx is not already
+// part of its trace, e.g. for an order stored by an earlier attempt of a batch
+func orderContext(ctx context.Context, order *models.Order) context.Context {
+	if order.TraceID == "" || correlation.FromContext(ctx).Trace.TraceID == order.TraceID {
+		return ctx
+	}
+	t := correlation.Trace{TraceID: order.TraceID, Flags: "01"}.Child()
+	ctx = trace.ContextWithRemoteSpanContext(ctx, t.SpanContext())
+	return correlation.NewContext(ctx, correlation.IDs{RequestID: order.RequestID, Trace: t})
+}
+
+// publishLifecycle notifies live order feeds, with one write for all the events; the changes
+// are already persisted so a failure here is not fatal
+func (s *Service) publishLifecycle(ctx context.Context, events ...Lifecycle) {
+	if s.events == nil || len(events) == 0 {
+		return
+	}
+	if err := s.events.Publish(ctx, events...); err != nil {
+		for _, e := range events {
+			logCtx := e.Context
+			if logCtx == nil {
+				logCtx = ctx
+			}
+			s.log.WarnContext(logCtx, "failed to publish order lifecycle event", "event", e.Type, logging.KeyOrderID, e.Order.ID.Hex(), "error", err)
+		}
+	}
+}
+
+// inTx runs fn in a transaction of the stores, or as it is when they have none
+func (s *Service) inTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	if s.tx == nil {
+		return fn(ctx)
+	}
+	return s.tx.InTx(ctx, fn)
+}
+
+// addToDailyAggregate adds totals to the daily aggregate (one per day and restaurant) of the day
+// the order was created on. Amounts are minor units of the restaurant currency. In a transaction
+// its error undoes the order's change; without one the change is already stored, so the
+// aggregate is only reported as missed.
+func (s *Service) addToDailyAggregate(ctx context.Context, order *models.Order, totals DailyTotals) error {
+	totals.RestaurantID = order.RestaurantID
+	totals.Day = dayOf(order.CreationDate)
+	totals.Currency = order.Currency
+	err := s.aggregates.Add(ctx, []DailyTotals{totals})
+	if err != nil && s.tx == nil {
+		s.log.WarnContext(ctx, "failed to update the daily aggregate", logging.KeyOrderID, order.ID.Hex(), "error", err)
+		return nil
+	}
+	return err
+}
+
+// dayOf truncates t to its UTC day
+func dayOf(t time.Time) time.Time {
+	t = t.UTC()
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
 }
@@ -0,0 +1,203 @@
+package orders_test
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"testing"
+	"time"
+
+	"consumer/internal/features/orders"
+	"consumer/internal/features/orders/orderstest"
+	"consumer/internal/memstore"
+	"consumer/internal/models"
+	"consumer/internal/pricing"
+	"contracts/money"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type fixture struct {
+	svc        *orders.Service
+	db         *memstore.DB
+	events     *orderstest.Publisher
+	restaurant models.Restaurant
+	item       models.Item
+}
+
+func newFixture() fixture {
+	f := fixture{
+		db:         memstore.New(),
+		restaurant: models.Restaurant{ID: primitive.NewObjectID(), Name: "Diner", Currency: "USD", TaxRateBps: 1000},
+		events:     &orderstest.Publisher{},
+	}
+	f.item = models.Item{ID: primitive.NewObjectID(), Name: "Burger", RestaurantID: f.restaurant.ID, Price: money.New(1000, "USD"), Cost: money.New(400, "USD")}
+	f.db.Restaurants.Put(f.restaurant)
+	f.db.Items.Put(f.item)
+	f.svc = orders.NewService(f.db.OrderStores(), f.events, slog.Default())
+	return f
+}
+
+func (f fixture) order(quantity int) *models.Order {
+	return &models.Order{
+		RestaurantID: f.restaurant.ID,
+		CreationDate: time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC),
+		Items:        []models.OrderItem{{ItemID: f.item.ID, Quantity: quantity}},
+		Tip:          150,
+	}
+}
+
+var day = time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+
+func TestCreateOrders(t *testing.T) {
+	f := newFixture()
+	ctx := context.Background()
+	unknown := f.order(1)
+	unknown.Items[0].ItemID = primitive.NewObjectID()
+	batch := []*models.Order{f.order(1), unknown, f.order(2)}
+
+	rejected, err := f.svc.CreateOrders(ctx, batch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rejected[0] != nil || rejected[2] != nil || !errors.Is(rejected[1], orders.ErrInvalidOrder) {
+		t.Fatalf("rejected = %v", rejected)
+	}
+	want := orders.DailyTotals{RestaurantID: f.restaurant.ID, Day: day, Currency: "USD", TotalOrders: 2}
+	for _, o := range []*models.Order{batch[0], batch[2]} {
+		want.Revenue += o.Pricing.NetSales()
+		want.Tax += o.Pricing.Tax
+		want.Tips += o.Pricing.Tip
+		want.Cost += o.TotalCost.Amount
+	}
+	if got, _ := f.db.Aggregates.Get(f.restaurant.ID, day); got != want {
+		t.Errorf("aggregate = %+v, want %+v", got, want)
+	}
+	if want.Cost != 1200 || want.Tips != 300 {
+		t.Errorf("cost %d and tips %d, want 1200 and 300", want.Cost, want.Tips)
+	}
+	if n := len(f.db.Orders.All()); n != 2 {
+		t.Errorf("stored %d orders, want 2", n)
+	}
+	if n, writes := len(f.events.Events()), f.events.Writes(); n != 2 || writes != 1 {
+		t.Errorf("published %d events in %d writes, want 2 in 1", n, writes)
+	}
+
+	// a retried batch is neither stored nor counted twice
+	if _, err := f.svc.CreateOrders(ctx, []*models.Order{batch[0], batch[2]}); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := f.db.Aggregates.Get(f.restaurant.ID, day); got != want {
+		t.Errorf("after retry aggregate = %+v, want %+v", got, want)
+	}
+	if n := len(f.db.Orders.All()); n != 2 {
+		t.Errorf("after retry stored %d orders, want 2", n)
+	}
+}
+
+func TestRefundThenCancel(t *testing.T) {
+	f := newFixture()
+	ctx := context.Background()
+	// an odd discount doesn't split evenly between the units refunded and those cancelled
+	f.db.Restaurants.PutPromotions(models.Promotion{ID: primitive.NewObjectID(), RestaurantID: f.restaurant.ID, Name: "Lunch", Kind: models.PromotionFixed, Amount: 125, Active: true})
+	order := f.order(2)
+	if _, err := f.svc.CreateOrders(ctx, []*models.Order{order}); err != nil {
+		t.Fatal(err)
+	}
+	if order.Pricing.Discount != 125 {
+		t.Fatalf("discount = %d, want 125", order.Pricing.Discount)
+	}
+
+	refund, err := f.svc.RefundOrder(ctx, f.restaurant.ID, order.ID, []orders.RefundLine{{Line: 0, Quantity: 1}}, "cold", "refund-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the tip is only given back once nothing is left
+	if refund.Amount.Amount != pricing.Portion(order.Pricing.Total-order.Pricing.Tip, 2, 0, 1) || refund.Tip.Amount != 0 {
+		t.Errorf("refund = %+v of order priced %+v", refund, order.Pricing)
+	}
+	if _, err := f.svc.RefundOrder(ctx, f.restaurant.ID, order.ID, []orders.RefundLine{{Line: 0, Quantity: 2}}, "", "refund-2"); !errors.Is(err, orders.ErrInvalidRefund) {
+		t.Errorf("refunding more than is left: %v, want ErrInvalidRefund", err)
+	}
+
+	cancelled, err := f.svc.CancelOrder(ctx, f.restaurant.ID, order.ID, "closed")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cancelled.Status != models.OrderStatusCancelled {
+		t.Errorf("status = %s", cancelled.Status)
+	}
+	if _, err := f.svc.CancelOrder(ctx, f.restaurant.ID, order.ID, ""); !errors.Is(err, orders.ErrOrderNotCancelable) {
+		t.Errorf("cancelling twice: %v, want ErrOrderNotCancelable", err)
+	}
+	if _, err := f.svc.CancelOrder(ctx, primitive.NewObjectID(), order.ID, ""); !errors.Is(err, orders.ErrOrderNotFound) {
+		t.Errorf("another restaurant's order: %v, want ErrOrderNotFound", err)
+	}
+
+	// whatever was sold has been given back, by the refund or the cancellation
+	want := orders.DailyTotals{
+		RestaurantID:    f.restaurant.ID,
+		Day:             day,
+		Currency:        "USD",
+		TotalOrders:     1,
+		CancelledOrders: 1,
+		Refunds:         refund.Amount.Amount,
+	}
+	if got, _ := f.db.Aggregates.Get(f.restaurant.ID, day); got != want {
+		t.Errorf("aggregate = %+v, want %+v", got, want)
+	}
+	if n := len(f.db.Orders.Refunds()); n != 1 {
+		t.Errorf("stored %d refunds, want 1", n)
+	}
+	var types []string
+	for _, e := range f.events.Events() {
+		types = append(types, e.Type)
+	}
+	if len(types) != 3 || types[0] != orders.EventOrderCreated || types[2] != orders.EventOrderStatusChanged {
+		t.Errorf("published %v", types)
+	}
+}
+
+func TestRefundLines(t *testing.T) {
+	f := newFixture()
+	ctx := context.Background()
+	order := f.order(1)
+	order.Items = append(order.Items, models.OrderItem{ItemID: f.item.ID, Quantity: 2, Notes: "no pickles"})
+	if _, err := f.svc.CreateOrders(ctx, []*models.Order{order}); err != nil {
+		t.Fatal(err)
+	}
+
+	// the same item on two lines is refunded from the line asked for
+	refund, err := f.svc.RefundOrder(ctx, f.restaurant.ID, order.ID, []orders.RefundLine{{Line: 1, Quantity: 2}}, "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(refund.Items) != 1 || refund.Items[0].Line != 1 || refund.Items[0].Quantity != 2 {
+		t.Errorf("refunded %+v, want 2 of line 1", refund.Items)
+	}
+	for _, lines := range [][]orders.RefundLine{{{Line: 1, Quantity: 1}}, {{Line: 2, Quantity: 1}}, {{Line: -1, Quantity: 1}}} {
+		if _, err := f.svc.RefundOrder(ctx, f.restaurant.ID, order.ID, lines, "", ""); !errors.Is(err, orders.ErrInvalidRefund) {
+			t.Errorf("refunding %+v: %v, want ErrInvalidRefund", lines, err)
+		}
+	}
+
+	// order.refund v1 names the item, which is refunded from its first line with some left
+	refund, err = f.svc.RefundItems(ctx, f.restaurant.ID, order.ID, map[primitive.ObjectID]int{f.item.ID: 1}, "", "refund-v1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(refund.Items) != 1 || refund.Items[0].Line != 0 || refund.Tip.Amount != order.Pricing.Tip {
+		t.Errorf("refund = %+v, want line 0 and the tip", refund)
+	}
+	if stored := f.db.Orders.All()[0]; stored.Status != models.OrderStatusRefunded {
+		t.Errorf("status = %s, want %s", stored.Status, models.OrderStatusRefunded)
+	}
+
+	// a redelivered event is recognized, though the order has nothing left to refund
+	if _, err := f.svc.RefundItems(ctx, f.restaurant.ID, order.ID, map[primitive.ObjectID]int{f.item.ID: 1}, "", "refund-v1"); !errors.Is(err, orders.ErrRefundApplied) {
+		t.Errorf("redelivered refund: %v, want ErrRefundApplied", err)
+	}
+	if n := len(f.db.Orders.Refunds()); n != 2 {
+		t.Errorf("%d refunds stored, want 2", n)
+	}
+}
@@ -0,0 +1,154 @@
+package orders
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// ConsumerStatus is what the Kafka consumer loop reports about itself to health checks. The loop
+// beats whenever it fetches a message or attempts a batch, so a loop with pending events and no
+// beat for longer than the stall timeout is stuck rather than waiting or retrying.
+type ConsumerStatus struct {
+	stallTimeout time.Duration
+
+	mu       sync.Mutex
+	running  bool
+	beat     time.Time
+	pending  int
+	offsets  map[int]partitionOffsets
+	failures map[int]string
+}
+
+// partitionOffsets are where a partition's handling is and the high water mark last fetched,
+// the offset its next message will get
+type partitionOffsets struct {
+	next          int64
+	highWaterMark int64
+}
+
+func (o partitionOffsets) lag() int64 {
+	return max(o.highWaterMark-o.next, 0)
+}
+
+func NewConsumerStatus(stallTimeout time.Duration) *ConsumerStatus {
+	return &ConsumerStatus{
+		stallTimeout: stallTimeout,
+		offsets:      make(map[int]partitionOffsets),
+		failures:     make(map[int]string),
+	}
+}
+
+// ConsumerReport is the consumer loop's part of the health report
+type ConsumerReport struct {
+	Running       bool              `json:"running"`
+	LastHeartbeat time.Time         `json:"lastHeartbeat"`
+	Pending       int               `json:"pending"`
+	Lag           map[string]int64  `json:"lag"`
+	Failing       map[string]string `json:"failing,omitempty"`
+}
+
+func (s *ConsumerStatus) started() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.running, s.beat = true, time.Now()
+}
+
+func (s *ConsumerStatus) stopped() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.running = false
+}
+
+// fetched records a message read from Kafka and not handled yet, with the partition's high
+// water mark as of the fetch, and returns the partition's lag
+func (s *ConsumerStatus) fetched(partition int, offset int64, highWaterMark int64) int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.beat = time.Now()
+	s.pending++
+	o, ok := s.offsets[partition]
+	if !ok {
+		// nothing handled yet: the partition starts at its first fetched message
+		o.next = offset
+	}
+	o.highWaterMark = max(o.highWaterMark, highWaterMark)
+	s.offsets[partition] = o
+	return o.lag()
+}
+
+// fetchFailed records a read error; the loop is alive and retries it
+func (s *ConsumerStatus) fetchFailed() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.beat = time.Now()
+}
+
+// attempted records an attempt at a partition's batch: how many of its messages were handled,
+// the offset after the last of them and the error that stopped the rest, if any. It returns
+// the partition's lag.
+func (s *ConsumerStatus) attempted(partition int, handled int, next int64, err error) int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.beat = time.Now()
+	s.pending -= handled
+	o := s.offsets[partition]
+	if handled > 0 {
+		o.next = next
+		s.offsets[partition] = o
+	}
+	if err != nil {
+		s.failures[partition] = err.Error()
+	} else {
+		delete(s.failures, partition)
+	}
+	return o.lag()
+}
+
+func (s *ConsumerStatus) report() ConsumerReport {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	r := ConsumerReport{
+		Running:       s.running,
+		LastHeartbeat: s.beat,
+		Pending:       s.pending,
+		Lag:           make(map[string]int64, len(s.offsets)),
+	}
+	for partition, o := range s.offsets {
+		r.Lag[strconv.Itoa(partition)] = o.lag()
+	}
+	for partition, failure := range s.failures {
+		if r.Failing == nil {
+			r.Failing = make(map[string]string)
+		}
+		r.Failing[strconv.Itoa(partition)] = failure
+	}
+	return r
+}
+
+// Live fails when the loop has exited or is stuck
+func (s *ConsumerStatus) Live(_ context.Context) (any, error) {
+	r := s.report()
+	if !r.Running {
+		return r, errors.New("consumer loop is not running")
+	}
+	if idle := time.Since(r.LastHeartbeat); r.Pending > 0 && idle > s.stallTimeout {
+		return r, fmt.Errorf("no heartbeat for %s with %d events pending", idle.Round(time.Second), r.Pending)
+	}
+	return r, nil
+}
+
+// Ready also fails while a partition's events can't be persisted and are being retried
+func (s *ConsumerStatus) Ready(ctx context.Context) (any, error) {
+	r, err := s.Live(ctx)
+	if err != nil {
+		return r, err
+	}
+	if failing := r.(ConsumerReport).Failing; len(failing) > 0 {
+		return r, fmt.Errorf("retrying events of %d partitions", len(failing))
+	}
+	return r, nil
+}
@@ -0,0 +1,58 @@
+package orders
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestConsumerStatus(t *testing.T) {
+	ctx := context.Background()
+	status := NewConsumerStatus(time.Minute)
+	if _, err := status.Live(ctx); err == nil {
+		t.Fatal("a loop that hasn't started should not be live")
+	}
+
+	status.started()
+	if lag := status.fetched(3, 10, 12); lag != 2 {
+		t.Errorf("lag after the first fetch = %d, want the 2 unhandled messages", lag)
+	}
+	// the lag follows the high water mark of every fetch
+	if lag := status.fetched(3, 11, 16); lag != 6 {
+		t.Errorf("lag after the second fetch = %d, want 6", lag)
+	}
+	if _, err := status.Ready(ctx); err != nil {
+		t.Fatalf("a loop with fresh pending events should be ready: %v", err)
+	}
+
+	// the first event is handled, the second is retried
+	if lag := status.attempted(3, 1, 11, errors.New("mongo is down")); lag != 5 {
+		t.Errorf("lag after handling one message = %d, want 5", lag)
+	}
+	if _, err := status.Live(ctx); err != nil {
+		t.Fatalf("a retrying loop is alive: %v", err)
+	}
+	details, err := status.Ready(ctx)
+	if err == nil {
+		t.Fatal("a retrying loop should not be ready")
+	}
+	if r := details.(ConsumerReport); r.Pending != 1 || r.Lag["3"] != 5 || r.Failing["3"] == "" {
+		t.Errorf("unexpected report %+v", r)
+	}
+
+	// no heartbeat for longer than the stall timeout while holding events
+	status.beat = time.Now().Add(-2 * time.Minute)
+	if _, err := status.Live(ctx); err == nil {
+		t.Error("a stalled loop should not be live")
+	}
+
+	status.attempted(3, 1, 12, nil)
+	if _, err := status.Ready(ctx); err != nil {
+		t.Errorf("a loop that caught up should be ready: %v", err)
+	}
+	status.stopped()
+	if _, err := status.Live(ctx); err == nil {
+		t.Error("a stopped loop should not be live")
+	}
+}
@@ -0,0 +1,311 @@
+package orders
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"consumer/internal/features/items"
+	"consumer/internal/models"
+	"consumer/internal/pricing"
+	"contracts/money"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// OrderStore keeps the orders and their refunds
+type OrderStore interface {
+	// InsertOrders stores the orders flagged AggregatePending and returns those not yet counted
+	// in the daily aggregates: the ones inserted now and, among those already stored by an
+	// earlier attempt (same ID or EventID), the ones still flagged
+	InsertOrders(ctx context.Context, orders []*models.Order) ([]*models.Order, error)
+	// MarkCounted clears the AggregatePending flag of the orders
+	MarkCounted(ctx context.Context, ids []primitive.ObjectID) error
+	// FindOrder returns ErrOrderNotFound unless the restaurant has the order
+	FindOrder(ctx context.Context, restaurantID, orderID primitive.ObjectID) (*models.Order, error)
+	// RefundApplied reports whether the refund of the event is stored
+	RefundApplied(ctx context.Context, eventID string) (bool, error)
+	// SaveCancellation stores the order's status, CancelledAt and CancellationReason, and
+	// SaveRefund its status, items and RefundedTotal along with the refund. Both store its
+	// Version and return ErrOrderChanged when the stored order is no longer at previousVersion;
+	// SaveRefund returns ErrRefundApplied when a refund with the same EventID is stored.
+	SaveCancellation(ctx context.Context, order *models.Order, previousVersion int64) error
+	SaveRefund(ctx context.Context, order *models.Order, previousVersion int64, refund *models.Refund) error
+}
+
+// AggregateStore keeps the daily aggregates, one per restaurant and UTC day
+type AggregateStore interface {
+	// Add adds each of the totals to its aggregate, which is created in the totals' currency
+	// when missing
+	Add(ctx context.Context, totals []DailyTotals) error
+}
+
+// DailyTotals are added to the daily aggregate of a restaurant and day. Amounts are minor units
+// of the restaurant currency; revenue is net sales.
+type DailyTotals struct {
+	RestaurantID    primitive.ObjectID
+	Day             time.Time
+	Currency        string
+	TotalOrders     int64
+	CancelledOrders int64
+	Revenue         money.Amount
+	Discounts       money.Amount
+	Tax             money.Amount
+	Tips            money.Amount
+	Cost            money.Amount
+	Refunds         money.Amount
+}
+
+// ItemStore looks up the items orders are placed for
+type ItemStore interface {
+	ListItems(ctx context.Context, ids []primitive.ObjectID) ([]models.Item, error)
+}
+
+// Pricing looks up what orders are priced with; unknown restaurants are missing from the result
+type Pricing interface {
+	Restaurants(ctx context.Context, ids []primitive.ObjectID) (map[primitive.ObjectID]models.Restaurant, error)
+	Promotions(ctx context.Context, restaurantIDs []primitive.ObjectID) (map[primitive.ObjectID][]models.Promotion, error)
+}
+
+// Transactor runs fn in a transaction, which the stores sharing it join through the context
+// fn is called with. fn's error rolls it back.
+type Transactor interface {
+	InTx(ctx context.Context, fn func(ctx context.Context) error) error
+}
+
+// Publisher notifies others of order lifecycle events
+type Publisher interface {
+	// Publish writes the events together, each correlated with the request and trace of its Context
+	Publish(ctx context.Context, events ...Lifecycle) error
+}
+
+// Lifecycle is a lifecycle event to publish about the order. Context is the order's, which
+// may differ from the others' of a batch.
+type Lifecycle struct {
+	Context context.Context
+	Type    string
+	Order   models.Order
+}
+
+// Stores are what the service reads and writes
+type Stores struct {
+	Orders     OrderStore
+	Aggregates AggregateStore
+	Items      ItemStore
+	Pricing    Pricing
+	// Tx makes an order's change and its daily aggregate one write, when set; without it the
+	// aggregates are written after the orders, and InsertOrders' AggregatePending flag lets a
+	// retry count the orders the first attempt left out
+	Tx Transactor
+}
+
+// MongoStores keeps everything in the database
+func MongoStores(database *mongo.Database) Stores {
+	return Stores{
+		Orders:     NewMongoOrderStore(database),
+		Aggregates: NewMongoAggregateStore(database),
+		Items:      items.NewMongoStore(database),
+		Pricing:    pricing.NewEngine(pricing.NewMongoStore(database)),
+	}
+}
+
+type MongoOrderStore struct {
+	orders  *mongo.Collection
+	refunds *mongo.Collection
+}
+
+func NewMongoOrderStore(database *mongo.Database) *MongoOrderStore {
+	return &MongoOrderStore{
+		orders:  database.Collection("orders"),
+		refunds: database.Collection("refunds"),
+	}
+}
+
+func (s *MongoOrderStore) InsertOrders(ctx context.Context, orders []*models.Order) ([]*models.Order, error) {
+	docs := make([]any, len(orders))
+	for i, order := range orders {
+		order.AggregatePending = true
+		docs[i] = order
+	}
+	_, err := s.orders.InsertMany(ctx, docs, options.InsertMany().SetOrdered(false))
+	var bulkErr mongo.BulkWriteException
+	if err != nil && !errors.As(err, &bulkErr) {
+		return nil, err
+	}
+	if err != nil && bulkErr.WriteConcernError != nil {
+		return nil, err
+	}
+
+	duplicate := make(map[int]bool, len(bulkErr.WriteErrors))
+	for _, we := range bulkErr.WriteErrors {
+		if !mongo.IsDuplicateKeyError(we) {
+			return nil, err
+		}
+		duplicate[we.Index] = true
+	}
+	uncounted := make([]*models.Order, 0, len(orders))
+	var dupIDs []primitive.ObjectID
+	var dupEvents []string
+	for i, order := range orders {
+		switch {
+		case !duplicate[i]:
+			uncounted = append(uncounted, order)
+		case order.EventID != "":
+			dupEvents = append(dupEvents, order.EventID)
+		default:
+			dupIDs = append(dupIDs, order.ID)
+		}
+	}
+	if len(duplicate) == 0 {
+		return uncounted, nil
+	}
+
+	filter := bson.M{
+		"aggregatePending": true,
+		"$or": bson.A{
+			bson.M{"_id": bson.M{"$in": dupIDs}},
+			bson.M{"eventId": bson.M{"$in": dupEvents}},
+		},
+	}
+	cursor, err := s.orders.Find(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	var stored []*models.Order
+	if err := cursor.All(ctx, &stored); err != nil {
+		return nil, err
+	}
+	// an event delivered twice in one batch is inserted by its first copy and found here as well
+	inserted := make(map[primitive.ObjectID]bool, len(uncounted))
+	for _, order := range uncounted {
+		inserted[order.ID] = true
+	}
+	for _, order := range stored {
+		if !inserted[order.ID] {
+			uncounted = append(uncounted, order)
+		}
+	}
+	return uncounted, nil
+}
+
+func (s *MongoOrderStore) MarkCounted(ctx context.Context, ids []primitive.ObjectID) error {
+	_, err := s.orders.UpdateMany(ctx, bson.M{"_id": bson.M{"$in": ids}}, bson.M{"$unset": bson.M{"aggregatePending": ""}})
+	return err
+}
+
+func (s *MongoOrderStore) FindOrder(ctx context.Context, restaurantID, orderID primitive.ObjectID) (*models.Order, error) {
+	var order models.Order
+	err := s.orders.FindOne(ctx, bson.M{"_id": orderID, "restaurantId": restaurantID}).Decode(&order)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, ErrOrderNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &order, nil
+}
+
+func (s *MongoOrderStore) RefundApplied(ctx context.Context, eventID string) (bool, error) {
+	n, err := s.refunds.CountDocuments(ctx, bson.M{"eventId": eventID}, options.Count().SetLimit(1))
+	return n > 0, err
+}
+
+func (s *MongoOrderStore) SaveCancellation(ctx context.Context, order *models.Order, previousVersion int64) error {
+	return s.update(ctx, order, previousVersion, bson.M{
+		"status":             order.Status,
+		"cancelledAt":        order.CancelledAt,
+		"cancellationReason": order.CancellationReason,
+	})
+}
+
+// SaveRefund inserts the refund before changing the order, so that its unique eventId stops a
+// redelivered event, and deletes it again when the order can't be changed. Without a
+// transaction, a crash in between leaves the refund stored and its event skipped.
+func (s *MongoOrderStore) SaveRefund(ctx context.Context, order *models.Order, previousVersion int64, refund *models.Refund) error {
+	if _, err := s.refunds.InsertOne(ctx, refund); err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return ErrRefundApplied
+		}
+		return err
+	}
+	err := s.update(ctx, order, previousVersion, bson.M{
+		"status":        order.Status,
+		"items":         order.Items,
+		"refundedTotal": order.RefundedTotal,
+	})
+	if err != nil {
+		if _, deleteErr := s.refunds.DeleteOne(ctx, bson.M{"_id": refund.ID}); deleteErr != nil {
+			return errors.Join(err, deleteErr)
+		}
+		return err
+	}
+	return nil
+}
+
+// update only applies if nobody changed the order in the meantime
+func (s *MongoOrderStore) update(ctx context.Context, order *models.Order, previousVersion int64, set bson.M) error {
+	filter := bson.M{"_id": order.ID, "restaurantId": order.RestaurantID, "version": previousVersion}
+	if previousVersion == 0 {
+		filter["version"] = bson.M{"$exists": false}
+	}
+	set["version"] = order.Version
+	res, err := s.orders.UpdateOne(ctx, filter, bson.M{"$set": set})
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return ErrOrderChanged
+	}
+	return nil
+}
+
+type MongoAggregateStore struct {
+	collection *mongo.Collection
+}
+
+func NewMongoAggregateStore(database *mongo.Database) *MongoAggregateStore {
+	return &MongoAggregateStore{collection: database.Collection("daily_aggregates")}
+}
+
+// Add upserts all the aggregates in one BulkWrite
+func (s *MongoAggregateStore) Add(ctx context.Context, totals []DailyTotals) error {
+	if len(totals) == 0 {
+		return nil
+	}
+	writes := make([]mongo.WriteModel, len(totals))
+	for i, t := range totals {
+		writes[i] = mongo.NewUpdateOneModel().
+			SetFilter(bson.M{"restaurantId": t.RestaurantID, "day": t.Day}).
+			SetUpdate(aggregateUpdate(t)).
+			SetUpsert(true)
+	}
+	_, err := s.collection.BulkWrite(ctx, writes, options.BulkWrite().SetOrdered(false))
+	return err
+}
+
+func aggregateUpdate(t DailyTotals) bson.M {
+	currency := t.Currency
+	if currency == "" {
+		currency = money.DefaultCurrency
+	}
+	return bson.M{
+		"$setOnInsert": bson.M{
+			"restaurantId": t.RestaurantID,
+			"day":          t.Day,
+			"currency":     currency,
+		},
+		"$inc": bson.M{
+			"totalOrders":     t.TotalOrders,
+			"cancelledOrders": t.CancelledOrders,
+			"revenue":         t.Revenue,
+			"discounts":       t.Discounts,
+			"tax":             t.Tax,
+			"tips":            t.Tips,
+			"cost":            t.Cost,
+			"refunds":         t.Refunds,
+		},
+	}
+}
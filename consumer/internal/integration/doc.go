@@ -0,0 +1,5 @@
+// Package integration runs the consumer's side of the pipeline in process: order events written
+// to an in-process Kafka-compatible broker, the way the producer writes them, are consumed by
+// the Kafka consumer into in-memory stores, which keep the daily aggregates analytics reads,
+// and come back as lifecycle events. Skipped with -short.
+package integration
@@ -0,0 +1,287 @@
+package integration
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"sync"
+	"testing"
+	"time"
+
+	"consumer/internal/features/orders"
+	"consumer/internal/memstore"
+	"consumer/internal/models"
+	"consumer/internal/seed"
+	"contracts/correlation"
+	"contracts/events"
+	"contracts/kafkaconn"
+	"contracts/kafkatest"
+
+	"github.com/segmentio/kafka-go"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	ordersTopic     = "orders"
+	lifecycleTopic  = "order-events"
+	deadLetterTopic = "orders-dlq"
+)
+
+// pipeline is the consumer wired to the broker and in-memory stores
+type pipeline struct {
+	conn   *kafkaconn.Conn
+	codec  *events.Codec
+	writer *kafka.Writer
+	db     *memstore.DB
+	gen    *seed.Generator
+}
+
+func startPipeline(t *testing.T) *pipeline {
+	if testing.Short() {
+		t.Skip("integration test")
+	}
+	conn := kafkatest.Start(t, 3, ordersTopic, lifecycleTopic, deadLetterTopic)
+	codec, err := events.NewCodec(events.FormatJSON, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gen, err := seed.NewGenerator(seed.GenerateOptions{Restaurants: 3, Months: 1, OrdersPerDay: 5, RandomSeed: 1, End: time.Now()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := &pipeline{conn: conn, codec: codec, gen: gen}
+
+	menus := gen.Menus()
+	p.db = memstore.New()
+	p.db.Restaurants.Put(menus.Restaurants...)
+	p.db.Restaurants.PutPromotions(menus.Promotions...)
+	p.db.Items.Put(menus.Items...)
+	lifecycle := orders.NewEventPublisher(conn, lifecycleTopic)
+	deadLetters := orders.NewDeadLetters(conn, deadLetterTopic)
+	svc := orders.NewService(p.db.OrderStores(), lifecycle, slog.Default())
+	stop := orders.StartKafkaConsumer(context.Background(), orders.ConsumerConfig{
+		Kafka:          conn,
+		Topic:          ordersTopic,
+		GroupID:        "consumer",
+		BatchSize:      10,
+		BatchWait:      20 * time.Millisecond,
+		Concurrency:    2,
+		CommitInterval: 100 * time.Millisecond,
+		DeadLetters:    deadLetters,
+	}, svc, codec)
+
+	p.writer = &kafka.Writer{Addr: conn.Addr(), Transport: conn.Transport(), Topic: ordersTopic, Balancer: &kafka.Hash{}, BatchTimeout: 10 * time.Millisecond}
+	t.Cleanup(func() {
+		_ = p.writer.Close()
+		// closing the reader waits for its last fetch, which the broker holds for the default
+		// MaxWait of 10s when there is nothing to read
+		stop(context.Background())
+		_ = lifecycle.Close()
+		_ = deadLetters.Close()
+	})
+	return p
+}
+
+// publish writes the event like the producer does, with the request's correlation headers
+func (p *pipeline) publish(t *testing.T, requestID, restaurantID, eventType string, data any) {
+	t.Helper()
+	ctx := correlation.NewContext(context.Background(), correlation.IDs{RequestID: requestID, Trace: correlation.NewTrace()})
+	env, err := events.New("producer", eventType, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	payload, headers, err := p.codec.Marshal(ctx, env)
+	if err != nil {
+		t.Fatal(err)
+	}
+	headers = append(headers, correlation.KafkaHeaders(ctx)...)
+	if err := p.writer.WriteMessages(ctx, kafka.Message{Key: []byte(restaurantID), Value: payload, Headers: headers}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// readTopic collects the topic's messages from the start until the test ends
+type readTopic struct {
+	mu       sync.Mutex
+	messages []kafka.Message
+}
+
+func (p *pipeline) read(t *testing.T, topic string) *readTopic {
+	ctx, cancel := context.WithCancel(context.Background())
+	r := kafka.NewReader(kafka.ReaderConfig{Brokers: p.conn.Brokers, Dialer: p.conn.Dialer(), Topic: topic, GroupID: "test-" + topic, MaxWait: 100 * time.Millisecond})
+	read := &readTopic{}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for {
+			m, err := r.ReadMessage(ctx)
+			if err != nil {
+				return
+			}
+			read.mu.Lock()
+			read.messages = append(read.messages, m)
+			read.mu.Unlock()
+		}
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+		_ = r.Close()
+	})
+	return read
+}
+
+func (r *readTopic) get() []kafka.Message {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]kafka.Message(nil), r.messages...)
+}
+
+// eventually retries check until it returns true or 20s have passed
+func eventually(t *testing.T, what string, check func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(20 * time.Second)
+	for !check() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+func header(m kafka.Message, key string) string {
+	for _, h := range m.Headers {
+		if h.Key == key {
+			return string(h.Value)
+		}
+	}
+	return ""
+}
+
+func TestOrdersFlowIntoAggregates(t *testing.T) {
+	p := startPipeline(t)
+	lifecycle := p.read(t, lifecycleTopic)
+	deadLetters := p.read(t, deadLetterTopic)
+
+	// the first generated day's orders, as customers would send them
+	var placed []*models.Order
+	_ = p.gen.Orders(func(_ time.Time, orders []*models.Order) error {
+		if len(placed) == 0 {
+			placed = orders
+		}
+		return nil
+	})
+	if len(placed) == 0 {
+		t.Fatal("no orders generated")
+	}
+	requestIDs := make(map[string]bool, len(placed))
+	for _, o := range placed {
+		requestID := correlation.NewRequestID()
+		requestIDs[requestID] = true
+		evt := events.OrderCreate{RestaurantID: o.RestaurantID.Hex(), PromoCode: o.PromoCode, Tip: int64(o.Tip)}
+		for _, it := range o.Items {
+			line := events.OrderItem{ID: it.ItemID.Hex(), Quantity: it.Quantity}
+			for _, m := range it.Modifiers {
+				line.Modifiers = append(line.Modifiers, events.Modifier{GroupID: m.GroupID, OptionID: m.OptionID})
+			}
+			evt.Items = append(evt.Items, line)
+		}
+		p.publish(t, requestID, evt.RestaurantID, events.TypeOrderCreate, evt)
+	}
+	if err := p.writer.WriteMessages(context.Background(), kafka.Message{Key: []byte("bad"), Value: []byte("not an event")}); err != nil {
+		t.Fatal(err)
+	}
+
+	eventually(t, "the orders to be stored", func() bool { return len(p.db.Orders.All()) == len(placed) })
+	eventually(t, "the order.created events", func() bool { return len(lifecycle.get()) == len(placed) })
+	eventually(t, "the unreadable event to be dead-lettered", func() bool { return len(deadLetters.get()) == 1 })
+
+	// every order is counted once in its restaurant's aggregate of the day
+	want := make(map[primitive.ObjectID]orders.DailyTotals)
+	var day time.Time
+	for _, o := range p.db.Orders.All() {
+		if !requestIDs[o.RequestID] {
+			t.Errorf("order %s has request ID %q, not one of the events'", o.ID.Hex(), o.RequestID)
+		}
+		day = o.CreationDate.UTC().Truncate(24 * time.Hour)
+		w := want[o.RestaurantID]
+		w.TotalOrders++
+		w.Revenue += o.Pricing.NetSales()
+		w.Tax += o.Pricing.Tax
+		w.Tips += o.Pricing.Tip
+		want[o.RestaurantID] = w
+	}
+	for restaurantID, w := range want {
+		got, ok := p.db.Aggregates.Get(restaurantID, day)
+		if !ok || got.TotalOrders != w.TotalOrders || got.Revenue != w.Revenue || got.Tax != w.Tax || got.Tips != w.Tips {
+			t.Errorf("restaurant %s aggregate = %+v, want %+v", restaurantID.Hex(), got, w)
+		}
+	}
+	for _, m := range lifecycle.get() {
+		var evt orders.LifecycleEvent
+		if err := json.Unmarshal(m.Value, &evt); err != nil || evt.Type != orders.EventOrderCreated {
+			t.Errorf("lifecycle event %s: %v", m.Value, err)
+		}
+		if id := header(m, correlation.HeaderRequestID); !requestIDs[id] || id != evt.Order.RequestID {
+			t.Errorf("lifecycle event of order %s carries request ID %q", evt.OrderID, id)
+		}
+	}
+	if reason := header(deadLetters.get()[0], orders.HeaderDeadLetterReason); reason == "" {
+		t.Error("dead letter has no reason")
+	}
+
+	// cancelling an order takes it back out of the aggregate
+	cancelled := p.db.Orders.All()[0]
+	before, _ := p.db.Aggregates.Get(cancelled.RestaurantID, day)
+	p.publish(t, correlation.NewRequestID(), cancelled.RestaurantID.Hex(), events.TypeOrderCancel,
+		events.OrderCancel{RestaurantID: cancelled.RestaurantID.Hex(), OrderID: cancelled.ID.Hex(), Reason: "test"})
+	eventually(t, "the cancellation to be counted", func() bool {
+		got, _ := p.db.Aggregates.Get(cancelled.RestaurantID, day)
+		return got.CancelledOrders == 1
+	})
+	after, _ := p.db.Aggregates.Get(cancelled.RestaurantID, day)
+	if after.Revenue != before.Revenue-cancelled.Pricing.NetSales() || after.Tips != before.Tips-cancelled.Pricing.Tip {
+		t.Errorf("after cancelling aggregate = %+v, before %+v", after, before)
+	}
+	eventually(t, "the order.status_changed event", func() bool { return len(lifecycle.get()) == len(placed)+1 })
+}
+
+func TestLegacyTipInDollars(t *testing.T) {
+	p := startPipeline(t)
+
+	var placed *models.Order
+	_ = p.gen.Orders(func(_ time.Time, orders []*models.Order) error {
+		if placed == nil && len(orders) > 0 {
+			placed = orders[0]
+		}
+		return nil
+	})
+	if placed == nil {
+		t.Fatal("no orders generated")
+	}
+	// a bare payload, as written before events had an envelope, with the tip in dollars
+	evt := struct {
+		RestaurantID string             `json:"restaurantId"`
+		Items        []events.OrderItem `json:"items"`
+		Tip          float64            `json:"tip"`
+	}{RestaurantID: placed.RestaurantID.Hex(), Tip: 2.5}
+	for _, it := range placed.Items {
+		line := events.OrderItem{ID: it.ItemID.Hex(), Quantity: it.Quantity}
+		for _, m := range it.Modifiers {
+			line.Modifiers = append(line.Modifiers, events.Modifier{GroupID: m.GroupID, OptionID: m.OptionID})
+		}
+		evt.Items = append(evt.Items, line)
+	}
+	payload, err := json.Marshal(evt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := p.writer.WriteMessages(context.Background(), kafka.Message{Key: []byte(evt.RestaurantID), Value: payload}); err != nil {
+		t.Fatal(err)
+	}
+
+	eventually(t, "the order to be stored", func() bool { return len(p.db.Orders.All()) == 1 })
+	if tip := p.db.Orders.All()[0].Pricing.Tip; tip != 250 {
+		t.Errorf("tip = %d, want 250", tip)
+	}
+}
@@ -0,0 +1,100 @@
+package memstore
+
+import (
+	"context"
+	"sync"
+
+	"consumer/internal/models"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Items is an items.Store of the items put in it
+type Items struct {
+	mu    sync.Mutex
+	items map[primitive.ObjectID]models.Item
+}
+
+func NewItems() *Items {
+	return &Items{items: make(map[primitive.ObjectID]models.Item)}
+}
+
+// Put adds or replaces items
+func (s *Items) Put(items ...models.Item) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, it := range items {
+		s.items[it.ID] = it
+	}
+}
+
+func (s *Items) ListItems(_ context.Context, ids []primitive.ObjectID) ([]models.Item, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var out []models.Item
+	for _, id := range ids {
+		if it, ok := s.items[id]; ok {
+			out = append(out, it)
+		}
+	}
+	return out, nil
+}
+
+// Restaurants is a pricing.Store of the restaurants and promotions put in it
+type Restaurants struct {
+	mu          sync.Mutex
+	restaurants map[primitive.ObjectID]models.Restaurant
+	promotions  map[primitive.ObjectID][]models.Promotion
+}
+
+func NewRestaurants() *Restaurants {
+	return &Restaurants{
+		restaurants: make(map[primitive.ObjectID]models.Restaurant),
+		promotions:  make(map[primitive.ObjectID][]models.Promotion),
+	}
+}
+
+// Put adds or replaces restaurants
+func (s *Restaurants) Put(restaurants ...models.Restaurant) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, r := range restaurants {
+		s.restaurants[r.ID] = r
+	}
+}
+
+// PutPromotions adds promotions to their restaurants
+func (s *Restaurants) PutPromotions(promotions ...models.Promotion) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, p := range promotions {
+		s.promotions[p.RestaurantID] = append(s.promotions[p.RestaurantID], p)
+	}
+}
+
+func (s *Restaurants) Restaurants(_ context.Context, ids []primitive.ObjectID) (map[primitive.ObjectID]models.Restaurant, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := make(map[primitive.ObjectID]models.Restaurant, len(ids))
+	for _, id := range ids {
+		if r, ok := s.restaurants[id]; ok {
+			out[id] = r
+		}
+	}
+	return out, nil
+}
+
+// Promotions returns the active ones, like the Mongo store
+func (s *Restaurants) Promotions(_ context.Context, restaurantIDs []primitive.ObjectID) (map[primitive.ObjectID][]models.Promotion, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := make(map[primitive.ObjectID][]models.Promotion, len(restaurantIDs))
+	for _, id := range restaurantIDs {
+		for _, p := range s.promotions[id] {
+			if p.Active {
+				out[id] = append(out[id], p)
+			}
+		}
+	}
+	return out, nil
+}
@@ -0,0 +1,79 @@
+// Package memstore keeps orders, items, restaurants and daily aggregates in memory. It implements
+// the stores of the services, to run them without MongoDB in tests and tools.
+package memstore
+
+import (
+	"context"
+	"slices"
+
+	"consumer/internal/features/orders"
+	"consumer/internal/models"
+	"consumer/internal/seed"
+)
+
+// DB holds one store of each kind
+type DB struct {
+	Orders      *Orders
+	Aggregates  *Aggregates
+	Items       *Items
+	Restaurants *Restaurants
+}
+
+func New() *DB {
+	return &DB{
+		Orders:      NewOrders(),
+		Aggregates:  NewAggregates(),
+		Items:       NewItems(),
+		Restaurants: NewRestaurants(),
+	}
+}
+
+// OrderStores returns the stores of the orders service
+func (db *DB) OrderStores() orders.Stores {
+	return orders.Stores{Orders: db.Orders, Aggregates: db.Aggregates, Items: db.Items, Pricing: db.Restaurants}
+}
+
+// HasRestaurants, RestaurantNames and InsertMenus make the DB a seed.Store
+func (db *DB) HasRestaurants(_ context.Context) (bool, error) {
+	db.Restaurants.mu.Lock()
+	defer db.Restaurants.mu.Unlock()
+	return len(db.Restaurants.restaurants) > 0, nil
+}
+
+func (db *DB) RestaurantNames(_ context.Context, names []string) ([]string, error) {
+	db.Restaurants.mu.Lock()
+	defer db.Restaurants.mu.Unlock()
+	var out []string
+	for _, r := range db.Restaurants.restaurants {
+		if slices.Contains(names, r.Name) && !slices.Contains(out, r.Name) {
+			out = append(out, r.Name)
+		}
+	}
+	return out, nil
+}
+
+// InsertMenus leaves what is already stored under its ID as it is, like the other seed stores
+func (db *DB) InsertMenus(_ context.Context, menus seed.Menus) error {
+	db.Items.mu.Lock()
+	for _, it := range menus.Items {
+		if _, ok := db.Items.items[it.ID]; !ok {
+			db.Items.items[it.ID] = it
+		}
+	}
+	db.Items.mu.Unlock()
+
+	db.Restaurants.mu.Lock()
+	defer db.Restaurants.mu.Unlock()
+	for _, r := range menus.Restaurants {
+		if _, ok := db.Restaurants.restaurants[r.ID]; !ok {
+			db.Restaurants.restaurants[r.ID] = r
+		}
+	}
+	for _, p := range menus.Promotions {
+		stored := db.Restaurants.promotions[p.RestaurantID]
+		if !slices.ContainsFunc(stored, func(q models.Promotion) bool { return q.ID == p.ID }) {
+			db.Restaurants.promotions[p.RestaurantID] = append(stored, p)
+		}
+	}
+	return nil
+}
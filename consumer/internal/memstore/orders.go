@@ -0,0 +1,214 @@
+package memstore
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"consumer/internal/features/orders"
+	"consumer/internal/models"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Orders is an orders.OrderStore. Orders are copied in and out, like documents, so that
+// changes the service makes to an order only show once saved.
+type Orders struct {
+	mu      sync.Mutex
+	orders  map[primitive.ObjectID]*models.Order
+	byEvent map[string]primitive.ObjectID
+	refunds []models.Refund
+}
+
+func NewOrders() *Orders {
+	return &Orders{
+		orders:  make(map[primitive.ObjectID]*models.Order),
+		byEvent: make(map[string]primitive.ObjectID),
+	}
+}
+
+func (s *Orders) InsertOrders(_ context.Context, batch []*models.Order) ([]*models.Order, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var uncounted []*models.Order
+	seen := make(map[primitive.ObjectID]bool, len(batch))
+	for _, order := range batch {
+		order.AggregatePending = true
+		stored, ok := s.orders[order.ID]
+		if !ok && order.EventID != "" {
+			if id, dup := s.byEvent[order.EventID]; dup {
+				stored, ok = s.orders[id], true
+			}
+		}
+		switch {
+		case !ok:
+			s.orders[order.ID] = clone(order)
+			if order.EventID != "" {
+				s.byEvent[order.EventID] = order.ID
+			}
+			uncounted = append(uncounted, order)
+		case stored.AggregatePending && !seen[stored.ID]:
+			uncounted = append(uncounted, clone(stored))
+		}
+		seen[order.ID] = true
+	}
+	return uncounted, nil
+}
+
+func (s *Orders) MarkCounted(_ context.Context, ids []primitive.ObjectID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, id := range ids {
+		if order, ok := s.orders[id]; ok {
+			order.AggregatePending = false
+		}
+	}
+	return nil
+}
+
+func (s *Orders) FindOrder(_ context.Context, restaurantID, orderID primitive.ObjectID) (*models.Order, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	order, ok := s.orders[orderID]
+	if !ok || order.RestaurantID != restaurantID {
+		return nil, orders.ErrOrderNotFound
+	}
+	return clone(order), nil
+}
+
+func (s *Orders) RefundApplied(_ context.Context, eventID string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.refundOf(eventID), nil
+}
+
+func (s *Orders) refundOf(eventID string) bool {
+	for _, r := range s.refunds {
+		if r.EventID != "" && r.EventID == eventID {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Orders) SaveCancellation(_ context.Context, order *models.Order, previousVersion int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	stored, err := s.current(order, previousVersion)
+	if err != nil {
+		return err
+	}
+	stored.Status = order.Status
+	stored.CancelledAt = order.CancelledAt
+	stored.CancellationReason = order.CancellationReason
+	stored.Version = order.Version
+	return nil
+}
+
+func (s *Orders) SaveRefund(_ context.Context, order *models.Order, previousVersion int64, refund *models.Refund) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.refundOf(refund.EventID) {
+		return orders.ErrRefundApplied
+	}
+	stored, err := s.current(order, previousVersion)
+	if err != nil {
+		return err
+	}
+	stored.Status = order.Status
+	stored.Items = append([]models.OrderItem(nil), order.Items...)
+	stored.RefundedTotal = order.RefundedTotal
+	stored.Version = order.Version
+	s.refunds = append(s.refunds, *refund)
+	return nil
+}
+
+func (s *Orders) current(order *models.Order, previousVersion int64) (*models.Order, error) {
+	stored, ok := s.orders[order.ID]
+	if !ok || stored.RestaurantID != order.RestaurantID || stored.Version != previousVersion {
+		return nil, orders.ErrOrderChanged
+	}
+	return stored, nil
+}
+
+// All returns the stored orders, in no particular order
+func (s *Orders) All() []models.Order {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := make([]models.Order, 0, len(s.orders))
+	for _, order := range s.orders {
+		out = append(out, *clone(order))
+	}
+	return out
+}
+
+func (s *Orders) Refunds() []models.Refund {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]models.Refund(nil), s.refunds...)
+}
+
+func clone(order *models.Order) *models.Order {
+	c := *order
+	c.Items = append([]models.OrderItem(nil), order.Items...)
+	return &c
+}
+
+// Aggregates is an orders.AggregateStore
+type Aggregates struct {
+	mu         sync.Mutex
+	aggregates map[aggregateKey]*orders.DailyTotals
+}
+
+type aggregateKey struct {
+	restaurantID primitive.ObjectID
+	day          time.Time
+}
+
+func NewAggregates() *Aggregates {
+	return &Aggregates{aggregates: make(map[aggregateKey]*orders.DailyTotals)}
+}
+
+func (s *Aggregates) Add(_ context.Context, totals []orders.DailyTotals) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, t := range totals {
+		key := aggregateKey{restaurantID: t.RestaurantID, day: t.Day}
+		agg, ok := s.aggregates[key]
+		if !ok {
+			agg = &orders.DailyTotals{RestaurantID: t.RestaurantID, Day: t.Day, Currency: t.Currency}
+			s.aggregates[key] = agg
+		}
+		agg.TotalOrders += t.TotalOrders
+		agg.CancelledOrders += t.CancelledOrders
+		agg.Revenue += t.Revenue
+		agg.Discounts += t.Discounts
+		agg.Tax += t.Tax
+		agg.Tips += t.Tips
+		agg.Cost += t.Cost
+		agg.Refunds += t.Refunds
+	}
+	return nil
+}
+
+// All returns the sums of the totals added, one per restaurant and day
+func (s *Aggregates) All() []orders.DailyTotals {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := make([]orders.DailyTotals, 0, len(s.aggregates))
+	for _, agg := range s.aggregates {
+		out = append(out, *agg)
+	}
+	return out
+}
+
+// Get returns the sums of the totals added for the restaurant and day
+func (s *Aggregates) Get(restaurantID primitive.ObjectID, day time.Time) (orders.DailyTotals, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	agg, ok := s.aggregates[aggregateKey{restaurantID: restaurantID, day: day}]
+	if !ok {
+		return orders.DailyTotals{}, false
+	}
+	return *agg, true
+}
@@ -0,0 +1,34 @@
+package migrations
+
+import (
+	"context"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// baselineIndexes are the indexes the seed used to create at startup; databases seeded before
+// migrations already have them
+var baselineIndexes = Migration{
+	Version: 1,
+	Name:    "baseline_indexes",
+	Up: func(ctx context.Context, db *mongo.Database) error {
+		return createIndexes(ctx, db, baselineIndexList...)
+	},
+	Down: func(ctx context.Context, db *mongo.Database) error {
+		return dropIndexes(ctx, db, baselineIndexList...)
+	},
+}
+
+var baselineIndexList = []index{
+	// popular items and other analytics filter every restaurant's orders by date
+	{"orders", mongo.IndexModel{Keys: bson.D{{Key: "creationDate", Value: 1}}}},
+	// order listing and recent orders filter by restaurant and walk creationDate/_id
+	{"orders", mongo.IndexModel{Keys: bson.D{{Key: "restaurantId", Value: 1}, {Key: "creationDate", Value: -1}, {Key: "_id", Value: -1}}}},
+	// redelivered order events are recognized by their event ID
+	{"orders", mongo.IndexModel{Keys: bson.D{{Key: "eventId", Value: 1}}, Options: options.Index().SetUnique(true).SetSparse(true)}},
+	// support looks orders up by the request that created them
+	{"orders", mongo.IndexModel{Keys: bson.D{{Key: "requestId", Value: 1}}, Options: options.Index().SetSparse(true)}},
+	{"restaurants", mongo.IndexModel{Keys: bson.D{{Key: "name", Value: 1}}}},
+}
@@ -0,0 +1,171 @@
+package migrations
+
+import (
+	"context"
+	"fmt"
+
+	"contracts/money"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// dailyAggregatesUnique keeps one aggregate per restaurant and day. The consumer upserts them
+// by restaurantId and day; without the index, concurrent upserts of a new day could insert it
+// twice, and the daily analytics scan every restaurant's days. The duplicates such upserts left
+// are merged first, or the index couldn't be built.
+var dailyAggregatesUnique = Migration{
+	Version: 2,
+	Name:    "daily_aggregates_restaurant_day_unique",
+	Up: func(ctx context.Context, db *mongo.Database) error {
+		if err := mergeDuplicateAggregates(ctx, db.Collection(dailyAggregatesIndex.collection)); err != nil {
+			return err
+		}
+		return createIndexes(ctx, db, dailyAggregatesIndex)
+	},
+	Down: func(ctx context.Context, db *mongo.Database) error {
+		return dropIndexes(ctx, db, dailyAggregatesIndex)
+	},
+}
+
+var dailyAggregatesIndex = index{"daily_aggregates", mongo.IndexModel{
+	Keys:    bson.D{{Key: "restaurantId", Value: 1}, {Key: "day", Value: 1}},
+	Options: options.Index().SetUnique(true),
+}}
+
+// mergeDuplicateAggregates folds the documents of each restaurant's day into the oldest one.
+// Like every migration, it runs before the consumers write again.
+func mergeDuplicateAggregates(ctx context.Context, aggregates *mongo.Collection) error {
+	cursor, err := aggregates.Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$group", Value: bson.D{
+			{Key: "_id", Value: bson.D{{Key: "restaurantId", Value: "$restaurantId"}, {Key: "day", Value: "$day"}}},
+			{Key: "ids", Value: bson.D{{Key: "$push", Value: "$_id"}}},
+			{Key: "count", Value: bson.D{{Key: "$sum", Value: 1}}},
+		}}},
+		{{Key: "$match", Value: bson.D{{Key: "count", Value: bson.D{{Key: "$gt", Value: 1}}}}}},
+	}, options.Aggregate().SetAllowDiskUse(true))
+	if err != nil {
+		return err
+	}
+	var groups []struct {
+		IDs []any `bson:"ids"`
+	}
+	if err := cursor.All(ctx, &groups); err != nil {
+		return err
+	}
+	for _, group := range groups {
+		cursor, err := aggregates.Find(ctx, bson.M{"_id": bson.M{"$in": group.IDs}}, options.Find().SetSort(bson.D{{Key: "_id", Value: 1}}))
+		if err != nil {
+			return err
+		}
+		var docs []bson.D
+		if err := cursor.All(ctx, &docs); err != nil {
+			return err
+		}
+		if len(docs) < 2 {
+			continue
+		}
+		// the days counted before amounts were in minor units are converted first, so that
+		// the sums don't mix units
+		for i, doc := range docs {
+			if docs[i], err = toMinorUnits(doc, legacyAggregates, money.DefaultCurrency); err != nil {
+				return fmt.Errorf("daily aggregate %v: %w", idOf(doc), err)
+			}
+		}
+		merged, err := mergeAggregates(docs)
+		if err != nil {
+			return err
+		}
+		keep := idOf(docs[0])
+		if _, err := aggregates.ReplaceOne(ctx, bson.M{"_id": keep}, merged); err != nil {
+			return err
+		}
+		rest := make(bson.A, 0, len(docs)-1)
+		for _, doc := range docs[1:] {
+			rest = append(rest, idOf(doc))
+		}
+		if _, err := aggregates.DeleteMany(ctx, bson.M{"_id": bson.M{"$in": rest}}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// mergeAggregates sums the counters of docs, the aggregates of one restaurant's day, into the
+// first of them; the other fields are the first document's, or the first one that has them
+func mergeAggregates(docs []bson.D) (bson.D, error) {
+	merged := append(bson.D(nil), docs[0]...)
+	at := make(map[string]int, len(merged))
+	for i, e := range merged {
+		at[e.Key] = i
+	}
+	for _, doc := range docs[1:] {
+		for _, e := range doc {
+			i, ok := at[e.Key]
+			if !ok {
+				at[e.Key] = len(merged)
+				merged = append(merged, e)
+				continue
+			}
+			if !isCounter(e.Key) {
+				continue
+			}
+			sum, err := add(merged[i].Value, e.Value)
+			if err != nil {
+				return nil, fmt.Errorf("daily aggregate %v, %s: %w", idOf(docs[0]), e.Key, err)
+			}
+			merged[i].Value = sum
+		}
+	}
+	return merged, nil
+}
+
+func idOf(doc bson.D) any {
+	return valueOf(doc, "_id")
+}
+
+// isCounter reports whether the field of an aggregate is summed; the others identify it
+func isCounter(key string) bool {
+	switch key {
+	case "_id", "restaurantId", "day", "currency":
+		return false
+	}
+	return true
+}
+
+// add sums two BSON numbers, keeping integers integral
+func add(a, b any) (any, error) {
+	switch {
+	case a == nil:
+		return b, nil
+	case b == nil:
+		return a, nil
+	}
+	x, xInt, err := number(a)
+	if err != nil {
+		return nil, err
+	}
+	y, yInt, err := number(b)
+	if err != nil {
+		return nil, err
+	}
+	if xInt != nil && yInt != nil {
+		return *xInt + *yInt, nil
+	}
+	return x + y, nil
+}
+
+// number is v as a float, and as an integer when it is one
+func number(v any) (float64, *int64, error) {
+	switch n := v.(type) {
+	case int32:
+		i := int64(n)
+		return float64(n), &i, nil
+	case int64:
+		return float64(n), &n, nil
+	case float64:
+		return n, nil, nil
+	}
+	return 0, nil, fmt.Errorf("%T is not a number", v)
+}
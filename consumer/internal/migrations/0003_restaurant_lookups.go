@@ -0,0 +1,26 @@
+package migrations
+
+import (
+	"context"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// restaurantLookups index the collections read by restaurant: items, joined to every restaurant
+// of the restaurant listing, and the active promotions of the pricing engine
+var restaurantLookups = Migration{
+	Version: 3,
+	Name:    "items_and_promotions_by_restaurant",
+	Up: func(ctx context.Context, db *mongo.Database) error {
+		return createIndexes(ctx, db, restaurantLookupIndexes...)
+	},
+	Down: func(ctx context.Context, db *mongo.Database) error {
+		return dropIndexes(ctx, db, restaurantLookupIndexes...)
+	},
+}
+
+var restaurantLookupIndexes = []index{
+	{"items", mongo.IndexModel{Keys: bson.D{{Key: "restaurantId", Value: 1}}}},
+	{"promotions", mongo.IndexModel{Keys: bson.D{{Key: "restaurantId", Value: 1}, {Key: "active", Value: 1}}}},
+}
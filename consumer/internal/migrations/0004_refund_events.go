@@ -0,0 +1,27 @@
+package migrations
+
+import (
+	"context"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// refundEvents recognizes redelivered refund events by their event ID, as orders are; refunds
+// stored before they recorded it have none
+var refundEvents = Migration{
+	Version: 4,
+	Name:    "refunds_event_id_unique",
+	Up: func(ctx context.Context, db *mongo.Database) error {
+		return createIndexes(ctx, db, refundEventIndex)
+	},
+	Down: func(ctx context.Context, db *mongo.Database) error {
+		return dropIndexes(ctx, db, refundEventIndex)
+	},
+}
+
+var refundEventIndex = index{"refunds", mongo.IndexModel{
+	Keys:    bson.D{{Key: "eventId", Value: 1}},
+	Options: options.Index().SetUnique(true).SetSparse(true),
+}}
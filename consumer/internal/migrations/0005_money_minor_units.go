@@ -0,0 +1,227 @@
+package migrations
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strings"
+
+	"contracts/money"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// moneyMinorUnits converts the amounts written before they were stored in minor units: doubles
+// in major units, and bare doubles where there is now a {amount, currency} document. Reading
+// them no longer guesses the unit from the BSON type, and the daily aggregates' $inc no longer
+// adds minor units to them.
+var moneyMinorUnits = Migration{
+	Version: 5,
+	Name:    "money_minor_units",
+	Up: func(ctx context.Context, db *mongo.Database) error {
+		currencies, err := restaurantCurrencies(ctx, db)
+		if err != nil {
+			return err
+		}
+		for _, amounts := range legacyMoney {
+			if err := convertLegacyMoney(ctx, db.Collection(amounts.collection), amounts, currencies); err != nil {
+				return fmt.Errorf("%s: %w", amounts.collection, err)
+			}
+		}
+		return nil
+	},
+	// the documents stay in minor units, which the previous release reads as well
+	Down: func(context.Context, *mongo.Database) error { return nil },
+}
+
+// legacyAmounts are the fields of a collection that held doubles in major units. Paths go through
+// arrays, as in queries.
+type legacyAmounts struct {
+	collection string
+	// money fields are {amount, currency} documents now, amounts bare minor units
+	money, amounts []string
+	// the documents' currency is their own currency field, filled in when missing, or their
+	// restaurant's; without either, amounts predate currencies and are in the default one
+	ownCurrency, byRestaurant bool
+}
+
+var legacyMoney = []legacyAmounts{
+	{
+		collection:  "orders",
+		money:       []string{"totalPrice", "totalCost", "refundedTotal"},
+		amounts:     []string{"items.unitPrice", "items.unitCost", "items.modifiers.priceDelta", "items.modifiers.costDelta"},
+		ownCurrency: true,
+	},
+	{
+		collection: "refunds",
+		money:      []string{"amount", "tax", "tip", "cost"},
+		amounts:    []string{"items.amount", "items.cost"},
+	},
+	{
+		collection:   "items",
+		money:        []string{"price", "cost"},
+		amounts:      []string{"modifierGroups.options.priceDelta", "modifierGroups.options.costDelta"},
+		byRestaurant: true,
+	},
+	legacyAggregates,
+}
+
+var legacyAggregates = legacyAmounts{
+	collection:  "daily_aggregates",
+	amounts:     []string{"revenue", "discounts", "tax", "tips", "cost", "refunds"},
+	ownCurrency: true,
+}
+
+func restaurantCurrencies(ctx context.Context, db *mongo.Database) (map[primitive.ObjectID]string, error) {
+	cursor, err := db.Collection("restaurants").Find(ctx, bson.M{})
+	if err != nil {
+		return nil, err
+	}
+	var restaurants []struct {
+		ID       primitive.ObjectID `bson:"_id"`
+		Currency string             `bson:"currency"`
+	}
+	if err := cursor.All(ctx, &restaurants); err != nil {
+		return nil, err
+	}
+	currencies := make(map[primitive.ObjectID]string, len(restaurants))
+	for _, r := range restaurants {
+		if r.Currency != "" {
+			currencies[r.ID] = r.Currency
+		}
+	}
+	return currencies, nil
+}
+
+// convertLegacyMoney rewrites the documents holding any of the legacy doubles
+func convertLegacyMoney(ctx context.Context, collection *mongo.Collection, amounts legacyAmounts, currencies map[primitive.ObjectID]string) error {
+	var legacy bson.A
+	for _, path := range append(append([]string(nil), amounts.money...), amounts.amounts...) {
+		legacy = append(legacy, bson.M{path: bson.M{"$type": "double"}})
+	}
+	cursor, err := collection.Find(ctx, bson.M{"$or": legacy})
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+	for cursor.Next(ctx) {
+		var doc bson.D
+		if err := cursor.Decode(&doc); err != nil {
+			return err
+		}
+		currency := money.DefaultCurrency
+		if amounts.byRestaurant {
+			if restaurantID, ok := valueOf(doc, "restaurantId").(primitive.ObjectID); ok && currencies[restaurantID] != "" {
+				currency = currencies[restaurantID]
+			}
+		}
+		converted, err := toMinorUnits(doc, amounts, currency)
+		if err != nil {
+			return fmt.Errorf("%v: %w", idOf(doc), err)
+		}
+		if _, err := collection.ReplaceOne(ctx, bson.M{"_id": idOf(doc)}, converted); err != nil {
+			return err
+		}
+	}
+	return cursor.Err()
+}
+
+// toMinorUnits returns doc with its legacy doubles converted, in currency unless the document
+// has its own
+func toMinorUnits(doc bson.D, amounts legacyAmounts, currency string) (bson.D, error) {
+	doc = append(bson.D(nil), doc...)
+	if amounts.ownCurrency {
+		if c, ok := valueOf(doc, "currency").(string); ok && c != "" {
+			currency = c
+		} else {
+			doc = setValue(doc, "currency", currency)
+		}
+	}
+	scale := math.Pow10(money.Exponent(currency))
+	minor := func(v any) (any, error) {
+		f, ok := v.(float64)
+		if !ok {
+			return v, nil
+		}
+		if math.IsNaN(f) || math.IsInf(f, 0) {
+			return nil, fmt.Errorf("%v is not an amount", f)
+		}
+		return int64(math.Round(f * scale)), nil
+	}
+	withCurrency := func(v any) (any, error) {
+		if _, ok := v.(float64); !ok {
+			return v, nil
+		}
+		amount, err := minor(v)
+		if err != nil {
+			return nil, err
+		}
+		return bson.D{{Key: "amount", Value: amount}, {Key: "currency", Value: currency}}, nil
+	}
+
+	var out any = doc
+	var err error
+	for _, path := range amounts.money {
+		if out, err = convertPath(out, strings.Split(path, "."), withCurrency); err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+	}
+	for _, path := range amounts.amounts {
+		if out, err = convertPath(out, strings.Split(path, "."), minor); err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+	}
+	return out.(bson.D), nil
+}
+
+// convertPath replaces the values at path in v, through documents and arrays, with convert's
+func convertPath(v any, path []string, convert func(any) (any, error)) (any, error) {
+	switch v := v.(type) {
+	case bson.D:
+		out := append(bson.D(nil), v...)
+		for i, e := range out {
+			if e.Key != path[0] {
+				continue
+			}
+			var err error
+			if len(path) == 1 {
+				out[i].Value, err = convert(e.Value)
+			} else {
+				out[i].Value, err = convertPath(e.Value, path[1:], convert)
+			}
+			return out, err
+		}
+		return out, nil
+	case bson.A:
+		out := make(bson.A, len(v))
+		for i, item := range v {
+			var err error
+			if out[i], err = convertPath(item, path, convert); err != nil {
+				return nil, err
+			}
+		}
+		return out, nil
+	}
+	return v, nil
+}
+
+func valueOf(doc bson.D, key string) any {
+	for _, e := range doc {
+		if e.Key == key {
+			return e.Value
+		}
+	}
+	return nil
+}
+
+func setValue(doc bson.D, key string, value any) bson.D {
+	for i, e := range doc {
+		if e.Key == key {
+			doc[i].Value = value
+			return doc
+		}
+	}
+	return append(doc, bson.E{Key: key, Value: value})
+}
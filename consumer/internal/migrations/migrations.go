@@ -0,0 +1,279 @@
+// Package migrations versions the database schema: the indexes the services' queries rely on,
+// and any data changes that come with them. Migrations are applied in version order and
+// recorded in the schema_migrations collection, one document per applied version.
+package migrations
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"sort"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Collection records the applied migrations, and holds the lock of the runner applying them
+const Collection = "schema_migrations"
+
+// Migration is one step of the schema. Down undoes Up, so that a release can be rolled back.
+type Migration struct {
+	Version int
+	Name    string
+	Up      func(ctx context.Context, db *mongo.Database) error
+	Down    func(ctx context.Context, db *mongo.Database) error
+}
+
+// All is every migration in version order. A new one goes in its own file, named after its
+// version, and is appended here with the next version; applied ones are never edited.
+var All = []Migration{
+	baselineIndexes,
+	dailyAggregatesUnique,
+	restaurantLookups,
+	refundEvents,
+	moneyMinorUnits,
+}
+
+// record is the schema_migrations document of an applied migration
+type record struct {
+	Version   int       `bson:"_id"`
+	Name      string    `bson:"name"`
+	AppliedAt time.Time `bson:"appliedAt"`
+}
+
+// Status is a migration and whether it's applied. Applied versions this build doesn't know,
+// written by a newer one, are listed with Unknown set.
+type Status struct {
+	Version   int
+	Name      string
+	AppliedAt *time.Time
+	Unknown   bool
+}
+
+type Runner struct {
+	db         *mongo.Database
+	col        *mongo.Collection
+	migrations []Migration
+	log        *slog.Logger
+}
+
+func NewRunner(db *mongo.Database, migrations []Migration, logger *slog.Logger) (*Runner, error) {
+	if err := check(migrations); err != nil {
+		return nil, err
+	}
+	return &Runner{db: db, col: db.Collection(Collection), migrations: migrations, log: logger}, nil
+}
+
+// check requires complete migrations in increasing version order
+func check(migrations []Migration) error {
+	for i, m := range migrations {
+		if m.Version <= 0 || m.Name == "" || m.Up == nil || m.Down == nil {
+			return fmt.Errorf("migration %d %q is incomplete", m.Version, m.Name)
+		}
+		if i > 0 && m.Version <= migrations[i-1].Version {
+			return fmt.Errorf("migration %d %q is out of order", m.Version, m.Name)
+		}
+	}
+	return nil
+}
+
+// applied returns the applied migrations by version
+func (r *Runner) applied(ctx context.Context) (map[int]record, error) {
+	cursor, err := r.col.Find(ctx, bson.M{"_id": bson.M{"$type": "number"}})
+	if err != nil {
+		return nil, err
+	}
+	var records []record
+	if err := cursor.All(ctx, &records); err != nil {
+		return nil, err
+	}
+	applied := make(map[int]record, len(records))
+	for _, rec := range records {
+		applied[rec.Version] = rec
+	}
+	return applied, nil
+}
+
+func (r *Runner) Status(ctx context.Context) ([]Status, error) {
+	applied, err := r.applied(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var out []Status
+	for _, m := range r.migrations {
+		s := Status{Version: m.Version, Name: m.Name}
+		if rec, ok := applied[m.Version]; ok {
+			s.AppliedAt = &rec.AppliedAt
+			delete(applied, m.Version)
+		}
+		out = append(out, s)
+	}
+	for _, rec := range applied {
+		out = append(out, Status{Version: rec.Version, Name: rec.Name, AppliedAt: &rec.AppliedAt, Unknown: true})
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Version < out[j].Version })
+	return out, nil
+}
+
+// Up applies the pending migrations up to version target, or all of them when target is 0,
+// and returns how many it applied
+func (r *Runner) Up(ctx context.Context, target int) (int, error) {
+	unlock, err := r.lock(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer unlock()
+
+	applied, err := r.applied(ctx)
+	if err != nil {
+		return 0, err
+	}
+	n := 0
+	for _, m := range r.migrations {
+		if target > 0 && m.Version > target {
+			break
+		}
+		if _, ok := applied[m.Version]; ok {
+			continue
+		}
+		start := time.Now()
+		if err := m.Up(ctx, r.db); err != nil {
+			return n, fmt.Errorf("migration %d %s: %w", m.Version, m.Name, err)
+		}
+		if _, err := r.col.InsertOne(ctx, record{Version: m.Version, Name: m.Name, AppliedAt: time.Now().UTC()}); err != nil {
+			return n, fmt.Errorf("migration %d %s applied but not recorded: %w", m.Version, m.Name, err)
+		}
+		r.log.Info("migration applied", "version", m.Version, "name", m.Name, "duration", time.Since(start))
+		n++
+	}
+	return n, nil
+}
+
+// Down reverts the last steps applied migrations, newest first, and returns how many it reverted
+func (r *Runner) Down(ctx context.Context, steps int) (int, error) {
+	unlock, err := r.lock(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer unlock()
+
+	applied, err := r.applied(ctx)
+	if err != nil {
+		return 0, err
+	}
+	n := 0
+	for i := len(r.migrations) - 1; i >= 0 && n < steps; i-- {
+		m := r.migrations[i]
+		if _, ok := applied[m.Version]; !ok {
+			continue
+		}
+		if err := m.Down(ctx, r.db); err != nil {
+			return n, fmt.Errorf("reverting migration %d %s: %w", m.Version, m.Name, err)
+		}
+		if _, err := r.col.DeleteOne(ctx, bson.M{"_id": m.Version}); err != nil {
+			return n, fmt.Errorf("migration %d %s reverted but still recorded: %w", m.Version, m.Name, err)
+		}
+		r.log.Info("migration reverted", "version", m.Version, "name", m.Name)
+		n++
+	}
+	return n, nil
+}
+
+const (
+	lockID = "lock"
+	// lockTTL is when a lock is considered abandoned by a runner that died while holding it
+	lockTTL       = 10 * time.Minute
+	lockRetryWait = time.Second
+)
+
+// lock keeps other instances from migrating at the same time, e.g. replicas starting together;
+// it waits for the lock until ctx is done
+func (r *Runner) lock(ctx context.Context) (func(), error) {
+	host, _ := os.Hostname()
+	owner := fmt.Sprintf("%s-%d-%d", host, os.Getpid(), time.Now().UnixNano())
+	for waiting := false; ; waiting = true {
+		_, err := r.col.InsertOne(ctx, bson.M{"_id": lockID, "owner": owner, "lockedAt": time.Now().UTC()})
+		if err == nil {
+			break
+		}
+		if !mongo.IsDuplicateKeyError(err) {
+			return nil, fmt.Errorf("locking %s: %w", Collection, err)
+		}
+		// take over an abandoned lock
+		res, err := r.col.DeleteOne(ctx, bson.M{"_id": lockID, "lockedAt": bson.M{"$lt": time.Now().Add(-lockTTL)}})
+		if err != nil {
+			return nil, fmt.Errorf("locking %s: %w", Collection, err)
+		}
+		if res.DeletedCount > 0 {
+			r.log.Warn("took over an abandoned migration lock")
+			continue
+		}
+		if !waiting {
+			r.log.Info("waiting for the migration lock held by another instance")
+		}
+		select {
+		case <-ctx.Done():
+			return nil, fmt.Errorf("locking %s: %w", Collection, ctx.Err())
+		case <-time.After(lockRetryWait):
+		}
+	}
+	return func() {
+		_, err := r.col.DeleteOne(context.WithoutCancel(ctx), bson.M{"_id": lockID, "owner": owner})
+		if err != nil {
+			r.log.Error("failed to release the migration lock", "error", err)
+		}
+	}, nil
+}
+
+// index is an index of a collection, created by a migration's Up and dropped by its Down
+type index struct {
+	collection string
+	model      mongo.IndexModel
+}
+
+// createIndexes builds the indexes. An index that already exists with the same keys and
+// options, e.g. one created before migrations, is left as it is.
+func createIndexes(ctx context.Context, db *mongo.Database, indexes ...index) error {
+	for _, idx := range indexes {
+		if _, err := db.Collection(idx.collection).Indexes().CreateOne(ctx, idx.model); err != nil {
+			return fmt.Errorf("index %s on %s: %w", indexName(idx.model.Keys.(bson.D)), idx.collection, err)
+		}
+	}
+	return nil
+}
+
+// dropIndexes drops the indexes by their default names; missing ones are skipped
+func dropIndexes(ctx context.Context, db *mongo.Database, indexes ...index) error {
+	for _, idx := range indexes {
+		name := indexName(idx.model.Keys.(bson.D))
+		_, err := db.Collection(idx.collection).Indexes().DropOne(ctx, name)
+		var cmdErr mongo.CommandError
+		if errors.As(err, &cmdErr) && (cmdErr.Code == codeIndexNotFound || cmdErr.Code == codeNamespaceNotFound) {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("index %s on %s: %w", name, idx.collection, err)
+		}
+	}
+	return nil
+}
+
+const (
+	codeNamespaceNotFound = 26
+	codeIndexNotFound     = 27
+)
+
+// indexName is the name MongoDB gives an index by default, e.g. restaurantId_1_day_1
+func indexName(keys bson.D) string {
+	name := ""
+	for i, k := range keys {
+		if i > 0 {
+			name += "_"
+		}
+		name += fmt.Sprintf("%s_%v", k.Key, k.Value)
+	}
+	return name
+}
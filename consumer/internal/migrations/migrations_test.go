@@ -0,0 +1,212 @@
+package migrations
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+
+	dbconn "consumer/internal/db"
+	"contracts/mongoconn"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+func TestAllInOrder(t *testing.T) {
+	if err := check(All); err != nil {
+		t.Fatal(err)
+	}
+	noop := func(context.Context, *mongo.Database) error { return nil }
+	if err := check([]Migration{{Version: 2, Name: "b", Up: noop, Down: noop}, {Version: 1, Name: "a", Up: noop, Down: noop}}); err == nil {
+		t.Error("out of order migrations should be refused")
+	}
+}
+
+func TestIndexName(t *testing.T) {
+	if got := indexName(dailyAggregatesIndex.model.Keys.(bson.D)); got != "restaurantId_1_day_1" {
+		t.Errorf("got %q", got)
+	}
+}
+
+func TestMergeAggregates(t *testing.T) {
+	day := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	merged, err := mergeAggregates([]bson.D{
+		{{Key: "_id", Value: "a"}, {Key: "restaurantId", Value: "r1"}, {Key: "day", Value: day}, {Key: "currency", Value: "USD"},
+			{Key: "totalOrders", Value: int32(2)}, {Key: "revenue", Value: int64(1500)}},
+		{{Key: "_id", Value: "b"}, {Key: "restaurantId", Value: "r1"}, {Key: "day", Value: day}, {Key: "currency", Value: "USD"},
+			{Key: "totalOrders", Value: int64(1)}, {Key: "revenue", Value: int64(700)}, {Key: "refunds", Value: int64(200)}},
+		{{Key: "_id", Value: "c"}, {Key: "restaurantId", Value: "r1"}, {Key: "day", Value: day},
+			{Key: "totalOrders", Value: int32(3)}, {Key: "tips", Value: int64(150)}, {Key: "revenue", Value: int64(50)}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := bson.D{{Key: "_id", Value: "a"}, {Key: "restaurantId", Value: "r1"}, {Key: "day", Value: day}, {Key: "currency", Value: "USD"},
+		{Key: "totalOrders", Value: int64(6)}, {Key: "revenue", Value: int64(2250)}, {Key: "refunds", Value: int64(200)}, {Key: "tips", Value: int64(150)}}
+	if !reflect.DeepEqual(merged, want) {
+		t.Errorf("merged %v, want %v", merged, want)
+	}
+
+	if _, err := mergeAggregates([]bson.D{{{Key: "revenue", Value: int64(1)}}, {{Key: "revenue", Value: "1"}}}); err == nil {
+		t.Error("a counter that isn't a number should fail the merge")
+	}
+}
+
+func TestToMinorUnits(t *testing.T) {
+	usd := func(amount int64) bson.D {
+		return bson.D{{Key: "amount", Value: amount}, {Key: "currency", Value: "USD"}}
+	}
+	cases := []struct {
+		name     string
+		amounts  legacyAmounts
+		currency string
+		doc      bson.D
+		want     bson.D
+	}{
+		{"order", legacyMoney[0], "USD", bson.D{
+			{Key: "totalPrice", Value: 12.5},
+			{Key: "items", Value: bson.A{
+				bson.D{{Key: "unitPrice", Value: 4.25}, {Key: "modifiers", Value: bson.A{bson.D{{Key: "priceDelta", Value: 0.5}}}}},
+				bson.D{{Key: "unitPrice", Value: int64(300)}},
+			}},
+			{Key: "tip", Value: int64(150)},
+		}, bson.D{
+			{Key: "totalPrice", Value: usd(1250)},
+			{Key: "items", Value: bson.A{
+				bson.D{{Key: "unitPrice", Value: int64(425)}, {Key: "modifiers", Value: bson.A{bson.D{{Key: "priceDelta", Value: int64(50)}}}}},
+				bson.D{{Key: "unitPrice", Value: int64(300)}},
+			}},
+			{Key: "tip", Value: int64(150)},
+			{Key: "currency", Value: "USD"},
+		}},
+		{"item of a restaurant with a currency", legacyMoney[2], "EUR",
+			bson.D{{Key: "price", Value: 9.99}, {Key: "cost", Value: bson.D{{Key: "amount", Value: int64(400)}, {Key: "currency", Value: "EUR"}}}},
+			bson.D{{Key: "price", Value: bson.D{{Key: "amount", Value: int64(999)}, {Key: "currency", Value: "EUR"}}}, {Key: "cost", Value: bson.D{{Key: "amount", Value: int64(400)}, {Key: "currency", Value: "EUR"}}}},
+		},
+		{"aggregate in its own currency", legacyAggregates, "USD",
+			bson.D{{Key: "currency", Value: "JPY"}, {Key: "totalOrders", Value: int32(2)}, {Key: "revenue", Value: 1200.0}},
+			bson.D{{Key: "currency", Value: "JPY"}, {Key: "totalOrders", Value: int32(2)}, {Key: "revenue", Value: int64(1200)}},
+		},
+	}
+	for _, c := range cases {
+		got, err := toMinorUnits(c.doc, c.amounts, c.currency)
+		if err != nil {
+			t.Fatalf("%s: %v", c.name, err)
+		}
+		if !reflect.DeepEqual(got, c.want) {
+			t.Errorf("%s: got %v, want %v", c.name, got, c.want)
+		}
+	}
+}
+
+// TestUpDown applies and reverts every migration against a throwaway database of the server at
+// MONGODB_TEST_URI:
+//
+//	MONGODB_TEST_URI=mongodb://localhost:27017 go test ./internal/migrations -v
+func TestUpDown(t *testing.T) {
+	uri := os.Getenv("MONGODB_TEST_URI")
+	if uri == "" {
+		t.Skip("MONGODB_TEST_URI not set")
+	}
+	ctx := context.Background()
+	cfg := mongoconn.Default(fmt.Sprintf("migrations_%d", time.Now().UnixNano()))
+	cfg.URI = uri
+	client, db, err := dbconn.Connect(ctx, cfg, slog.Default())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = db.Drop(ctx)
+		_ = client.Disconnect(ctx)
+	}()
+
+	// concurrent upserts of a new day, before the unique index, left duplicates behind, one of
+	// them counted in dollars before amounts were in minor units
+	aggregates := db.Collection("daily_aggregates")
+	duplicated := time.Date(2023, 12, 31, 0, 0, 0, 0, time.UTC)
+	for _, totals := range []bson.M{{"totalOrders": int64(2), "revenue": int64(1500)}, {"totalOrders": int64(1), "revenue": 7.0}} {
+		totals["restaurantId"], totals["day"], totals["currency"] = "r1", duplicated, "USD"
+		if _, err := aggregates.InsertOne(ctx, totals); err != nil {
+			t.Fatal(err)
+		}
+	}
+	legacyOrder, err := db.Collection("orders").InsertOne(ctx, bson.M{"totalPrice": 12.5, "items": bson.A{bson.M{"unitPrice": 6.25, "quantity": 2}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	runner, err := NewRunner(db, All, slog.Default())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n, err := runner.Up(ctx, 2); err != nil || n != 2 {
+		t.Fatalf("up to 2 applied %d: %v", n, err)
+	}
+	var merged []struct {
+		TotalOrders int64 `bson:"totalOrders"`
+		Revenue     int64 `bson:"revenue"`
+	}
+	cursor, err := aggregates.Find(ctx, bson.M{"restaurantId": "r1", "day": duplicated})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cursor.All(ctx, &merged); err != nil {
+		t.Fatal(err)
+	}
+	if len(merged) != 1 || merged[0].TotalOrders != 3 || merged[0].Revenue != 2200 {
+		t.Errorf("duplicates merged into %+v, want one aggregate of 3 orders and 2200", merged)
+	}
+	if n, err := runner.Up(ctx, 0); err != nil || n != len(All)-2 {
+		t.Fatalf("up applied %d: %v", n, err)
+	}
+	statuses, err := runner.Status(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range statuses {
+		if s.AppliedAt == nil || s.Unknown {
+			t.Errorf("unexpected status %+v", s)
+		}
+	}
+
+	// legacy amounts are in minor units
+	var order struct {
+		Currency   string `bson:"currency"`
+		TotalPrice struct {
+			Amount   int64  `bson:"amount"`
+			Currency string `bson:"currency"`
+		} `bson:"totalPrice"`
+		Items []struct {
+			UnitPrice int64 `bson:"unitPrice"`
+		} `bson:"items"`
+	}
+	if err := db.Collection("orders").FindOne(ctx, bson.M{"_id": legacyOrder.InsertedID}).Decode(&order); err != nil {
+		t.Fatal(err)
+	}
+	if order.Currency != "USD" || order.TotalPrice.Amount != 1250 || order.TotalPrice.Currency != "USD" || order.Items[0].UnitPrice != 625 {
+		t.Errorf("legacy order converted to %+v", order)
+	}
+
+	// the unique daily aggregate refuses a second document for a restaurant's day
+	day := bson.M{"restaurantId": "r1", "day": time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+	if _, err := aggregates.InsertOne(ctx, day); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := aggregates.InsertOne(ctx, day); err == nil {
+		t.Error("duplicate daily aggregate inserted")
+	}
+
+	if n, err := runner.Down(ctx, len(All)); err != nil || n != len(All) {
+		t.Fatalf("down reverted %d: %v", n, err)
+	}
+	if n, err := runner.Up(ctx, 0); err != nil || n != len(All) {
+		t.Fatalf("up after down applied %d: %v", n, err)
+	}
+	if n, _ := db.Collection(Collection).CountDocuments(ctx, bson.M{"_id": lockID}); n != 0 {
+		t.Error("the lock was not released")
+	}
+}
@@ -1,12 +1,18 @@
 package models
 
-import "go.mongodb.org/mongo-driver/bson/primitive"
+import (
+	"contracts/money"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
 
 type Item struct {
 	ID           primitive.ObjectID `bson:"_id,omitempty" json:"id"`
 	Name         string             `bson:"name" json:"name"`
 	RestaurantID primitive.ObjectID `bson:"restaurantId" json:"restaurantId"`
-	Price        float64            `bson:"price" json:"price"`
-	Cost         float64            `bson:"cost" json:"cost"`
+	Price        money.Money        `bson:"price" json:"price"`
+	Cost         money.Money        `bson:"cost" json:"cost"`
 	Quantity     int                `bson:"quantity" json:"quantity"`
+
+	ModifierGroups []ModifierGroup `bson:"modifierGroups,omitempty" json:"modifierGroups,omitempty"`
 }
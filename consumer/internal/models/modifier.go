@@ -0,0 +1,32 @@
+package models
+
+import "contracts/money"
+
+// ModifierGroup is a set of choices offered on a menu item, e.g. "Cheese" or "Extras"
+type ModifierGroup struct {
+	ID       string `bson:"id" json:"id"`
+	Name     string `bson:"name" json:"name"`
+	Required bool   `bson:"required" json:"required"`
+	// MinSelections applies to required groups, or to optional ones once anything is picked
+	MinSelections int `bson:"minSelections" json:"minSelections"`
+	// MaxSelections of 0 means no limit
+	MaxSelections int              `bson:"maxSelections" json:"maxSelections"`
+	Options       []ModifierOption `bson:"options" json:"options"`
+}
+
+// ModifierOption deltas are in minor units of the item's currency
+type ModifierOption struct {
+	ID         string       `bson:"id" json:"id"`
+	Name       string       `bson:"name" json:"name"`
+	PriceDelta money.Amount `bson:"priceDelta" json:"priceDelta"`
+	CostDelta  money.Amount `bson:"costDelta" json:"costDelta"`
+}
+
+// OrderItemModifier is a selected modifier option, snapshotted when the order is placed
+type OrderItemModifier struct {
+	GroupID    string       `bson:"groupId" json:"groupId"`
+	OptionID   string       `bson:"optionId" json:"optionId"`
+	Name       string       `bson:"name" json:"name"`
+	PriceDelta money.Amount `bson:"priceDelta" json:"priceDelta"`
+	CostDelta  money.Amount `bson:"costDelta" json:"costDelta"`
+}
@@ -3,19 +3,62 @@ package models
 import (
 	"time"
 
+	"contracts/money"
+
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
+// Order statuses
+const (
+	OrderStatusPending           = "pending"
+	OrderStatusCancelled         = "cancelled"
+	OrderStatusPartiallyRefunded = "partially_refunded"
+	OrderStatusRefunded          = "refunded"
+)
+
 type Order struct {
 	ID           primitive.ObjectID `bson:"_id,omitempty" json:"id"`
 	RestaurantID primitive.ObjectID `bson:"restaurantId" json:"restaurantId"`
-	TotalPrice   float64            `bson:"totalPrice" json:"totalPrice"`
-	TotalCost    float64            `bson:"totalCost" json:"totalCost"`
+	Currency     string             `bson:"currency" json:"currency"`
+	TotalPrice   money.Money        `bson:"totalPrice" json:"totalPrice"`
+	TotalCost    money.Money        `bson:"totalCost" json:"totalCost"`
+	Status       string             `bson:"status" json:"status"`
 	CreationDate time.Time          `bson:"creationDate" json:"creationDate"`
 	Items        []OrderItem        `bson:"items" json:"items"`
+
+	PromoCode string          `bson:"promoCode,omitempty" json:"promoCode,omitempty"`
+	Tip       money.Amount    `bson:"tip,omitempty" json:"tip,omitempty"`
+	Pricing   *PriceBreakdown `bson:"pricing,omitempty" json:"pricing,omitempty"`
+
+	RefundedTotal      money.Money `bson:"refundedTotal,omitempty" json:"refundedTotal,omitempty"`
+	CancelledAt        *time.Time  `bson:"cancelledAt,omitempty" json:"cancelledAt,omitempty"`
+	CancellationReason string      `bson:"cancellationReason,omitempty" json:"cancellationReason,omitempty"`
+
+	// RequestID and TraceID identify the request that created the order, for support lookups
+	RequestID string `bson:"requestId,omitempty" json:"requestId,omitempty"`
+	TraceID   string `bson:"traceId,omitempty" json:"traceId,omitempty"`
+	// EventID is the ID of the event the order was created from; it is unique so that a
+	// redelivered event doesn't create the order twice
+	EventID string `bson:"eventId,omitempty" json:"-"`
+	// AggregatePending is set until the order has been counted in the daily aggregates
+	AggregatePending bool `bson:"aggregatePending,omitempty" json:"-"`
+	// Version is bumped by every cancellation and refund, which only apply to the version they
+	// were computed from; orders that never changed have none
+	Version int64 `bson:"version,omitempty" json:"-"`
 }
 
 type OrderItem struct {
 	ItemID   primitive.ObjectID `bson:"itemId" json:"id"`
 	Quantity int                `bson:"quantity" json:"quantity"`
+	// UnitPrice and UnitCost are in minor units of the order currency and include the modifier deltas
+	UnitPrice        money.Amount        `bson:"unitPrice" json:"unitPrice"`
+	UnitCost         money.Amount        `bson:"unitCost" json:"unitCost"`
+	Modifiers        []OrderItemModifier `bson:"modifiers,omitempty" json:"modifiers,omitempty"`
+	Notes            string              `bson:"notes,omitempty" json:"notes,omitempty"`
+	RefundedQuantity int                 `bson:"refundedQuantity,omitempty" json:"refundedQuantity,omitempty"`
+}
+
+// RemainingQuantity is how many units of the line have not been refunded yet
+func (it OrderItem) RemainingQuantity() int {
+	return it.Quantity - it.RefundedQuantity
 }
@@ -0,0 +1,51 @@
+package models
+
+import (
+	"contracts/money"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// PriceBreakdown is how an order's total was computed, in minor units of Currency
+type PriceBreakdown struct {
+	Currency         string            `bson:"currency" json:"currency"`
+	Lines            []PricedLine      `bson:"lines" json:"lines"`
+	Discounts        []AppliedDiscount `bson:"discounts,omitempty" json:"discounts,omitempty"`
+	Subtotal         money.Amount      `bson:"subtotal" json:"subtotal"`
+	Discount         money.Amount      `bson:"discount" json:"discount"`
+	ServiceCharge    money.Amount      `bson:"serviceCharge" json:"serviceCharge"`
+	Tax              money.Amount      `bson:"tax" json:"tax"`
+	Tip              money.Amount      `bson:"tip" json:"tip"`
+	Total            money.Amount      `bson:"total" json:"total"`
+	TaxRateBps       int64             `bson:"taxRateBps" json:"taxRateBps"`
+	ServiceChargeBps int64             `bson:"serviceChargeBps" json:"serviceChargeBps"`
+}
+
+// NetSales is what the restaurant earned before tax and tips
+func (b PriceBreakdown) NetSales() money.Amount {
+	return b.Subtotal - b.Discount + b.ServiceCharge
+}
+
+// PricedLine matches the order line at the same index
+type PricedLine struct {
+	ItemID        primitive.ObjectID `bson:"itemId" json:"itemId"`
+	Quantity      int                `bson:"quantity" json:"quantity"`
+	UnitPrice     money.Amount       `bson:"unitPrice" json:"unitPrice"`
+	Gross         money.Amount       `bson:"gross" json:"gross"`
+	Discount      money.Amount       `bson:"discount" json:"discount"`
+	ServiceCharge money.Amount       `bson:"serviceCharge" json:"serviceCharge"`
+	Tax           money.Amount       `bson:"tax" json:"tax"`
+	Total         money.Amount       `bson:"total" json:"total"`
+}
+
+// NetSales is the line's share of the order's net sales
+func (l PricedLine) NetSales() money.Amount {
+	return l.Gross - l.Discount + l.ServiceCharge
+}
+
+type AppliedDiscount struct {
+	PromotionID primitive.ObjectID `bson:"promotionId" json:"promotionId"`
+	Name        string             `bson:"name" json:"name"`
+	Code        string             `bson:"code,omitempty" json:"code,omitempty"`
+	Amount      money.Amount       `bson:"amount" json:"amount"`
+}
@@ -0,0 +1,46 @@
+package models
+
+import (
+	"time"
+
+	"contracts/money"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Promotion kinds
+const (
+	PromotionPercent = "percent"
+	PromotionFixed   = "fixed"
+)
+
+// Promotion is a restaurant discount. Promotions without a code apply automatically,
+// the others only when the order carries their promo code.
+type Promotion struct {
+	ID           primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	RestaurantID primitive.ObjectID `bson:"restaurantId" json:"restaurantId"`
+	Name         string             `bson:"name" json:"name"`
+	Code         string             `bson:"code,omitempty" json:"code,omitempty"`
+	Kind         string             `bson:"kind" json:"kind"`
+	// PercentBps is used by percent promotions (1000 = 10%), Amount by fixed ones
+	PercentBps  int64        `bson:"percentBps,omitempty" json:"percentBps,omitempty"`
+	Amount      money.Amount `bson:"amount,omitempty" json:"amount,omitempty"`
+	MinSubtotal money.Amount `bson:"minSubtotal,omitempty" json:"minSubtotal,omitempty"`
+	Active      bool         `bson:"active" json:"active"`
+	StartsAt    *time.Time   `bson:"startsAt,omitempty" json:"startsAt,omitempty"`
+	EndsAt      *time.Time   `bson:"endsAt,omitempty" json:"endsAt,omitempty"`
+}
+
+// AppliesAt reports whether the promotion is active at t
+func (p Promotion) AppliesAt(t time.Time) bool {
+	if !p.Active {
+		return false
+	}
+	if p.StartsAt != nil && t.Before(*p.StartsAt) {
+		return false
+	}
+	if p.EndsAt != nil && !t.Before(*p.EndsAt) {
+		return false
+	}
+	return true
+}
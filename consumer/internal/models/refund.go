@@ -0,0 +1,36 @@
+package models
+
+import (
+	"time"
+
+	"contracts/money"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type Refund struct {
+	ID           primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	OrderID      primitive.ObjectID `bson:"orderId" json:"orderId"`
+	RestaurantID primitive.ObjectID `bson:"restaurantId" json:"restaurantId"`
+	// Amount is what goes back to the customer, Tax and Tip included
+	Amount       money.Money  `bson:"amount" json:"amount"`
+	Tax          money.Money  `bson:"tax" json:"tax"`
+	Tip          money.Money  `bson:"tip" json:"tip"`
+	Cost         money.Money  `bson:"cost" json:"cost"`
+	Reason       string       `bson:"reason,omitempty" json:"reason,omitempty"`
+	CreationDate time.Time    `bson:"creationDate" json:"creationDate"`
+	Items        []RefundItem `bson:"items" json:"items"`
+	// EventID is the ID of the event the refund was made for; it is unique so that a
+	// redelivered event doesn't refund twice
+	EventID string `bson:"eventId,omitempty" json:"-"`
+}
+
+// RefundItem amounts are in minor units of the refund currency. Line is the index of the
+// refunded order line, 0 on refunds recorded before lines were addressed by index.
+type RefundItem struct {
+	Line     int                `bson:"line" json:"line"`
+	ItemID   primitive.ObjectID `bson:"itemId" json:"id"`
+	Quantity int                `bson:"quantity" json:"quantity"`
+	Amount   money.Amount       `bson:"amount" json:"amount"`
+	Cost     money.Amount       `bson:"cost" json:"cost"`
+}
@@ -1,8 +1,25 @@
 package models
 
-import "go.mongodb.org/mongo-driver/bson/primitive"
+import (
+	"contracts/money"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
 
 type Restaurant struct {
 	ID   primitive.ObjectID `bson:"_id,omitempty" json:"id"`
 	Name string             `bson:"name" json:"name"`
+	// Currency is the ISO 4217 code the restaurant's menu and orders are priced in
+	Currency string `bson:"currency" json:"currency"`
+	// Rates in basis points (825 = 8.25%)
+	TaxRateBps       int64 `bson:"taxRateBps" json:"taxRateBps"`
+	ServiceChargeBps int64 `bson:"serviceChargeBps" json:"serviceChargeBps"`
+}
+
+// CurrencyOrDefault is the restaurant currency, falling back for restaurants created before it was recorded
+func (r Restaurant) CurrencyOrDefault() string {
+	if r.Currency == "" {
+		return money.DefaultCurrency
+	}
+	return r.Currency
 }
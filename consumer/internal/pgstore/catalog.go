@@ -0,0 +1,152 @@
+package pgstore
+
+import (
+	"context"
+
+	"consumer/internal/models"
+	"consumer/internal/seed"
+
+	"github.com/jackc/pgx/v5"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Items is the items.Store of the items table
+type Items struct {
+	db *DB
+}
+
+func (s *Items) ListItems(ctx context.Context, ids []primitive.ObjectID) ([]models.Item, error) {
+	rows, err := s.db.conn(ctx).Query(ctx, `SELECT id, restaurant_id, name, price, price_currency, cost, cost_currency, quantity, modifier_groups
+		FROM items WHERE id = ANY($1)`, hexes(ids))
+	if err != nil {
+		return nil, err
+	}
+	return pgx.CollectRows(rows, func(row pgx.CollectableRow) (models.Item, error) {
+		var it models.Item
+		var id, restaurantID string
+		err := row.Scan(&id, &restaurantID, &it.Name, &it.Price.Amount, &it.Price.Currency, &it.Cost.Amount, &it.Cost.Currency, &it.Quantity, &it.ModifierGroups)
+		if err != nil {
+			return it, err
+		}
+		if len(it.ModifierGroups) == 0 {
+			it.ModifierGroups = nil
+		}
+		if it.ID, err = objectID(id); err != nil {
+			return it, err
+		}
+		it.RestaurantID, err = objectID(restaurantID)
+		return it, err
+	})
+}
+
+// Restaurants is the pricing.Store of the restaurants and promotions tables
+type Restaurants struct {
+	db *DB
+}
+
+func (s *Restaurants) Restaurants(ctx context.Context, ids []primitive.ObjectID) (map[primitive.ObjectID]models.Restaurant, error) {
+	rows, err := s.db.conn(ctx).Query(ctx, `SELECT id, name, currency, tax_rate_bps, service_charge_bps
+		FROM restaurants WHERE id = ANY($1)`, hexes(ids))
+	if err != nil {
+		return nil, err
+	}
+	restaurants, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (models.Restaurant, error) {
+		var r models.Restaurant
+		var id string
+		if err := row.Scan(&id, &r.Name, &r.Currency, &r.TaxRateBps, &r.ServiceChargeBps); err != nil {
+			return r, err
+		}
+		var err error
+		r.ID, err = objectID(id)
+		return r, err
+	})
+	if err != nil {
+		return nil, err
+	}
+	byID := make(map[primitive.ObjectID]models.Restaurant, len(restaurants))
+	for _, r := range restaurants {
+		byID[r.ID] = r
+	}
+	return byID, nil
+}
+
+func (s *Restaurants) Promotions(ctx context.Context, restaurantIDs []primitive.ObjectID) (map[primitive.ObjectID][]models.Promotion, error) {
+	rows, err := s.db.conn(ctx).Query(ctx, `SELECT id, restaurant_id, name, code, kind, percent_bps, amount, min_subtotal, active, starts_at, ends_at
+		FROM promotions WHERE restaurant_id = ANY($1) AND active ORDER BY id`, hexes(restaurantIDs))
+	if err != nil {
+		return nil, err
+	}
+	promotions, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (models.Promotion, error) {
+		var p models.Promotion
+		var id, restaurantID string
+		err := row.Scan(&id, &restaurantID, &p.Name, &p.Code, &p.Kind, &p.PercentBps, &p.Amount, &p.MinSubtotal, &p.Active, &p.StartsAt, &p.EndsAt)
+		if err != nil {
+			return p, err
+		}
+		p.StartsAt, p.EndsAt = utc(p.StartsAt), utc(p.EndsAt)
+		if p.ID, err = objectID(id); err != nil {
+			return p, err
+		}
+		p.RestaurantID, err = objectID(restaurantID)
+		return p, err
+	})
+	if err != nil {
+		return nil, err
+	}
+	byRestaurant := make(map[primitive.ObjectID][]models.Promotion, len(restaurantIDs))
+	for _, p := range promotions {
+		byRestaurant[p.RestaurantID] = append(byRestaurant[p.RestaurantID], p)
+	}
+	return byRestaurant, nil
+}
+
+// HasRestaurants, RestaurantNames and InsertMenus make the DB a seed.Store
+var _ seed.Store = (*DB)(nil)
+
+func (db *DB) HasRestaurants(ctx context.Context) (bool, error) {
+	var has bool
+	err := db.conn(ctx).QueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM restaurants)`).Scan(&has)
+	return has, err
+}
+
+func (db *DB) RestaurantNames(ctx context.Context, names []string) ([]string, error) {
+	rows, err := db.conn(ctx).Query(ctx, `SELECT DISTINCT name FROM restaurants WHERE name = ANY($1)`, names)
+	if err != nil {
+		return nil, err
+	}
+	return pgx.CollectRows(rows, pgx.RowTo[string])
+}
+
+// InsertMenus stores the restaurants before their items and promotions, in one transaction
+func (db *DB) InsertMenus(ctx context.Context, menus seed.Menus) error {
+	return db.InTx(ctx, func(ctx context.Context) error {
+		q := db.conn(ctx)
+		rows := make([][]any, len(menus.Restaurants))
+		for i, r := range menus.Restaurants {
+			rows[i] = []any{r.ID.Hex(), r.Name, r.Currency, r.TaxRateBps, r.ServiceChargeBps}
+		}
+		err := insert(ctx, q, `restaurants (id, name, currency, tax_rate_bps, service_charge_bps)`, `ON CONFLICT (id) DO NOTHING`, rows)
+		if err != nil {
+			return err
+		}
+
+		rows = make([][]any, len(menus.Items))
+		for i, it := range menus.Items {
+			groups := it.ModifierGroups
+			if groups == nil {
+				groups = []models.ModifierGroup{}
+			}
+			rows[i] = []any{it.ID.Hex(), it.RestaurantID.Hex(), it.Name, it.Price.Amount, it.Price.Currency, it.Cost.Amount, it.Cost.Currency, it.Quantity, groups}
+		}
+		err = insert(ctx, q, `items (id, restaurant_id, name, price, price_currency, cost, cost_currency, quantity, modifier_groups)`, `ON CONFLICT (id) DO NOTHING`, rows)
+		if err != nil {
+			return err
+		}
+
+		rows = make([][]any, len(menus.Promotions))
+		for i, p := range menus.Promotions {
+			rows[i] = []any{p.ID.Hex(), p.RestaurantID.Hex(), p.Name, p.Code, p.Kind, p.PercentBps, p.Amount, p.MinSubtotal, p.Active, p.StartsAt, p.EndsAt}
+		}
+		return insert(ctx, q, `promotions (id, restaurant_id, name, code, kind, percent_bps, amount, min_subtotal, active, starts_at, ends_at)`, `ON CONFLICT (id) DO NOTHING`, rows)
+	})
+}
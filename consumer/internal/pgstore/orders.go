@@ -0,0 +1,315 @@
+package pgstore
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"time"
+
+	"consumer/internal/features/orders"
+	"consumer/internal/models"
+	"contracts/money"
+
+	"github.com/jackc/pgx/v5"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Orders is the orders.OrderStore of the orders and refunds tables
+type Orders struct {
+	db *DB
+}
+
+const orderColumns = `id, restaurant_id, currency, total_price, total_cost, status, creation_date, items,
+	promo_code, tip, pricing, refunded_total, cancelled_at, cancellation_reason, request_id, trace_id,
+	event_id, aggregate_pending, version`
+
+// orderValues are the order's orderColumns; lines and pricing are stored as JSON
+func orderValues(o *models.Order) []any {
+	items := o.Items
+	if items == nil {
+		items = []models.OrderItem{}
+	}
+	var eventID *string
+	if o.EventID != "" {
+		eventID = &o.EventID
+	}
+	return []any{
+		o.ID.Hex(), o.RestaurantID.Hex(), o.Currency, o.TotalPrice.Amount, o.TotalCost.Amount, o.Status, o.CreationDate, items,
+		o.PromoCode, o.Tip, o.Pricing, o.RefundedTotal.Amount, o.CancelledAt, o.CancellationReason, o.RequestID, o.TraceID,
+		eventID, o.AggregatePending, o.Version,
+	}
+}
+
+func scanOrder(row pgx.Row) (*models.Order, error) {
+	var o models.Order
+	var id, restaurantID string
+	var totalPrice, totalCost, refundedTotal money.Amount
+	var eventID *string
+	err := row.Scan(&id, &restaurantID, &o.Currency, &totalPrice, &totalCost, &o.Status, &o.CreationDate, &o.Items,
+		&o.PromoCode, &o.Tip, &o.Pricing, &refundedTotal, &o.CancelledAt, &o.CancellationReason, &o.RequestID, &o.TraceID,
+		&eventID, &o.AggregatePending, &o.Version)
+	if err != nil {
+		return nil, err
+	}
+	if o.ID, err = objectID(id); err != nil {
+		return nil, err
+	}
+	if o.RestaurantID, err = objectID(restaurantID); err != nil {
+		return nil, err
+	}
+	o.TotalPrice = money.Money{Amount: totalPrice, Currency: o.Currency}
+	o.TotalCost = money.Money{Amount: totalCost, Currency: o.Currency}
+	if refundedTotal != 0 {
+		o.RefundedTotal = money.Money{Amount: refundedTotal, Currency: o.Currency}
+	}
+	o.CreationDate = o.CreationDate.UTC()
+	o.CancelledAt = utc(o.CancelledAt)
+	if eventID != nil {
+		o.EventID = *eventID
+	}
+	return &o, nil
+}
+
+// InsertOrders skips the orders whose ID or EventID is already stored, then looks those up
+func (s *Orders) InsertOrders(ctx context.Context, batch []*models.Order) ([]*models.Order, error) {
+	q := s.db.conn(ctx)
+	inserted := make(map[primitive.ObjectID]bool, len(batch))
+	for start := 0; start < len(batch); start += rowsPerInsert {
+		chunk := batch[start:min(start+rowsPerInsert, len(batch))]
+		args := make([]any, 0, len(chunk)*18)
+		for _, order := range chunk {
+			order.AggregatePending = true
+			args = append(args, orderValues(order)...)
+		}
+		rows, err := q.Query(ctx, `INSERT INTO orders (`+orderColumns+`) VALUES `+values(len(chunk), 19)+`
+			ON CONFLICT DO NOTHING RETURNING id`, args...)
+		if err != nil {
+			return nil, err
+		}
+		ids, err := pgx.CollectRows(rows, pgx.RowTo[string])
+		if err != nil {
+			return nil, err
+		}
+		for _, hex := range ids {
+			id, err := objectID(hex)
+			if err != nil {
+				return nil, err
+			}
+			inserted[id] = true
+		}
+	}
+
+	uncounted := make([]*models.Order, 0, len(batch))
+	claimed := make(map[primitive.ObjectID]bool, len(inserted))
+	var dupIDs, dupEvents []string
+	for _, order := range batch {
+		switch {
+		// a second order with the same ID wasn't the one inserted
+		case inserted[order.ID] && !claimed[order.ID]:
+			claimed[order.ID] = true
+			uncounted = append(uncounted, order)
+		case order.EventID != "":
+			dupEvents = append(dupEvents, order.EventID)
+		default:
+			dupIDs = append(dupIDs, order.ID.Hex())
+		}
+	}
+	if len(dupIDs) == 0 && len(dupEvents) == 0 {
+		return uncounted, nil
+	}
+
+	rows, err := q.Query(ctx, `SELECT `+orderColumns+` FROM orders
+		WHERE aggregate_pending AND (id = ANY($1) OR event_id = ANY($2))`, dupIDs, dupEvents)
+	if err != nil {
+		return nil, err
+	}
+	stored, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (*models.Order, error) { return scanOrder(row) })
+	if err != nil {
+		return nil, err
+	}
+	// an event delivered twice in one batch is inserted by its first copy and found here as well
+	for _, order := range stored {
+		if !inserted[order.ID] {
+			uncounted = append(uncounted, order)
+		}
+	}
+	return uncounted, nil
+}
+
+func (s *Orders) MarkCounted(ctx context.Context, ids []primitive.ObjectID) error {
+	_, err := s.db.conn(ctx).Exec(ctx, `UPDATE orders SET aggregate_pending = false WHERE id = ANY($1)`, hexes(ids))
+	return err
+}
+
+func (s *Orders) FindOrder(ctx context.Context, restaurantID, orderID primitive.ObjectID) (*models.Order, error) {
+	row := s.db.conn(ctx).QueryRow(ctx, `SELECT `+orderColumns+` FROM orders WHERE id = $1 AND restaurant_id = $2`, orderID.Hex(), restaurantID.Hex())
+	order, err := scanOrder(row)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, orders.ErrOrderNotFound
+	}
+	return order, err
+}
+
+func (s *Orders) RefundApplied(ctx context.Context, eventID string) (bool, error) {
+	var applied bool
+	err := s.db.conn(ctx).QueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM refunds WHERE event_id = $1)`, eventID).Scan(&applied)
+	return applied, err
+}
+
+// SaveCancellation, like SaveRefund, only applies if nobody changed the order in the meantime
+func (s *Orders) SaveCancellation(ctx context.Context, order *models.Order, previousVersion int64) error {
+	tag, err := s.db.conn(ctx).Exec(ctx, `UPDATE orders SET status = $1, cancelled_at = $2, cancellation_reason = $3, version = $4
+		WHERE id = $5 AND restaurant_id = $6 AND version = $7`,
+		order.Status, order.CancelledAt, order.CancellationReason, order.Version, order.ID.Hex(), order.RestaurantID.Hex(), previousVersion)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return orders.ErrOrderChanged
+	}
+	return nil
+}
+
+// SaveRefund updates the order and records the refund together
+func (s *Orders) SaveRefund(ctx context.Context, order *models.Order, previousVersion int64, refund *models.Refund) error {
+	return s.db.InTx(ctx, func(ctx context.Context) error {
+		q := s.db.conn(ctx)
+		tag, err := q.Exec(ctx, `UPDATE orders SET status = $1, items = $2, refunded_total = $3, version = $4
+			WHERE id = $5 AND restaurant_id = $6 AND version = $7`,
+			order.Status, order.Items, order.RefundedTotal.Amount, order.Version, order.ID.Hex(), order.RestaurantID.Hex(), previousVersion)
+		if err != nil {
+			return err
+		}
+		if tag.RowsAffected() == 0 {
+			return orders.ErrOrderChanged
+		}
+		items := refund.Items
+		if items == nil {
+			items = []models.RefundItem{}
+		}
+		var eventID *string
+		if refund.EventID != "" {
+			eventID = &refund.EventID
+		}
+		tag, err = q.Exec(ctx, `INSERT INTO refunds (id, order_id, restaurant_id, currency, amount, tax, tip, cost, reason, creation_date, items, event_id)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12) ON CONFLICT (event_id) DO NOTHING`,
+			refund.ID.Hex(), refund.OrderID.Hex(), refund.RestaurantID.Hex(), refund.Amount.Currency,
+			refund.Amount.Amount, refund.Tax.Amount, refund.Tip.Amount, refund.Cost.Amount, refund.Reason, refund.CreationDate, items, eventID)
+		if err != nil {
+			return err
+		}
+		if tag.RowsAffected() == 0 {
+			return orders.ErrRefundApplied
+		}
+		return nil
+	})
+}
+
+// Refunds returns the refunds of the order, oldest first
+func (s *Orders) Refunds(ctx context.Context, orderID primitive.ObjectID) ([]models.Refund, error) {
+	rows, err := s.db.conn(ctx).Query(ctx, `SELECT id, restaurant_id, currency, amount, tax, tip, cost, reason, creation_date, items
+		FROM refunds WHERE order_id = $1 ORDER BY creation_date, id`, orderID.Hex())
+	if err != nil {
+		return nil, err
+	}
+	return pgx.CollectRows(rows, func(row pgx.CollectableRow) (models.Refund, error) {
+		r := models.Refund{OrderID: orderID}
+		var id, restaurantID, currency string
+		var amount, tax, tip, cost money.Amount
+		err := row.Scan(&id, &restaurantID, &currency, &amount, &tax, &tip, &cost, &r.Reason, &r.CreationDate, &r.Items)
+		if err != nil {
+			return r, err
+		}
+		if r.ID, err = objectID(id); err != nil {
+			return r, err
+		}
+		if r.RestaurantID, err = objectID(restaurantID); err != nil {
+			return r, err
+		}
+		r.Amount = money.Money{Amount: amount, Currency: currency}
+		r.Tax = money.Money{Amount: tax, Currency: currency}
+		r.Tip = money.Money{Amount: tip, Currency: currency}
+		r.Cost = money.Money{Amount: cost, Currency: currency}
+		r.CreationDate = r.CreationDate.UTC()
+		return r, nil
+	})
+}
+
+// Aggregates is the orders.AggregateStore of the daily_aggregates table
+type Aggregates struct {
+	db *DB
+}
+
+type aggregateKey struct {
+	restaurantID primitive.ObjectID
+	day          string
+}
+
+// Add upserts all the aggregates in one statement; totals of the same restaurant and day are
+// summed first, as a statement can't update a row twice
+func (s *Aggregates) Add(ctx context.Context, totals []orders.DailyTotals) error {
+	if len(totals) == 0 {
+		return nil
+	}
+	byKey := make(map[aggregateKey]*orders.DailyTotals, len(totals))
+	var keys []aggregateKey
+	for _, t := range totals {
+		key := aggregateKey{restaurantID: t.RestaurantID, day: t.Day.Format(time.DateOnly)}
+		sum, ok := byKey[key]
+		if !ok {
+			if t.Currency == "" {
+				t.Currency = money.DefaultCurrency
+			}
+			byKey[key] = &t
+			keys = append(keys, key)
+			continue
+		}
+		sum.TotalOrders += t.TotalOrders
+		sum.CancelledOrders += t.CancelledOrders
+		sum.Revenue += t.Revenue
+		sum.Discounts += t.Discounts
+		sum.Tax += t.Tax
+		sum.Tips += t.Tips
+		sum.Cost += t.Cost
+		sum.Refunds += t.Refunds
+	}
+	// the same lock order in every statement keeps concurrent batches from deadlocking
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].restaurantID != keys[j].restaurantID {
+			return keys[i].restaurantID.Hex() < keys[j].restaurantID.Hex()
+		}
+		return keys[i].day < keys[j].day
+	})
+	rows := make([][]any, len(keys))
+	for i, key := range keys {
+		t := byKey[key]
+		rows[i] = []any{t.RestaurantID.Hex(), key.day, t.Currency, t.TotalOrders, t.CancelledOrders,
+			t.Revenue, t.Discounts, t.Tax, t.Tips, t.Cost, t.Refunds}
+	}
+	return insert(ctx, s.db.conn(ctx), `daily_aggregates (restaurant_id, day, currency, total_orders, cancelled_orders,
+		revenue, discounts, tax, tips, cost, refunds)`, `ON CONFLICT (restaurant_id, day) DO UPDATE SET
+		total_orders = daily_aggregates.total_orders + EXCLUDED.total_orders,
+		cancelled_orders = daily_aggregates.cancelled_orders + EXCLUDED.cancelled_orders,
+		revenue = daily_aggregates.revenue + EXCLUDED.revenue,
+		discounts = daily_aggregates.discounts + EXCLUDED.discounts,
+		tax = daily_aggregates.tax + EXCLUDED.tax,
+		tips = daily_aggregates.tips + EXCLUDED.tips,
+		cost = daily_aggregates.cost + EXCLUDED.cost,
+		refunds = daily_aggregates.refunds + EXCLUDED.refunds`, rows)
+}
+
+// Get returns the aggregate of the restaurant's day, false when there is none
+func (s *Aggregates) Get(ctx context.Context, restaurantID primitive.ObjectID, day time.Time) (orders.DailyTotals, bool, error) {
+	t := orders.DailyTotals{RestaurantID: restaurantID}
+	err := s.db.conn(ctx).QueryRow(ctx, `SELECT day, currency, total_orders, cancelled_orders, revenue, discounts, tax, tips, cost, refunds
+		FROM daily_aggregates WHERE restaurant_id = $1 AND day = $2`, restaurantID.Hex(), day.Format(time.DateOnly)).
+		Scan(&t.Day, &t.Currency, &t.TotalOrders, &t.CancelledOrders, &t.Revenue, &t.Discounts, &t.Tax, &t.Tips, &t.Cost, &t.Refunds)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return t, false, nil
+	}
+	if err != nil {
+		return t, false, err
+	}
+	t.Day = t.Day.UTC()
+	return t, true, nil
+}
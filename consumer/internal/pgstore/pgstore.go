@@ -0,0 +1,143 @@
+// Package pgstore keeps orders, refunds, menus and daily aggregates in PostgreSQL, in the
+// tables of contracts/pgschema. It implements the stores of the services, and runs an order's
+// change and its daily aggregate in one transaction.
+package pgstore
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"consumer/internal/features/orders"
+	"consumer/internal/pricing"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// DB holds one store of each kind, sharing the pool and the transactions of InTx
+type DB struct {
+	pool *pgxpool.Pool
+
+	Orders      *Orders
+	Aggregates  *Aggregates
+	Items       *Items
+	Restaurants *Restaurants
+}
+
+func New(pool *pgxpool.Pool) *DB {
+	db := &DB{pool: pool}
+	db.Orders = &Orders{db: db}
+	db.Aggregates = &Aggregates{db: db}
+	db.Items = &Items{db: db}
+	db.Restaurants = &Restaurants{db: db}
+	return db
+}
+
+// OrderStores returns the stores of the orders service
+func (db *DB) OrderStores() orders.Stores {
+	return orders.Stores{
+		Orders:     db.Orders,
+		Aggregates: db.Aggregates,
+		Items:      db.Items,
+		Pricing:    pricing.NewEngine(db.Restaurants),
+		Tx:         db,
+	}
+}
+
+type txKey struct{}
+
+// InTx runs fn in a transaction the stores use when given the context fn is called with; fn
+// joins the transaction of ctx when there is one
+func (db *DB) InTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	if _, ok := ctx.Value(txKey{}).(pgx.Tx); ok {
+		return fn(ctx)
+	}
+	return pgx.BeginFunc(ctx, db.pool, func(tx pgx.Tx) error {
+		return fn(context.WithValue(ctx, txKey{}, tx))
+	})
+}
+
+// querier is a pool or a transaction
+type querier interface {
+	Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error)
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+}
+
+// conn is the transaction of ctx, or the pool
+func (db *DB) conn(ctx context.Context) querier {
+	if tx, ok := ctx.Value(txKey{}).(pgx.Tx); ok {
+		return tx
+	}
+	return db.pool
+}
+
+// rowsPerInsert bounds the rows of one INSERT, well within the 65535 parameters of a statement
+const rowsPerInsert = 500
+
+// values is the VALUES list of rows rows of cols columns: ($1, $2), ($3, $4)...
+func values(rows, cols int) string {
+	var b strings.Builder
+	for r := 0; r < rows; r++ {
+		if r > 0 {
+			b.WriteString(", ")
+		}
+		b.WriteByte('(')
+		for c := 0; c < cols; c++ {
+			if c > 0 {
+				b.WriteString(", ")
+			}
+			b.WriteByte('$')
+			b.WriteString(strconv.Itoa(r*cols + c + 1))
+		}
+		b.WriteByte(')')
+	}
+	return b.String()
+}
+
+// insert runs "INSERT INTO into VALUES ... suffix" for the rows, rowsPerInsert at a time
+func insert(ctx context.Context, q querier, into, suffix string, rows [][]any) error {
+	for start := 0; start < len(rows); start += rowsPerInsert {
+		batch := rows[start:min(start+rowsPerInsert, len(rows))]
+		args := make([]any, 0, len(batch)*len(batch[0]))
+		for _, row := range batch {
+			args = append(args, row...)
+		}
+		sql := "INSERT INTO " + into + " VALUES " + values(len(batch), len(batch[0])) + " " + suffix
+		if _, err := q.Exec(ctx, sql, args...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// hexes are the IDs as stored
+func hexes(ids []primitive.ObjectID) []string {
+	out := make([]string, len(ids))
+	for i, id := range ids {
+		out[i] = id.Hex()
+	}
+	return out
+}
+
+// utc is t in UTC, as the MongoDB driver decodes times
+func utc(t *time.Time) *time.Time {
+	if t == nil {
+		return nil
+	}
+	u := t.UTC()
+	return &u
+}
+
+func objectID(hex string) (primitive.ObjectID, error) {
+	id, err := primitive.ObjectIDFromHex(hex)
+	if err != nil {
+		return id, fmt.Errorf("stored ID %q: %w", hex, err)
+	}
+	return id, nil
+}
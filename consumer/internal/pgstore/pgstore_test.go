@@ -0,0 +1,258 @@
+package pgstore_test
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"testing"
+	"time"
+
+	"consumer/internal/features/orders"
+	"consumer/internal/features/orders/orderstest"
+	"consumer/internal/models"
+	"consumer/internal/pgstore"
+	"consumer/internal/seed"
+	"contracts/money"
+	"contracts/pgtest"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type fixture struct {
+	db         *pgstore.DB
+	svc        *orders.Service
+	restaurant models.Restaurant
+	item       models.Item
+	promotion  models.Promotion
+}
+
+func newFixture(t *testing.T) fixture {
+	f := fixture{
+		db:         pgstore.New(pgtest.Start(t)),
+		restaurant: models.Restaurant{ID: primitive.NewObjectID(), Name: "Diner", Currency: "USD", TaxRateBps: 1000},
+	}
+	f.item = models.Item{
+		ID: primitive.NewObjectID(), Name: "Burger", RestaurantID: f.restaurant.ID,
+		Price: money.New(1000, "USD"), Cost: money.New(400, "USD"),
+		ModifierGroups: []models.ModifierGroup{{ID: "cheese", Name: "Cheese", MaxSelections: 1, Options: []models.ModifierOption{
+			{ID: "cheddar", Name: "Cheddar", PriceDelta: 100, CostDelta: 30},
+		}}},
+	}
+	f.promotion = models.Promotion{
+		ID: primitive.NewObjectID(), RestaurantID: f.restaurant.ID, Name: "Lunch",
+		Kind: models.PromotionFixed, Amount: 200, MinSubtotal: 1000, Active: true,
+	}
+	menus := seed.Menus{Restaurants: []models.Restaurant{f.restaurant}, Items: []models.Item{f.item}, Promotions: []models.Promotion{f.promotion}}
+	if err := f.db.InsertMenus(context.Background(), menus); err != nil {
+		t.Fatal(err)
+	}
+	f.svc = orders.NewService(f.db.OrderStores(), &orderstest.Publisher{}, slog.Default())
+	return f
+}
+
+func (f fixture) order(quantity int) *models.Order {
+	return &models.Order{
+		RestaurantID: f.restaurant.ID,
+		CreationDate: time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC),
+		Items: []models.OrderItem{{ItemID: f.item.ID, Quantity: quantity, Notes: "no onions",
+			Modifiers: []models.OrderItemModifier{{GroupID: "cheese", OptionID: "cheddar"}}}},
+		Tip: 150,
+	}
+}
+
+var day = time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+
+func TestCatalog(t *testing.T) {
+	f := newFixture(t)
+	ctx := context.Background()
+
+	items, err := f.db.Items.ListItems(ctx, []primitive.ObjectID{f.item.ID, primitive.NewObjectID()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(items) != 1 || items[0].Price != f.item.Price || len(items[0].ModifierGroups) != 1 || items[0].ModifierGroups[0].Options[0].PriceDelta != 100 {
+		t.Errorf("items = %+v", items)
+	}
+	restaurants, err := f.db.Restaurants.Restaurants(ctx, []primitive.ObjectID{f.restaurant.ID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if restaurants[f.restaurant.ID] != f.restaurant {
+		t.Errorf("restaurants = %+v", restaurants)
+	}
+	promotions, err := f.db.Restaurants.Promotions(ctx, []primitive.ObjectID{f.restaurant.ID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := promotions[f.restaurant.ID]; len(got) != 1 || got[0].Amount != 200 || got[0].StartsAt != nil {
+		t.Errorf("promotions = %+v", promotions)
+	}
+}
+
+func TestOrderLifecycle(t *testing.T) {
+	f := newFixture(t)
+	ctx := context.Background()
+	batch := []*models.Order{f.order(1), f.order(2)}
+	batch[1].EventID = "event-2"
+
+	rejected, err := f.svc.CreateOrders(ctx, batch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rejected[0] != nil || rejected[1] != nil {
+		t.Fatalf("rejected = %v", rejected)
+	}
+	want := orders.DailyTotals{RestaurantID: f.restaurant.ID, Day: day, Currency: "USD", TotalOrders: 2}
+	for _, o := range batch {
+		want.Revenue += o.Pricing.NetSales()
+		want.Discounts += o.Pricing.Discount
+		want.Tax += o.Pricing.Tax
+		want.Tips += o.Pricing.Tip
+		want.Cost += o.TotalCost.Amount
+	}
+	if got, _, err := f.db.Aggregates.Get(ctx, f.restaurant.ID, day); err != nil || got != want {
+		t.Errorf("aggregate = %+v, %v, want %+v", got, err, want)
+	}
+	if want.Discounts != 400 {
+		t.Errorf("discounts = %d, want the promotion's 200 twice", want.Discounts)
+	}
+
+	// a redelivered event, under a new ID, is neither stored nor counted twice
+	redelivered := f.order(2)
+	redelivered.EventID = "event-2"
+	if _, err := f.svc.CreateOrders(ctx, []*models.Order{batch[0], redelivered}); err != nil {
+		t.Fatal(err)
+	}
+	if got, _, _ := f.db.Aggregates.Get(ctx, f.restaurant.ID, day); got != want {
+		t.Errorf("after retry aggregate = %+v, want %+v", got, want)
+	}
+	if _, err := f.db.Orders.FindOrder(ctx, f.restaurant.ID, redelivered.ID); !errors.Is(err, orders.ErrOrderNotFound) {
+		t.Errorf("redelivered order: %v, want ErrOrderNotFound", err)
+	}
+
+	stored, err := f.db.Orders.FindOrder(ctx, f.restaurant.ID, batch[1].ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.TotalPrice != batch[1].TotalPrice || stored.Pricing.Total != batch[1].Pricing.Total || stored.AggregatePending ||
+		!stored.CreationDate.Equal(batch[1].CreationDate) || stored.Items[0].Notes != "no onions" || stored.Items[0].Modifiers[0].Name != "Cheddar" {
+		t.Errorf("stored %+v, want %+v", stored, batch[1])
+	}
+
+	order := batch[1]
+	refund, err := f.svc.RefundOrder(ctx, f.restaurant.ID, order.ID, []orders.RefundLine{{Line: 0, Quantity: 1}}, "cold", "refund-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.svc.RefundOrder(ctx, f.restaurant.ID, order.ID, []orders.RefundLine{{Line: 0, Quantity: 1}}, "cold", "refund-1"); !errors.Is(err, orders.ErrRefundApplied) {
+		t.Errorf("redelivered refund: %v, want ErrRefundApplied", err)
+	}
+	if _, err := f.svc.CancelOrder(ctx, f.restaurant.ID, order.ID, "closed"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.svc.CancelOrder(ctx, f.restaurant.ID, order.ID, ""); !errors.Is(err, orders.ErrOrderNotCancelable) {
+		t.Errorf("cancelling twice: %v, want ErrOrderNotCancelable", err)
+	}
+	cancelled, err := f.db.Orders.FindOrder(ctx, f.restaurant.ID, order.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cancelled.Status != models.OrderStatusCancelled || cancelled.CancelledAt == nil || cancelled.RefundedTotal.Amount != refund.Amount.Amount {
+		t.Errorf("cancelled order = %+v", cancelled)
+	}
+	refunds, err := f.db.Orders.Refunds(ctx, order.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(refunds) != 1 || refunds[0].Amount != refund.Amount || refunds[0].Reason != "cold" {
+		t.Errorf("refunds = %+v, want %+v", refunds, refund)
+	}
+
+	// the cancellation takes back what the refund didn't
+	got, _, _ := f.db.Aggregates.Get(ctx, f.restaurant.ID, day)
+	if got.TotalOrders != 2 || got.CancelledOrders != 1 || got.Refunds != refund.Amount.Amount || got.Revenue != batch[0].Pricing.NetSales() {
+		t.Errorf("aggregate = %+v after refunding and cancelling %+v", got, order.Pricing)
+	}
+}
+
+// a change computed from an order another one changed since, even a partial refund after
+// another, is not applied
+func TestStaleChanges(t *testing.T) {
+	f := newFixture(t)
+	ctx := context.Background()
+	order := f.order(2)
+	if _, err := f.svc.CreateOrders(ctx, []*models.Order{order}); err != nil {
+		t.Fatal(err)
+	}
+	stale, err := f.db.Orders.FindOrder(ctx, f.restaurant.ID, order.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.svc.RefundOrder(ctx, f.restaurant.ID, order.ID, []orders.RefundLine{{Line: 0, Quantity: 1}}, "", ""); err != nil {
+		t.Fatal(err)
+	}
+
+	stale.Version++
+	stale.Items[0].RefundedQuantity = 1
+	refund := &models.Refund{ID: primitive.NewObjectID(), OrderID: order.ID, RestaurantID: f.restaurant.ID, CreationDate: time.Now()}
+	if err := f.db.Orders.SaveRefund(ctx, stale, 0, refund); !errors.Is(err, orders.ErrOrderChanged) {
+		t.Errorf("refunding a stale order: %v, want ErrOrderChanged", err)
+	}
+	stale.Status = models.OrderStatusCancelled
+	if err := f.db.Orders.SaveCancellation(ctx, stale, 0); !errors.Is(err, orders.ErrOrderChanged) {
+		t.Errorf("cancelling a stale order: %v, want ErrOrderChanged", err)
+	}
+	if refunds, _ := f.db.Orders.Refunds(ctx, order.ID); len(refunds) != 1 {
+		t.Errorf("%d refunds stored, want 1", len(refunds))
+	}
+}
+
+func TestInTxRollsBack(t *testing.T) {
+	f := newFixture(t)
+	ctx := context.Background()
+	order := f.order(1)
+	order.ID = primitive.NewObjectID()
+	failed := errors.New("failed")
+
+	err := f.db.InTx(ctx, func(ctx context.Context) error {
+		if _, err := f.db.Orders.InsertOrders(ctx, []*models.Order{order}); err != nil {
+			return err
+		}
+		if err := f.db.Aggregates.Add(ctx, []orders.DailyTotals{{RestaurantID: f.restaurant.ID, Day: day, TotalOrders: 1}}); err != nil {
+			return err
+		}
+		return failed
+	})
+	if !errors.Is(err, failed) {
+		t.Fatalf("InTx = %v, want the error of fn", err)
+	}
+	if _, err := f.db.Orders.FindOrder(ctx, f.restaurant.ID, order.ID); !errors.Is(err, orders.ErrOrderNotFound) {
+		t.Errorf("order of the rolled back transaction: %v, want ErrOrderNotFound", err)
+	}
+	if _, ok, _ := f.db.Aggregates.Get(ctx, f.restaurant.ID, day); ok {
+		t.Error("aggregate of the rolled back transaction stored")
+	}
+}
+
+func TestLoadFixtures(t *testing.T) {
+	db := pgstore.New(pgtest.Start(t))
+	ctx := context.Background()
+	fixtures := seed.DefaultFixtures()
+
+	if has, err := db.HasRestaurants(ctx); err != nil || has {
+		t.Fatalf("HasRestaurants = %v, %v on an empty database", has, err)
+	}
+	n, err := seed.LoadFixtures(ctx, db, fixtures)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != len(fixtures.Restaurants) {
+		t.Errorf("loaded %d restaurants, want %d", n, len(fixtures.Restaurants))
+	}
+	if n, err := seed.LoadFixtures(ctx, db, fixtures); err != nil || n != 0 {
+		t.Errorf("loading again = %d, %v, want 0", n, err)
+	}
+	if has, err := db.HasRestaurants(ctx); err != nil || !has {
+		t.Errorf("HasRestaurants = %v, %v after loading", has, err)
+	}
+}
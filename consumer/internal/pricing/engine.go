@@ -0,0 +1,193 @@
+package pricing
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"consumer/internal/models"
+	"contracts/money"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var (
+	ErrUnknownRestaurant = errors.New("unknown restaurant")
+	ErrInvalidPromoCode  = errors.New("invalid promo code")
+	ErrNegativeTip       = errors.New("tip must not be negative")
+)
+
+// Engine prices orders: line subtotals, restaurant discounts and promo codes, service charge,
+// tax and tip. All arithmetic is done in minor units.
+type Engine struct {
+	store Store
+}
+
+func NewEngine(store Store) *Engine {
+	return &Engine{store: store}
+}
+
+// Restaurant loads the restaurant whose tax rate, service charge and currency apply
+func (e *Engine) Restaurant(ctx context.Context, id primitive.ObjectID) (models.Restaurant, error) {
+	restaurants, err := e.store.Restaurants(ctx, []primitive.ObjectID{id})
+	if err != nil {
+		return models.Restaurant{}, err
+	}
+	restaurant, ok := restaurants[id]
+	if !ok {
+		return models.Restaurant{}, ErrUnknownRestaurant
+	}
+	return restaurant, nil
+}
+
+// Restaurants loads several restaurants at once; unknown IDs are missing from the result
+func (e *Engine) Restaurants(ctx context.Context, ids []primitive.ObjectID) (map[primitive.ObjectID]models.Restaurant, error) {
+	return e.store.Restaurants(ctx, ids)
+}
+
+// Promotions loads the active promotions of the restaurants, with and without codes, so that
+// a batch of orders can be priced with PriceWith without a query per order
+func (e *Engine) Promotions(ctx context.Context, restaurantIDs []primitive.ObjectID) (map[primitive.ObjectID][]models.Promotion, error) {
+	return e.store.Promotions(ctx, restaurantIDs)
+}
+
+// Price computes the breakdown for the order's lines, whose UnitPrice must already include
+// modifier deltas and be in the restaurant's currency. Discounts are spread over the lines in
+// proportion to their gross so that each line carries its own share of discount, service
+// charge and tax for later refunds.
+func (e *Engine) Price(ctx context.Context, restaurant models.Restaurant, order *models.Order) (models.PriceBreakdown, error) {
+	promotions, err := e.Promotions(ctx, []primitive.ObjectID{order.RestaurantID})
+	if err != nil {
+		return models.PriceBreakdown{}, err
+	}
+	return PriceWith(restaurant, promotions[order.RestaurantID], order)
+}
+
+// PriceWith is Price with the restaurant's active promotions already loaded
+func PriceWith(restaurant models.Restaurant, promotions []models.Promotion, order *models.Order) (models.PriceBreakdown, error) {
+	if order.Tip < 0 {
+		return models.PriceBreakdown{}, ErrNegativeTip
+	}
+
+	b := models.PriceBreakdown{
+		Currency:         restaurant.CurrencyOrDefault(),
+		Lines:            make([]models.PricedLine, len(order.Items)),
+		TaxRateBps:       restaurant.TaxRateBps,
+		ServiceChargeBps: restaurant.ServiceChargeBps,
+		Tip:              order.Tip,
+	}
+	for i, it := range order.Items {
+		b.Lines[i] = models.PricedLine{
+			ItemID:    it.ItemID,
+			Quantity:  it.Quantity,
+			UnitPrice: it.UnitPrice,
+			Gross:     it.UnitPrice.Mul(it.Quantity),
+		}
+		b.Subtotal += b.Lines[i].Gross
+	}
+
+	applied, err := promotionsFor(promotions, order, b.Subtotal)
+	if err != nil {
+		return models.PriceBreakdown{}, err
+	}
+	for _, p := range applied {
+		remaining := b.Subtotal - b.Discount
+		amount := p.Amount
+		if p.Kind == models.PromotionPercent {
+			amount = b.Subtotal.Percent(p.PercentBps)
+		}
+		amount = min(amount, remaining)
+		if amount <= 0 {
+			continue
+		}
+		b.Discount += amount
+		b.Discounts = append(b.Discounts, models.AppliedDiscount{PromotionID: p.ID, Name: p.Name, Code: p.Code, Amount: amount})
+	}
+
+	allocate(b.Lines, b.Discount, b.Subtotal)
+	for i := range b.Lines {
+		l := &b.Lines[i]
+		l.ServiceCharge = (l.Gross - l.Discount).Percent(restaurant.ServiceChargeBps)
+		l.Tax = (l.Gross - l.Discount + l.ServiceCharge).Percent(restaurant.TaxRateBps)
+		l.Total = l.Gross - l.Discount + l.ServiceCharge + l.Tax
+		b.ServiceCharge += l.ServiceCharge
+		b.Tax += l.Tax
+	}
+	b.Total = b.Subtotal - b.Discount + b.ServiceCharge + b.Tax + b.Tip
+	return b, nil
+}
+
+// promotionsFor picks, from the restaurant's active promotions, the automatic ones that apply and
+// the one matching the order's promo code. An unknown, inactive or unmet promo code is an error
+// rather than silently ignored.
+func promotionsFor(candidates []models.Promotion, order *models.Order, subtotal money.Amount) ([]models.Promotion, error) {
+	code := strings.ToUpper(strings.TrimSpace(order.PromoCode))
+	order.PromoCode = code
+
+	now := order.CreationDate
+	if now.IsZero() {
+		now = time.Now().UTC()
+	}
+	var applied []models.Promotion
+	codeApplied := false
+	for _, p := range candidates {
+		if p.Code != "" && p.Code != code {
+			continue
+		}
+		if !p.AppliesAt(now) || subtotal < p.MinSubtotal {
+			continue
+		}
+		if p.Code != "" {
+			codeApplied = true
+		}
+		applied = append(applied, p)
+	}
+	if code != "" && !codeApplied {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidPromoCode, code)
+	}
+	return applied, nil
+}
+
+// allocate spreads total over the lines in proportion to their gross by largest remainder: each
+// line gets its share rounded down, then the units left go one each to the lines with the largest
+// fractions, so the shares add up exactly and none exceeds its line's gross
+func allocate(lines []models.PricedLine, total, subtotal money.Amount) {
+	if total <= 0 || subtotal <= 0 || len(lines) == 0 {
+		return
+	}
+	total = min(total, subtotal)
+	fractions := make([]int64, len(lines))
+	left := total
+	for i := range lines {
+		share := int64(total) * int64(lines[i].Gross)
+		lines[i].Discount = money.Amount(share / int64(subtotal))
+		fractions[i] = share % int64(subtotal)
+		left -= lines[i].Discount
+	}
+	byFraction := make([]int, len(lines))
+	for i := range byFraction {
+		byFraction[i] = i
+	}
+	sort.SliceStable(byFraction, func(a, b int) bool { return fractions[byFraction[a]] > fractions[byFraction[b]] })
+	for _, i := range byFraction {
+		if left == 0 {
+			break
+		}
+		if lines[i].Discount < lines[i].Gross {
+			lines[i].Discount++
+			left--
+		}
+	}
+}
+
+// Portion returns the share of a line amount that covers units [from, to) of quantity,
+// computed cumulatively so that refunding a line in several steps adds up to the whole
+func Portion(amount money.Amount, quantity, from, to int) money.Amount {
+	if quantity == 0 {
+		return 0
+	}
+	return amount.Ratio(int64(to), int64(quantity)) - amount.Ratio(int64(from), int64(quantity))
+}
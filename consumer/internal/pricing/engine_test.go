@@ -0,0 +1,181 @@
+package pricing_test
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"consumer/internal/models"
+	"consumer/internal/pricing"
+	"contracts/money"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var restaurant = models.Restaurant{ID: primitive.NewObjectID(), Name: "Diner", Currency: "USD"}
+
+// order has a line of quantity 1 per unit price
+func order(promoCode string, unitPrices ...money.Amount) *models.Order {
+	o := &models.Order{RestaurantID: restaurant.ID, PromoCode: promoCode, CreationDate: time.Date(2025, 8, 11, 12, 0, 0, 0, time.UTC)}
+	for _, p := range unitPrices {
+		o.Items = append(o.Items, models.OrderItem{ItemID: primitive.NewObjectID(), Quantity: 1, UnitPrice: p})
+	}
+	return o
+}
+
+func percentOff(bps int64) models.Promotion {
+	return models.Promotion{ID: primitive.NewObjectID(), Name: "percent", Kind: models.PromotionPercent, PercentBps: bps, Active: true}
+}
+
+func amountOff(amount money.Amount) models.Promotion {
+	return models.Promotion{ID: primitive.NewObjectID(), Name: "fixed", Kind: models.PromotionFixed, Amount: amount, Active: true}
+}
+
+func TestDiscountAllocation(t *testing.T) {
+	cases := []struct {
+		name       string
+		promotion  models.Promotion
+		unitPrices []money.Amount
+		want       []money.Amount
+	}{
+		{"in proportion to gross", percentOff(1000), []money.Amount{1000, 2000, 3000}, []money.Amount{100, 200, 300}},
+		{"remainder to the largest fraction", amountOff(100), []money.Amount{333, 333, 334}, []money.Amount{33, 33, 34}},
+		{"remainder over equal fractions", amountOff(2), []money.Amount{1, 1, 1, 1}, []money.Amount{1, 1, 0, 0}},
+		{"percent of cents", percentOff(4000), []money.Amount{1, 1, 1, 1, 1}, []money.Amount{1, 1, 0, 0, 0}},
+		{"whole subtotal", amountOff(500), []money.Amount{100, 0, 300}, []money.Amount{100, 0, 300}},
+	}
+	for _, c := range cases {
+		b, err := pricing.PriceWith(restaurant, []models.Promotion{c.promotion}, order("", c.unitPrices...))
+		if err != nil {
+			t.Fatalf("%s: %v", c.name, err)
+		}
+		var got []money.Amount
+		var sum money.Amount
+		for _, l := range b.Lines {
+			if l.Discount < 0 || l.Discount > l.Gross {
+				t.Errorf("%s: line of %d discounted by %d", c.name, l.Gross, l.Discount)
+			}
+			got = append(got, l.Discount)
+			sum += l.Discount
+		}
+		if sum != b.Discount {
+			t.Errorf("%s: shares add up to %d, discount is %d", c.name, sum, b.Discount)
+		}
+		if !reflect.DeepEqual(got, c.want) {
+			t.Errorf("%s: shares %v, want %v", c.name, got, c.want)
+		}
+	}
+}
+
+func TestServiceChargeThenTax(t *testing.T) {
+	cases := []struct {
+		name                string
+		serviceBps, taxBps  int64
+		unitPrice, tip      money.Amount
+		service, tax, total money.Amount
+	}{
+		// 10% of 12.50, then 8.25% of 13.75 = 1.134375
+		{"tax on the service charge", 1000, 825, 1250, 200, 125, 113, 1688},
+		// 12.5% of 10.00, then 8.25% of 11.25 = 0.928125
+		{"rounded up", 1250, 825, 1000, 0, 125, 93, 1218},
+		// 5% of 0.10 is half a cent
+		{"half away from zero", 0, 500, 10, 0, 0, 1, 11},
+	}
+	for _, c := range cases {
+		r := restaurant
+		r.ServiceChargeBps, r.TaxRateBps = c.serviceBps, c.taxBps
+		o := order("", c.unitPrice)
+		o.Tip = c.tip
+		b, err := pricing.PriceWith(r, nil, o)
+		if err != nil {
+			t.Fatalf("%s: %v", c.name, err)
+		}
+		if b.ServiceCharge != c.service || b.Tax != c.tax || b.Total != c.total {
+			t.Errorf("%s: service %d tax %d total %d, want %d %d %d", c.name, b.ServiceCharge, b.Tax, b.Total, c.service, c.tax, c.total)
+		}
+	}
+}
+
+func TestPromotions(t *testing.T) {
+	welcome := percentOff(1000)
+	welcome.Code = "WELCOME10"
+	inactive := amountOff(500)
+	inactive.Code, inactive.Active = "OLD", false
+	bigOrders := amountOff(300)
+	bigOrders.Code, bigOrders.MinSubtotal = "BIG", 5000
+	automaticBig := amountOff(300)
+	automaticBig.MinSubtotal = 5000
+
+	cases := []struct {
+		name       string
+		promotions []models.Promotion
+		code       string
+		discount   money.Amount
+		err        error
+	}{
+		{"percent", []models.Promotion{percentOff(1000)}, "", 125, nil},
+		{"fixed", []models.Promotion{amountOff(200)}, "", 200, nil},
+		{"fixed capped at the subtotal", []models.Promotion{amountOff(5000)}, "", 1250, nil},
+		{"capped at what is left", []models.Promotion{percentOff(5000), amountOff(1000)}, "", 1250, nil},
+		{"automatic below its minimum subtotal", []models.Promotion{automaticBig}, "", 0, nil},
+		{"code", []models.Promotion{welcome}, "WELCOME10", 125, nil},
+		{"lowercase code", []models.Promotion{welcome}, " welcome10 ", 125, nil},
+		{"code without the order giving it", []models.Promotion{welcome}, "", 0, nil},
+		{"unknown code", []models.Promotion{welcome}, "NOPE", 0, pricing.ErrInvalidPromoCode},
+		{"inactive code", []models.Promotion{inactive}, "OLD", 0, pricing.ErrInvalidPromoCode},
+		{"code below its minimum subtotal", []models.Promotion{bigOrders}, "BIG", 0, pricing.ErrInvalidPromoCode},
+	}
+	for _, c := range cases {
+		o := order(c.code, 1250)
+		b, err := pricing.PriceWith(restaurant, c.promotions, o)
+		if !errors.Is(err, c.err) {
+			t.Errorf("%s: error %v, want %v", c.name, err, c.err)
+			continue
+		}
+		if err == nil && b.Discount != c.discount {
+			t.Errorf("%s: discount %d, want %d", c.name, b.Discount, c.discount)
+		}
+	}
+
+	o := order(" welcome10 ", 1250)
+	if _, err := pricing.PriceWith(restaurant, []models.Promotion{welcome}, o); err != nil || o.PromoCode != "WELCOME10" {
+		t.Errorf("promo code stored as %q: %v", o.PromoCode, err)
+	}
+}
+
+func TestNegativeTip(t *testing.T) {
+	o := order("", 1250)
+	o.Tip = -1
+	if _, err := pricing.PriceWith(restaurant, nil, o); !errors.Is(err, pricing.ErrNegativeTip) {
+		t.Errorf("got %v", err)
+	}
+}
+
+func TestPortionAddsUpToTheLine(t *testing.T) {
+	cases := []struct {
+		amount   money.Amount
+		quantity int
+		steps    []int
+	}{
+		{100, 3, []int{1, 1, 1}},
+		{100, 3, []int{2, 1}},
+		{1001, 7, []int{3, 2, 1, 1}},
+		{5, 4, []int{1, 3}},
+	}
+	for _, c := range cases {
+		var sum money.Amount
+		from := 0
+		for _, n := range c.steps {
+			part := pricing.Portion(c.amount, c.quantity, from, from+n)
+			if part < 0 || part > c.amount {
+				t.Errorf("%d over %d: units [%d, %d) get %d", c.amount, c.quantity, from, from+n, part)
+			}
+			sum += part
+			from += n
+		}
+		if sum != c.amount {
+			t.Errorf("%d over %d refunded in steps %v adds up to %d", c.amount, c.quantity, c.steps, sum)
+		}
+	}
+}
@@ -0,0 +1,63 @@
+package pricing
+
+import (
+	"context"
+
+	"consumer/internal/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Store keeps the restaurants and their promotions
+type Store interface {
+	// Restaurants returns the restaurants by ID; unknown IDs are missing from the result
+	Restaurants(ctx context.Context, ids []primitive.ObjectID) (map[primitive.ObjectID]models.Restaurant, error)
+	// Promotions returns the active promotions of the restaurants, with and without codes
+	Promotions(ctx context.Context, restaurantIDs []primitive.ObjectID) (map[primitive.ObjectID][]models.Promotion, error)
+}
+
+type MongoStore struct {
+	restaurants *mongo.Collection
+	promotions  *mongo.Collection
+}
+
+func NewMongoStore(database *mongo.Database) *MongoStore {
+	return &MongoStore{
+		restaurants: database.Collection("restaurants"),
+		promotions:  database.Collection("promotions"),
+	}
+}
+
+func (s *MongoStore) Restaurants(ctx context.Context, ids []primitive.ObjectID) (map[primitive.ObjectID]models.Restaurant, error) {
+	cursor, err := s.restaurants.Find(ctx, bson.M{"_id": bson.M{"$in": ids}})
+	if err != nil {
+		return nil, err
+	}
+	var restaurants []models.Restaurant
+	if err := cursor.All(ctx, &restaurants); err != nil {
+		return nil, err
+	}
+	byID := make(map[primitive.ObjectID]models.Restaurant, len(restaurants))
+	for _, r := range restaurants {
+		byID[r.ID] = r
+	}
+	return byID, nil
+}
+
+func (s *MongoStore) Promotions(ctx context.Context, restaurantIDs []primitive.ObjectID) (map[primitive.ObjectID][]models.Promotion, error) {
+	cursor, err := s.promotions.Find(ctx, bson.M{"restaurantId": bson.M{"$in": restaurantIDs}, "active": true})
+	if err != nil {
+		return nil, err
+	}
+	var promotions []models.Promotion
+	if err := cursor.All(ctx, &promotions); err != nil {
+		return nil, err
+	}
+	byRestaurant := make(map[primitive.ObjectID][]models.Promotion, len(restaurantIDs))
+	for _, p := range promotions {
+		byRestaurant[p.RestaurantID] = append(byRestaurant[p.RestaurantID], p)
+	}
+	return byRestaurant, nil
+}
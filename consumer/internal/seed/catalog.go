@@ -0,0 +1,187 @@
+package seed
+
+import (
+	"fmt"
+	"math/rand"
+	"strings"
+
+	"consumer/internal/models"
+	"contracts/money"
+)
+
+// cuisine is a kind of restaurant with the dishes its menus are drawn from
+type cuisine struct {
+	name   string
+	dishes []dish
+}
+
+type dish struct {
+	name string
+	// price is in minor units, before each restaurant's markup
+	price     money.Amount
+	modifiers []models.ModifierGroup
+}
+
+var (
+	sizeGroup = models.ModifierGroup{ID: "size", Name: "Size", Required: true, MinSelections: 1, MaxSelections: 1, Options: []models.ModifierOption{
+		{ID: "regular", Name: "Regular"},
+		{ID: "large", Name: "Large", PriceDelta: 150, CostDelta: 40},
+	}}
+	burgerGroups = []models.ModifierGroup{
+		{ID: "cheese", Name: "Cheese", MaxSelections: 1, Options: []models.ModifierOption{
+			{ID: "cheddar", Name: "Cheddar", PriceDelta: 100, CostDelta: 30},
+			{ID: "swiss", Name: "Swiss", PriceDelta: 125, CostDelta: 40},
+		}},
+		{ID: "extras", Name: "Extras", MaxSelections: 3, Options: []models.ModifierOption{
+			{ID: "bacon", Name: "Bacon", PriceDelta: 150, CostDelta: 60},
+			{ID: "extra-patty", Name: "Extra patty", PriceDelta: 300, CostDelta: 180},
+			{ID: "no-onions", Name: "No onions"},
+		}},
+	}
+	donenessGroup = models.ModifierGroup{ID: "doneness", Name: "Doneness", Required: true, MinSelections: 1, MaxSelections: 1, Options: []models.ModifierOption{
+		{ID: "rare", Name: "Rare"},
+		{ID: "medium", Name: "Medium"},
+		{ID: "well-done", Name: "Well done"},
+	}}
+	spiceGroup = models.ModifierGroup{ID: "spice", Name: "Spice level", Required: true, MinSelections: 1, MaxSelections: 1, Options: []models.ModifierOption{
+		{ID: "mild", Name: "Mild"},
+		{ID: "medium", Name: "Medium"},
+		{ID: "hot", Name: "Hot"},
+	}}
+	toppingsGroup = models.ModifierGroup{ID: "toppings", Name: "Extra toppings", MaxSelections: 3, Options: []models.ModifierOption{
+		{ID: "mushrooms", Name: "Mushrooms", PriceDelta: 150, CostDelta: 40},
+		{ID: "olives", Name: "Olives", PriceDelta: 125, CostDelta: 35},
+		{ID: "pepperoni", Name: "Pepperoni", PriceDelta: 200, CostDelta: 70},
+		{ID: "extra-cheese", Name: "Extra cheese", PriceDelta: 175, CostDelta: 60},
+	}}
+	milkGroup = models.ModifierGroup{ID: "milk", Name: "Milk", MaxSelections: 1, Options: []models.ModifierOption{
+		{ID: "oat", Name: "Oat milk", PriceDelta: 60, CostDelta: 20},
+		{ID: "almond", Name: "Almond milk", PriceDelta: 60, CostDelta: 25},
+	}}
+)
+
+var cuisines = []cuisine{
+	{name: "Diner", dishes: []dish{
+		{name: "Classic Burger", price: 1250, modifiers: burgerGroups},
+		{name: "Fries", price: 425, modifiers: []models.ModifierGroup{sizeGroup}},
+		{name: "Club Sandwich", price: 1100},
+		{name: "Pancake Stack", price: 950},
+		{name: "Chocolate Shake", price: 650, modifiers: []models.ModifierGroup{sizeGroup}},
+		{name: "Cobb Salad", price: 1050},
+		{name: "Apple Pie", price: 575},
+	}},
+	{name: "Grill", dishes: []dish{
+		{name: "Ribeye Steak", price: 2890, modifiers: []models.ModifierGroup{donenessGroup}},
+		{name: "Sirloin Steak", price: 2190, modifiers: []models.ModifierGroup{donenessGroup}},
+		{name: "BBQ Ribs", price: 2250},
+		{name: "Grilled Chicken", price: 1650},
+		{name: "Corn on the Cob", price: 450},
+		{name: "Baked Potato", price: 525},
+		{name: "Chili", price: 950},
+	}},
+	{name: "Bistro", dishes: []dish{
+		{name: "Salmon Fillet", price: 1875},
+		{name: "Steak Frites", price: 2250, modifiers: []models.ModifierGroup{donenessGroup}},
+		{name: "French Onion Soup", price: 890},
+		{name: "Moules Marinières", price: 1740},
+		{name: "Croque Monsieur", price: 1150},
+		{name: "Crème Brûlée", price: 750},
+	}},
+	{name: "Pizzeria", dishes: []dish{
+		{name: "Margherita", price: 1200, modifiers: []models.ModifierGroup{toppingsGroup}},
+		{name: "Pepperoni Pizza", price: 1400, modifiers: []models.ModifierGroup{toppingsGroup}},
+		{name: "Quattro Formaggi", price: 1550, modifiers: []models.ModifierGroup{toppingsGroup}},
+		{name: "Garlic Bread", price: 550},
+		{name: "Caesar Salad", price: 950},
+		{name: "Tiramisu", price: 700},
+	}},
+	{name: "Taqueria", dishes: []dish{
+		{name: "Tacos al Pastor", price: 1050, modifiers: []models.ModifierGroup{spiceGroup}},
+		{name: "Carnitas Burrito", price: 1250, modifiers: []models.ModifierGroup{spiceGroup}},
+		{name: "Chicken Quesadilla", price: 1100},
+		{name: "Chips and Guacamole", price: 650},
+		{name: "Elote", price: 500},
+		{name: "Horchata", price: 400, modifiers: []models.ModifierGroup{sizeGroup}},
+	}},
+	{name: "Noodle Bar", dishes: []dish{
+		{name: "Tonkotsu Ramen", price: 1550, modifiers: []models.ModifierGroup{spiceGroup}},
+		{name: "Pad Thai", price: 1350, modifiers: []models.ModifierGroup{spiceGroup}},
+		{name: "Dan Dan Noodles", price: 1250, modifiers: []models.ModifierGroup{spiceGroup}},
+		{name: "Gyoza", price: 750},
+		{name: "Edamame", price: 500},
+		{name: "Iced Tea", price: 350, modifiers: []models.ModifierGroup{sizeGroup}},
+	}},
+	{name: "Café", dishes: []dish{
+		{name: "Cappuccino", price: 450, modifiers: []models.ModifierGroup{sizeGroup, milkGroup}},
+		{name: "Latte", price: 475, modifiers: []models.ModifierGroup{sizeGroup, milkGroup}},
+		{name: "Croissant", price: 350},
+		{name: "Avocado Toast", price: 1050},
+		{name: "Granola Bowl", price: 850},
+		{name: "Blueberry Muffin", price: 375},
+	}},
+}
+
+var namePrefixes = []string{
+	"Sunset", "Ocean", "Mountain", "Harbor", "Golden", "Maple", "River", "Copper", "Olive",
+	"Cedar", "Lantern", "Juniper", "Saffron", "Granite", "Willow", "Amber", "Corner", "Little",
+}
+
+// generateMenus makes each restaurant a menu of its cuisine's dishes at its own prices, and
+// gives about half of them a promo code and some a spend threshold discount
+func (g *Generator) generateMenus(rng *rand.Rand) {
+	used := make(map[string]int)
+	for i := 0; i < g.opts.Restaurants; i++ {
+		c := cuisines[rng.Intn(len(cuisines))]
+		prefix := namePrefixes[rng.Intn(len(namePrefixes))]
+		name := prefix + " " + c.name
+		if used[name]++; used[name] > 1 {
+			name = fmt.Sprintf("%s %d", name, used[name])
+		}
+
+		restaurant := models.Restaurant{ID: objectID(rng, g.start), Name: name, Currency: "USD", TaxRateBps: int64(600 + 25*rng.Intn(17))}
+		if rng.Float64() < 0.25 {
+			restaurant.Currency = "EUR"
+			restaurant.TaxRateBps = int64(700 + 100*rng.Intn(14))
+			if rng.Float64() < 0.4 {
+				restaurant.ServiceChargeBps = 1000
+			}
+		}
+		p := profile{restaurant: restaurant, popularity: 0.5 + rng.Float64()}
+
+		// prices are 15% below to 25% above the dish's, in steps of 5 cents
+		markup := 0.85 + 0.4*rng.Float64()
+		dishes := rng.Perm(len(c.dishes))[:4+rng.Intn(len(c.dishes)-3)]
+		for rank, d := range dishes {
+			dish := c.dishes[d]
+			price := money.Amount(float64(dish.price)*markup/5) * 5
+			item := models.Item{
+				ID:             objectID(rng, g.start),
+				Name:           dish.name,
+				RestaurantID:   restaurant.ID,
+				Price:          money.New(price, restaurant.Currency),
+				Cost:           money.New(price.Ratio(int64(28+rng.Intn(15)), 100), restaurant.Currency),
+				ModifierGroups: dish.modifiers,
+			}
+			p.items = append(p.items, item)
+			p.itemWeights = append(p.itemWeights, 1/float64(rank+1))
+		}
+
+		if rng.Float64() < 0.5 {
+			code := strings.ToUpper(prefix) + "10"
+			p.promoCodes = append(p.promoCodes, code)
+			g.menus.Promotions = append(g.menus.Promotions, models.Promotion{
+				ID: objectID(rng, g.start), RestaurantID: restaurant.ID, Name: "10% off", Code: code,
+				Kind: models.PromotionPercent, PercentBps: 1000, Active: true,
+			})
+		}
+		if rng.Float64() < 0.3 {
+			g.menus.Promotions = append(g.menus.Promotions, models.Promotion{
+				ID: objectID(rng, g.start), RestaurantID: restaurant.ID, Name: "5 off 40",
+				Kind: models.PromotionFixed, Amount: 500, MinSubtotal: 4000, Active: true,
+			})
+		}
+		g.menus.Restaurants = append(g.menus.Restaurants, restaurant)
+		g.menus.Items = append(g.menus.Items, p.items...)
+		g.profiles = append(g.profiles, p)
+	}
+}
@@ -0,0 +1,187 @@
+package seed
+
+import (
+	"bytes"
+	_ "embed"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"consumer/internal/models"
+	"contracts/money"
+
+	"gopkg.in/yaml.v3"
+)
+
+//go:embed default.yaml
+var defaultFixtures []byte
+
+// Fixtures are restaurants with their menus and promotions, read from a YAML or JSON file.
+// Amounts are minor units of the restaurant currency and rates are basis points.
+type Fixtures struct {
+	Restaurants []RestaurantFixture `yaml:"restaurants"`
+}
+
+type RestaurantFixture struct {
+	Name string `yaml:"name"`
+	// Currency defaults to USD
+	Currency         string             `yaml:"currency"`
+	TaxRateBps       int64              `yaml:"taxRateBps"`
+	ServiceChargeBps int64              `yaml:"serviceChargeBps"`
+	Items            []ItemFixture      `yaml:"items"`
+	Promotions       []PromotionFixture `yaml:"promotions"`
+}
+
+type ItemFixture struct {
+	Name           string                 `yaml:"name"`
+	Price          money.Amount           `yaml:"price"`
+	Cost           money.Amount           `yaml:"cost"`
+	ModifierGroups []ModifierGroupFixture `yaml:"modifierGroups"`
+}
+
+type ModifierGroupFixture struct {
+	ID            string                  `yaml:"id"`
+	Name          string                  `yaml:"name"`
+	Required      bool                    `yaml:"required"`
+	MinSelections int                     `yaml:"minSelections"`
+	MaxSelections int                     `yaml:"maxSelections"`
+	Options       []ModifierOptionFixture `yaml:"options"`
+}
+
+type ModifierOptionFixture struct {
+	ID         string       `yaml:"id"`
+	Name       string       `yaml:"name"`
+	PriceDelta money.Amount `yaml:"priceDelta"`
+	CostDelta  money.Amount `yaml:"costDelta"`
+}
+
+type PromotionFixture struct {
+	Name        string       `yaml:"name"`
+	Code        string       `yaml:"code"`
+	Kind        string       `yaml:"kind"`
+	PercentBps  int64        `yaml:"percentBps"`
+	Amount      money.Amount `yaml:"amount"`
+	MinSubtotal money.Amount `yaml:"minSubtotal"`
+	// Active defaults to true
+	Active   *bool      `yaml:"active"`
+	StartsAt *time.Time `yaml:"startsAt"`
+	EndsAt   *time.Time `yaml:"endsAt"`
+}
+
+// DefaultFixtures are the restaurants seeded at startup when no fixtures file is configured
+func DefaultFixtures() Fixtures {
+	f, err := ParseFixtures(defaultFixtures)
+	if err != nil {
+		panic(fmt.Sprintf("default fixtures: %v", err))
+	}
+	return f
+}
+
+// ReadFixtures reads a fixtures file; JSON is read as the YAML it is a subset of
+func ReadFixtures(path string) (Fixtures, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return Fixtures{}, err
+	}
+	f, err := ParseFixtures(b)
+	if err != nil {
+		return Fixtures{}, fmt.Errorf("fixtures %s: %w", path, err)
+	}
+	return f, nil
+}
+
+// ParseFixtures decodes and checks fixtures; unknown keys are errors, so that a misspelled
+// setting isn't silently dropped
+func ParseFixtures(b []byte) (Fixtures, error) {
+	var f Fixtures
+	dec := yaml.NewDecoder(bytes.NewReader(b))
+	dec.KnownFields(true)
+	if err := dec.Decode(&f); err != nil && !errors.Is(err, io.EOF) {
+		return Fixtures{}, err
+	}
+	return f, f.check()
+}
+
+// check reports every invalid restaurant, item and promotion
+func (f Fixtures) check() error {
+	var errs []error
+	names := make(map[string]bool, len(f.Restaurants))
+	for i, r := range f.Restaurants {
+		where := fmt.Sprintf("restaurants[%d]", i)
+		switch {
+		case r.Name == "":
+			errs = append(errs, fmt.Errorf("%s: name is required", where))
+		case names[r.Name]:
+			errs = append(errs, fmt.Errorf("%s: restaurant %q is listed twice", where, r.Name))
+		}
+		names[r.Name] = true
+		if r.Currency != "" && len(r.Currency) != 3 {
+			errs = append(errs, fmt.Errorf("%s: currency %q is not an ISO 4217 code", where, r.Currency))
+		}
+		if r.TaxRateBps < 0 || r.ServiceChargeBps < 0 {
+			errs = append(errs, fmt.Errorf("%s: rates must not be negative", where))
+		}
+		for j, it := range r.Items {
+			if it.Name == "" || it.Price <= 0 || it.Cost < 0 {
+				errs = append(errs, fmt.Errorf("%s.items[%d]: a name, a positive price and a cost are required", where, j))
+			}
+		}
+		for j, p := range r.Promotions {
+			if p.Name == "" {
+				errs = append(errs, fmt.Errorf("%s.promotions[%d]: name is required", where, j))
+			}
+			switch {
+			case p.Kind == models.PromotionPercent && (p.PercentBps <= 0 || p.PercentBps > 10000):
+				errs = append(errs, fmt.Errorf("%s.promotions[%d]: percentBps must be between 1 and 10000", where, j))
+			case p.Kind == models.PromotionFixed && p.Amount <= 0:
+				errs = append(errs, fmt.Errorf("%s.promotions[%d]: amount must be positive", where, j))
+			case p.Kind != models.PromotionPercent && p.Kind != models.PromotionFixed:
+				errs = append(errs, fmt.Errorf("%s.promotions[%d]: kind %q is not percent or fixed", where, j, p.Kind))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (r RestaurantFixture) restaurant() models.Restaurant {
+	currency := strings.ToUpper(r.Currency)
+	if currency == "" {
+		currency = money.DefaultCurrency
+	}
+	return models.Restaurant{Name: r.Name, Currency: currency, TaxRateBps: r.TaxRateBps, ServiceChargeBps: r.ServiceChargeBps}
+}
+
+func (it ItemFixture) item(restaurant models.Restaurant) models.Item {
+	item := models.Item{
+		Name:         it.Name,
+		RestaurantID: restaurant.ID,
+		Price:        money.New(it.Price, restaurant.Currency),
+		Cost:         money.New(it.Cost, restaurant.Currency),
+	}
+	for _, g := range it.ModifierGroups {
+		group := models.ModifierGroup{ID: g.ID, Name: g.Name, Required: g.Required, MinSelections: g.MinSelections, MaxSelections: g.MaxSelections}
+		for _, o := range g.Options {
+			group.Options = append(group.Options, models.ModifierOption{ID: o.ID, Name: o.Name, PriceDelta: o.PriceDelta, CostDelta: o.CostDelta})
+		}
+		item.ModifierGroups = append(item.ModifierGroups, group)
+	}
+	return item
+}
+
+func (p PromotionFixture) promotion(restaurant models.Restaurant) models.Promotion {
+	return models.Promotion{
+		RestaurantID: restaurant.ID,
+		Name:         p.Name,
+		Code:         p.Code,
+		Kind:         p.Kind,
+		PercentBps:   p.PercentBps,
+		Amount:       p.Amount,
+		MinSubtotal:  p.MinSubtotal,
+		Active:       p.Active == nil || *p.Active,
+		StartsAt:     p.StartsAt,
+		EndsAt:       p.EndsAt,
+	}
+}
@@ -0,0 +1,197 @@
+package seed
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"math/rand"
+	"sort"
+	"time"
+
+	"consumer/internal/models"
+	"contracts/money"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// GenerateOptions size the synthetic data. The same options always generate the same
+// restaurants, items, promotions and orders, IDs included.
+type GenerateOptions struct {
+	Restaurants int
+	// Months of orders before End
+	Months int
+	// OrdersPerDay is the average number of orders of a restaurant per day, before seasonality
+	OrdersPerDay int
+	RandomSeed   int64
+	// End is the day the orders stop at, exclusive; it's truncated to its UTC day
+	End time.Time
+}
+
+// Generator makes restaurants with menus and promotions, then their orders day by day, with
+// weekday and hour of day seasonality (hours are UTC), a slow growth over the period and
+// restaurants of different popularity
+type Generator struct {
+	opts       GenerateOptions
+	start, end time.Time
+	menus      Menus
+	profiles   []profile
+}
+
+// profile is how a generated restaurant's customers order
+type profile struct {
+	restaurant models.Restaurant
+	items      []models.Item
+	// itemWeights favour a few best sellers
+	itemWeights []float64
+	popularity  float64
+	promoCodes  []string
+}
+
+// weekdayWeights average 1, from Sunday
+var weekdayWeights = [7]float64{0.95, 0.8, 0.85, 0.9, 1.0, 1.2, 1.3}
+
+// hourWeights peak at lunch and dinner
+var hourWeights = [24]float64{
+	0.2, 0.1, 0, 0, 0, 0, 0.2, 0.6, 1.0, 0.8, 0.9, 2.2,
+	3.2, 2.6, 1.2, 0.8, 0.9, 1.8, 3.0, 3.4, 2.6, 1.5, 0.8, 0.4,
+}
+
+func NewGenerator(opts GenerateOptions) (*Generator, error) {
+	if opts.Restaurants < 1 || opts.Months < 1 || opts.OrdersPerDay < 1 {
+		return nil, fmt.Errorf("restaurants, months and orders per day must be positive")
+	}
+	end := opts.End.UTC()
+	end = time.Date(end.Year(), end.Month(), end.Day(), 0, 0, 0, 0, time.UTC)
+	g := &Generator{opts: opts, start: end.AddDate(0, -opts.Months, 0), end: end}
+	g.generateMenus(rand.New(rand.NewSource(opts.RandomSeed)))
+	return g, nil
+}
+
+// Menus are the generated restaurants, items and promotions
+func (g *Generator) Menus() Menus {
+	return g.menus
+}
+
+// Days is the number of days orders are generated for
+func (g *Generator) Days() int {
+	return int(g.end.Sub(g.start).Hours() / 24)
+}
+
+// Orders generates the orders of each day in turn, oldest first, and passes them to fn in
+// creation order. The orders are unpriced, as placed by customers: items, modifiers, tip and
+// promo code. It stops at the first error of fn.
+func (g *Generator) Orders(fn func(day time.Time, orders []*models.Order) error) error {
+	rng := rand.New(rand.NewSource(g.opts.RandomSeed + 1))
+	days := g.Days()
+	for d := 0; d < days; d++ {
+		day := g.start.AddDate(0, 0, d)
+		// grow from 90% to 110% of the average over the period
+		trend := 0.9 + 0.2*float64(d)/float64(max(days-1, 1))
+		var orders []*models.Order
+		for _, p := range g.profiles {
+			mean := float64(g.opts.OrdersPerDay) * p.popularity * weekdayWeights[day.Weekday()] * trend
+			for n := poisson(rng, mean); n > 0; n-- {
+				orders = append(orders, p.order(rng, day))
+			}
+		}
+		sort.SliceStable(orders, func(i, j int) bool { return orders[i].CreationDate.Before(orders[j].CreationDate) })
+		if err := fn(day, orders); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (p profile) order(rng *rand.Rand, day time.Time) *models.Order {
+	at := day.Add(time.Duration(pick(rng, hourWeights[:]))*time.Hour + time.Duration(rng.Int63n(int64(time.Hour))))
+	at = at.Truncate(time.Millisecond)
+	order := &models.Order{
+		ID:           objectID(rng, at),
+		RestaurantID: p.restaurant.ID,
+		CreationDate: at,
+		Status:       models.OrderStatusPending,
+	}
+
+	lines := 1 + pick(rng, []float64{0.45, 0.35, 0.15, 0.05})
+	chosen := make(map[int]bool, lines)
+	var subtotal money.Amount
+	for len(order.Items) < min(lines, len(p.items)) {
+		i := pick(rng, p.itemWeights)
+		if chosen[i] {
+			continue
+		}
+		chosen[i] = true
+		item := p.items[i]
+		line := models.OrderItem{ItemID: item.ID, Quantity: 1 + pick(rng, []float64{0.85, 0.12, 0.03})}
+		line.Modifiers = chooseModifiers(rng, item.ModifierGroups)
+		order.Items = append(order.Items, line)
+		subtotal += item.Price.Amount.Mul(line.Quantity)
+	}
+
+	if rng.Float64() < 0.55 {
+		tipBps := []int64{1000, 1500, 1800, 2000}[rng.Intn(4)]
+		order.Tip = subtotal.Percent(tipBps)
+	}
+	if len(p.promoCodes) > 0 && rng.Float64() < 0.08 {
+		order.PromoCode = p.promoCodes[rng.Intn(len(p.promoCodes))]
+	}
+	return order
+}
+
+// chooseModifiers picks an option of each required group, and some of the optional ones
+func chooseModifiers(rng *rand.Rand, groups []models.ModifierGroup) []models.OrderItemModifier {
+	var selected []models.OrderItemModifier
+	for _, g := range groups {
+		n := 0
+		switch {
+		case g.Required:
+			n = max(g.MinSelections, 1)
+		case rng.Float64() < 0.35:
+			n = 1 + rng.Intn(max(g.MaxSelections, 1))
+		}
+		for _, i := range rng.Perm(len(g.Options))[:min(n, len(g.Options))] {
+			selected = append(selected, models.OrderItemModifier{GroupID: g.ID, OptionID: g.Options[i].ID})
+		}
+	}
+	return selected
+}
+
+// pick returns an index drawn in proportion to weights
+func pick(rng *rand.Rand, weights []float64) int {
+	total := 0.0
+	for _, w := range weights {
+		total += w
+	}
+	r := rng.Float64() * total
+	for i, w := range weights {
+		if r < w {
+			return i
+		}
+		r -= w
+	}
+	return len(weights) - 1
+}
+
+// poisson draws a number of events of the given mean, approximated by a normal distribution
+// for large means
+func poisson(rng *rand.Rand, mean float64) int {
+	if mean > 30 {
+		return max(int(math.Round(mean+math.Sqrt(mean)*rng.NormFloat64())), 0)
+	}
+	limit, p := math.Exp(-mean), 1.0
+	n := -1
+	for p > limit {
+		p *= rng.Float64()
+		n++
+	}
+	return n
+}
+
+// objectID is an ObjectID created at t whose other bytes come from rng, so that generated
+// documents get the same IDs every time
+func objectID(rng *rand.Rand, t time.Time) primitive.ObjectID {
+	var id primitive.ObjectID
+	binary.BigEndian.PutUint32(id[:4], uint32(t.Unix()))
+	binary.BigEndian.PutUint64(id[4:], rng.Uint64())
+	return id
+}
@@ -0,0 +1,161 @@
+package seed
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"consumer/internal/models"
+)
+
+func TestDefaultFixtures(t *testing.T) {
+	f := DefaultFixtures()
+	if len(f.Restaurants) != 3 {
+		t.Fatalf("got %d restaurants", len(f.Restaurants))
+	}
+	bistro := f.Restaurants[1]
+	if bistro.restaurant().Currency != "EUR" || bistro.ServiceChargeBps != 1000 || len(bistro.Items) != 3 {
+		t.Errorf("unexpected restaurant %+v", bistro)
+	}
+	promo := f.Restaurants[0].Promotions[0].promotion(models.Restaurant{})
+	if promo.Code != "WELCOME10" || !promo.Active {
+		t.Errorf("unexpected promotion %+v", promo)
+	}
+}
+
+func TestParseFixturesJSON(t *testing.T) {
+	f, err := ParseFixtures([]byte(`{"restaurants": [{"name": "Cart", "currency": "gbp", "items": [{"name": "Tea", "price": 250, "cost": 40}]}]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	item := f.Restaurants[0].Items[0].item(f.Restaurants[0].restaurant())
+	if item.Price.Amount != 250 || item.Price.Currency != "GBP" {
+		t.Errorf("unexpected item %+v", item)
+	}
+
+	_, err = ParseFixtures([]byte(`
+restaurants:
+  - name: Cart
+    items: [{name: Tea}]
+    promotions: [{name: Half, kind: half}]
+  - name: Cart
+    tax: 5
+`))
+	for _, want := range []string{
+		"field tax not found",
+	} {
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("got error %v, want one containing %q", err, want)
+		}
+	}
+	_, err = ParseFixtures([]byte(`
+restaurants:
+  - name: Cart
+    items: [{name: Tea}]
+    promotions: [{name: Half, kind: half}]
+  - name: Cart
+`))
+	for _, want := range []string{
+		"restaurants[0].items[0]: a name, a positive price",
+		`restaurants[0].promotions[0]: kind "half"`,
+		`restaurants[1]: restaurant "Cart" is listed twice`,
+	} {
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("got error %v, want one containing %q", err, want)
+		}
+	}
+}
+
+func generateAll(t *testing.T, opts GenerateOptions) (Menus, []*models.Order) {
+	t.Helper()
+	g, err := NewGenerator(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var all []*models.Order
+	err = g.Orders(func(day time.Time, orders []*models.Order) error {
+		for _, o := range orders {
+			if !o.CreationDate.Truncate(24 * time.Hour).Equal(day) {
+				t.Fatalf("order of %s generated for %s", o.CreationDate, day)
+			}
+		}
+		all = append(all, orders...)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return g.Menus(), all
+}
+
+func TestGenerateIsDeterministic(t *testing.T) {
+	opts := GenerateOptions{Restaurants: 4, Months: 1, OrdersPerDay: 20, RandomSeed: 7, End: time.Date(2026, 3, 1, 15, 0, 0, 0, time.UTC)}
+	menus, orders := generateAll(t, opts)
+	again, againOrders := generateAll(t, opts)
+	if !reflect.DeepEqual(menus, again) || !reflect.DeepEqual(orders, againOrders) {
+		t.Fatal("the same options generated different data")
+	}
+	if len(menus.Restaurants) != 4 || len(orders) == 0 {
+		t.Fatalf("generated %d restaurants and %d orders", len(menus.Restaurants), len(orders))
+	}
+	if first, last := orders[0].CreationDate, orders[len(orders)-1].CreationDate; first.Before(time.Date(2026, 2, 1, 0, 0, 0, 0, time.UTC)) || !last.Before(time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("orders from %s to %s", first, last)
+	}
+
+	opts.RandomSeed = 8
+	if other, _ := generateAll(t, opts); reflect.DeepEqual(menus, other) {
+		t.Error("another seed generated the same menus")
+	}
+}
+
+func TestGenerateOrdersAreValid(t *testing.T) {
+	menus, orders := generateAll(t, GenerateOptions{Restaurants: 6, Months: 1, OrdersPerDay: 10, RandomSeed: 3, End: time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)})
+	items := make(map[[12]byte]models.Item)
+	for _, it := range menus.Items {
+		items[it.ID] = it
+	}
+	ids := make(map[[12]byte]bool)
+	for _, o := range orders {
+		if ids[o.ID] {
+			t.Fatalf("order ID %s generated twice", o.ID.Hex())
+		}
+		ids[o.ID] = true
+		if len(o.Items) == 0 {
+			t.Fatalf("order %s has no items", o.ID.Hex())
+		}
+		for _, line := range o.Items {
+			item, ok := items[line.ItemID]
+			if !ok || item.RestaurantID != o.RestaurantID || line.Quantity < 1 {
+				t.Fatalf("order %s has an invalid line %+v", o.ID.Hex(), line)
+			}
+			for _, g := range item.ModifierGroups {
+				n := 0
+				for _, m := range line.Modifiers {
+					if m.GroupID == g.ID {
+						n++
+					}
+				}
+				if n > g.MaxSelections || (g.Required && n < g.MinSelections) {
+					t.Fatalf("order %s selects %d options of %s", o.ID.Hex(), n, g.ID)
+				}
+			}
+		}
+	}
+}
+
+func TestGenerateSeasonality(t *testing.T) {
+	_, orders := generateAll(t, GenerateOptions{Restaurants: 5, Months: 3, OrdersPerDay: 40, RandomSeed: 1, End: time.Date(2026, 6, 1, 0, 0, 0, 0, time.UTC)})
+	var byWeekday [7]int
+	var byHour [24]int
+	for _, o := range orders {
+		byWeekday[o.CreationDate.Weekday()]++
+		byHour[o.CreationDate.Hour()]++
+	}
+	if byWeekday[time.Saturday] <= byWeekday[time.Monday] {
+		t.Errorf("saturdays have %d orders and mondays %d", byWeekday[time.Saturday], byWeekday[time.Monday])
+	}
+	if byHour[19] <= byHour[15] || byHour[12] <= byHour[9] || byHour[4] != 0 {
+		t.Errorf("unexpected orders by hour %v", byHour)
+	}
+}
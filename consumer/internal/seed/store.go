@@ -0,0 +1,78 @@
+package seed
+
+import (
+	"context"
+	"errors"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Store is where the menus are written
+type Store interface {
+	HasRestaurants(ctx context.Context) (bool, error)
+	// RestaurantNames returns those of names that stored restaurants have
+	RestaurantNames(ctx context.Context, names []string) ([]string, error)
+	// InsertMenus stores the menus; those already stored under their ID are left as they are,
+	// so that generating the same data twice doesn't fail
+	InsertMenus(ctx context.Context, menus Menus) error
+}
+
+type MongoStore struct {
+	db *mongo.Database
+}
+
+func NewMongoStore(database *mongo.Database) *MongoStore {
+	return &MongoStore{db: database}
+}
+
+func (s *MongoStore) HasRestaurants(ctx context.Context) (bool, error) {
+	count, err := s.db.Collection("restaurants").CountDocuments(ctx, bson.D{}, options.Count().SetLimit(1))
+	return count > 0, err
+}
+
+func (s *MongoStore) RestaurantNames(ctx context.Context, names []string) ([]string, error) {
+	stored, err := s.db.Collection("restaurants").Distinct(ctx, "name", bson.M{"name": bson.M{"$in": names}})
+	if err != nil {
+		return nil, err
+	}
+	out := make([]string, 0, len(stored))
+	for _, name := range stored {
+		if s, ok := name.(string); ok {
+			out = append(out, s)
+		}
+	}
+	return out, nil
+}
+
+func (s *MongoStore) InsertMenus(ctx context.Context, menus Menus) error {
+	if err := insertMissing(ctx, s.db.Collection("restaurants"), menus.Restaurants); err != nil {
+		return err
+	}
+	if err := insertMissing(ctx, s.db.Collection("items"), menus.Items); err != nil {
+		return err
+	}
+	return insertMissing(ctx, s.db.Collection("promotions"), menus.Promotions)
+}
+
+func insertMissing[T any](ctx context.Context, col *mongo.Collection, docs []T) error {
+	if len(docs) == 0 {
+		return nil
+	}
+	batch := make([]any, len(docs))
+	for i, doc := range docs {
+		batch[i] = doc
+	}
+	_, err := col.InsertMany(ctx, batch, options.InsertMany().SetOrdered(false))
+	var bulkErr mongo.BulkWriteException
+	if errors.As(err, &bulkErr) && bulkErr.WriteConcernError == nil {
+		for _, we := range bulkErr.WriteErrors {
+			if !mongo.IsDuplicateKeyError(we) {
+				return err
+			}
+		}
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,116 @@
+// Package storage opens the database of storage.backend, MongoDB or PostgreSQL, and hands its
+// stores to the services and the migrate and seed commands
+package storage
+
+import (
+	"context"
+	"log/slog"
+
+	"consumer/internal/config"
+	dbconn "consumer/internal/db"
+	"consumer/internal/features/items"
+	"consumer/internal/features/orders"
+	"consumer/internal/migrations"
+	"consumer/internal/pgstore"
+	"consumer/internal/seed"
+	"contracts/health"
+	"contracts/pgschema"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Backend is the connected database; only the fields of its kind are set
+type Backend struct {
+	Name string
+
+	MongoClient *mongo.Client
+	DB          *mongo.Database
+	Postgres    *pgxpool.Pool
+
+	Orders orders.Stores
+	Items  items.Store
+	Seed   seed.Store
+	// Check is the readiness check of the database
+	Check health.Check
+}
+
+// Open connects to the configured backend, waiting for it as its section says
+func Open(ctx context.Context, cfg config.Config, logger *slog.Logger) (*Backend, error) {
+	if cfg.Storage.Backend == config.BackendPostgres {
+		pool, err := dbconn.ConnectPostgres(ctx, cfg.Postgres, logger)
+		if err != nil {
+			return nil, err
+		}
+		db := pgstore.New(pool)
+		return &Backend{
+			Name:     config.BackendPostgres,
+			Postgres: pool,
+			Orders:   db.OrderStores(),
+			Items:    db.Items,
+			Seed:     db,
+			Check:    health.PostgresCheck(pool),
+		}, nil
+	}
+
+	client, database, err := dbconn.Connect(ctx, cfg.Mongo, logger)
+	if err != nil {
+		return nil, err
+	}
+	return &Backend{
+		Name:        config.BackendMongo,
+		MongoClient: client,
+		DB:          database,
+		Orders:      orders.MongoStores(database),
+		Items:       items.NewMongoStore(database),
+		Seed:        seed.NewMongoStore(database),
+		Check:       health.MongoCheck(client),
+	}, nil
+}
+
+// Migrator applies the schema migrations of the backend
+type Migrator interface {
+	Up(ctx context.Context, target int) (int, error)
+	Down(ctx context.Context, steps int) (int, error)
+	Status(ctx context.Context) ([]migrations.Status, error)
+}
+
+func (b *Backend) Migrator(logger *slog.Logger) (Migrator, error) {
+	if b.Postgres != nil {
+		runner, err := pgschema.NewRunner(b.Postgres, pgschema.All, logger)
+		if err != nil {
+			return nil, err
+		}
+		return sqlMigrator{runner}, nil
+	}
+	return migrations.NewRunner(b.DB, migrations.All, logger)
+}
+
+// sqlMigrator reports the SQL migrations as the MongoDB ones
+type sqlMigrator struct {
+	*pgschema.Runner
+}
+
+func (m sqlMigrator) Status(ctx context.Context) ([]migrations.Status, error) {
+	statuses, err := m.Runner.Status(ctx)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]migrations.Status, len(statuses))
+	for i, s := range statuses {
+		out[i] = migrations.Status(s)
+	}
+	return out, nil
+}
+
+// Close disconnects from the database
+func (b *Backend) Close(ctx context.Context) error {
+	if b.Postgres != nil {
+		b.Postgres.Close()
+		return nil
+	}
+	if b.MongoClient != nil {
+		return b.MongoClient.Disconnect(ctx)
+	}
+	return nil
+}
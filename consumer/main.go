@@ -2,50 +2,162 @@ package main
 
 import (
 	"context"
-	"log"
+	"errors"
+	"fmt"
+	"log/slog"
 	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/gin-gonic/gin/otelgin"
 
 	"consumer/internal/config"
 	"consumer/internal/container"
 	ordersFeature "consumer/internal/features/orders"
-	"consumer/internal/seed"
+	"contracts/configload"
+	"contracts/health"
+	"contracts/metrics"
+	"contracts/middleware"
 )
 
 func main() {
-	cfg := config.Load()
+	args := os.Args[1:]
+	command := "serve"
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		command, args = args[0], args[1:]
+	}
+	switch command {
+	case "serve":
+		serve(args)
+	case "config":
+		configload.ConfigCommand(config.Read, "consumer config", args, usage)
+	case "migrate":
+		migrateCommand(args)
+	case "seed":
+		seedCommand(args)
+	default:
+		fmt.Fprintf(os.Stderr, "unknown command %q\n%s", command, usage)
+		os.Exit(2)
+	}
+}
 
-	ctx, cancel := context.WithCancel(context.Background())
-	defer cancel()
+const usage = `usage:
+  consumer [serve] [flags]      consume order events and run the API
+  consumer config print [flags] print the effective configuration, secrets redacted
+  consumer migrate up [version] [flags]
+                                apply the pending schema migrations, up to version
+  consumer migrate down [steps] [flags]
+                                revert the last applied migrations, 1 by default
+  consumer migrate status [flags]
+                                list the migrations and when they were applied
+  consumer seed fixtures [flags]
+                                load the restaurants of --seed.fixtures missing by name
+  consumer seed generate [flags]
+                                generate restaurants, menus and months of orders
+run with -h for the flags
+`
+
+// serve consumes order events and serves the API until SIGTERM or SIGINT
+func serve(args []string) {
+	cfg := configload.MustLoad(config.Load, "consumer serve", args)
+
+	// SIGTERM and SIGINT start a graceful shutdown: the consumer stops fetching at once and
+	// HTTP requests in flight are drained, see shutdown
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
 
 	c, err := container.New(ctx, cfg)
 	if err != nil {
-		log.Fatalf("failed to initialize container: %v", err)
+		slog.Error("failed to initialize container", "error", err)
+		os.Exit(1)
 	}
-	defer func(ctx context.Context) {
-		_ = c.Close(ctx)
-	}(ctx)
-
-	if err := seed.SeedDatabase(ctx, c.DB); err != nil {
-		log.Fatalf("failed to seed database: %v", err)
+	if cfg.Migrations.OnStart {
+		if err := migrateUp(ctx, c.Storage, c.Logger); err != nil {
+			c.Logger.Error("failed to migrate database", "error", err)
+			os.Exit(1)
+		}
+	}
+	if cfg.Seed.OnStart {
+		if err := seedOnStart(ctx, c.Storage.Seed, cfg.Seed); err != nil {
+			c.Logger.Error("failed to seed database", "error", err)
+			os.Exit(1)
+		}
 	}
 
-	router := gin.Default()
+	router := gin.New()
+	router.ContextWithFallback = true
+	router.Use(otelgin.Middleware("consumer"), middleware.Correlation(), middleware.Logger(c.Logger), metrics.HTTP(), gin.Recovery())
+	router.GET("/metrics", gin.WrapH(metrics.Handler()))
+
+	healthController := health.NewController(c.Health)
+	healthController.RegisterRoutes(router)
 
 	orderService := c.Orders
 	orderController := ordersFeature.NewController(orderService)
 	orderController.RegisterRoutes(router)
 
 	// Start Kafka consumer for orders
-	stopKafka := ordersFeature.StartKafkaConsumer(ctx, cfg.KafkaBroker, "orders", "consumer-orders-group", orderService)
+	stopKafka := ordersFeature.StartKafkaConsumer(ctx, ordersFeature.ConsumerConfig{
+		Kafka:          c.Kafka,
+		Topic:          cfg.Kafka.OrdersTopic,
+		GroupID:        cfg.Consumer.GroupID,
+		BatchSize:      cfg.Consumer.BatchSize,
+		BatchWait:      cfg.Consumer.BatchWait,
+		Concurrency:    cfg.Consumer.Concurrency,
+		CommitInterval: cfg.Consumer.CommitInterval,
+		DeadLetters:    c.DeadLetters,
+		Status:         c.ConsumerStatus,
+	}, orderService, c.Events)
 	c.ShutdownFns = append(c.ShutdownFns, stopKafka)
 
 	srv := &http.Server{
-		Addr:    ":" + cfg.Port,
+		Addr:    ":" + cfg.HTTP.Port,
 		Handler: router,
 	}
-	if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-		log.Fatalf("server error: %v", err)
+	serveErr := make(chan error, 1)
+	go func() {
+		c.Logger.Info("listening", "addr", srv.Addr)
+		serveErr <- srv.ListenAndServe()
+	}()
+
+	exitCode := 0
+	select {
+	case <-ctx.Done():
+		c.Logger.Info("shutting down", "timeout", cfg.ShutdownTimeout)
+	case err := <-serveErr:
+		c.Logger.Error("server error", "error", err)
+		exitCode = 1
+	}
+	// from here a second signal kills the process
+	stop()
+	if err := shutdown(c, srv, cfg.ShutdownTimeout); err != nil {
+		c.Logger.Error("shutdown failed", "error", err)
+		exitCode = 1
+	} else {
+		c.Logger.Info("shut down")
+	}
+	os.Exit(exitCode)
+}
+
+// shutdown stops accepting requests and waits for those in flight, then closes the container,
+// all within timeout
+func shutdown(c *container.Container, srv *http.Server, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	httpErr := srv.Shutdown(ctx)
+
+	closed := make(chan error, 1)
+	go func() {
+		closed <- c.Close(ctx)
+	}()
+	select {
+	case err := <-closed:
+		return errors.Join(httpErr, err)
+	case <-ctx.Done():
+		return fmt.Errorf("shutdown did not finish within %s", timeout)
 	}
 }
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
+	"consumer/internal/config"
+	"consumer/internal/storage"
+	"contracts/configload"
+	"contracts/logging"
+)
+
+// migrateUp applies every pending migration of the backend
+func migrateUp(ctx context.Context, backend *storage.Backend, logger *slog.Logger) error {
+	runner, err := backend.Migrator(logger)
+	if err != nil {
+		return err
+	}
+	_, err = runner.Up(ctx, 0)
+	return err
+}
+
+// migrateCommand runs "migrate up|down|status", connecting to the database of storage.backend only
+func migrateCommand(args []string) {
+	if len(args) == 0 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+	action, args := args[0], args[1:]
+	// up takes a target version and down a number of steps, before the flags
+	n := 0
+	if (action == "up" || action == "down") && len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		var err error
+		if n, err = strconv.Atoi(args[0]); err != nil || n < 1 {
+			fmt.Fprintf(os.Stderr, "invalid %s argument %q\n%s", action, args[0], usage)
+			os.Exit(2)
+		}
+		args = args[1:]
+	}
+	if action == "down" && n == 0 {
+		n = 1
+	}
+	if action != "up" && action != "down" && action != "status" {
+		fmt.Fprintf(os.Stderr, "unknown migrate command %q\n%s", action, usage)
+		os.Exit(2)
+	}
+	cfg := configload.MustLoad(config.Load, "consumer migrate "+action, args)
+
+	logger, err := logging.New(os.Stderr, cfg.Log.Format, cfg.Log.Level)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	backend, err := storage.Open(ctx, cfg, logger)
+	if err != nil {
+		logger.Error("failed to connect to "+cfg.Storage.Backend, "error", err)
+		os.Exit(1)
+	}
+	defer func() { _ = backend.Close(context.Background()) }()
+
+	if err := runMigrate(ctx, backend, logger, action, n); err != nil {
+		logger.Error("migrate "+action+" failed", "error", err)
+		_ = backend.Close(context.Background())
+		os.Exit(1)
+	}
+}
+
+func runMigrate(ctx context.Context, backend *storage.Backend, logger *slog.Logger, action string, n int) error {
+	runner, err := backend.Migrator(logger)
+	if err != nil {
+		return err
+	}
+	switch action {
+	case "up":
+		applied, err := runner.Up(ctx, n)
+		if err == nil {
+			fmt.Printf("applied %d migrations\n", applied)
+		}
+		return err
+	case "down":
+		reverted, err := runner.Down(ctx, n)
+		if err == nil {
+			fmt.Printf("reverted %d migrations\n", reverted)
+		}
+		return err
+	}
+
+	statuses, err := runner.Status(ctx)
+	if err != nil {
+		return err
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "VERSION\tNAME\tAPPLIED")
+	for _, s := range statuses {
+		applied := "pending"
+		if s.AppliedAt != nil {
+			applied = s.AppliedAt.Local().Format(time.RFC3339)
+		}
+		if s.Unknown {
+			applied += " (unknown to this build)"
+		}
+		fmt.Fprintf(w, "%d\t%s\t%s\n", s.Version, s.Name, applied)
+	}
+	return w.Flush()
+}
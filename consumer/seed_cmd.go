@@ -0,0 +1,150 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"consumer/internal/config"
+	"consumer/internal/features/orders"
+	"consumer/internal/models"
+	"consumer/internal/seed"
+	"consumer/internal/storage"
+	"contracts/configload"
+	"contracts/logging"
+)
+
+// ordersPerWrite bounds the batches generated orders are stored in
+const ordersPerWrite = 1000
+
+// fixtures are the configured fixtures file's, or the built-in ones
+func fixtures(cfg config.SeedConfig) (seed.Fixtures, error) {
+	if cfg.Fixtures == "" {
+		return seed.DefaultFixtures(), nil
+	}
+	return seed.ReadFixtures(cfg.Fixtures)
+}
+
+// seedOnStart loads the fixtures into a database without restaurants
+func seedOnStart(ctx context.Context, store seed.Store, cfg config.SeedConfig) error {
+	f, err := fixtures(cfg)
+	if err != nil {
+		return err
+	}
+	return seed.SeedDatabase(ctx, store, f)
+}
+
+// seedCommand runs "seed fixtures|generate", connecting to the database of storage.backend only. Pending migrations
+// are applied first, so that the data lands in an indexed schema.
+func seedCommand(args []string) {
+	if len(args) == 0 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+	action, args := args[0], args[1:]
+	if action != "fixtures" && action != "generate" {
+		fmt.Fprintf(os.Stderr, "unknown seed command %q\n%s", action, usage)
+		os.Exit(2)
+	}
+	cfg := configload.MustLoad(config.Load, "consumer seed "+action, args)
+
+	logger, err := logging.New(os.Stderr, cfg.Log.Format, cfg.Log.Level)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	backend, err := storage.Open(ctx, cfg, logger)
+	if err != nil {
+		logger.Error("failed to connect to "+cfg.Storage.Backend, "error", err)
+		os.Exit(1)
+	}
+	defer func() { _ = backend.Close(context.Background()) }()
+
+	if err := runSeed(ctx, backend, logger, action, cfg.Seed); err != nil {
+		logger.Error("seed "+action+" failed", "error", err)
+		_ = backend.Close(context.Background())
+		os.Exit(1)
+	}
+}
+
+func runSeed(ctx context.Context, backend *storage.Backend, logger *slog.Logger, action string, cfg config.SeedConfig) error {
+	if err := migrateUp(ctx, backend, logger); err != nil {
+		return err
+	}
+	if action == "fixtures" {
+		f, err := fixtures(cfg)
+		if err != nil {
+			return err
+		}
+		n, err := seed.LoadFixtures(ctx, backend.Seed, f)
+		if err == nil {
+			fmt.Printf("loaded %d of %d restaurants, the others exist\n", n, len(f.Restaurants))
+		}
+		return err
+	}
+	return generate(ctx, backend, logger, cfg.Generate)
+}
+
+// generate stores the synthetic menus, then prices and stores the orders with the order
+// service, which keeps the daily aggregates. Running it again with the same settings adds
+// nothing: the documents have the same IDs.
+func generate(ctx context.Context, backend *storage.Backend, logger *slog.Logger, cfg config.GenerateConfig) error {
+	end := time.Now().UTC()
+	if cfg.End != "" {
+		var err error
+		if end, err = time.Parse(time.DateOnly, cfg.End); err != nil {
+			return err
+		}
+	}
+	g, err := seed.NewGenerator(seed.GenerateOptions{
+		Restaurants:  cfg.Restaurants,
+		Months:       cfg.Months,
+		OrdersPerDay: cfg.OrdersPerDay,
+		RandomSeed:   cfg.RandomSeed,
+		End:          end,
+	})
+	if err != nil {
+		return err
+	}
+	menus := g.Menus()
+	if err := backend.Seed.InsertMenus(ctx, menus); err != nil {
+		return err
+	}
+	logger.Info("generated menus", "restaurants", len(menus.Restaurants), "items", len(menus.Items), "promotions", len(menus.Promotions))
+
+	// lifecycle events aren't published for generated orders
+	service := orders.NewService(backend.Orders, nil, logger)
+	total, days := 0, g.Days()
+	start := time.Now()
+	err = g.Orders(func(day time.Time, batch []*models.Order) error {
+		for len(batch) > 0 {
+			n := min(len(batch), ordersPerWrite)
+			rejected, err := service.CreateOrders(ctx, batch[:n])
+			if err != nil {
+				return fmt.Errorf("orders of %s: %w", day.Format(time.DateOnly), err)
+			}
+			for _, err := range rejected {
+				if err != nil {
+					return fmt.Errorf("generated order of %s rejected: %w", day.Format(time.DateOnly), err)
+				}
+			}
+			total += n
+			batch = batch[n:]
+		}
+		if day.Day() == 1 {
+			logger.Info("generating orders", "month", day.Format("2006-01"), "orders", total)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	fmt.Printf("generated %d restaurants and %d orders over %d days in %s\n", len(menus.Restaurants), total, days, time.Since(start).Round(time.Second))
+	return nil
+}
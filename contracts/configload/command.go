@@ -0,0 +1,41 @@
+package configload
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+)
+
+// MustLoad returns the configuration load reads from args, exiting with status 0 when they ask
+// for help and 2, like flag errors, when it is invalid
+func MustLoad[C any](load func(name string, args []string) (C, error), name string, args []string) C {
+	cfg, err := load(name, args)
+	if errors.Is(err, flag.ErrHelp) {
+		os.Exit(0)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "invalid configuration:\n%v\n", err)
+		os.Exit(2)
+	}
+	return cfg
+}
+
+// ConfigCommand runs the service command name ("producer config") with args: "print" writes
+// the configuration read by read as a config file and fails when it is invalid, anything else
+// prints usage
+func ConfigCommand[C interface{ Validate() error }](read func(name string, args []string) (C, error), name string, args []string, usage string) {
+	if len(args) == 0 || args[0] != "print" {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+	cfg := MustLoad(read, name+" print", args[1:])
+	if err := Print(os.Stdout, cfg); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	if err := cfg.Validate(); err != nil {
+		fmt.Fprintf(os.Stderr, "invalid configuration:\n%v\n", err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,312 @@
+// Package configload fills a service's configuration struct from its defaults, a YAML or TOML
+// file, environment variables and command-line flags, each overriding the ones before, and
+// prints the result with its secrets redacted.
+//
+// The struct describes its sources with field tags:
+//
+//	yaml:"broker"       key in files; joined by dots with the keys of enclosing sections, the flag name (--kafka.broker)
+//	env:"KAFKA_BROKER"  environment variable
+//	usage:"..."         flag help
+//	secret:"true"       hidden when printed; passwords in URLs are always hidden
+//
+// Fields are strings, bools, ints, float64s, time.Durations ("1m30s") or string slices
+// (comma-separated in env and flags); struct fields are sections, or part of the enclosing one
+// when tagged yaml:",inline".
+package configload
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pelletier/go-toml/v2"
+	"gopkg.in/yaml.v3"
+)
+
+// EnvConfigFile names the config file when --config is not given
+const EnvConfigFile = "CONFIG_FILE"
+
+type field struct {
+	path   string // dotted yaml keys
+	env    string
+	usage  string
+	secret bool
+	value  reflect.Value
+}
+
+// fields lists the settable fields of the struct v, depth first
+func fields(v reflect.Value, prefix string) []field {
+	var out []field
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		key, opts, _ := strings.Cut(sf.Tag.Get("yaml"), ",")
+		if opts == "inline" && sf.Type.Kind() == reflect.Struct {
+			out = append(out, fields(v.Field(i), prefix)...)
+			continue
+		}
+		if key == "" || key == "-" || !sf.IsExported() {
+			continue
+		}
+		path := prefix + key
+		if sf.Type.Kind() == reflect.Struct && sf.Type != durationType {
+			out = append(out, fields(v.Field(i), path+".")...)
+			continue
+		}
+		out = append(out, field{
+			path:   path,
+			env:    sf.Tag.Get("env"),
+			usage:  sf.Tag.Get("usage"),
+			secret: sf.Tag.Get("secret") == "true",
+			value:  v.Field(i),
+		})
+	}
+	return out
+}
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// Load fills cfg, a pointer to a struct holding the defaults, from the file named by --config
+// or CONFIG_FILE (TOML when it ends in .toml, YAML otherwise), the environment and the flags in
+// args, in that order. It returns flag.ErrHelp when args ask for help, after printing it.
+func Load(cfg any, name string, args []string) error {
+	v := reflect.ValueOf(cfg)
+	if v.Kind() != reflect.Pointer || v.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("configload: %T is not a pointer to a struct", cfg)
+	}
+	all := fields(v.Elem(), "")
+
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	configFile := fs.String("config", os.Getenv(EnvConfigFile), "YAML or TOML config file (env "+EnvConfigFile+")")
+	flags := make(map[string]string)
+	for _, f := range all {
+		usage := f.usage
+		if f.env != "" {
+			usage = strings.TrimSpace(usage + " (env " + f.env + ")")
+		}
+		fs.Var(&flagValue{field: f, set: flags}, f.path, usage)
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() > 0 {
+		return fmt.Errorf("unexpected argument %q", fs.Arg(0))
+	}
+
+	if *configFile != "" {
+		if err := loadFile(cfg, *configFile); err != nil {
+			return err
+		}
+	}
+	var errs []error
+	for _, f := range all {
+		if s := os.Getenv(f.env); f.env != "" && s != "" {
+			if err := set(f.value, s); err != nil {
+				errs = append(errs, fmt.Errorf("env %s: %w", f.env, err))
+			}
+		}
+	}
+	for _, f := range all {
+		if s, ok := flags[f.path]; ok {
+			// already checked by flagValue.Set
+			_ = set(f.value, s)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// flagValue checks a flag's value and keeps it until the file and environment are applied
+type flagValue struct {
+	field field
+	set   map[string]string
+}
+
+func (f *flagValue) String() string {
+	if f == nil || !f.field.value.IsValid() {
+		return ""
+	}
+	return format(f.field.value)
+}
+
+func (f *flagValue) Set(s string) error {
+	if err := set(reflect.New(f.field.value.Type()).Elem(), s); err != nil {
+		return err
+	}
+	f.set[f.field.path] = s
+	return nil
+}
+
+func loadFile(cfg any, path string) error {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("config file: %w", err)
+	}
+	if strings.EqualFold(filepath.Ext(path), ".toml") {
+		// TOML goes through YAML so that both use the same keys and decoding rules
+		var doc map[string]any
+		if err := toml.Unmarshal(b, &doc); err != nil {
+			return fmt.Errorf("config file %s: %w", path, err)
+		}
+		if b, err = yaml.Marshal(doc); err != nil {
+			return fmt.Errorf("config file %s: %w", path, err)
+		}
+	}
+	dec := yaml.NewDecoder(bytes.NewReader(b))
+	dec.KnownFields(true)
+	if err := dec.Decode(cfg); err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("config file %s: %w", path, err)
+	}
+	return nil
+}
+
+// set parses s into v according to its type
+func set(v reflect.Value, s string) error {
+	if v.Type() == durationType {
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return fmt.Errorf("invalid duration %q, expected e.g. 500ms, 30s or 5m", s)
+		}
+		v.SetInt(int64(d))
+		return nil
+	}
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(s)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return fmt.Errorf("invalid boolean %q", s)
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int64:
+		n, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid integer %q", s)
+		}
+		v.SetInt(n)
+	case reflect.Float64:
+		f, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return fmt.Errorf("invalid number %q", s)
+		}
+		v.SetFloat(f)
+	case reflect.Slice:
+		if v.Type().Elem().Kind() != reflect.String {
+			return fmt.Errorf("unsupported type %s", v.Type())
+		}
+		var items []string
+		for _, item := range strings.Split(s, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		v.Set(reflect.ValueOf(items))
+	default:
+		return fmt.Errorf("unsupported type %s", v.Type())
+	}
+	return nil
+}
+
+// format is the inverse of set
+func format(v reflect.Value) string {
+	if v.Type() == durationType {
+		return time.Duration(v.Int()).String()
+	}
+	if v.Kind() == reflect.Slice {
+		return strings.Join(v.Interface().([]string), ",")
+	}
+	return fmt.Sprint(v.Interface())
+}
+
+// Redacted is the placeholder of hidden values
+const Redacted = "REDACTED"
+
+var urlPassword = regexp.MustCompile(`(://[^:/@\s]+:)[^@/\s]+@`)
+
+func redact(s string, secret bool) string {
+	if secret && s != "" {
+		return Redacted
+	}
+	return urlPassword.ReplaceAllString(s, "${1}"+Redacted+"@")
+}
+
+// Print writes cfg as a YAML config file, each value commented with its environment variable.
+// Secrets and URL passwords are redacted.
+func Print(w io.Writer, cfg any) error {
+	v := reflect.Indirect(reflect.ValueOf(cfg))
+	doc, err := node(v)
+	if err != nil {
+		return err
+	}
+	enc := yaml.NewEncoder(w)
+	enc.SetIndent(2)
+	if err := enc.Encode(doc); err != nil {
+		return err
+	}
+	return enc.Close()
+}
+
+func node(v reflect.Value) (*yaml.Node, error) {
+	m := &yaml.Node{Kind: yaml.MappingNode}
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		key, opts, _ := strings.Cut(sf.Tag.Get("yaml"), ",")
+		if opts == "inline" && sf.Type.Kind() == reflect.Struct {
+			inline, err := node(v.Field(i))
+			if err != nil {
+				return nil, err
+			}
+			m.Content = append(m.Content, inline.Content...)
+			continue
+		}
+		if key == "" || key == "-" || !sf.IsExported() {
+			continue
+		}
+		fv := v.Field(i)
+		var value *yaml.Node
+		switch {
+		case sf.Type.Kind() == reflect.Struct && sf.Type != durationType:
+			var err error
+			if value, err = node(fv); err != nil {
+				return nil, err
+			}
+		case sf.Type == durationType:
+			value = &yaml.Node{Kind: yaml.ScalarNode, Value: format(fv)}
+		case sf.Type.Kind() == reflect.String:
+			value = &yaml.Node{}
+			if err := value.Encode(redact(fv.String(), sf.Tag.Get("secret") == "true")); err != nil {
+				return nil, err
+			}
+		case sf.Type.Kind() == reflect.Slice:
+			items := make([]string, fv.Len())
+			for j := range items {
+				items[j] = redact(fv.Index(j).String(), sf.Tag.Get("secret") == "true")
+			}
+			value = &yaml.Node{}
+			if err := value.Encode(items); err != nil {
+				return nil, err
+			}
+			value.Style = yaml.FlowStyle
+		default:
+			value = &yaml.Node{}
+			if err := value.Encode(fv.Interface()); err != nil {
+				return nil, err
+			}
+		}
+		if env := sf.Tag.Get("env"); env != "" {
+			value.LineComment = env
+		}
+		m.Content = append(m.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: key}, value)
+	}
+	return m, nil
+}
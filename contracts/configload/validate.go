@@ -0,0 +1,88 @@
+package configload
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Errors collects the validation errors of a configuration, prefixed by their keys
+type Errors []error
+
+// Check records err, if any, as the error of the setting key
+func (e *Errors) Check(key string, err error) {
+	if err != nil {
+		*e = append(*e, fmt.Errorf("%s: %w", key, err))
+	}
+}
+
+// Err returns the errors joined, one per line, or nil
+func (e Errors) Err() error {
+	return errors.Join(e...)
+}
+
+func Required(s string) error {
+	if strings.TrimSpace(s) == "" {
+		return errors.New("is required")
+	}
+	return nil
+}
+
+func Positive(d time.Duration) error {
+	if d <= 0 {
+		return fmt.Errorf("%s is not a positive duration", d)
+	}
+	return nil
+}
+
+// NonNegative allows 0, which usually means no limit
+func NonNegative(d time.Duration) error {
+	if d < 0 {
+		return fmt.Errorf("%s is negative", d)
+	}
+	return nil
+}
+
+func AtLeast(n int, least int) error {
+	if n < least {
+		return fmt.Errorf("%d is less than %d", n, least)
+	}
+	return nil
+}
+
+func OneOf(s string, allowed ...string) error {
+	for _, a := range allowed {
+		if s == a {
+			return nil
+		}
+	}
+	return fmt.Errorf("%q is not one of %s", s, strings.Join(allowed, ", "))
+}
+
+func Port(s string) error {
+	if n, err := strconv.Atoi(s); err != nil || n < 1 || n > 65535 {
+		return fmt.Errorf("%q is not a port number", s)
+	}
+	return nil
+}
+
+func HostPort(s string) error {
+	host, port, err := net.SplitHostPort(s)
+	if err != nil || host == "" {
+		return fmt.Errorf("%q is not host:port", s)
+	}
+	return Port(port)
+}
+
+// URL checks that s starts with one of the schemes, e.g. "mongodb" or "mongodb+srv"
+func URL(s string, schemes ...string) error {
+	for _, scheme := range schemes {
+		if strings.HasPrefix(s, scheme+"://") {
+			return nil
+		}
+	}
+	return fmt.Errorf("%q is not a %s:// URL", redact(s, false), strings.Join(schemes, ":// or "))
+}
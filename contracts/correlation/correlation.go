@@ -0,0 +1,198 @@
+// Package correlation carries a request ID and a W3C trace context (traceparent) from the
+// HTTP request that produced an event, through Kafka headers, to the services handling it.
+// When OpenTelemetry spans are in use, the trace context is the one of the current span.
+package correlation
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"strings"
+
+	"github.com/segmentio/kafka-go"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Header names, used both on HTTP requests and on Kafka messages
+const (
+	HeaderRequestID   = "x-request-id"
+	HeaderTraceparent = "traceparent"
+)
+
+// maxRequestIDLength bounds request IDs taken from clients
+const maxRequestIDLength = 128
+
+// Trace is a W3C trace context: the trace an operation belongs to and the span of its caller
+type Trace struct {
+	TraceID string // 32 lowercase hex digits
+	SpanID  string // 16 lowercase hex digits
+	Flags   string // 2 hex digits; 01 means sampled
+}
+
+// NewTrace starts a sampled trace
+func NewTrace() Trace {
+	return Trace{TraceID: randomHex(16), SpanID: randomHex(8), Flags: "01"}
+}
+
+// ParseTraceparent reads a version 00 traceparent header
+func ParseTraceparent(s string) (Trace, bool) {
+	parts := strings.Split(strings.TrimSpace(s), "-")
+	if len(parts) != 4 || parts[0] != "00" {
+		return Trace{}, false
+	}
+	t := Trace{TraceID: parts[1], SpanID: parts[2], Flags: parts[3]}
+	if !isHex(t.TraceID, 32) || !isHex(t.SpanID, 16) || !isHex(t.Flags, 2) ||
+		t.TraceID == strings.Repeat("0", 32) || t.SpanID == strings.Repeat("0", 16) {
+		return Trace{}, false
+	}
+	return t, true
+}
+
+// Child continues the trace with a new span
+func (t Trace) Child() Trace {
+	t.SpanID = randomHex(8)
+	return t
+}
+
+// SpanTrace returns the trace context of an OpenTelemetry span
+func SpanTrace(sc trace.SpanContext) Trace {
+	if !sc.IsValid() {
+		return Trace{}
+	}
+	return Trace{TraceID: sc.TraceID().String(), SpanID: sc.SpanID().String(), Flags: sc.TraceFlags().String()}
+}
+
+// SpanContext is the inverse of SpanTrace; it is marked remote, as it comes from another process
+func (t Trace) SpanContext() trace.SpanContext {
+	traceID, _ := trace.TraceIDFromHex(t.TraceID)
+	spanID, _ := trace.SpanIDFromHex(t.SpanID)
+	var flags trace.TraceFlags
+	if t.Flags == "01" {
+		flags = trace.FlagsSampled
+	}
+	return trace.NewSpanContext(trace.SpanContextConfig{TraceID: traceID, SpanID: spanID, TraceFlags: flags, Remote: true})
+}
+
+func (t Trace) IsZero() bool {
+	return t.TraceID == ""
+}
+
+// String formats the trace as a traceparent header
+func (t Trace) String() string {
+	if t.IsZero() {
+		return ""
+	}
+	return "00-" + t.TraceID + "-" + t.SpanID + "-" + t.Flags
+}
+
+// IDs identify the request an operation is part of
+type IDs struct {
+	RequestID string
+	Trace     Trace
+}
+
+type contextKey struct{}
+
+func NewContext(ctx context.Context, ids IDs) context.Context {
+	return context.WithValue(ctx, contextKey{}, ids)
+}
+
+// FromContext returns the IDs stored in ctx, zero when there are none. The trace is the one
+// of the current span when there is one.
+func FromContext(ctx context.Context) IDs {
+	ids, _ := ctx.Value(contextKey{}).(IDs)
+	if t := SpanTrace(trace.SpanContextFromContext(ctx)); !t.IsZero() {
+		ids.Trace = t
+	}
+	return ids
+}
+
+// Incoming reads the IDs a caller sent, given its request ID and traceparent headers; missing
+// or invalid values are generated. The trace continues the caller's with a span of our own.
+func Incoming(requestID string, traceparent string) IDs {
+	ids := IDs{RequestID: strings.TrimSpace(requestID)}
+	if ids.RequestID == "" || len(ids.RequestID) > maxRequestIDLength {
+		ids.RequestID = NewRequestID()
+	}
+	if t, ok := ParseTraceparent(traceparent); ok {
+		ids.Trace = t.Child()
+	} else {
+		ids.Trace = NewTrace()
+	}
+	return ids
+}
+
+// NewRequestID returns a random request ID
+func NewRequestID() string {
+	return randomHex(16)
+}
+
+// KafkaHeaders returns the headers propagating ctx's IDs; none when ctx has no IDs
+func KafkaHeaders(ctx context.Context) []kafka.Header {
+	ids := FromContext(ctx)
+	var headers []kafka.Header
+	if ids.RequestID != "" {
+		headers = append(headers, kafka.Header{Key: HeaderRequestID, Value: []byte(ids.RequestID)})
+	}
+	if !ids.Trace.IsZero() {
+		headers = append(headers, kafka.Header{Key: HeaderTraceparent, Value: []byte(ids.Trace.String())})
+	}
+	return headers
+}
+
+// FromKafkaHeaders returns ctx carrying the IDs of a message, with the sender's span as the
+// remote parent of spans started from it. Messages without a request ID keep it empty, so that
+// log lines and documents don't show IDs no caller knows about.
+func FromKafkaHeaders(ctx context.Context, headers []kafka.Header) context.Context {
+	var ids IDs
+	for _, h := range headers {
+		switch h.Key {
+		case HeaderRequestID:
+			if len(h.Value) <= maxRequestIDLength {
+				ids.RequestID = string(h.Value)
+			}
+		case HeaderTraceparent:
+			if t, ok := ParseTraceparent(string(h.Value)); ok {
+				ctx = trace.ContextWithRemoteSpanContext(ctx, t.SpanContext())
+				ids.Trace = t
+			}
+		}
+	}
+	if ids.Trace.IsZero() {
+		ids.Trace = NewTrace()
+	}
+	return NewContext(ctx, ids)
+}
+
+// String formats the IDs for log lines
+func (ids IDs) String() string {
+	var b strings.Builder
+	if ids.RequestID != "" {
+		b.WriteString("requestId=" + ids.RequestID)
+	}
+	if !ids.Trace.IsZero() {
+		if b.Len() > 0 {
+			b.WriteByte(' ')
+		}
+		b.WriteString("traceId=" + ids.Trace.TraceID)
+	}
+	return b.String()
+}
+
+func isHex(s string, n int) bool {
+	if len(s) != n {
+		return false
+	}
+	for _, c := range s {
+		if (c < '0' || c > '9') && (c < 'a' || c > 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+func randomHex(n int) string {
+	b := make([]byte, n)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,58 @@
+package correlation
+
+import (
+	"context"
+	"testing"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestParseTraceparent(t *testing.T) {
+	const valid = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	trace, ok := ParseTraceparent(valid)
+	if !ok || trace.TraceID != "4bf92f3577b34da6a3ce929d0e0e4736" || trace.SpanID != "00f067aa0ba902b7" || trace.Flags != "01" {
+		t.Fatalf("ParseTraceparent(%q) = %+v, %v", valid, trace, ok)
+	}
+	if trace.String() != valid {
+		t.Errorf("String() = %q, want %q", trace.String(), valid)
+	}
+
+	for _, invalid := range []string{
+		"",
+		"01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+		"00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01",
+		"00-00000000000000000000000000000000-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7",
+	} {
+		if _, ok := ParseTraceparent(invalid); ok {
+			t.Errorf("ParseTraceparent(%q) accepted an invalid header", invalid)
+		}
+	}
+}
+
+func TestKafkaHeadersRoundTrip(t *testing.T) {
+	sent := Incoming("req-1", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	if sent.RequestID != "req-1" || sent.Trace.TraceID != "4bf92f3577b34da6a3ce929d0e0e4736" || sent.Trace.SpanID == "00f067aa0ba902b7" {
+		t.Fatalf("Incoming did not continue the caller's trace with a new span: %+v", sent)
+	}
+
+	headers := KafkaHeaders(NewContext(context.Background(), sent))
+	received := FromKafkaHeaders(context.Background(), headers)
+	got := FromContext(received)
+	if got.RequestID != sent.RequestID || got.Trace != sent.Trace {
+		t.Errorf("got %+v from headers, want %+v", got, sent)
+	}
+	// spans started while handling the message are children of the sender's span
+	if parent := trace.SpanContextFromContext(received); !parent.IsRemote() || parent.SpanID().String() != sent.Trace.SpanID {
+		t.Errorf("remote parent is %+v, want span %s", parent, sent.Trace.SpanID)
+	}
+
+	generated := Incoming("", "garbage")
+	if generated.RequestID == "" || generated.Trace.IsZero() {
+		t.Errorf("Incoming should generate missing IDs, got %+v", generated)
+	}
+	if len(KafkaHeaders(context.Background())) != 0 {
+		t.Error("a context without IDs should not produce headers")
+	}
+}
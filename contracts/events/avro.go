@@ -0,0 +1,165 @@
+package events
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"time"
+
+	"github.com/hamba/avro/v2"
+)
+
+// avroFormat encodes the envelope as the Event record of the schema's .avsc file.
+// Readers decode with the writer's schema from the registry, so records from newer
+// writers still decode; the JSON Schema check afterwards decides what is acceptable.
+type avroFormat struct{}
+
+func (avroFormat) compile(schema string) (any, error) {
+	// a cache per schema: writer and local schemas share record names
+	return avro.ParseWithCache(schema, "", &avro.SchemaCache{})
+}
+
+func (avroFormat) encode(compiled any, doc map[string]any) ([]byte, error) {
+	v, err := toAvro(compiled.(avro.Schema), doc)
+	if err != nil {
+		return nil, err
+	}
+	return avro.Marshal(compiled.(avro.Schema), v)
+}
+
+func (avroFormat) decode(compiled any, value []byte) (map[string]any, error) {
+	var v any
+	if err := avro.Unmarshal(compiled.(avro.Schema), value, &v); err != nil {
+		return nil, err
+	}
+	doc, ok := fromAvro(compiled.(avro.Schema), v).(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("avro schema is not a record")
+	}
+	return doc, nil
+}
+
+// toAvro converts a generic JSON value to the Go types the schema's encoder expects,
+// filling in defaults for missing fields
+func toAvro(schema avro.Schema, v any) (any, error) {
+	switch s := schema.(type) {
+	case *avro.RecordSchema:
+		doc, ok := v.(map[string]any)
+		if !ok {
+			return nil, fmt.Errorf("%s: expected an object", s.FullName())
+		}
+		out := make(map[string]any, len(s.Fields()))
+		for _, f := range s.Fields() {
+			fv, ok := doc[f.Name()]
+			if !ok || fv == nil {
+				if !f.HasDefault() {
+					return nil, fmt.Errorf("%s: missing %s", s.FullName(), f.Name())
+				}
+				out[f.Name()] = f.Default()
+				continue
+			}
+			converted, err := toAvro(f.Type(), fv)
+			if err != nil {
+				return nil, err
+			}
+			out[f.Name()] = converted
+		}
+		return out, nil
+	case *avro.ArraySchema:
+		items, ok := v.([]any)
+		if !ok {
+			return nil, fmt.Errorf("expected a list")
+		}
+		out := make([]any, len(items))
+		for i, item := range items {
+			converted, err := toAvro(s.Items(), item)
+			if err != nil {
+				return nil, err
+			}
+			out[i] = converted
+		}
+		return out, nil
+	case *avro.PrimitiveSchema:
+		return primitiveToAvro(s, v)
+	}
+	return nil, fmt.Errorf("unsupported avro type %s", schema.Type())
+}
+
+func primitiveToAvro(s *avro.PrimitiveSchema, v any) (any, error) {
+	if l := s.Logical(); l != nil && l.Type() == avro.TimestampMicros {
+		str, _ := v.(string)
+		return time.Parse(time.RFC3339Nano, str)
+	}
+	n, isNumber := v.(json.Number)
+	switch s.Type() {
+	case avro.String:
+		if str, ok := v.(string); ok {
+			return str, nil
+		}
+	case avro.Boolean:
+		if b, ok := v.(bool); ok {
+			return b, nil
+		}
+	case avro.Int:
+		if isNumber {
+			i, err := n.Int64()
+			return int(i), err
+		}
+	case avro.Long:
+		if isNumber {
+			return n.Int64()
+		}
+	case avro.Double:
+		if isNumber {
+			return n.Float64()
+		}
+	}
+	return nil, fmt.Errorf("unexpected value %v for avro %s", v, s.Type())
+}
+
+// fromAvro is the inverse of toAvro; fields still at their default are omitted
+func fromAvro(schema avro.Schema, v any) any {
+	switch s := schema.(type) {
+	case *avro.RecordSchema:
+		doc, _ := v.(map[string]any)
+		out := make(map[string]any, len(doc))
+		for _, f := range s.Fields() {
+			fv, ok := doc[f.Name()]
+			if !ok || (f.HasDefault() && isDefault(fv, f.Default())) {
+				continue
+			}
+			out[f.Name()] = fromAvro(f.Type(), fv)
+		}
+		return out
+	case *avro.ArraySchema:
+		items, _ := v.([]any)
+		out := make([]any, len(items))
+		for i, item := range items {
+			out[i] = fromAvro(s.Items(), item)
+		}
+		return out
+	}
+	if t, ok := v.(time.Time); ok {
+		return t.UTC().Format(time.RFC3339Nano)
+	}
+	return v
+}
+
+func isDefault(v any, def any) bool {
+	if items, ok := v.([]any); ok {
+		defItems, _ := def.([]any)
+		return len(items) == 0 && len(defItems) == 0
+	}
+	if def == nil {
+		return v == nil
+	}
+	// defaults come back from the schema as their JSON types
+	rv, rd := reflect.ValueOf(v), reflect.ValueOf(def)
+	if rv.CanInt() && rd.CanInt() {
+		return rv.Int() == rd.Int()
+	}
+	if rv.CanInt() && rd.CanFloat() {
+		return float64(rv.Int()) == rd.Float()
+	}
+	return reflect.DeepEqual(v, def)
+}
@@ -0,0 +1,201 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"strconv"
+	"sync"
+
+	"contracts/registry"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// Format is the wire encoding of events on Kafka
+type Format string
+
+const (
+	FormatJSON     Format = "json"
+	FormatProtobuf Format = "protobuf"
+	FormatAvro     Format = "avro"
+)
+
+// Kafka headers describing how a message value is encoded. Messages without a content type are JSON.
+const (
+	HeaderContentType = "content-type"
+	HeaderSchemaID    = "schema-id"
+)
+
+var contentTypes = map[Format]string{
+	FormatJSON:     "application/json",
+	FormatProtobuf: "application/x-protobuf",
+	FormatAvro:     "avro/binary",
+}
+
+var ErrNoRegistry = errors.New("schema registry is required for binary event formats")
+
+func ParseFormat(s string) (Format, error) {
+	switch f := Format(s); f {
+	case FormatJSON, FormatProtobuf, FormatAvro:
+		return f, nil
+	case "":
+		return FormatJSON, nil
+	}
+	return "", fmt.Errorf("unknown event format %q (json, protobuf, avro)", s)
+}
+
+// binaryFormat converts between the generic form of an envelope (as decoded from its JSON)
+// and the binary encoding described by a schema
+type binaryFormat interface {
+	compile(schema string) (any, error)
+	encode(compiled any, doc map[string]any) ([]byte, error)
+	decode(compiled any, value []byte) (map[string]any, error)
+}
+
+var binaryFormats = map[Format]struct {
+	ext          string
+	registryType string
+	impl         binaryFormat
+}{
+	FormatProtobuf: {".proto", registry.TypeProtobuf, protobufFormat{}},
+	FormatAvro:     {".avsc", registry.TypeAvro, avroFormat{}},
+}
+
+// Codec writes events in one format and reads any of them. Binary formats register their schema
+// and carry its ID in the schema-id header, which readers use to fetch the writer's schema.
+// Whatever the format, decoded events go through the same JSON Schema validation as Unmarshal.
+type Codec struct {
+	format   Format
+	registry *registry.Client
+
+	local  sync.Map // schemaKey -> compiled schema, for writing
+	writer sync.Map // schema id -> compiled schema, for reading
+}
+
+// NewCodec returns a codec writing format; reg may be nil when only JSON is written and read
+func NewCodec(format Format, reg *registry.Client) (*Codec, error) {
+	if format != FormatJSON && reg == nil {
+		return nil, ErrNoRegistry
+	}
+	return &Codec{format: format, registry: reg}, nil
+}
+
+// Marshal encodes env and returns the headers describing the encoding
+func (c *Codec) Marshal(ctx context.Context, env Envelope) ([]byte, []kafka.Header, error) {
+	value, err := json.Marshal(env)
+	if err != nil {
+		return nil, nil, err
+	}
+	headers := []kafka.Header{{Key: HeaderContentType, Value: []byte(contentTypes[c.format])}}
+
+	if c.format == FormatJSON {
+		if c.registry != nil {
+			schema, err := fs.ReadFile(schemaFiles, "schemas/"+schemaKey(env.Type, env.Version)+".json")
+			if err != nil {
+				return nil, nil, fmt.Errorf("%w: %s v%d", ErrUnknownSchema, env.Type, env.Version)
+			}
+			id, err := c.registry.Register(ctx, subject(env.Type, env.Version, c.format), registry.TypeJSON, string(schema))
+			if err != nil {
+				return nil, nil, err
+			}
+			headers = append(headers, kafka.Header{Key: HeaderSchemaID, Value: []byte(strconv.Itoa(id))})
+		}
+		return value, headers, nil
+	}
+
+	bf := binaryFormats[c.format]
+	key := schemaKey(env.Type, env.Version)
+	text, err := fs.ReadFile(schemaFiles, "schemas/"+key+bf.ext)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: %s v%d has no %s schema", ErrUnknownSchema, env.Type, env.Version, c.format)
+	}
+	id, err := c.registry.Register(ctx, subject(env.Type, env.Version, c.format), bf.registryType, string(text))
+	if err != nil {
+		return nil, nil, err
+	}
+	compiled, ok := c.local.Load(key)
+	if !ok {
+		if compiled, err = bf.impl.compile(string(text)); err != nil {
+			return nil, nil, err
+		}
+		c.local.Store(key, compiled)
+	}
+	doc, err := decodeJSON(value)
+	if err != nil {
+		return nil, nil, err
+	}
+	value, err = bf.impl.encode(compiled, doc.(map[string]any))
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: %s v%d: %v", ErrInvalidEvent, env.Type, env.Version, err)
+	}
+	headers = append(headers, kafka.Header{Key: HeaderSchemaID, Value: []byte(strconv.Itoa(id))})
+	return value, headers, nil
+}
+
+// Unmarshal decodes a message written by any codec, then validates it like Unmarshal
+func (c *Codec) Unmarshal(ctx context.Context, value []byte, headers []kafka.Header) (Envelope, error) {
+	format := FormatJSON
+	if ct := header(headers, HeaderContentType); ct != "" {
+		format = ""
+		for f, t := range contentTypes {
+			if t == ct {
+				format = f
+			}
+		}
+		if format == "" {
+			return Envelope{}, fmt.Errorf("%w: unsupported content type %q", ErrInvalidEvent, ct)
+		}
+	}
+	if format == FormatJSON {
+		return Unmarshal(value)
+	}
+
+	if c.registry == nil {
+		return Envelope{}, ErrNoRegistry
+	}
+	id, err := strconv.Atoi(header(headers, HeaderSchemaID))
+	if err != nil {
+		return Envelope{}, fmt.Errorf("%w: missing or invalid %s header", ErrInvalidEvent, HeaderSchemaID)
+	}
+	bf := binaryFormats[format]
+	compiled, ok := c.writer.Load(id)
+	if !ok {
+		schema, err := c.registry.SchemaByID(ctx, id)
+		if err != nil {
+			return Envelope{}, err
+		}
+		if schema.Type != bf.registryType {
+			return Envelope{}, fmt.Errorf("%w: schema %d is %s, message is %s", ErrInvalidEvent, id, schema.Type, format)
+		}
+		if compiled, err = bf.impl.compile(schema.Schema); err != nil {
+			return Envelope{}, fmt.Errorf("schema %d: %w", id, err)
+		}
+		c.writer.Store(id, compiled)
+	}
+	doc, err := bf.impl.decode(compiled, value)
+	if err != nil {
+		return Envelope{}, fmt.Errorf("%w: %v", ErrInvalidEvent, err)
+	}
+	raw, err := json.Marshal(doc)
+	if err != nil {
+		return Envelope{}, err
+	}
+	return Unmarshal(raw)
+}
+
+// subject names the registry subject of an event type, version and format
+func subject(eventType string, version int, format Format) string {
+	return fmt.Sprintf("%s-%s", schemaKey(eventType, version), format)
+}
+
+func header(headers []kafka.Header, key string) string {
+	for _, h := range headers {
+		if h.Key == key {
+			return string(h.Value)
+		}
+	}
+	return ""
+}
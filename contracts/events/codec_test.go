@@ -0,0 +1,159 @@
+package events
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+
+	"contracts/registry"
+
+	"github.com/segmentio/kafka-go"
+)
+
+func newTestRegistry(t *testing.T) *registry.Client {
+	t.Helper()
+	srv := httptest.NewServer(registry.NewFake())
+	t.Cleanup(srv.Close)
+	client, err := registry.NewClient(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return client
+}
+
+func TestCodecRoundTrip(t *testing.T) {
+	ctx := context.Background()
+	reg := newTestRegistry(t)
+	create := OrderCreate{
+		RestaurantID: "689904ceab76a67dea61142a",
+		Items: []OrderItem{
+			{ID: "689904ceab76a67dea61142d", Quantity: 2, Modifiers: []Modifier{{GroupID: "cheese", OptionID: "cheddar"}}, Notes: "no pickles"},
+			{ID: "689904ceab76a67dea61142e", Quantity: 1},
+		},
+		PromoCode: "WELCOME10",
+		Tip:       250,
+	}
+	refund := OrderRefund{RestaurantID: "689904ceab76a67dea61142a", OrderID: "68990a11ab76a67dea611500", Items: []RefundItem{{Line: 0, Quantity: 1}, {Line: 1, Quantity: 2}}}
+
+	for _, format := range []Format{FormatJSON, FormatProtobuf, FormatAvro} {
+		writer, err := NewCodec(format, reg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// a separate reader only shares the registry, like another service would
+		reader, _ := NewCodec(FormatJSON, reg)
+
+		for _, c := range []struct {
+			eventType string
+			data      any
+			decoded   any
+		}{
+			{TypeOrderCreate, create, &OrderCreate{}},
+			{TypeOrderCancel, OrderCancel{RestaurantID: "689904ceab76a67dea61142a", OrderID: "68990a11ab76a67dea611500"}, &OrderCancel{}},
+			{TypeOrderRefund, refund, &OrderRefund{}},
+		} {
+			env, err := New("test", c.eventType, c.data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			value, headers, err := writer.Marshal(ctx, env)
+			if err != nil {
+				t.Fatalf("%s %s: %v", format, c.eventType, err)
+			}
+			if header(headers, HeaderSchemaID) == "" {
+				t.Errorf("%s %s: no schema id header", format, c.eventType)
+			}
+			got, err := reader.Unmarshal(ctx, value, headers)
+			if err != nil {
+				t.Fatalf("%s %s: %v", format, c.eventType, err)
+			}
+			if got.ID != env.ID || got.Type != env.Type || got.Version != env.Version || got.Timestamp.Sub(env.Timestamp).Abs() >= time.Microsecond {
+				t.Errorf("%s %s: envelope %+v, want %+v", format, c.eventType, got, env)
+			}
+			if err := got.Decode(c.decoded); err != nil {
+				t.Fatal(err)
+			}
+			if v := reflect.ValueOf(c.decoded).Elem().Interface(); !reflect.DeepEqual(v, c.data) {
+				t.Errorf("%s %s: got %+v, want %+v", format, c.eventType, v, c.data)
+			}
+		}
+	}
+}
+
+func TestCodecReadsNewerWriterSchema(t *testing.T) {
+	ctx := context.Background()
+	reg := newTestRegistry(t)
+	// a newer producer added a field; its schema is only known through the registry
+	newer := `syntax = "proto3";
+package events.order_cancel.v1;
+import "google/protobuf/timestamp.proto";
+message Event {
+  string id = 1;
+  string type = 2;
+  int32 version = 3;
+  google.protobuf.Timestamp timestamp = 4;
+  string source = 5;
+  OrderCancel data = 6;
+}
+message OrderCancel {
+  string restaurant_id = 1;
+  string order_id = 2;
+  string reason = 3;
+  string cancelled_by = 4;
+}`
+	id, err := reg.Register(ctx, "order.cancel.v1-protobuf", registry.TypeProtobuf, newer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	compiled, err := protobufFormat{}.compile(newer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	doc, _ := decodeJSON([]byte(`{"id":"x","type":"order.cancel","version":1,"timestamp":"2025-08-11T14:05:00Z","source":"test",
+		"data":{"restaurantId":"689904ceab76a67dea61142a","orderId":"68990a11ab76a67dea611500","cancelledBy":"manager"}}`))
+	value, err := protobufFormat{}.encode(compiled, doc.(map[string]any))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	reader, _ := NewCodec(FormatJSON, reg)
+	env, err := reader.Unmarshal(ctx, value, []kafka.Header{
+		{Key: HeaderContentType, Value: []byte(contentTypes[FormatProtobuf])},
+		{Key: HeaderSchemaID, Value: []byte(strconv.Itoa(id))},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var cancel OrderCancel
+	if err := env.Decode(&cancel); err != nil || cancel.OrderID != "68990a11ab76a67dea611500" {
+		t.Errorf("got %+v, %v", cancel, err)
+	}
+}
+
+func TestCodecRejects(t *testing.T) {
+	ctx := context.Background()
+	if _, err := NewCodec(FormatAvro, nil); !errors.Is(err, ErrNoRegistry) {
+		t.Errorf("avro without registry: %v", err)
+	}
+	reader, _ := NewCodec(FormatJSON, newTestRegistry(t))
+	cases := map[string][]kafka.Header{
+		"unknown content type": {{Key: HeaderContentType, Value: []byte("text/plain")}},
+		"missing schema id":    {{Key: HeaderContentType, Value: []byte(contentTypes[FormatAvro])}},
+	}
+	for name, headers := range cases {
+		if _, err := reader.Unmarshal(ctx, []byte{0}, headers); !errors.Is(err, ErrInvalidEvent) {
+			t.Errorf("%s: %v", name, err)
+		}
+	}
+	_, err := reader.Unmarshal(ctx, []byte{0}, []kafka.Header{
+		{Key: HeaderContentType, Value: []byte(contentTypes[FormatAvro])},
+		{Key: HeaderSchemaID, Value: []byte("42")},
+	})
+	if !errors.Is(err, registry.ErrNotFound) {
+		t.Errorf("unknown schema id: %v", err)
+	}
+}
@@ -0,0 +1,380 @@
+package events
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/hamba/avro/v2"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// Schemas under testdata/published are the versions already on the wire. They must stay
+// readable by current code: a published schema may only change compatibly (new optional
+// fields, looser limits), and anything else needs a new version.
+
+func TestPublishedSchemasStayCompatible(t *testing.T) {
+	published := readSchemaDir(t, "testdata/published")
+	current := readSchemaDir(t, "schemas")
+
+	for name, old := range published {
+		cur, ok := current[name]
+		if !ok {
+			t.Errorf("%s: published schema was removed", name)
+			continue
+		}
+		for _, problem := range compareSchemas(old, cur, old, cur, "") {
+			t.Errorf("%s: breaking change at %s; publish a new version instead", name, problem)
+		}
+	}
+	for name := range current {
+		if _, ok := published[name]; !ok {
+			t.Errorf("%s: not published; copy it to testdata/published when it ships", name)
+		}
+	}
+}
+
+// Binary schemas of a published version are checked with their own rules: Avro with the
+// reader/writer resolution rules, both ways; Protobuf by field numbers, which must keep
+// their name, type and cardinality.
+func TestPublishedBinarySchemasStayCompatible(t *testing.T) {
+	for _, file := range glob(t, "testdata/published/*.avsc") {
+		name := filepath.Base(file)
+		old, err := avro.ParseFiles(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		text, err := os.ReadFile(filepath.Join("schemas", name))
+		if err != nil {
+			t.Errorf("%s: published schema was removed", name)
+			continue
+		}
+		cur, err := avroFormat{}.compile(string(text))
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		compat := avro.NewSchemaCompatibility()
+		if err := compat.Compatible(cur.(avro.Schema), old); err != nil {
+			t.Errorf("%s: cannot read published records: %v", name, err)
+		}
+		if err := compat.Compatible(old, cur.(avro.Schema)); err != nil {
+			t.Errorf("%s: published readers cannot read new records: %v", name, err)
+		}
+	}
+
+	for _, file := range glob(t, "testdata/published/*.proto") {
+		name := filepath.Base(file)
+		oldText, _ := os.ReadFile(file)
+		old, err := protobufFormat{}.compile(string(oldText))
+		if err != nil {
+			t.Fatal(err)
+		}
+		text, err := os.ReadFile(filepath.Join("schemas", name))
+		if err != nil {
+			t.Errorf("%s: published schema was removed", name)
+			continue
+		}
+		cur, err := protobufFormat{}.compile(string(text))
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		for _, problem := range compareMessages(old.(protoreflect.MessageDescriptor), cur.(protoreflect.MessageDescriptor)) {
+			t.Errorf("%s: breaking change: %s", name, problem)
+		}
+	}
+	for _, file := range append(glob(t, "schemas/*.avsc"), glob(t, "schemas/*.proto")...) {
+		if _, err := os.Stat(filepath.Join("testdata/published", filepath.Base(file))); err != nil {
+			t.Errorf("%s: not published; copy it to testdata/published when it ships", filepath.Base(file))
+		}
+	}
+}
+
+func compareMessages(old, cur protoreflect.MessageDescriptor) []string {
+	var problems []string
+	for i := 0; i < old.Fields().Len(); i++ {
+		of := old.Fields().Get(i)
+		cf := cur.Fields().ByNumber(of.Number())
+		if cf == nil {
+			problems = append(problems, fmt.Sprintf("%s: field %d (%s) removed; reserve it instead", old.FullName(), of.Number(), of.Name()))
+			continue
+		}
+		if cf.Name() != of.Name() || cf.Kind() != of.Kind() || cf.Cardinality() != of.Cardinality() {
+			problems = append(problems, fmt.Sprintf("%s: field %d changed from %s %s to %s %s", old.FullName(), of.Number(), of.Kind(), of.Name(), cf.Kind(), cf.Name()))
+			continue
+		}
+		if of.Kind() == protoreflect.MessageKind && of.Message().FullName() != timestampName {
+			problems = append(problems, compareMessages(of.Message(), cf.Message())...)
+		}
+	}
+	return problems
+}
+
+func TestCurrentVersionsHaveSchemas(t *testing.T) {
+	for eventType, version := range versions {
+		if _, ok := dataSchemas[schemaKey(eventType, version)]; !ok {
+			t.Errorf("%s v%d has no schema", eventType, version)
+		}
+	}
+}
+
+func TestExamples(t *testing.T) {
+	for _, file := range glob(t, "testdata/examples/valid/*.json") {
+		raw, _ := os.ReadFile(file)
+		if _, err := Unmarshal(raw); err != nil {
+			t.Errorf("%s: %v", file, err)
+		}
+	}
+	for _, file := range glob(t, "testdata/examples/invalid/*.json") {
+		raw, _ := os.ReadFile(file)
+		if _, err := Unmarshal(raw); err == nil {
+			t.Errorf("%s: accepted", file)
+		}
+	}
+}
+
+func TestLegacyTipInDollars(t *testing.T) {
+	raw := `{"restaurantId":"689904ceab76a67dea61142a","items":[{"id":"689904ceab76a67dea61142d","quantity":1}],"tip":2.55}`
+	env, err := Unmarshal([]byte(raw))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got OrderCreate
+	if err := env.Decode(&got); err != nil {
+		t.Fatal(err)
+	}
+	if env.Version != 1 || got.Tip != 255 {
+		t.Errorf("version %d with tip %d, want v1 with 255", env.Version, got.Tip)
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	cases := []struct {
+		eventType string
+		data      any
+		decoded   any
+	}{
+		{TypeOrderCreate, OrderCreate{
+			RestaurantID: "689904ceab76a67dea61142a",
+			Items: []OrderItem{{
+				ID: "689904ceab76a67dea61142d", Quantity: 2, Notes: "no pickles",
+				Modifiers: []Modifier{{GroupID: "cheese", OptionID: "cheddar"}},
+			}},
+			PromoCode: "WELCOME10",
+			Tip:       250,
+		}, &OrderCreate{}},
+		{TypeOrderCancel, OrderCancel{RestaurantID: "689904ceab76a67dea61142a", OrderID: "68990a11ab76a67dea611500", Reason: "closed"}, &OrderCancel{}},
+		{TypeOrderRefund, OrderRefund{
+			RestaurantID: "689904ceab76a67dea61142a", OrderID: "68990a11ab76a67dea611500",
+			Items: []RefundItem{{Line: 1, Quantity: 1}},
+		}, &OrderRefund{}},
+	}
+	for _, c := range cases {
+		env, err := New("test", c.eventType, c.data)
+		if err != nil {
+			t.Fatalf("%s: %v", c.eventType, err)
+		}
+		raw, _ := json.Marshal(env)
+		got, err := Unmarshal(raw)
+		if err != nil {
+			t.Fatalf("%s: %v", c.eventType, err)
+		}
+		if got.ID != env.ID || got.Type != c.eventType || got.Version != CurrentVersion(c.eventType) || got.Source != "test" {
+			t.Errorf("%s: envelope changed: %+v", c.eventType, got)
+		}
+		if err := got.Decode(c.decoded); err != nil {
+			t.Fatal(err)
+		}
+		if v := reflect.ValueOf(c.decoded).Elem().Interface(); !reflect.DeepEqual(v, c.data) {
+			t.Errorf("%s: got %+v, want %+v", c.eventType, v, c.data)
+		}
+	}
+
+	_, err := New("test", TypeOrderCreate, OrderCreate{RestaurantID: "689904ceab76a67dea61142a"})
+	if err == nil {
+		t.Error("order without items was accepted")
+	}
+}
+
+func TestCompareSchemasFlagsBreakingChanges(t *testing.T) {
+	base := `{"type":"object","required":["a"],"properties":{"a":{"type":"string","maxLength":10},"b":{"type":"integer","enum":[1,2]}}}`
+	cases := []struct {
+		schema   string
+		breaking bool
+	}{
+		{base, false},
+		{`{"type":"object","required":["a"],"properties":{"a":{"type":"string","maxLength":20},"b":{"type":"integer","enum":[1,2,3]},"c":{"type":"string"}}}`, false},
+		{`{"type":"object","required":["a"],"properties":{"a":{"type":"string"}}}`, true},
+		{`{"type":"object","required":["a","b"],"properties":{"a":{"type":"string","maxLength":10},"b":{"type":"integer","enum":[1,2]}}}`, true},
+		{`{"type":"object","required":["a"],"properties":{"a":{"type":"integer"},"b":{"type":"integer","enum":[1,2]}}}`, true},
+		{`{"type":"object","required":["a"],"properties":{"a":{"type":"string","maxLength":5},"b":{"type":"integer","enum":[1,2]}}}`, true},
+		{`{"type":"object","required":["a"],"properties":{"a":{"type":"string","maxLength":10},"b":{"type":"integer","enum":[1]}}}`, true},
+		{`{"type":"object","required":["a"],"additionalProperties":false,"properties":{"a":{"type":"string","maxLength":10},"b":{"type":"integer","enum":[1,2]}}}`, true},
+	}
+	old := decodeSchema(t, base)
+	for i, c := range cases {
+		cur := decodeSchema(t, c.schema)
+		problems := compareSchemas(old, cur, old, cur, "")
+		if got := len(problems) > 0; got != c.breaking {
+			t.Errorf("case %d: breaking = %v (%v), want %v", i, got, problems, c.breaking)
+		}
+	}
+}
+
+// compareSchemas lists the changes from old to cur that would reject events old accepted.
+// Roots are kept to resolve local $refs.
+func compareSchemas(oldRoot, curRoot, old, cur map[string]any, at string) []string {
+	old, cur = resolveRef(oldRoot, old), resolveRef(curRoot, cur)
+	if at == "" {
+		at = "/"
+	}
+	var problems []string
+	report := func(format string, args ...any) {
+		problems = append(problems, at+": "+fmt.Sprintf(format, args...))
+	}
+
+	if !reflect.DeepEqual(old["type"], cur["type"]) {
+		report("type changed from %v to %v", old["type"], cur["type"])
+	}
+	oldRequired := stringSet(old["required"])
+	for name := range stringSet(cur["required"]) {
+		if !oldRequired[name] {
+			report("%q became required", name)
+		}
+	}
+	if cur["additionalProperties"] == false && old["additionalProperties"] != false {
+		report("additional properties are no longer allowed")
+	}
+	for _, keyword := range []string{"pattern", "format", "const"} {
+		if v, ok := cur[keyword]; ok && !reflect.DeepEqual(old[keyword], v) {
+			report("%s changed from %v to %v", keyword, old[keyword], v)
+		}
+	}
+	for _, keyword := range []string{"minimum", "minLength", "minItems", "exclusiveMinimum"} {
+		if v, ok := number(cur[keyword]); ok {
+			if o, had := number(old[keyword]); !had || v > o {
+				report("%s raised to %v", keyword, v)
+			}
+		}
+	}
+	for _, keyword := range []string{"maximum", "maxLength", "maxItems", "exclusiveMaximum"} {
+		if v, ok := number(cur[keyword]); ok {
+			if o, had := number(old[keyword]); !had || v < o {
+				report("%s lowered to %v", keyword, v)
+			}
+		}
+	}
+	if curEnum, ok := cur["enum"].([]any); ok {
+		oldEnum, _ := old["enum"].([]any)
+		if oldEnum == nil {
+			report("enum added")
+		}
+		for _, v := range oldEnum {
+			if !containsValue(curEnum, v) {
+				report("enum value %v removed", v)
+			}
+		}
+	}
+
+	oldProps, _ := old["properties"].(map[string]any)
+	curProps, _ := cur["properties"].(map[string]any)
+	names := make([]string, 0, len(oldProps))
+	for name := range oldProps {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		curProp, ok := curProps[name].(map[string]any)
+		if !ok {
+			report("property %q removed", name)
+			continue
+		}
+		problems = append(problems, compareSchemas(oldRoot, curRoot, oldProps[name].(map[string]any), curProp, strings.TrimSuffix(at, "/")+"/"+name)...)
+	}
+	if oldItems, ok := old["items"].(map[string]any); ok {
+		curItems, ok := cur["items"].(map[string]any)
+		if !ok {
+			report("items schema removed")
+		} else {
+			problems = append(problems, compareSchemas(oldRoot, curRoot, oldItems, curItems, strings.TrimSuffix(at, "/")+"/[]")...)
+		}
+	}
+	return problems
+}
+
+// resolveRef follows a local "#/..." $ref
+func resolveRef(root, schema map[string]any) map[string]any {
+	ref, ok := schema["$ref"].(string)
+	if !ok || !strings.HasPrefix(ref, "#/") {
+		return schema
+	}
+	var node any = root
+	for _, part := range strings.Split(strings.TrimPrefix(ref, "#/"), "/") {
+		m, _ := node.(map[string]any)
+		node = m[part]
+	}
+	if resolved, ok := node.(map[string]any); ok {
+		return resolveRef(root, resolved)
+	}
+	return schema
+}
+
+func stringSet(v any) map[string]bool {
+	set := map[string]bool{}
+	list, _ := v.([]any)
+	for _, s := range list {
+		if str, ok := s.(string); ok {
+			set[str] = true
+		}
+	}
+	return set
+}
+
+func number(v any) (float64, bool) {
+	f, ok := v.(float64)
+	return f, ok
+}
+
+func containsValue(list []any, v any) bool {
+	for _, item := range list {
+		if reflect.DeepEqual(item, v) {
+			return true
+		}
+	}
+	return false
+}
+
+func readSchemaDir(t *testing.T, dir string) map[string]map[string]any {
+	t.Helper()
+	schemas := map[string]map[string]any{}
+	for _, file := range glob(t, filepath.Join(dir, "*.json")) {
+		raw, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		schemas[filepath.Base(file)] = decodeSchema(t, string(raw))
+	}
+	return schemas
+}
+
+func decodeSchema(t *testing.T, raw string) map[string]any {
+	t.Helper()
+	var schema map[string]any
+	if err := json.Unmarshal([]byte(raw), &schema); err != nil {
+		t.Fatal(err)
+	}
+	return schema
+}
+
+func glob(t *testing.T, pattern string) []string {
+	t.Helper()
+	files, err := filepath.Glob(pattern)
+	if err != nil || len(files) == 0 {
+		t.Fatalf("no files match %s", pattern)
+	}
+	return files
+}
@@ -0,0 +1,144 @@
+// Package events is the contract between the services that write and read Kafka events:
+// the envelope every event travels in, the payload types, and the JSON Schemas both ends
+// validate against.
+package events
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+)
+
+var (
+	ErrInvalidEvent  = errors.New("invalid event")
+	ErrUnknownSchema = errors.New("unknown event schema")
+)
+
+// Envelope wraps every event payload. Version is the schema version of Data for Type.
+type Envelope struct {
+	ID        string          `json:"id"`
+	Type      string          `json:"type"`
+	Version   int             `json:"version"`
+	Timestamp time.Time       `json:"timestamp"`
+	Source    string          `json:"source"`
+	Data      json.RawMessage `json:"data"`
+}
+
+// New wraps data in an envelope at the current schema version of eventType,
+// failing with ErrInvalidEvent when data does not match the schema
+func New(source string, eventType string, data any) (Envelope, error) {
+	version := CurrentVersion(eventType)
+	if version == 0 {
+		return Envelope{}, fmt.Errorf("%w: %s", ErrUnknownSchema, eventType)
+	}
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return Envelope{}, err
+	}
+	doc, err := decodeJSON(payload)
+	if err != nil {
+		return Envelope{}, err
+	}
+	if err := validateData(eventType, version, doc); err != nil {
+		return Envelope{}, err
+	}
+	return Envelope{
+		ID:        newID(),
+		Type:      eventType,
+		Version:   version,
+		Timestamp: time.Now().UTC(),
+		Source:    source,
+		Data:      payload,
+	}, nil
+}
+
+// Unmarshal parses and validates an event: the envelope first, then Data against the schema
+// for its type and version.
+//
+// Messages written before events had an envelope are bare payloads with an optional "type"
+// (defaulting to order.create); they are read as version 1 with an empty ID and source. Their
+// tip was in dollars, before amounts were in minor units, and is converted to cents.
+func Unmarshal(raw []byte) (Envelope, error) {
+	doc, err := decodeJSON(raw)
+	if err != nil {
+		return Envelope{}, fmt.Errorf("%w: %v", ErrInvalidEvent, err)
+	}
+	fields, ok := doc.(map[string]any)
+	if !ok {
+		return Envelope{}, fmt.Errorf("%w: not a JSON object", ErrInvalidEvent)
+	}
+
+	data, enveloped := fields["data"]
+	if !enveloped {
+		eventType, _ := fields["type"].(string)
+		if eventType == "" {
+			eventType = TypeOrderCreate
+		}
+		if eventType == TypeOrderCreate {
+			if raw, err = tipInCents(fields); err != nil {
+				return Envelope{}, err
+			}
+		}
+		if err := validateData(eventType, 1, fields); err != nil {
+			return Envelope{}, err
+		}
+		return Envelope{Type: eventType, Version: 1, Data: raw}, nil
+	}
+
+	if err := envelopeSchema.Validate(doc); err != nil {
+		return Envelope{}, fmt.Errorf("%w: envelope: %v", ErrInvalidEvent, err)
+	}
+	var env Envelope
+	if err := json.Unmarshal(raw, &env); err != nil {
+		return Envelope{}, fmt.Errorf("%w: %v", ErrInvalidEvent, err)
+	}
+	if err := validateData(env.Type, env.Version, data); err != nil {
+		return Envelope{}, err
+	}
+	return env, nil
+}
+
+// tipInCents converts the dollar tip of a bare order.create payload, rounding half away from
+// zero, and returns the payload encoded again
+func tipInCents(fields map[string]any) ([]byte, error) {
+	if n, ok := fields["tip"].(json.Number); ok {
+		dollars, err := n.Float64()
+		if err != nil || math.IsInf(dollars*100, 0) {
+			return nil, fmt.Errorf("%w: tip %s is not an amount", ErrInvalidEvent, n)
+		}
+		fields["tip"] = json.Number(strconv.FormatFloat(math.Round(dollars*100), 'f', -1, 64))
+	}
+	return json.Marshal(fields)
+}
+
+// Decode unmarshals Data into v, one of the payload types of this package
+func (e Envelope) Decode(v any) error {
+	return json.Unmarshal(e.Data, v)
+}
+
+// decodeJSON decodes into the generic form the validator expects, keeping numbers exact
+func decodeJSON(b []byte) (any, error) {
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+	var v any
+	if err := dec.Decode(&v); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+// newID returns a random (version 4) UUID
+func newID() string {
+	var b [16]byte
+	_, _ = rand.Read(b[:])
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	h := hex.EncodeToString(b[:])
+	return h[0:8] + "-" + h[8:12] + "-" + h[12:16] + "-" + h[16:20] + "-" + h[20:]
+}
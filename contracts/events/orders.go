@@ -0,0 +1,77 @@
+package events
+
+// Event types on the orders topic
+const (
+	TypeOrderCreate = "order.create"
+	TypeOrderCancel = "order.cancel"
+	TypeOrderRefund = "order.refund"
+)
+
+// versions is the schema version producers write for each event type. Bumping one requires a new
+// schemas/<type>.v<N>.json; published versions are frozen (see compat_test.go).
+var versions = map[string]int{
+	TypeOrderCreate: 1,
+	TypeOrderCancel: 1,
+	TypeOrderRefund: 2,
+}
+
+// CurrentVersion returns the schema version written for eventType, 0 when the type is unknown
+func CurrentVersion(eventType string) int {
+	return versions[eventType]
+}
+
+// OrderCreate asks the consumer to price and persist a new order (order.create v1)
+type OrderCreate struct {
+	RestaurantID string      `json:"restaurantId"`
+	Items        []OrderItem `json:"items"`
+	PromoCode    string      `json:"promoCode,omitempty"`
+	Tip          int64       `json:"tip,omitempty"` // minor units of the restaurant currency
+}
+
+type OrderItem struct {
+	ID        string     `json:"id"`
+	Quantity  int        `json:"quantity"`
+	Modifiers []Modifier `json:"modifiers,omitempty"`
+	Notes     string     `json:"notes,omitempty"`
+}
+
+// Modifier selects a modifier option; the consumer validates it against the menu
+type Modifier struct {
+	GroupID  string `json:"groupId"`
+	OptionID string `json:"optionId"`
+}
+
+// OrderCancel asks the consumer to cancel an order (order.cancel v1)
+type OrderCancel struct {
+	RestaurantID string `json:"restaurantId"`
+	OrderID      string `json:"orderId"`
+	Reason       string `json:"reason,omitempty"`
+}
+
+// OrderRefund asks the consumer to refund the given lines, or the whole order when Items is empty (order.refund v2)
+type OrderRefund struct {
+	RestaurantID string       `json:"restaurantId"`
+	OrderID      string       `json:"orderId"`
+	Reason       string       `json:"reason,omitempty"`
+	Items        []RefundItem `json:"items,omitempty"`
+}
+
+// RefundItem refunds a quantity of the order line at index Line, counting from 0
+type RefundItem struct {
+	Line     int `json:"line"`
+	Quantity int `json:"quantity"`
+}
+
+// OrderRefundV1 is order.refund v1, which named items rather than lines; an item on several
+// lines is refunded from the first of them. Consumers still read it.
+type OrderRefundV1 struct {
+	RestaurantID string         `json:"restaurantId"`
+	OrderID      string         `json:"orderId"`
+	Reason       string         `json:"reason,omitempty"`
+	Items        []RefundItemV1 `json:"items,omitempty"`
+}
+
+type RefundItemV1 struct {
+	ID       string `json:"id"`
+	Quantity int    `json:"quantity"`
+}
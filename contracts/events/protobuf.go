@@ -0,0 +1,171 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/bufbuild/protocompile"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+// protobufFormat encodes the envelope as the Event message of the schema's .proto file.
+// Messages are built dynamically from the descriptor, so there is no generated code to keep in sync.
+type protobufFormat struct{}
+
+const timestampName protoreflect.FullName = "google.protobuf.Timestamp"
+
+func (protobufFormat) compile(schema string) (any, error) {
+	const file = "event.proto"
+	compiler := protocompile.Compiler{
+		Resolver: protocompile.WithStandardImports(&protocompile.SourceResolver{
+			Accessor: protocompile.SourceAccessorFromMap(map[string]string{file: schema}),
+		}),
+	}
+	files, err := compiler.Compile(context.Background(), file)
+	if err != nil {
+		return nil, err
+	}
+	event := files[0].Messages().ByName("Event")
+	if event == nil {
+		return nil, fmt.Errorf("protobuf schema has no Event message")
+	}
+	return event, nil
+}
+
+func (protobufFormat) encode(compiled any, doc map[string]any) ([]byte, error) {
+	msg := dynamicpb.NewMessage(compiled.(protoreflect.MessageDescriptor))
+	if err := fillMessage(msg, doc); err != nil {
+		return nil, err
+	}
+	return proto.Marshal(msg)
+}
+
+func (protobufFormat) decode(compiled any, value []byte) (map[string]any, error) {
+	msg := dynamicpb.NewMessage(compiled.(protoreflect.MessageDescriptor))
+	if err := proto.Unmarshal(value, msg); err != nil {
+		return nil, err
+	}
+	return messageDoc(msg), nil
+}
+
+// fillMessage sets the fields of msg from doc, matching keys to the fields' JSON names.
+// Keys the schema doesn't know are dropped.
+func fillMessage(msg protoreflect.Message, doc map[string]any) error {
+	fields := msg.Descriptor().Fields()
+	for key, v := range doc {
+		fd := fields.ByJSONName(key)
+		if fd == nil || v == nil {
+			continue
+		}
+		if fd.IsList() {
+			items, ok := v.([]any)
+			if !ok {
+				return fmt.Errorf("%s: expected a list", key)
+			}
+			list := msg.Mutable(fd).List()
+			for _, item := range items {
+				pv, err := protoValue(list.NewElement, fd, item)
+				if err != nil {
+					return fmt.Errorf("%s: %w", key, err)
+				}
+				list.Append(pv)
+			}
+			continue
+		}
+		pv, err := protoValue(func() protoreflect.Value { return msg.NewField(fd) }, fd, v)
+		if err != nil {
+			return fmt.Errorf("%s: %w", key, err)
+		}
+		msg.Set(fd, pv)
+	}
+	return nil
+}
+
+func protoValue(newMessage func() protoreflect.Value, fd protoreflect.FieldDescriptor, v any) (protoreflect.Value, error) {
+	switch fd.Kind() {
+	case protoreflect.StringKind:
+		if s, ok := v.(string); ok {
+			return protoreflect.ValueOfString(s), nil
+		}
+	case protoreflect.BoolKind:
+		if b, ok := v.(bool); ok {
+			return protoreflect.ValueOfBool(b), nil
+		}
+	case protoreflect.Int32Kind, protoreflect.Sint32Kind, protoreflect.Sfixed32Kind:
+		if n, ok := v.(json.Number); ok {
+			i, err := n.Int64()
+			return protoreflect.ValueOfInt32(int32(i)), err
+		}
+	case protoreflect.Int64Kind, protoreflect.Sint64Kind, protoreflect.Sfixed64Kind:
+		if n, ok := v.(json.Number); ok {
+			i, err := n.Int64()
+			return protoreflect.ValueOfInt64(i), err
+		}
+	case protoreflect.DoubleKind:
+		if n, ok := v.(json.Number); ok {
+			f, err := n.Float64()
+			return protoreflect.ValueOfFloat64(f), err
+		}
+	case protoreflect.MessageKind:
+		if fd.Message().FullName() == timestampName {
+			s, _ := v.(string)
+			t, err := time.Parse(time.RFC3339Nano, s)
+			if err != nil {
+				return protoreflect.Value{}, err
+			}
+			pv := newMessage()
+			fields := fd.Message().Fields()
+			pv.Message().Set(fields.ByName("seconds"), protoreflect.ValueOfInt64(t.Unix()))
+			pv.Message().Set(fields.ByName("nanos"), protoreflect.ValueOfInt32(int32(t.Nanosecond())))
+			return pv, nil
+		}
+		doc, ok := v.(map[string]any)
+		if !ok {
+			break
+		}
+		pv := newMessage()
+		if err := fillMessage(pv.Message(), doc); err != nil {
+			return protoreflect.Value{}, err
+		}
+		return pv, nil
+	default:
+		return protoreflect.Value{}, fmt.Errorf("unsupported field kind %s", fd.Kind())
+	}
+	return protoreflect.Value{}, fmt.Errorf("unexpected value %v for %s field", v, fd.Kind())
+}
+
+// messageDoc is the inverse of fillMessage; fields left at their zero value are omitted
+func messageDoc(msg protoreflect.Message) map[string]any {
+	doc := map[string]any{}
+	msg.Range(func(fd protoreflect.FieldDescriptor, v protoreflect.Value) bool {
+		if fd.IsList() {
+			list := v.List()
+			items := make([]any, list.Len())
+			for i := range items {
+				items[i] = docValue(fd, list.Get(i))
+			}
+			doc[fd.JSONName()] = items
+			return true
+		}
+		doc[fd.JSONName()] = docValue(fd, v)
+		return true
+	})
+	return doc
+}
+
+func docValue(fd protoreflect.FieldDescriptor, v protoreflect.Value) any {
+	if fd.Kind() != protoreflect.MessageKind {
+		return v.Interface()
+	}
+	if fd.Message().FullName() == timestampName {
+		fields := fd.Message().Fields()
+		m := v.Message()
+		t := time.Unix(m.Get(fields.ByName("seconds")).Int(), m.Get(fields.ByName("nanos")).Int())
+		return t.UTC().Format(time.RFC3339Nano)
+	}
+	return messageDoc(v.Message())
+}
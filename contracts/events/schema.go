@@ -0,0 +1,91 @@
+package events
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	"io/fs"
+	"path"
+	"strings"
+
+	"github.com/santhosh-tekuri/jsonschema/v5"
+)
+
+// schemaBaseURL matches the $id of the files under schemas/
+const schemaBaseURL = "https://restaurant-orders/events/"
+
+//go:embed schemas
+var schemaFiles embed.FS
+
+var (
+	envelopeSchema *jsonschema.Schema
+	// dataSchemas is keyed by "<type>.v<version>", the file name without .json
+	dataSchemas map[string]*jsonschema.Schema
+)
+
+func init() {
+	var err error
+	envelopeSchema, dataSchemas, err = compileSchemas(schemaFiles, "schemas")
+	if err != nil {
+		panic(err)
+	}
+}
+
+// compileSchemas compiles every <name>.json under dir; envelope.v1 is returned apart
+func compileSchemas(fsys fs.FS, dir string) (*jsonschema.Schema, map[string]*jsonschema.Schema, error) {
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return nil, nil, err
+	}
+	compiler := jsonschema.NewCompiler()
+	compiler.Draft = jsonschema.Draft2020
+	compiler.AssertFormat = true
+	var names []string
+	for _, e := range entries {
+		if e.IsDir() || path.Ext(e.Name()) != ".json" {
+			continue
+		}
+		b, err := fs.ReadFile(fsys, path.Join(dir, e.Name()))
+		if err != nil {
+			return nil, nil, err
+		}
+		if err := compiler.AddResource(schemaBaseURL+e.Name(), bytes.NewReader(b)); err != nil {
+			return nil, nil, fmt.Errorf("schema %s: %w", e.Name(), err)
+		}
+		names = append(names, strings.TrimSuffix(e.Name(), ".json"))
+	}
+
+	var envelope *jsonschema.Schema
+	schemas := make(map[string]*jsonschema.Schema, len(names))
+	for _, name := range names {
+		s, err := compiler.Compile(schemaBaseURL + name + ".json")
+		if err != nil {
+			return nil, nil, fmt.Errorf("schema %s: %w", name, err)
+		}
+		if name == "envelope.v1" {
+			envelope = s
+			continue
+		}
+		schemas[name] = s
+	}
+	if envelope == nil {
+		return nil, nil, fmt.Errorf("schema envelope.v1 is missing")
+	}
+	return envelope, schemas, nil
+}
+
+func schemaKey(eventType string, version int) string {
+	return fmt.Sprintf("%s.v%d", eventType, version)
+}
+
+// validateData checks a decoded payload (see decodeJSON) against its schema
+func validateData(eventType string, version int, data any) error {
+	schema, ok := dataSchemas[schemaKey(eventType, version)]
+	if !ok {
+		return fmt.Errorf("%w: %s v%d", ErrUnknownSchema, eventType, version)
+	}
+	if err := schema.Validate(data); err != nil {
+		return fmt.Errorf("%w: %s v%d: %v", ErrInvalidEvent, eventType, version, err)
+	}
+	return nil
+}
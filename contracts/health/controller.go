@@ -0,0 +1,38 @@
+package health
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+type Controller struct {
+	service *Service
+}
+
+func NewController(service *Service) *Controller {
+	return &Controller{service: service}
+}
+
+func (c *Controller) RegisterRoutes(router *gin.Engine) {
+	router.GET("/healthz", c.Live)
+	router.GET("/readyz", c.Ready)
+}
+
+// Live answers 503 when the process is stuck and should be restarted
+func (c *Controller) Live(ctx *gin.Context) {
+	respond(ctx, c.service.Live(ctx))
+}
+
+// Ready answers 503 while a dependency is unavailable, so that no traffic is sent to the service
+func (c *Controller) Ready(ctx *gin.Context) {
+	respond(ctx, c.service.Ready(ctx))
+}
+
+func respond(ctx *gin.Context, report Report) {
+	status := http.StatusOK
+	if report.Status != StatusOK {
+		status = http.StatusServiceUnavailable
+	}
+	ctx.JSON(status, report)
+}
@@ -0,0 +1,146 @@
+package health
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"contracts/kafkaconn"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/redis/go-redis/v9"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/readpref"
+)
+
+// Check reports whether a dependency works, with optional details for the report
+type Check func(ctx context.Context) (any, error)
+
+// Statuses of a report and of each of its checks
+const (
+	StatusOK          = "ok"
+	StatusFailing     = "failing"
+	StatusUnavailable = "unavailable"
+)
+
+// CheckReport is the outcome of one check
+type CheckReport struct {
+	Status  string `json:"status"`
+	Latency string `json:"latency"`
+	Error   string `json:"error,omitempty"`
+	Details any    `json:"details,omitempty"`
+}
+
+// Report is the outcome of all the checks of an endpoint; it is ok when every check is
+type Report struct {
+	Status string                 `json:"status"`
+	Checks map[string]CheckReport `json:"checks"`
+}
+
+type Service struct {
+	timeout   time.Duration
+	liveness  map[string]Check
+	readiness map[string]Check
+}
+
+// NewService runs every check with timeout. Liveness checks tell whether the process should
+// be restarted, so they must not depend on other services; readiness checks tell whether it
+// can do its work, so they include every dependency.
+func NewService(timeout time.Duration) *Service {
+	return &Service{
+		timeout:   timeout,
+		liveness:  make(map[string]Check),
+		readiness: make(map[string]Check),
+	}
+}
+
+func (s *Service) AddLiveness(name string, check Check) {
+	s.liveness[name] = check
+}
+
+func (s *Service) AddReadiness(name string, check Check) {
+	s.readiness[name] = check
+}
+
+func (s *Service) Live(ctx context.Context) Report {
+	return s.run(ctx, s.liveness)
+}
+
+func (s *Service) Ready(ctx context.Context) Report {
+	return s.run(ctx, s.readiness)
+}
+
+// run runs the checks concurrently
+func (s *Service) run(ctx context.Context, checks map[string]Check) Report {
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
+	report := Report{Status: StatusOK, Checks: make(map[string]CheckReport, len(checks))}
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for name, check := range checks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			start := time.Now()
+			details, err := check(ctx)
+			result := CheckReport{Status: StatusOK, Latency: time.Since(start).Round(time.Microsecond).String(), Details: details}
+			if err != nil {
+				result.Status, result.Error = StatusFailing, err.Error()
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			report.Checks[name] = result
+			if err != nil {
+				report.Status = StatusUnavailable
+			}
+		}()
+	}
+	wg.Wait()
+	return report
+}
+
+// MongoCheck pings the primary
+func MongoCheck(client *mongo.Client) Check {
+	return func(ctx context.Context) (any, error) {
+		return nil, client.Ping(ctx, readpref.Primary())
+	}
+}
+
+// PostgresCheck pings the server on a connection of the pool, reporting the pool's use
+func PostgresCheck(pool *pgxpool.Pool) Check {
+	return func(ctx context.Context) (any, error) {
+		if err := pool.Ping(ctx); err != nil {
+			return nil, err
+		}
+		stat := pool.Stat()
+		return map[string]int32{"connections": stat.TotalConns(), "idle": stat.IdleConns()}, nil
+	}
+}
+
+// RedisCheck pings the server
+func RedisCheck(client *redis.Client) Check {
+	return func(ctx context.Context) (any, error) {
+		return nil, client.Ping(ctx).Err()
+	}
+}
+
+// KafkaCheck connects to a bootstrap broker and reads the cluster's brokers from its metadata
+func KafkaCheck(conn *kafkaconn.Conn) Check {
+	return func(ctx context.Context) (any, error) {
+		broker, err := conn.Dial(ctx)
+		if err != nil {
+			return nil, err
+		}
+		defer broker.Close()
+		if deadline, ok := ctx.Deadline(); ok {
+			_ = broker.SetDeadline(deadline)
+		}
+		brokers, err := broker.Brokers()
+		if err != nil {
+			return nil, err
+		}
+		return map[string]int{"brokers": len(brokers)}, nil
+	}
+}
@@ -0,0 +1,160 @@
+// Package kafkaconn connects kafka-go readers, writers and dialers to a cluster: any of its
+// bootstrap brokers, over TLS and authenticated with SASL when configured.
+package kafkaconn
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"time"
+
+	"contracts/configload"
+	"contracts/tlsconfig"
+
+	"github.com/segmentio/kafka-go"
+	"github.com/segmentio/kafka-go/sasl"
+	"github.com/segmentio/kafka-go/sasl/plain"
+	"github.com/segmentio/kafka-go/sasl/scram"
+)
+
+// SASL mechanisms
+const (
+	MechanismNone        = "none"
+	MechanismPlain       = "plain"
+	MechanismScramSHA256 = "scram-sha-256"
+	MechanismScramSHA512 = "scram-sha-512"
+)
+
+// Config is the connection part of a service's Kafka settings, inlined in its kafka section
+type Config struct {
+	Brokers []string   `yaml:"brokers" env:"KAFKA_BROKERS" usage:"bootstrap brokers as host:port,host:port"`
+	TLS     TLSConfig  `yaml:"tls"`
+	SASL    SASLConfig `yaml:"sasl"`
+}
+
+// TLSConfig verifies the brokers against CAFile, or the system roots without it, and presents
+// CertFile and KeyFile to brokers that require client certificates
+type TLSConfig struct {
+	Enabled            bool   `yaml:"enabled" env:"KAFKA_TLS_ENABLED" usage:"connect to the brokers over TLS"`
+	CAFile             string `yaml:"caFile" env:"KAFKA_TLS_CA_FILE" usage:"PEM CA bundle the brokers are verified against, instead of the system roots"`
+	CertFile           string `yaml:"certFile" env:"KAFKA_TLS_CERT_FILE" usage:"PEM client certificate"`
+	KeyFile            string `yaml:"keyFile" env:"KAFKA_TLS_KEY_FILE" usage:"PEM client key"`
+	ServerName         string `yaml:"serverName" env:"KAFKA_TLS_SERVER_NAME" usage:"broker name to verify, when it differs from the host dialed"`
+	InsecureSkipVerify bool   `yaml:"insecureSkipVerify" env:"KAFKA_TLS_INSECURE_SKIP_VERIFY" usage:"accept any broker certificate, for testing only"`
+}
+
+type SASLConfig struct {
+	Mechanism string `yaml:"mechanism" env:"KAFKA_SASL_MECHANISM" usage:"SASL mechanism: none, plain, scram-sha-256 or scram-sha-512"`
+	Username  string `yaml:"username" env:"KAFKA_SASL_USERNAME" usage:"SASL username"`
+	Password  string `yaml:"password" env:"KAFKA_SASL_PASSWORD" secret:"true" usage:"SASL password"`
+}
+
+// Default connects to a local PLAINTEXT broker
+func Default(brokers ...string) Config {
+	return Config{Brokers: brokers, SASL: SASLConfig{Mechanism: MechanismNone}}
+}
+
+// Validate checks the settings under prefix, e.g. "kafka."
+func (c Config) Validate(errs *configload.Errors, prefix string) {
+	if len(c.Brokers) == 0 {
+		errs.Check(prefix+"brokers", errors.New("is required"))
+	}
+	for _, broker := range c.Brokers {
+		errs.Check(prefix+"brokers", configload.HostPort(broker))
+	}
+
+	if !c.TLS.Enabled && (c.TLS.CAFile != "" || c.TLS.CertFile != "" || c.TLS.KeyFile != "") {
+		errs.Check(prefix+"tls.enabled", errors.New("is required by the TLS files"))
+	}
+	if (c.TLS.CertFile == "") != (c.TLS.KeyFile == "") {
+		errs.Check(prefix+"tls", errors.New("certFile and keyFile go together"))
+	}
+
+	errs.Check(prefix+"sasl.mechanism", configload.OneOf(c.SASL.Mechanism, MechanismNone, MechanismPlain, MechanismScramSHA256, MechanismScramSHA512))
+	if c.SASL.Mechanism != MechanismNone {
+		errs.Check(prefix+"sasl.username", configload.Required(c.SASL.Username))
+		errs.Check(prefix+"sasl.password", configload.Required(c.SASL.Password))
+	}
+}
+
+// Conn holds the brokers, TLS settings and SASL mechanism every Kafka client of a service shares
+type Conn struct {
+	Brokers []string
+
+	tls       *tls.Config
+	mechanism sasl.Mechanism
+	transport *kafka.Transport
+}
+
+// New reads the TLS files and prepares the SASL mechanism of cfg
+func New(cfg Config) (*Conn, error) {
+	c := &Conn{Brokers: cfg.Brokers}
+	if cfg.TLS.Enabled {
+		var err error
+		if c.tls, err = tlsconfig.Load(cfg.TLS.CAFile, cfg.TLS.CertFile, cfg.TLS.KeyFile); err != nil {
+			return nil, fmt.Errorf("kafka tls: %w", err)
+		}
+		c.tls.ServerName = cfg.TLS.ServerName
+		c.tls.InsecureSkipVerify = cfg.TLS.InsecureSkipVerify
+	}
+	switch cfg.SASL.Mechanism {
+	case "", MechanismNone:
+	case MechanismPlain:
+		c.mechanism = plain.Mechanism{Username: cfg.SASL.Username, Password: cfg.SASL.Password}
+	case MechanismScramSHA256, MechanismScramSHA512:
+		algo := scram.SHA256
+		if cfg.SASL.Mechanism == MechanismScramSHA512 {
+			algo = scram.SHA512
+		}
+		mechanism, err := scram.Mechanism(algo, cfg.SASL.Username, cfg.SASL.Password)
+		if err != nil {
+			return nil, fmt.Errorf("kafka sasl: %w", err)
+		}
+		c.mechanism = mechanism
+	default:
+		return nil, fmt.Errorf("kafka sasl: unknown mechanism %q", cfg.SASL.Mechanism)
+	}
+	c.transport = &kafka.Transport{TLS: c.tls, SASL: c.mechanism}
+	return c, nil
+}
+
+// Addr is the writers' address: any of the bootstrap brokers
+func (c *Conn) Addr() net.Addr {
+	return kafka.TCP(c.Brokers...)
+}
+
+// Transport is the writers' transport, whose connections they share
+func (c *Conn) Transport() *kafka.Transport {
+	return c.transport
+}
+
+// Close closes the writers' connections; writers don't close a transport they were given
+func (c *Conn) Close() {
+	c.transport.CloseIdleConnections()
+}
+
+// Dialer is the readers' dialer
+func (c *Conn) Dialer() *kafka.Dialer {
+	return &kafka.Dialer{
+		Timeout:       10 * time.Second,
+		DualStack:     true,
+		TLS:           c.tls,
+		SASLMechanism: c.mechanism,
+	}
+}
+
+// Dial connects to the first bootstrap broker that answers
+func (c *Conn) Dial(ctx context.Context) (*kafka.Conn, error) {
+	dialer := c.Dialer()
+	var errs []error
+	for _, broker := range c.Brokers {
+		conn, err := dialer.DialContext(ctx, "tcp", broker)
+		if err == nil {
+			return conn, nil
+		}
+		errs = append(errs, err)
+	}
+	return nil, errors.Join(errs...)
+}
@@ -0,0 +1,149 @@
+package kafkaconn
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"contracts/configload"
+)
+
+func TestValidate(t *testing.T) {
+	for name, tc := range map[string]struct {
+		cfg  Config
+		want []string
+	}{
+		"default": {cfg: Default("localhost:9094")},
+		"brokers": {
+			cfg:  Config{Brokers: []string{"a:9092", "b"}, SASL: SASLConfig{Mechanism: MechanismNone}},
+			want: []string{`kafka.brokers: "b" is not host:port`},
+		},
+		"no brokers": {
+			cfg:  Default(),
+			want: []string{"kafka.brokers: is required"},
+		},
+		"tls files": {
+			cfg:  Config{Brokers: []string{"a:9093"}, TLS: TLSConfig{CertFile: "client.pem"}, SASL: SASLConfig{Mechanism: MechanismNone}},
+			want: []string{"kafka.tls.enabled: is required", "kafka.tls: certFile and keyFile go together"},
+		},
+		"sasl": {
+			cfg:  Config{Brokers: []string{"a:9093"}, SASL: SASLConfig{Mechanism: MechanismScramSHA512, Username: "app"}},
+			want: []string{"kafka.sasl.password: is required"},
+		},
+		"mechanism": {
+			cfg:  Config{Brokers: []string{"a:9093"}, SASL: SASLConfig{Mechanism: "gssapi"}},
+			want: []string{`kafka.sasl.mechanism: "gssapi" is not one of`},
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			var errs configload.Errors
+			tc.cfg.Validate(&errs, "kafka.")
+			err := errs.Err()
+			if len(tc.want) == 0 && err != nil {
+				t.Fatalf("unexpected error %v", err)
+			}
+			for _, want := range tc.want {
+				if err == nil || !strings.Contains(err.Error(), want) {
+					t.Errorf("got error %v, want one containing %q", err, want)
+				}
+			}
+		})
+	}
+}
+
+func TestNewSASL(t *testing.T) {
+	for mechanism, want := range map[string]string{
+		MechanismNone:        "",
+		MechanismPlain:       "PLAIN",
+		MechanismScramSHA256: "SCRAM-SHA-256",
+		MechanismScramSHA512: "SCRAM-SHA-512",
+	} {
+		conn, err := New(Config{Brokers: []string{"a:9093"}, SASL: SASLConfig{Mechanism: mechanism, Username: "app", Password: "secret"}})
+		if err != nil {
+			t.Fatalf("%s: %v", mechanism, err)
+		}
+		got := ""
+		if m := conn.Dialer().SASLMechanism; m != nil {
+			got = m.Name()
+		}
+		if got != want || conn.Transport().SASL != conn.Dialer().SASLMechanism {
+			t.Errorf("%s: dialer uses %q, want %q on the dialer and transport", mechanism, got, want)
+		}
+	}
+}
+
+func TestNewTLS(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := writeCert(t, dir)
+
+	conn, err := New(Config{
+		Brokers: []string{"a:9093", "b:9093"},
+		TLS:     TLSConfig{Enabled: true, CAFile: certFile, CertFile: certFile, KeyFile: keyFile, ServerName: "kafka"},
+		SASL:    SASLConfig{Mechanism: MechanismNone},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tls := conn.Dialer().TLS
+	if tls == nil || tls.RootCAs == nil || len(tls.Certificates) != 1 || tls.ServerName != "kafka" {
+		t.Fatalf("unexpected TLS config %+v", tls)
+	}
+	if conn.Transport().TLS != tls {
+		t.Error("writers should use the readers' TLS config")
+	}
+	if addr := conn.Addr().String(); addr != "a:9093,b:9093" {
+		t.Errorf("got address %q", addr)
+	}
+
+	notPEM := filepath.Join(dir, "ca.txt")
+	if err := os.WriteFile(notPEM, []byte("not a certificate"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := New(Config{Brokers: []string{"a:9093"}, TLS: TLSConfig{Enabled: true, CAFile: notPEM}}); err == nil {
+		t.Error("a CA file without certificates should fail")
+	}
+}
+
+// writeCert writes a self-signed certificate and its key
+func writeCert(t *testing.T, dir string) (string, string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "kafka"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	for path, block := range map[string]*pem.Block{
+		certFile: {Type: "CERTIFICATE", Bytes: der},
+		keyFile:  {Type: "EC PRIVATE KEY", Bytes: keyDER},
+	} {
+		if err := os.WriteFile(path, pem.EncodeToMemory(block), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return certFile, keyFile
+}
@@ -0,0 +1,105 @@
+package kafkatest
+
+import (
+	"sync"
+
+	"github.com/twmb/franz-go/pkg/kfake"
+	"github.com/twmb/franz-go/pkg/kmsg"
+)
+
+// memberID is the ID every member of every group is given
+const memberID = "kafkatest-member"
+
+// groups coordinates the consumer groups in place of the fake broker, which answers kafka-go's
+// JoinGroup v1 requests without a member ID, so that its readers never get past SyncGroup. Each
+// member joins its group on its own and is assigned what it asks for, which is all the group's
+// partitions for a single reader; tests don't run several readers of one group. Offsets are
+// kept per group, topic and partition.
+type groups struct {
+	mu      sync.Mutex
+	offsets map[string]map[string]map[int32]int64
+}
+
+func coordinateGroups(cluster *kfake.Cluster) {
+	g := &groups{offsets: make(map[string]map[string]map[int32]int64)}
+	for _, key := range []kmsg.Key{kmsg.JoinGroup, kmsg.SyncGroup, kmsg.Heartbeat, kmsg.LeaveGroup, kmsg.OffsetCommit, kmsg.OffsetFetch} {
+		cluster.ControlKey(int16(key), func(req kmsg.Request) (kmsg.Response, error, bool) {
+			cluster.KeepControl()
+			return g.handle(req), nil, true
+		})
+	}
+}
+
+func (g *groups) handle(req kmsg.Request) kmsg.Response {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	switch req := req.(type) {
+	case *kmsg.JoinGroupRequest:
+		resp := req.ResponseKind().(*kmsg.JoinGroupResponse)
+		resp.Generation = 1
+		resp.ProtocolType = kmsg.StringPtr(req.ProtocolType)
+		resp.Protocol = kmsg.StringPtr(req.Protocols[0].Name)
+		resp.LeaderID = memberID
+		resp.MemberID = memberID
+		member := kmsg.NewJoinGroupResponseMember()
+		member.MemberID = memberID
+		member.ProtocolMetadata = req.Protocols[0].Metadata
+		resp.Members = append(resp.Members, member)
+		return resp
+	case *kmsg.SyncGroupRequest:
+		resp := req.ResponseKind().(*kmsg.SyncGroupResponse)
+		for _, a := range req.GroupAssignment {
+			if a.MemberID == req.MemberID {
+				resp.MemberAssignment = a.MemberAssignment
+			}
+		}
+		return resp
+	case *kmsg.OffsetCommitRequest:
+		resp := req.ResponseKind().(*kmsg.OffsetCommitResponse)
+		for _, t := range req.Topics {
+			committed := g.topicOffsets(req.Group, t.Topic)
+			rt := kmsg.NewOffsetCommitResponseTopic()
+			rt.Topic = t.Topic
+			for _, p := range t.Partitions {
+				committed[p.Partition] = p.Offset
+				rp := kmsg.NewOffsetCommitResponseTopicPartition()
+				rp.Partition = p.Partition
+				rt.Partitions = append(rt.Partitions, rp)
+			}
+			resp.Topics = append(resp.Topics, rt)
+		}
+		return resp
+	case *kmsg.OffsetFetchRequest:
+		resp := req.ResponseKind().(*kmsg.OffsetFetchResponse)
+		for _, t := range req.Topics {
+			committed := g.topicOffsets(req.Group, t.Topic)
+			rt := kmsg.NewOffsetFetchResponseTopic()
+			rt.Topic = t.Topic
+			for _, p := range t.Partitions {
+				rp := kmsg.NewOffsetFetchResponseTopicPartition()
+				rp.Partition = p
+				// -1 has the reader start at its configured StartOffset
+				rp.Offset = -1
+				if offset, ok := committed[p]; ok {
+					rp.Offset = offset
+				}
+				rt.Partitions = append(rt.Partitions, rp)
+			}
+			resp.Topics = append(resp.Topics, rt)
+		}
+		return resp
+	default:
+		// Heartbeat and LeaveGroup always succeed
+		return req.ResponseKind()
+	}
+}
+
+func (g *groups) topicOffsets(group, topic string) map[int32]int64 {
+	if g.offsets[group] == nil {
+		g.offsets[group] = make(map[string]map[int32]int64)
+	}
+	if g.offsets[group][topic] == nil {
+		g.offsets[group][topic] = make(map[int32]int64)
+	}
+	return g.offsets[group][topic]
+}
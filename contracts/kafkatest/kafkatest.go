@@ -0,0 +1,38 @@
+// Package kafkatest runs an in-process Kafka-compatible broker for tests, so that the services'
+// readers and writers, consumer groups included, run against a real wire protocol without a
+// Kafka cluster
+package kafkatest
+
+import (
+	"testing"
+
+	"contracts/kafkaconn"
+
+	"github.com/twmb/franz-go/pkg/kfake"
+)
+
+// Start runs a broker with the topics created with partitions partitions each, and closes it
+// when the test ends. Topics that don't exist yet are created when first written to.
+func Start(tb testing.TB, partitions int, topics ...string) *kafkaconn.Conn {
+	tb.Helper()
+	cluster, err := kfake.NewCluster(
+		kfake.NumBrokers(1),
+		kfake.AllowAutoTopicCreation(),
+		kfake.DefaultNumPartitions(partitions),
+		kfake.SeedTopics(int32(partitions), topics...),
+	)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	coordinateGroups(cluster)
+	conn, err := kafkaconn.New(kafkaconn.Default(cluster.ListenAddrs()...))
+	if err != nil {
+		cluster.Close()
+		tb.Fatal(err)
+	}
+	tb.Cleanup(func() {
+		conn.Close()
+		cluster.Close()
+	})
+	return conn
+}
@@ -0,0 +1,62 @@
+package kafkatest
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+func TestConsumerGroup(t *testing.T) {
+	conn := Start(t, 3, "orders")
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+	defer cancel()
+
+	w := &kafka.Writer{Addr: conn.Addr(), Transport: conn.Transport(), Topic: "orders", Balancer: &kafka.Hash{}, BatchTimeout: 10 * time.Millisecond}
+	defer w.Close()
+	want := map[string]bool{"a": true, "b": true, "c": true, "d": true}
+	for key := range want {
+		if err := w.WriteMessages(ctx, kafka.Message{Key: []byte(key), Value: []byte(key)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	read := func(n int) []string {
+		r := kafka.NewReader(kafka.ReaderConfig{Brokers: conn.Brokers, Dialer: conn.Dialer(), Topic: "orders", GroupID: "g", MaxWait: 100 * time.Millisecond})
+		defer r.Close()
+		var values []string
+		for len(values) < n {
+			m, err := r.FetchMessage(ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := r.CommitMessages(ctx, m); err != nil {
+				t.Fatal(err)
+			}
+			values = append(values, string(m.Value))
+		}
+		return values
+	}
+	for _, v := range read(len(want)) {
+		if !want[v] {
+			t.Errorf("read %q twice or unexpectedly", v)
+		}
+		delete(want, v)
+	}
+
+	// a new reader of the group resumes after the committed offsets
+	if err := w.WriteMessages(ctx, kafka.Message{Key: []byte("e"), Value: []byte("e")}); err != nil {
+		t.Fatal(err)
+	}
+	if got := read(1); got[0] != "e" {
+		t.Errorf("resumed at %q, want e", got[0])
+	}
+
+	// topics are created when first written to
+	auto := &kafka.Writer{Addr: conn.Addr(), Transport: conn.Transport(), Topic: "order-events", AllowAutoTopicCreation: true, BatchTimeout: 10 * time.Millisecond}
+	defer auto.Close()
+	if err := auto.WriteMessages(ctx, kafka.Message{Value: []byte("x")}); err != nil {
+		t.Fatal(err)
+	}
+}
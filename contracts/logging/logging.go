@@ -0,0 +1,137 @@
+// Package logging builds the service's structured logger. Log lines written with a context carry
+// the request and trace IDs of that context, plus the attributes added to it with With.
+package logging
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"slices"
+	"strings"
+	"time"
+
+	"contracts/correlation"
+)
+
+// Output formats
+const (
+	FormatJSON = "json"
+	FormatText = "text"
+)
+
+// Attribute keys, the same in every service so that one query finds an order's lines everywhere
+const (
+	KeyRequestID    = "requestId"
+	KeyTraceID      = "traceId"
+	KeyRestaurantID = "restaurantId"
+	KeyOrderID      = "orderId"
+	KeyPartition    = "partition"
+	KeyOffset       = "offset"
+)
+
+// New returns a logger writing to w in format ("json" or "text") from level on
+// ("debug", "info", "warn" or "error")
+func New(w io.Writer, format string, level string) (*slog.Logger, error) {
+	var lvl slog.Level
+	if err := lvl.UnmarshalText([]byte(level)); err != nil {
+		return nil, fmt.Errorf("invalid log level %q", level)
+	}
+	opts := &slog.HandlerOptions{Level: lvl}
+	var handler slog.Handler
+	switch strings.ToLower(format) {
+	case FormatJSON:
+		handler = slog.NewJSONHandler(w, opts)
+	case FormatText:
+		handler = slog.NewTextHandler(w, opts)
+	default:
+		return nil, fmt.Errorf("invalid log format %q, expected %s or %s", format, FormatJSON, FormatText)
+	}
+	return slog.New(contextHandler{Handler: handler, base: handler}), nil
+}
+
+type attrsKey struct{}
+
+// With returns ctx with attributes, given as alternating keys and values like slog's, added to
+// every line logged with it
+func With(ctx context.Context, args ...any) context.Context {
+	if len(args) == 0 {
+		return ctx
+	}
+	existing, _ := ctx.Value(attrsKey{}).([]slog.Attr)
+	record := slog.NewRecord(time.Time{}, 0, "", 0)
+	record.Add(args...)
+	attrs := make([]slog.Attr, 0, len(existing)+record.NumAttrs())
+	attrs = append(attrs, existing...)
+	record.Attrs(func(a slog.Attr) bool {
+		attrs = append(attrs, a)
+		return true
+	})
+	return context.WithValue(ctx, attrsKey{}, attrs)
+}
+
+// contextHandler adds the IDs and attributes of the context to each record, at the top level
+// even when the logger has groups
+type contextHandler struct {
+	slog.Handler
+	// base is the handler before the first group, after replays the groups and attributes
+	// added from then on
+	base  slog.Handler
+	after []func(slog.Handler) slog.Handler
+}
+
+func (h contextHandler) Handle(ctx context.Context, r slog.Record) error {
+	attrs := contextAttrs(ctx)
+	if len(attrs) == 0 {
+		return h.Handler.Handle(ctx, r)
+	}
+	if len(h.after) == 0 {
+		r.AddAttrs(attrs...)
+		return h.Handler.Handle(ctx, r)
+	}
+	// a record's attributes go in the innermost group, so the context's are added before it
+	handler := h.base.WithAttrs(attrs)
+	for _, apply := range h.after {
+		handler = apply(handler)
+	}
+	return handler.Handle(ctx, r)
+}
+
+func contextAttrs(ctx context.Context) []slog.Attr {
+	var attrs []slog.Attr
+	ids := correlation.FromContext(ctx)
+	if ids.RequestID != "" {
+		attrs = append(attrs, slog.String(KeyRequestID, ids.RequestID))
+	}
+	if !ids.Trace.IsZero() {
+		attrs = append(attrs, slog.String(KeyTraceID, ids.Trace.TraceID))
+	}
+	if extra, ok := ctx.Value(attrsKey{}).([]slog.Attr); ok {
+		attrs = append(attrs, extra...)
+	}
+	return attrs
+}
+
+func (h contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	if len(attrs) == 0 {
+		return h
+	}
+	next := contextHandler{Handler: h.Handler.WithAttrs(attrs), base: h.base}
+	if len(h.after) == 0 {
+		next.base = next.Handler
+		return next
+	}
+	next.after = append(slices.Clip(h.after), func(handler slog.Handler) slog.Handler { return handler.WithAttrs(attrs) })
+	return next
+}
+
+func (h contextHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	return contextHandler{
+		Handler: h.Handler.WithGroup(name),
+		base:    h.base,
+		after:   append(slices.Clip(h.after), func(handler slog.Handler) slog.Handler { return handler.WithGroup(name) }),
+	}
+}
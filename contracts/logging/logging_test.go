@@ -0,0 +1,36 @@
+package logging_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"contracts/correlation"
+	"contracts/logging"
+)
+
+func TestContextAttributesStayOutOfGroups(t *testing.T) {
+	var buf bytes.Buffer
+	logger, err := logging.New(&buf, logging.FormatJSON, "info")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := correlation.NewContext(context.Background(), correlation.IDs{RequestID: "request-1"})
+	ctx = logging.With(ctx, logging.KeyOrderID, "order-1")
+
+	logger.With("service", "producer").WithGroup("kafka").With("topic", "orders").InfoContext(ctx, "published", "partition", 2)
+
+	var line map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &line); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]any{"service": "producer", "requestId": "request-1", "orderId": "order-1",
+		"kafka": map[string]any{"topic": "orders", "partition": float64(2)}}
+	for key, value := range want {
+		if !reflect.DeepEqual(line[key], value) {
+			t.Errorf("%s = %v, want %v in %s", key, line[key], value, buf.String())
+		}
+	}
+}
@@ -0,0 +1,103 @@
+// Package metrics holds the Prometheus metrics both services report, served on /metrics, and
+// the handler serving them with those of the services' own packages
+package metrics
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+
+	"contracts/pgconn"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"go.mongodb.org/mongo-driver/event"
+)
+
+var (
+	httpRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "http_requests_total",
+		Help: "HTTP requests by route, method and status code.",
+	}, []string{"route", "method", "status"})
+	httpDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "http_request_duration_seconds",
+		Help:    "HTTP request latency by route and method.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"route", "method"})
+
+	kafkaPublishDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "kafka_publish_duration_seconds",
+		Help:    "Time to write a message to Kafka, including failed writes.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"topic"})
+	kafkaPublishErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "kafka_publish_errors_total",
+		Help: "Messages that could not be written to Kafka.",
+	}, []string{"topic"})
+
+	mongoDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "mongodb_command_duration_seconds",
+		Help:    "MongoDB command latency by command and result (ok or error).",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"command", "result"})
+	postgresDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "postgresql_query_duration_seconds",
+		Help:    "PostgreSQL query latency by operation (select, insert...) and result (ok or error).",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"operation", "result"})
+)
+
+// Handler serves the metrics in the Prometheus text format
+func Handler() http.Handler {
+	return promhttp.Handler()
+}
+
+// HTTP counts and times requests by route pattern, so that path parameters don't
+// multiply the series. Requests matching no route are reported as "unmatched".
+func HTTP() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		start := time.Now()
+		ctx.Next()
+		route := ctx.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+		method := ctx.Request.Method
+		httpRequests.WithLabelValues(route, method, strconv.Itoa(ctx.Writer.Status())).Inc()
+		httpDuration.WithLabelValues(route, method).Observe(time.Since(start).Seconds())
+	}
+}
+
+// ObservePublish records a Kafka write to topic that started at start
+func ObservePublish(topic string, start time.Time, err error) {
+	kafkaPublishDuration.WithLabelValues(topic).Observe(time.Since(start).Seconds())
+	if err != nil {
+		kafkaPublishErrors.WithLabelValues(topic).Inc()
+	}
+}
+
+// MongoMonitor times every command
+func MongoMonitor() *event.CommandMonitor {
+	return &event.CommandMonitor{
+		Succeeded: func(_ context.Context, e *event.CommandSucceededEvent) {
+			mongoDuration.WithLabelValues(e.CommandName, "ok").Observe(e.Duration.Seconds())
+		},
+		Failed: func(_ context.Context, e *event.CommandFailedEvent) {
+			mongoDuration.WithLabelValues(e.CommandName, "error").Observe(e.Duration.Seconds())
+		},
+	}
+}
+
+// PostgresHook times every query
+func PostgresHook() pgconn.QueryHook {
+	return func(_ context.Context, q pgconn.Query) {
+		result := "ok"
+		if q.Err != nil {
+			result = "error"
+		}
+		postgresDuration.WithLabelValues(q.Operation(), result).Observe(q.Duration.Seconds())
+	}
+}
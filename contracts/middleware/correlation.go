@@ -0,0 +1,63 @@
+// Package middleware holds the Gin middleware shared by every route
+package middleware
+
+import (
+	"log/slog"
+	"time"
+
+	"contracts/correlation"
+	"contracts/logging"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Correlation takes the request ID and traceparent sent by the caller, or generates them, and
+// stores them in the request context, from where they reach Kafka headers and log lines.
+// The request ID is echoed in the X-Request-ID response header.
+func Correlation() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		ids := correlation.Incoming(ctx.GetHeader(correlation.HeaderRequestID), ctx.GetHeader(correlation.HeaderTraceparent))
+		ctx.Request = ctx.Request.WithContext(correlation.NewContext(ctx.Request.Context(), ids))
+		ctx.Header(correlation.HeaderRequestID, ids.RequestID)
+		ctx.Next()
+	}
+}
+
+// Logger adds the restaurant (x-org header) and order (:id) the request is about to its log
+// context, then writes an access log line: warn for 4xx responses, error for 5xx
+func Logger(logger *slog.Logger) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		var attrs []any
+		if org := ctx.GetHeader("x-org"); org != "" {
+			attrs = append(attrs, logging.KeyRestaurantID, org)
+		}
+		if id := ctx.Param("id"); id != "" {
+			attrs = append(attrs, logging.KeyOrderID, id)
+		}
+		ctx.Request = ctx.Request.WithContext(logging.With(ctx.Request.Context(), attrs...))
+
+		start := time.Now()
+		ctx.Next()
+
+		status := ctx.Writer.Status()
+		level := slog.LevelInfo
+		switch {
+		case status >= 500:
+			level = slog.LevelError
+		case status >= 400:
+			level = slog.LevelWarn
+		}
+		args := []any{
+			"method", ctx.Request.Method,
+			"path", ctx.Request.URL.Path,
+			"route", ctx.FullPath(),
+			"status", status,
+			"latency", time.Since(start),
+			"clientIp", ctx.ClientIP(),
+		}
+		if errs := ctx.Errors.ByType(gin.ErrorTypePrivate); len(errs) > 0 {
+			args = append(args, "error", errs.String())
+		}
+		logger.Log(ctx.Request.Context(), level, "request", args...)
+	}
+}
@@ -0,0 +1,174 @@
+// Package money holds amounts in minor units of a currency, their rounding and their storage,
+// and the exchange rates analytics convert them with
+package money
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/bsontype"
+	"go.mongodb.org/mongo-driver/x/bsonx/bsoncore"
+)
+
+// DefaultCurrency is assumed for restaurants and prices stored before currencies were recorded
+const DefaultCurrency = "USD"
+
+var ErrCurrencyMismatch = errors.New("currency mismatch")
+
+// Amount is a monetary amount in minor units (cents for USD). Arithmetic on it is exact;
+// it is stored in Mongo and rendered in JSON as an integer.
+type Amount int64
+
+// Mul multiplies the amount by a quantity
+func (a Amount) Mul(qty int) Amount {
+	return a * Amount(qty)
+}
+
+// Percent returns the share of the amount given in basis points (825 = 8.25%),
+// rounded half away from zero
+func (a Amount) Percent(bps int64) Amount {
+	return Amount(divRound(int64(a)*bps, 10000))
+}
+
+// Ratio returns a * num / den rounded half away from zero, used to split amounts proportionally
+func (a Amount) Ratio(num, den int64) Amount {
+	if den == 0 {
+		return 0
+	}
+	return Amount(divRound(int64(a)*num, den))
+}
+
+func divRound(n, d int64) int64 {
+	if d < 0 {
+		n, d = -n, -d
+	}
+	if n >= 0 {
+		return (n + d/2) / d
+	}
+	return -((-n + d/2) / d)
+}
+
+func (a Amount) MarshalBSONValue() (bsontype.Type, []byte, error) {
+	return bson.TypeInt64, bsoncore.AppendInt64(nil, int64(a)), nil
+}
+
+// UnmarshalBSONValue refuses doubles: amounts stored before they were in minor units are
+// converted by the money_minor_units migration, as their unit can't be told from their type
+func (a *Amount) UnmarshalBSONValue(t bsontype.Type, data []byte) error {
+	switch t {
+	case bson.TypeInt64:
+		v, _, ok := bsoncore.ReadInt64(data)
+		if !ok {
+			return fmt.Errorf("invalid int64 amount")
+		}
+		*a = Amount(v)
+	case bson.TypeInt32:
+		v, _, ok := bsoncore.ReadInt32(data)
+		if !ok {
+			return fmt.Errorf("invalid int32 amount")
+		}
+		*a = Amount(v)
+	case bson.TypeNull:
+		*a = 0
+	default:
+		return fmt.Errorf("cannot decode %s into an amount", t)
+	}
+	return nil
+}
+
+// Money is an amount in minor units of an ISO 4217 currency
+type Money struct {
+	Amount   Amount `bson:"amount" json:"amount"`
+	Currency string `bson:"currency" json:"currency"`
+}
+
+func New(amount Amount, currency string) Money {
+	return Money{Amount: amount, Currency: strings.ToUpper(currency)}
+}
+
+// Add sums two amounts of the same currency; a zero value takes the other's currency
+func (m Money) Add(o Money) (Money, error) {
+	switch {
+	case m.Currency == "" && m.Amount == 0:
+		return o, nil
+	case o.Currency == "" && o.Amount == 0:
+		return m, nil
+	case m.Currency != o.Currency:
+		return Money{}, fmt.Errorf("%w: %s and %s", ErrCurrencyMismatch, m.Currency, o.Currency)
+	}
+	return Money{Amount: m.Amount + o.Amount, Currency: m.Currency}, nil
+}
+
+// In returns the money in currency, filling in currency for legacy values that have none
+func (m Money) In(currency string) (Money, error) {
+	if m.Currency == "" {
+		return Money{Amount: m.Amount, Currency: currency}, nil
+	}
+	if m.Currency != currency {
+		return Money{}, fmt.Errorf("%w: %s and %s", ErrCurrencyMismatch, m.Currency, currency)
+	}
+	return m, nil
+}
+
+func (m Money) String() string {
+	exp := Exponent(m.Currency)
+	v := int64(m.Amount)
+	sign := ""
+	if v < 0 {
+		sign = "-"
+		v = -v
+	}
+	if exp == 0 {
+		return fmt.Sprintf("%s%d %s", sign, v, m.Currency)
+	}
+	scale := int64(math.Pow10(exp))
+	return fmt.Sprintf("%s%d.%0*d %s", sign, v/scale, exp, v%scale, m.Currency)
+}
+
+// UnmarshalBSONValue decodes the {amount, currency} document; the bare doubles stored before
+// amounts had a currency are converted by the money_minor_units migration
+func (m *Money) UnmarshalBSONValue(t bsontype.Type, data []byte) error {
+	switch t {
+	case bson.TypeEmbeddedDocument:
+		type plain Money
+		var p plain
+		if err := bson.Unmarshal(data, &p); err != nil {
+			return err
+		}
+		*m = Money(p)
+	case bson.TypeNull:
+		*m = Money{}
+	default:
+		return fmt.Errorf("cannot decode %s into money", t)
+	}
+	return nil
+}
+
+// exponents lists currencies whose minor unit is not a hundredth
+var exponents = map[string]int{
+	"BHD": 3, "CLP": 0, "ISK": 0, "JOD": 3, "JPY": 0, "KRW": 0, "KWD": 3, "OMR": 3, "TND": 3, "VND": 0,
+}
+
+// Exponent is the number of decimals of the currency's minor unit
+func Exponent(currency string) int {
+	if exp, ok := exponents[currency]; ok {
+		return exp
+	}
+	return 2
+}
+
+// ValidCurrency reports whether code looks like an ISO 4217 code
+func ValidCurrency(code string) bool {
+	if len(code) != 3 {
+		return false
+	}
+	for _, r := range code {
+		if r < 'A' || r > 'Z' {
+			return false
+		}
+	}
+	return true
+}
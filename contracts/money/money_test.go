@@ -0,0 +1,126 @@
+package money_test
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"contracts/money"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestRounding(t *testing.T) {
+	cases := []struct {
+		name      string
+		got, want money.Amount
+	}{
+		{"percent", money.Amount(1250).Percent(825), 103},
+		{"percent half up", money.Amount(10).Percent(500), 1},
+		{"negative percent half away from zero", money.Amount(-10).Percent(500), -1},
+		{"ratio", money.Amount(100).Ratio(1, 3), 33},
+		{"ratio half up", money.Amount(5).Ratio(1, 2), 3},
+		{"negative ratio", money.Amount(-5).Ratio(1, 2), -3},
+		{"ratio of nothing", money.Amount(5).Ratio(1, 0), 0},
+		{"mul", money.Amount(425).Mul(3), 1275},
+	}
+	for _, c := range cases {
+		if c.got != c.want {
+			t.Errorf("%s: got %d, want %d", c.name, c.got, c.want)
+		}
+	}
+}
+
+func TestAdd(t *testing.T) {
+	sum, err := money.New(100, "usd").Add(money.New(250, "USD"))
+	if err != nil || sum != money.New(350, "USD") {
+		t.Errorf("got %v, %v", sum, err)
+	}
+	if sum, err := (money.Money{}).Add(money.New(5, "JPY")); err != nil || sum != money.New(5, "JPY") {
+		t.Errorf("zero value took %v, %v", sum, err)
+	}
+	if _, err := money.New(1, "USD").Add(money.New(1, "EUR")); !errors.Is(err, money.ErrCurrencyMismatch) {
+		t.Errorf("mixed currencies: %v", err)
+	}
+}
+
+func TestString(t *testing.T) {
+	for m, want := range map[money.Money]string{
+		money.New(1250, "USD"): "12.50 USD",
+		money.New(-5, "EUR"):   "-0.05 EUR",
+		money.New(1200, "JPY"): "1200 JPY",
+		money.New(1234, "KWD"): "1.234 KWD",
+	} {
+		if got := m.String(); got != want {
+			t.Errorf("got %q, want %q", got, want)
+		}
+	}
+}
+
+func TestBSON(t *testing.T) {
+	type doc struct {
+		Price money.Money  `bson:"price"`
+		Tip   money.Amount `bson:"tip"`
+	}
+	raw, err := bson.Marshal(doc{Price: money.New(1250, "USD"), Tip: 150})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got doc
+	if err := bson.Unmarshal(raw, &got); err != nil || got.Price != money.New(1250, "USD") || got.Tip != 150 {
+		t.Errorf("round trip gave %+v, %v", got, err)
+	}
+	raw, _ = bson.Marshal(bson.M{"tip": int32(7)})
+	if err := bson.Unmarshal(raw, &got); err != nil || got.Tip != 7 {
+		t.Errorf("int32 amount gave %d, %v", got.Tip, err)
+	}
+
+	// the unit of a double can't be told, the money_minor_units migration converts them
+	for _, legacy := range []bson.M{{"tip": 1.5}, {"price": 12.5}} {
+		raw, _ := bson.Marshal(legacy)
+		if err := bson.Unmarshal(raw, &doc{}); err == nil {
+			t.Errorf("%v decoded", legacy)
+		}
+	}
+}
+
+func TestJSON(t *testing.T) {
+	raw, err := json.Marshal(money.New(1250, "USD"))
+	if err != nil || string(raw) != `{"amount":1250,"currency":"USD"}` {
+		t.Errorf("got %s, %v", raw, err)
+	}
+}
+
+func TestExponent(t *testing.T) {
+	for currency, want := range map[string]int{"USD": 2, "EUR": 2, "JPY": 0, "KWD": 3} {
+		if got := money.Exponent(currency); got != want {
+			t.Errorf("%s: got %d, want %d", currency, got, want)
+		}
+	}
+}
+
+func TestConvert(t *testing.T) {
+	rates, err := money.ParseRates("USD", "EUR:1.08,JPY:0.0067")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cases := []struct {
+		from money.Money
+		to   string
+		want money.Money
+	}{
+		{money.New(1000, "EUR"), "USD", money.New(1080, "USD")},
+		{money.New(1000, "USD"), "EUR", money.New(926, "EUR")},
+		{money.New(1000, "JPY"), "USD", money.New(670, "USD")},
+		{money.New(500, "USD"), "USD", money.New(500, "USD")},
+	}
+	for _, c := range cases {
+		got, err := rates.Convert(c.from, c.to)
+		if err != nil || got != c.want {
+			t.Errorf("%v in %s: got %v, %v, want %v", c.from, c.to, got, err, c.want)
+		}
+	}
+	if _, err := rates.Convert(money.New(1, "GBP"), "USD"); !errors.Is(err, money.ErrNoRate) {
+		t.Errorf("no rate: %v", err)
+	}
+}
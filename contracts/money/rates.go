@@ -0,0 +1,83 @@
+package money
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+var ErrNoRate = errors.New("no exchange rate")
+
+// Rates is a locally configured exchange rate table: how many units of the base currency
+// one unit of each other currency is worth. Rates are kept as exact rationals so converting
+// only rounds once, to the target currency's minor unit.
+type Rates struct {
+	base  string
+	rates map[string]*big.Rat
+}
+
+// ParseRates reads "EUR:1.08,GBP:1.27" relative to base
+func ParseRates(base string, spec string) (*Rates, error) {
+	base = strings.ToUpper(strings.TrimSpace(base))
+	if !ValidCurrency(base) {
+		return nil, fmt.Errorf("invalid base currency %q", base)
+	}
+	r := &Rates{base: base, rates: map[string]*big.Rat{base: big.NewRat(1, 1)}}
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		code, value, ok := strings.Cut(entry, ":")
+		code = strings.ToUpper(strings.TrimSpace(code))
+		if !ok || !ValidCurrency(code) {
+			return nil, fmt.Errorf("invalid exchange rate entry %q", entry)
+		}
+		rate, ok := new(big.Rat).SetString(strings.TrimSpace(value))
+		if !ok || rate.Sign() <= 0 {
+			return nil, fmt.Errorf("invalid exchange rate for %s: %q", code, value)
+		}
+		r.rates[code] = rate
+	}
+	return r, nil
+}
+
+// Convert returns m in currency, rounded half away from zero to the target minor unit
+func (r *Rates) Convert(m Money, currency string) (Money, error) {
+	if m.Currency == currency {
+		return m, nil
+	}
+	from, ok := r.rates[m.Currency]
+	if !ok {
+		return Money{}, fmt.Errorf("%w for %s", ErrNoRate, m.Currency)
+	}
+	to, ok := r.rates[currency]
+	if !ok {
+		return Money{}, fmt.Errorf("%w for %s", ErrNoRate, currency)
+	}
+	// minor(from) -> major(from) -> base -> major(to) -> minor(to)
+	v := new(big.Rat).SetInt64(int64(m.Amount))
+	v.Mul(v, from)
+	v.Quo(v, to)
+	v.Mul(v, new(big.Rat).SetFrac(pow10(Exponent(currency)), pow10(Exponent(m.Currency))))
+	return Money{Amount: Amount(roundRat(v)), Currency: currency}, nil
+}
+
+func pow10(n int) *big.Int {
+	return new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(n)), nil)
+}
+
+func roundRat(v *big.Rat) int64 {
+	num := new(big.Int).Set(v.Num())
+	den := v.Denom()
+	neg := num.Sign() < 0
+	num.Abs(num)
+	// (num + den/2) / den
+	num.Add(num, new(big.Int).Quo(den, big.NewInt(2)))
+	num.Quo(num, den)
+	if neg {
+		num.Neg(num)
+	}
+	return num.Int64()
+}
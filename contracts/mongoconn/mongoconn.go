@@ -0,0 +1,270 @@
+// Package mongoconn connects the services to MongoDB: it applies the pool, timeout, TLS and
+// read/write concern settings, waits for the server with a retried ping and installs the
+// services' command monitors.
+package mongoconn
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"time"
+
+	"contracts/configload"
+	"contracts/tlsconfig"
+
+	"go.mongodb.org/mongo-driver/event"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/mongo/readconcern"
+	"go.mongodb.org/mongo-driver/mongo/readpref"
+	"go.mongodb.org/mongo-driver/mongo/writeconcern"
+)
+
+// Config is a service's mongo section. Settings left zero keep the URI's option, or the
+// driver's default; the others override it.
+type Config struct {
+	URI      string `yaml:"uri" env:"MONGODB_URI" usage:"MongoDB connection string"`
+	Database string `yaml:"database" env:"MONGODB_DATABASE" usage:"MongoDB database"`
+	// AppName is only used when the URI has no appName
+	AppName string `yaml:"appName" env:"MONGODB_APP_NAME" usage:"client name shown in the server's logs and currentOp, unless the URI sets one"`
+
+	MinPoolSize     int           `yaml:"minPoolSize" env:"MONGODB_MIN_POOL_SIZE" usage:"connections kept open per server, 0 for the URI's"`
+	MaxPoolSize     int           `yaml:"maxPoolSize" env:"MONGODB_MAX_POOL_SIZE" usage:"most connections per server, 0 for the URI's"`
+	MaxConnIdleTime time.Duration `yaml:"maxConnIdleTime" env:"MONGODB_MAX_CONN_IDLE_TIME" usage:"how long an idle connection is kept, 0 for the URI's"`
+
+	ConnectTimeout         time.Duration `yaml:"connectTimeout" env:"MONGODB_CONNECT_TIMEOUT" usage:"deadline of each new connection, 0 for the URI's"`
+	ServerSelectionTimeout time.Duration `yaml:"serverSelectionTimeout" env:"MONGODB_SERVER_SELECTION_TIMEOUT" usage:"how long an operation waits for a suitable server, 0 for the URI's"`
+	SocketTimeout          time.Duration `yaml:"socketTimeout" env:"MONGODB_SOCKET_TIMEOUT" usage:"deadline of each read or write on a connection, 0 for the URI's"`
+	// StartupTimeout is how long Connect retries its ping before giving up
+	StartupTimeout time.Duration `yaml:"startupTimeout" env:"MONGODB_STARTUP_TIMEOUT" usage:"how long to wait for MongoDB at startup"`
+
+	TLS TLSConfig `yaml:"tls"`
+
+	ReadPreference string `yaml:"readPreference" env:"MONGODB_READ_PREFERENCE" usage:"primary, primaryPreferred, secondary, secondaryPreferred or nearest; empty for the URI's"`
+	// ReadConcern and WriteConcern are left to the URI, then the server, when empty
+	ReadConcern  string `yaml:"readConcern" env:"MONGODB_READ_CONCERN" usage:"local, available, majority, linearizable or snapshot; empty for the server default"`
+	WriteConcern string `yaml:"writeConcern" env:"MONGODB_WRITE_CONCERN" usage:"majority or a number of members; empty for the server default"`
+
+	// SlowCommandThreshold logs the commands that take longer, when positive
+	SlowCommandThreshold time.Duration `yaml:"slowCommandThreshold" env:"MONGODB_SLOW_COMMAND_THRESHOLD" usage:"log commands slower than this, 0 to disable"`
+}
+
+type TLSConfig struct {
+	Enabled            bool   `yaml:"enabled" env:"MONGODB_TLS_ENABLED" usage:"connect to MongoDB over TLS"`
+	CAFile             string `yaml:"caFile" env:"MONGODB_TLS_CA_FILE" usage:"PEM CA bundle the servers are verified against, instead of the system roots"`
+	CertFile           string `yaml:"certFile" env:"MONGODB_TLS_CERT_FILE" usage:"PEM client certificate"`
+	KeyFile            string `yaml:"keyFile" env:"MONGODB_TLS_KEY_FILE" usage:"PEM client key"`
+	InsecureSkipVerify bool   `yaml:"insecureSkipVerify" env:"MONGODB_TLS_INSECURE_SKIP_VERIFY" usage:"accept any server certificate, for testing only"`
+}
+
+// DefaultURI is a local server with a short server selection timeout, so that requests fail
+// fast while MongoDB is down
+const DefaultURI = "mongodb://localhost:27017/?serverSelectionTimeoutMS=5000"
+
+// Default connects to DefaultURI and leaves every option to it
+func Default(database string) Config {
+	return Config{
+		URI:            DefaultURI,
+		Database:       database,
+		StartupTimeout: 30 * time.Second,
+	}
+}
+
+// Validate checks the settings under prefix, e.g. "mongo."
+func (c Config) Validate(errs *configload.Errors, prefix string) {
+	errs.Check(prefix+"uri", configload.URL(c.URI, "mongodb", "mongodb+srv"))
+	errs.Check(prefix+"database", configload.Required(c.Database))
+
+	errs.Check(prefix+"minPoolSize", configload.AtLeast(c.MinPoolSize, 0))
+	if c.MaxPoolSize != 0 {
+		errs.Check(prefix+"maxPoolSize", configload.AtLeast(c.MaxPoolSize, max(c.MinPoolSize, 1)))
+	}
+	errs.Check(prefix+"maxConnIdleTime", configload.NonNegative(c.MaxConnIdleTime))
+
+	errs.Check(prefix+"connectTimeout", configload.NonNegative(c.ConnectTimeout))
+	errs.Check(prefix+"serverSelectionTimeout", configload.NonNegative(c.ServerSelectionTimeout))
+	errs.Check(prefix+"socketTimeout", configload.NonNegative(c.SocketTimeout))
+	errs.Check(prefix+"startupTimeout", configload.Positive(c.StartupTimeout))
+	errs.Check(prefix+"slowCommandThreshold", configload.NonNegative(c.SlowCommandThreshold))
+
+	if !c.TLS.Enabled && (c.TLS.CAFile != "" || c.TLS.CertFile != "" || c.TLS.KeyFile != "") {
+		errs.Check(prefix+"tls.enabled", errors.New("is required by the TLS files"))
+	}
+	if (c.TLS.CertFile == "") != (c.TLS.KeyFile == "") {
+		errs.Check(prefix+"tls", errors.New("certFile and keyFile go together"))
+	}
+
+	if c.ReadPreference != "" {
+		errs.Check(prefix+"readPreference", configload.OneOf(c.ReadPreference, "primary", "primaryPreferred", "secondary", "secondaryPreferred", "nearest"))
+	}
+	if c.ReadConcern != "" {
+		errs.Check(prefix+"readConcern", configload.OneOf(c.ReadConcern, "local", "available", "majority", "linearizable", "snapshot"))
+	}
+	if _, err := writeConcern(c.WriteConcern); err != nil {
+		errs.Check(prefix+"writeConcern", err)
+	}
+}
+
+func writeConcern(w string) (*writeconcern.WriteConcern, error) {
+	switch w {
+	case "":
+		return nil, nil
+	case "majority":
+		return writeconcern.Majority(), nil
+	}
+	n, err := strconv.Atoi(w)
+	if err != nil || n < 0 {
+		return nil, fmt.Errorf("%q is not majority or a number of members", w)
+	}
+	return &writeconcern.WriteConcern{W: n}, nil
+}
+
+// ClientOptions are the driver options of cfg's URI, overridden by the settings that aren't
+// zero, with the command monitors combined
+func ClientOptions(cfg Config, monitors ...*event.CommandMonitor) (*options.ClientOptions, error) {
+	opts := options.Client().ApplyURI(cfg.URI).SetMonitor(Monitors(monitors...))
+	if cfg.MinPoolSize > 0 {
+		opts.SetMinPoolSize(uint64(cfg.MinPoolSize))
+	}
+	if cfg.MaxPoolSize > 0 {
+		opts.SetMaxPoolSize(uint64(cfg.MaxPoolSize))
+	}
+	if cfg.MaxConnIdleTime > 0 {
+		opts.SetMaxConnIdleTime(cfg.MaxConnIdleTime)
+	}
+	if cfg.ConnectTimeout > 0 {
+		opts.SetConnectTimeout(cfg.ConnectTimeout)
+	}
+	if cfg.ServerSelectionTimeout > 0 {
+		opts.SetServerSelectionTimeout(cfg.ServerSelectionTimeout)
+	}
+	if cfg.SocketTimeout > 0 {
+		opts.SetSocketTimeout(cfg.SocketTimeout)
+	}
+	// the services name themselves by default, which mustn't hide the URI's name
+	if cfg.AppName != "" && opts.AppName == nil {
+		opts.SetAppName(cfg.AppName)
+	}
+	if cfg.TLS.Enabled {
+		t, err := tlsconfig.Load(cfg.TLS.CAFile, cfg.TLS.CertFile, cfg.TLS.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("mongodb tls: %w", err)
+		}
+		t.InsecureSkipVerify = cfg.TLS.InsecureSkipVerify
+		opts.SetTLSConfig(t)
+	}
+	if cfg.ReadPreference != "" {
+		mode, err := readpref.ModeFromString(cfg.ReadPreference)
+		if err != nil {
+			return nil, err
+		}
+		rp, err := readpref.New(mode)
+		if err != nil {
+			return nil, err
+		}
+		opts.SetReadPreference(rp)
+	}
+	if cfg.ReadConcern != "" {
+		opts.SetReadConcern(&readconcern.ReadConcern{Level: cfg.ReadConcern})
+	}
+	wc, err := writeConcern(cfg.WriteConcern)
+	if err != nil {
+		return nil, err
+	}
+	if wc != nil {
+		opts.SetWriteConcern(wc)
+	}
+	return opts, opts.Validate()
+}
+
+// Connect connects to cfg.URI and pings it until it answers or StartupTimeout runs out,
+// backing off between attempts. Every command is reported to the monitors, in order, and
+// logged when slower than SlowCommandThreshold.
+func Connect(ctx context.Context, cfg Config, logger *slog.Logger, monitors ...*event.CommandMonitor) (*mongo.Client, *mongo.Database, error) {
+	if cfg.SlowCommandThreshold > 0 {
+		monitors = append(monitors, SlowCommands(logger, cfg.SlowCommandThreshold))
+	}
+	opts, err := ClientOptions(cfg, monitors...)
+	if err != nil {
+		return nil, nil, err
+	}
+	client, err := mongo.Connect(ctx, opts)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := ping(ctx, client, cfg.StartupTimeout, logger); err != nil {
+		_ = client.Disconnect(context.WithoutCancel(ctx))
+		return nil, nil, err
+	}
+	return client, client.Database(cfg.Database), nil
+}
+
+const (
+	firstBackoff = 250 * time.Millisecond
+	maxBackoff   = 5 * time.Second
+)
+
+func ping(ctx context.Context, client *mongo.Client, timeout time.Duration, logger *slog.Logger) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	backoff := firstBackoff
+	for attempt := 1; ; attempt++ {
+		err := client.Ping(ctx, nil)
+		if err == nil {
+			return nil
+		}
+		logger.Warn("mongodb is not reachable, retrying", "attempt", attempt, "retryIn", backoff, "error", err)
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("mongodb not reachable within %s: %w", timeout, err)
+		case <-time.After(backoff):
+		}
+		backoff = min(2*backoff, maxBackoff)
+	}
+}
+
+// Monitors reports every command event to each of monitors in turn; nil monitors and
+// callbacks are skipped
+func Monitors(monitors ...*event.CommandMonitor) *event.CommandMonitor {
+	return &event.CommandMonitor{
+		Started: func(ctx context.Context, e *event.CommandStartedEvent) {
+			for _, m := range monitors {
+				if m != nil && m.Started != nil {
+					m.Started(ctx, e)
+				}
+			}
+		},
+		Succeeded: func(ctx context.Context, e *event.CommandSucceededEvent) {
+			for _, m := range monitors {
+				if m != nil && m.Succeeded != nil {
+					m.Succeeded(ctx, e)
+				}
+			}
+		},
+		Failed: func(ctx context.Context, e *event.CommandFailedEvent) {
+			for _, m := range monitors {
+				if m != nil && m.Failed != nil {
+					m.Failed(ctx, e)
+				}
+			}
+		},
+	}
+}
+
+// SlowCommands logs the commands that take longer than threshold, with the request's context
+func SlowCommands(logger *slog.Logger, threshold time.Duration) *event.CommandMonitor {
+	return &event.CommandMonitor{
+		Succeeded: func(ctx context.Context, e *event.CommandSucceededEvent) {
+			if e.Duration > threshold {
+				logger.WarnContext(ctx, "slow mongodb command", "command", e.CommandName, "database", e.DatabaseName, "duration", e.Duration)
+			}
+		},
+		Failed: func(ctx context.Context, e *event.CommandFailedEvent) {
+			if e.Duration > threshold {
+				logger.WarnContext(ctx, "slow mongodb command", "command", e.CommandName, "database", e.DatabaseName, "duration", e.Duration, "error", e.Failure)
+			}
+		},
+	}
+}
@@ -0,0 +1,119 @@
+package mongoconn
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+
+	"contracts/configload"
+
+	"go.mongodb.org/mongo-driver/event"
+	"go.mongodb.org/mongo-driver/mongo/readpref"
+)
+
+func TestValidate(t *testing.T) {
+	var errs configload.Errors
+	Default("app").Validate(&errs, "mongo.")
+	if err := errs.Err(); err != nil {
+		t.Fatalf("defaults should be valid: %v", err)
+	}
+
+	cfg := Default("app")
+	cfg.MinPoolSize, cfg.MaxPoolSize = 20, 10
+	cfg.ReadPreference = "secondary-preferred"
+	cfg.WriteConcern = "all"
+	cfg.TLS.CertFile = "client.pem"
+	errs = nil
+	cfg.Validate(&errs, "mongo.")
+	err := errs.Err()
+	for _, want := range []string{
+		"mongo.maxPoolSize: 10 is less than 20",
+		`mongo.readPreference: "secondary-preferred" is not one of`,
+		`mongo.writeConcern: "all" is not majority`,
+		"mongo.tls.enabled: is required",
+		"mongo.tls: certFile and keyFile go together",
+	} {
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("got error %v, want one containing %q", err, want)
+		}
+	}
+}
+
+func TestClientOptions(t *testing.T) {
+	cfg := Default("app")
+	cfg.URI = "mongodb://localhost:27017/?maxPoolSize=5&appName=uri&connectTimeoutMS=3000&readPreference=secondary"
+	cfg.AppName = "consumer"
+
+	// settings left zero keep the URI's options
+	opts, err := ClientOptions(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *opts.MaxPoolSize != 5 || *opts.AppName != "uri" || *opts.ConnectTimeout != 3*time.Second || opts.ReadPreference.Mode() != readpref.SecondaryMode {
+		t.Errorf("URI options lost: maxPoolSize %d, appName %q, connectTimeout %s, readPreference %v",
+			*opts.MaxPoolSize, *opts.AppName, *opts.ConnectTimeout, opts.ReadPreference)
+	}
+	if opts.SocketTimeout != nil || opts.ReadConcern != nil || opts.WriteConcern != nil {
+		t.Errorf("unset options set: %v, %v, %v", opts.SocketTimeout, opts.ReadConcern, opts.WriteConcern)
+	}
+
+	cfg.MaxPoolSize = 50
+	cfg.ServerSelectionTimeout = 2 * time.Second
+	cfg.ReadPreference = "secondaryPreferred"
+	cfg.ReadConcern = "majority"
+	cfg.WriteConcern = "2"
+	opts, err = ClientOptions(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *opts.MaxPoolSize != 50 || *opts.ServerSelectionTimeout != 2*time.Second || *opts.ConnectTimeout != 3*time.Second {
+		t.Errorf("settings should override the URI: maxPoolSize %d, serverSelectionTimeout %s, connectTimeout %s",
+			*opts.MaxPoolSize, *opts.ServerSelectionTimeout, *opts.ConnectTimeout)
+	}
+	if opts.ReadPreference.Mode() != readpref.SecondaryPreferredMode || opts.ReadConcern.Level != "majority" || opts.WriteConcern.W != 2 {
+		t.Errorf("unexpected concerns %v, %v, %v", opts.ReadPreference, opts.ReadConcern, opts.WriteConcern)
+	}
+
+	opts, err = ClientOptions(Default("app"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *opts.ServerSelectionTimeout != 5*time.Second {
+		t.Errorf("default serverSelectionTimeout %s, want the default URI's 5s", *opts.ServerSelectionTimeout)
+	}
+}
+
+func TestMonitors(t *testing.T) {
+	var calls []string
+	record := func(name string) *event.CommandMonitor {
+		return &event.CommandMonitor{
+			Succeeded: func(context.Context, *event.CommandSucceededEvent) { calls = append(calls, name) },
+		}
+	}
+	m := Monitors(record("metrics"), nil, &event.CommandMonitor{}, record("tracing"))
+	m.Started(context.Background(), &event.CommandStartedEvent{})
+	m.Succeeded(context.Background(), &event.CommandSucceededEvent{})
+	m.Failed(context.Background(), &event.CommandFailedEvent{})
+	if strings.Join(calls, ",") != "metrics,tracing" {
+		t.Errorf("monitors called as %v", calls)
+	}
+}
+
+func TestConnectGivesUp(t *testing.T) {
+	cfg := Default("app")
+	cfg.URI = "mongodb://127.0.0.1:1/?directConnection=true"
+	cfg.ServerSelectionTimeout = 50 * time.Millisecond
+	cfg.StartupTimeout = 400 * time.Millisecond
+
+	start := time.Now()
+	_, _, err := Connect(context.Background(), cfg, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	if err == nil || !strings.Contains(err.Error(), "mongodb not reachable within 400ms") {
+		t.Fatalf("got error %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("gave up after %s", elapsed)
+	}
+}
@@ -0,0 +1,6 @@
+DROP TABLE daily_aggregates;
+DROP TABLE refunds;
+DROP TABLE orders;
+DROP TABLE promotions;
+DROP TABLE items;
+DROP TABLE restaurants;
@@ -0,0 +1,104 @@
+-- IDs are the 24 hex digits of the MongoDB ObjectIDs the services use, so that the same IDs
+-- work against either backend. Amounts are BIGINT minor units of the row's currency.
+
+CREATE TABLE restaurants (
+    id                 CHAR(24) PRIMARY KEY,
+    name               TEXT     NOT NULL,
+    -- empty for restaurants created before it was recorded
+    currency           TEXT     NOT NULL DEFAULT '',
+    tax_rate_bps       BIGINT   NOT NULL DEFAULT 0,
+    service_charge_bps BIGINT   NOT NULL DEFAULT 0
+);
+CREATE INDEX restaurants_name ON restaurants (name);
+
+CREATE TABLE items (
+    id              CHAR(24) PRIMARY KEY,
+    restaurant_id   CHAR(24) NOT NULL REFERENCES restaurants (id),
+    name            TEXT     NOT NULL,
+    price           BIGINT   NOT NULL,
+    price_currency  TEXT     NOT NULL DEFAULT '',
+    cost            BIGINT   NOT NULL,
+    cost_currency   TEXT     NOT NULL DEFAULT '',
+    quantity        INTEGER  NOT NULL DEFAULT 0,
+    modifier_groups JSONB    NOT NULL DEFAULT '[]'
+);
+CREATE INDEX items_restaurant ON items (restaurant_id);
+
+CREATE TABLE promotions (
+    id            CHAR(24)    PRIMARY KEY,
+    restaurant_id CHAR(24)    NOT NULL REFERENCES restaurants (id),
+    name          TEXT        NOT NULL,
+    -- empty for promotions that apply without a code
+    code          TEXT        NOT NULL DEFAULT '',
+    kind          TEXT        NOT NULL CHECK (kind IN ('percent', 'fixed')),
+    percent_bps   BIGINT      NOT NULL DEFAULT 0,
+    amount        BIGINT      NOT NULL DEFAULT 0,
+    min_subtotal  BIGINT      NOT NULL DEFAULT 0,
+    active        BOOLEAN     NOT NULL,
+    starts_at     TIMESTAMPTZ,
+    ends_at       TIMESTAMPTZ
+);
+CREATE INDEX promotions_active ON promotions (restaurant_id) WHERE active;
+
+-- order lines and the price breakdown are read and written whole, with the order
+CREATE TABLE orders (
+    id                  CHAR(24)    PRIMARY KEY,
+    restaurant_id       CHAR(24)    NOT NULL REFERENCES restaurants (id),
+    currency            TEXT        NOT NULL,
+    total_price         BIGINT      NOT NULL,
+    total_cost          BIGINT      NOT NULL,
+    status              TEXT        NOT NULL,
+    creation_date       TIMESTAMPTZ NOT NULL,
+    items               JSONB       NOT NULL,
+    promo_code          TEXT        NOT NULL DEFAULT '',
+    tip                 BIGINT      NOT NULL DEFAULT 0,
+    pricing             JSONB,
+    refunded_total      BIGINT      NOT NULL DEFAULT 0,
+    cancelled_at        TIMESTAMPTZ,
+    cancellation_reason TEXT        NOT NULL DEFAULT '',
+    request_id          TEXT        NOT NULL DEFAULT '',
+    trace_id            TEXT        NOT NULL DEFAULT '',
+    -- redelivered order events are recognized by their event ID
+    event_id            TEXT        UNIQUE,
+    aggregate_pending   BOOLEAN     NOT NULL DEFAULT false
+);
+-- popular items and other analytics filter every restaurant's orders by date
+CREATE INDEX orders_creation_date ON orders (creation_date);
+-- order listing and recent orders filter by restaurant and walk creation_date/id
+CREATE INDEX orders_restaurant_creation ON orders (restaurant_id, creation_date DESC, id DESC);
+-- support looks orders up by the request that created them
+CREATE INDEX orders_request ON orders (request_id) WHERE request_id <> '';
+-- listing the orders of an item matches the lines with items @> '[{"id": ...}]'
+CREATE INDEX orders_items ON orders USING GIN (items jsonb_path_ops);
+CREATE INDEX orders_aggregate_pending ON orders (id) WHERE aggregate_pending;
+
+CREATE TABLE refunds (
+    id            CHAR(24)    PRIMARY KEY,
+    order_id      CHAR(24)    NOT NULL REFERENCES orders (id),
+    restaurant_id CHAR(24)    NOT NULL REFERENCES restaurants (id),
+    currency      TEXT        NOT NULL,
+    amount        BIGINT      NOT NULL,
+    tax           BIGINT      NOT NULL,
+    tip           BIGINT      NOT NULL,
+    cost          BIGINT      NOT NULL,
+    reason        TEXT        NOT NULL DEFAULT '',
+    creation_date TIMESTAMPTZ NOT NULL,
+    items         JSONB       NOT NULL
+);
+CREATE INDEX refunds_order ON refunds (order_id);
+
+-- one row per restaurant and UTC day, added to as orders are placed, cancelled and refunded
+CREATE TABLE daily_aggregates (
+    restaurant_id    CHAR(24) NOT NULL REFERENCES restaurants (id),
+    day              DATE     NOT NULL,
+    currency         TEXT     NOT NULL,
+    total_orders     BIGINT   NOT NULL DEFAULT 0,
+    cancelled_orders BIGINT   NOT NULL DEFAULT 0,
+    revenue          BIGINT   NOT NULL DEFAULT 0,
+    discounts        BIGINT   NOT NULL DEFAULT 0,
+    tax              BIGINT   NOT NULL DEFAULT 0,
+    tips             BIGINT   NOT NULL DEFAULT 0,
+    cost             BIGINT   NOT NULL DEFAULT 0,
+    refunds          BIGINT   NOT NULL DEFAULT 0,
+    PRIMARY KEY (restaurant_id, day)
+);
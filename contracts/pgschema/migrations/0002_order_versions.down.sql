@@ -0,0 +1,2 @@
+ALTER TABLE refunds DROP COLUMN event_id;
+ALTER TABLE orders DROP COLUMN version;
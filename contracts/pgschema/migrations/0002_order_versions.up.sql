@@ -0,0 +1,4 @@
+-- cancellations and refunds apply to the version of the order they were computed from
+ALTER TABLE orders ADD COLUMN version BIGINT NOT NULL DEFAULT 0;
+-- redelivered refund events are recognized by their event ID
+ALTER TABLE refunds ADD COLUMN event_id TEXT UNIQUE;
@@ -0,0 +1,292 @@
+// Package pgschema versions the PostgreSQL schema the services share: the consumer applies the
+// migrations ("consumer migrate" or at startup) and the producer reads the tables they create.
+// Migrations are SQL files embedded from migrations/, applied in version order, each in a
+// transaction with its row in the schema_migrations table.
+package pgschema
+
+import (
+	"context"
+	"embed"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Table records the applied migrations
+const Table = "schema_migrations"
+
+// Migration is one step of the schema. Down undoes Up, so that a release can be rolled back.
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+//go:embed migrations/*.sql
+var files embed.FS
+
+// All is every migration in version order. A new one is a pair of files named after the next
+// version, NNNN_name.up.sql and NNNN_name.down.sql; applied ones are never edited.
+var All = mustLoad(files)
+
+func mustLoad(fsys fs.FS) []Migration {
+	migrations, err := Load(fsys, "migrations")
+	if err != nil {
+		panic(err)
+	}
+	return migrations
+}
+
+// Load reads the NNNN_name.up.sql and NNNN_name.down.sql pairs of dir, in version order
+func Load(fsys fs.FS, dir string) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return nil, err
+	}
+	byVersion := make(map[int]*Migration)
+	for _, e := range entries {
+		base, direction, ok := strings.Cut(strings.TrimSuffix(e.Name(), ".sql"), ".")
+		digits, name, _ := strings.Cut(base, "_")
+		version, err := strconv.Atoi(digits)
+		if !ok || err != nil || !strings.HasSuffix(e.Name(), ".sql") || (direction != "up" && direction != "down") {
+			return nil, fmt.Errorf("migration file %s is not named NNNN_name.up.sql or NNNN_name.down.sql", e.Name())
+		}
+		sql, err := fs.ReadFile(fsys, path.Join(dir, e.Name()))
+		if err != nil {
+			return nil, err
+		}
+		m := byVersion[version]
+		if m == nil {
+			m = &Migration{Version: version, Name: name}
+			byVersion[version] = m
+		}
+		if m.Name != name {
+			return nil, fmt.Errorf("migration %d is named both %q and %q", version, m.Name, name)
+		}
+		if direction == "up" {
+			m.Up = string(sql)
+		} else {
+			m.Down = string(sql)
+		}
+	}
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	return migrations, check(migrations)
+}
+
+// check requires complete migrations in increasing version order
+func check(migrations []Migration) error {
+	for i, m := range migrations {
+		if m.Version <= 0 || m.Name == "" || strings.TrimSpace(m.Up) == "" || strings.TrimSpace(m.Down) == "" {
+			return fmt.Errorf("migration %d %q is incomplete", m.Version, m.Name)
+		}
+		if i > 0 && m.Version <= migrations[i-1].Version {
+			return fmt.Errorf("migration %d %q is out of order", m.Version, m.Name)
+		}
+	}
+	return nil
+}
+
+// Status is a migration and whether it's applied. Applied versions this build doesn't know,
+// written by a newer one, are listed with Unknown set.
+type Status struct {
+	Version   int
+	Name      string
+	AppliedAt *time.Time
+	Unknown   bool
+}
+
+type Runner struct {
+	pool       *pgxpool.Pool
+	migrations []Migration
+	log        *slog.Logger
+}
+
+func NewRunner(pool *pgxpool.Pool, migrations []Migration, logger *slog.Logger) (*Runner, error) {
+	if err := check(migrations); err != nil {
+		return nil, err
+	}
+	return &Runner{pool: pool, migrations: migrations, log: logger}, nil
+}
+
+const createTable = `CREATE TABLE IF NOT EXISTS ` + Table + ` (
+    version    INTEGER     PRIMARY KEY,
+    name       TEXT        NOT NULL,
+    applied_at TIMESTAMPTZ NOT NULL
+)`
+
+type record struct {
+	name      string
+	appliedAt time.Time
+}
+
+// querier is a pool or one of its connections
+type querier interface {
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+}
+
+// applied returns the applied migrations by version
+func applied(ctx context.Context, q querier) (map[int]record, error) {
+	rows, err := q.Query(ctx, `SELECT version, name, applied_at FROM `+Table)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	records := make(map[int]record)
+	for rows.Next() {
+		var version int
+		var rec record
+		if err := rows.Scan(&version, &rec.name, &rec.appliedAt); err != nil {
+			return nil, err
+		}
+		records[version] = rec
+	}
+	return records, rows.Err()
+}
+
+func (r *Runner) Status(ctx context.Context) ([]Status, error) {
+	if _, err := r.pool.Exec(ctx, createTable); err != nil {
+		return nil, err
+	}
+	records, err := applied(ctx, r.pool)
+	if err != nil {
+		return nil, err
+	}
+	var out []Status
+	for _, m := range r.migrations {
+		s := Status{Version: m.Version, Name: m.Name}
+		if rec, ok := records[m.Version]; ok {
+			s.AppliedAt = &rec.appliedAt
+			delete(records, m.Version)
+		}
+		out = append(out, s)
+	}
+	for version, rec := range records {
+		out = append(out, Status{Version: version, Name: rec.name, AppliedAt: &rec.appliedAt, Unknown: true})
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Version < out[j].Version })
+	return out, nil
+}
+
+// Up applies the pending migrations up to version target, or all of them when target is 0,
+// and returns how many it applied
+func (r *Runner) Up(ctx context.Context, target int) (int, error) {
+	conn, unlock, err := r.lock(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer unlock()
+
+	records, err := applied(ctx, conn)
+	if err != nil {
+		return 0, err
+	}
+	n := 0
+	for _, m := range r.migrations {
+		if target > 0 && m.Version > target {
+			break
+		}
+		if _, ok := records[m.Version]; ok {
+			continue
+		}
+		start := time.Now()
+		err := pgx.BeginFunc(ctx, conn, func(tx pgx.Tx) error {
+			if _, err := tx.Exec(ctx, m.Up); err != nil {
+				return err
+			}
+			_, err := tx.Exec(ctx, `INSERT INTO `+Table+` (version, name, applied_at) VALUES ($1, $2, $3)`, m.Version, m.Name, time.Now().UTC())
+			return err
+		})
+		if err != nil {
+			return n, fmt.Errorf("migration %d %s: %w", m.Version, m.Name, err)
+		}
+		r.log.Info("migration applied", "version", m.Version, "name", m.Name, "duration", time.Since(start))
+		n++
+	}
+	return n, nil
+}
+
+// Down reverts the last steps applied migrations, newest first, and returns how many it reverted
+func (r *Runner) Down(ctx context.Context, steps int) (int, error) {
+	conn, unlock, err := r.lock(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer unlock()
+
+	records, err := applied(ctx, conn)
+	if err != nil {
+		return 0, err
+	}
+	n := 0
+	for i := len(r.migrations) - 1; i >= 0 && n < steps; i-- {
+		m := r.migrations[i]
+		if _, ok := records[m.Version]; !ok {
+			continue
+		}
+		err := pgx.BeginFunc(ctx, conn, func(tx pgx.Tx) error {
+			if _, err := tx.Exec(ctx, m.Down); err != nil {
+				return err
+			}
+			_, err := tx.Exec(ctx, `DELETE FROM `+Table+` WHERE version = $1`, m.Version)
+			return err
+		})
+		if err != nil {
+			return n, fmt.Errorf("reverting migration %d %s: %w", m.Version, m.Name, err)
+		}
+		r.log.Info("migration reverted", "version", m.Version, "name", m.Name)
+		n++
+	}
+	return n, nil
+}
+
+// lockKey is the advisory lock of the runners, the same in every database of the server
+const lockKey = 0x6d6967726174 // "migrat"
+
+// lock keeps other instances from migrating at the same time, e.g. replicas starting together,
+// with a session advisory lock on the connection the migrations then run on; the server
+// releases it should the runner die. It waits for the lock until ctx is done.
+func (r *Runner) lock(ctx context.Context) (*pgxpool.Conn, func(), error) {
+	conn, err := r.pool.Acquire(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	var locked bool
+	if err := conn.QueryRow(ctx, `SELECT pg_try_advisory_lock($1)`, lockKey).Scan(&locked); err != nil {
+		conn.Release()
+		return nil, nil, fmt.Errorf("locking %s: %w", Table, err)
+	}
+	if !locked {
+		r.log.Info("waiting for the migration lock held by another instance")
+		if _, err := conn.Exec(ctx, `SELECT pg_advisory_lock($1)`, lockKey); err != nil {
+			conn.Release()
+			return nil, nil, fmt.Errorf("locking %s: %w", Table, err)
+		}
+	}
+	if _, err := conn.Exec(ctx, createTable); err != nil {
+		r.unlock(ctx, conn)
+		return nil, nil, err
+	}
+	return conn, func() { r.unlock(ctx, conn) }, nil
+}
+
+func (r *Runner) unlock(ctx context.Context, conn *pgxpool.Conn) {
+	if _, err := conn.Exec(context.WithoutCancel(ctx), `SELECT pg_advisory_unlock($1)`, lockKey); err != nil {
+		r.log.Error("failed to release the migration lock", "error", err)
+		// the lock goes with the session
+		_ = conn.Conn().Close(context.WithoutCancel(ctx))
+	}
+	conn.Release()
+}
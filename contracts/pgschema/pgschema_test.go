@@ -0,0 +1,100 @@
+package pgschema_test
+
+import (
+	"context"
+	"log/slog"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"contracts/pgschema"
+	"contracts/pgtest"
+
+	"github.com/jackc/pgx/v5"
+)
+
+func TestLoad(t *testing.T) {
+	if len(pgschema.All) == 0 || pgschema.All[0].Version != 1 {
+		t.Fatalf("embedded migrations: %+v", pgschema.All)
+	}
+
+	fsys := fstest.MapFS{
+		"m/0002_b.up.sql":   {Data: []byte("SELECT 2")},
+		"m/0002_b.down.sql": {Data: []byte("SELECT -2")},
+		"m/0001_a.up.sql":   {Data: []byte("SELECT 1")},
+		"m/0001_a.down.sql": {Data: []byte("SELECT -1")},
+	}
+	got, err := pgschema.Load(fsys, "m")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 || got[0].Name != "a" || got[1].Up != "SELECT 2" || got[1].Down != "SELECT -2" {
+		t.Errorf("loaded %+v", got)
+	}
+
+	for file, want := range map[string]string{
+		"m/0003_c.up.sql":     "is incomplete",
+		"m/0002_renamed.down": "is not named",
+		"m/0001_other.up.sql": "is named both",
+	} {
+		broken := fstest.MapFS{file: {Data: []byte("SELECT 3")}}
+		for k, v := range fsys {
+			broken[k] = v
+		}
+		if _, err := pgschema.Load(broken, "m"); err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("with %s got %v, want %q", file, err, want)
+		}
+	}
+}
+
+func TestUpDown(t *testing.T) {
+	// the database comes migrated up
+	pool := pgtest.Start(t)
+	ctx := context.Background()
+	runner, err := pgschema.NewRunner(pool, pgschema.All, slog.Default())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n, err := runner.Up(ctx, 0); err != nil || n != 0 {
+		t.Fatalf("up applied %d again: %v", n, err)
+	}
+
+	// a restaurant's day has a single aggregate
+	if _, err := pool.Exec(ctx, `INSERT INTO restaurants (id, name) VALUES ('000000000000000000000001', 'Diner')`); err != nil {
+		t.Fatal(err)
+	}
+	insertDay := `INSERT INTO daily_aggregates (restaurant_id, day, currency) VALUES ('000000000000000000000001', '2024-01-01', 'USD')`
+	if _, err := pool.Exec(ctx, insertDay); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := pool.Exec(ctx, insertDay); err == nil {
+		t.Error("duplicate daily aggregate inserted")
+	}
+
+	if n, err := runner.Down(ctx, len(pgschema.All)); err != nil || n != len(pgschema.All) {
+		t.Fatalf("down reverted %d: %v", n, err)
+	}
+	statuses, err := runner.Status(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range statuses {
+		if s.AppliedAt != nil || s.Unknown {
+			t.Errorf("after down: %+v", s)
+		}
+	}
+	if n, err := runner.Up(ctx, 0); err != nil || n != len(pgschema.All) {
+		t.Fatalf("up after down applied %d: %v", n, err)
+	}
+
+	// the lock was released: another session takes it at once
+	other, err := pgx.ConnectConfig(ctx, pool.Config().ConnConfig.Copy())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer other.Close(ctx)
+	var locked bool
+	if err := other.QueryRow(ctx, `SELECT pg_try_advisory_lock(x'6d6967726174'::bigint)`).Scan(&locked); err != nil || !locked {
+		t.Errorf("migration lock still held: %v", err)
+	}
+}
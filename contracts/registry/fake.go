@@ -0,0 +1,114 @@
+package registry
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+)
+
+// Fake is an in-memory schema registry speaking the same REST API, for tests and local runs:
+//
+//	srv := httptest.NewServer(registry.NewFake())
+//	client, _ := registry.NewClient(srv.URL)
+//
+// Like the real registry, an identical schema gets the same ID under every subject.
+type Fake struct {
+	mu       sync.Mutex
+	schemas  []registerRequest // index + 1 is the ID
+	subjects map[string][]int  // subject -> ids by version
+	mux      *http.ServeMux
+}
+
+func NewFake() *Fake {
+	f := &Fake{subjects: make(map[string][]int), mux: http.NewServeMux()}
+	f.mux.HandleFunc("POST /subjects/{subject}/versions", f.register)
+	f.mux.HandleFunc("GET /subjects/{subject}/versions", f.versions)
+	f.mux.HandleFunc("GET /subjects", f.listSubjects)
+	f.mux.HandleFunc("GET /schemas/ids/{id}", f.schemaByID)
+	return f
+}
+
+func (f *Fake) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mux.ServeHTTP(w, r)
+}
+
+func (f *Fake) register(w http.ResponseWriter, r *http.Request) {
+	var req registerRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Schema == "" {
+		writeError(w, http.StatusUnprocessableEntity, 42201, "invalid schema")
+		return
+	}
+	subject := r.PathValue("subject")
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	id := 0
+	for i, s := range f.schemas {
+		if s == req {
+			id = i + 1
+			break
+		}
+	}
+	if id == 0 {
+		f.schemas = append(f.schemas, req)
+		id = len(f.schemas)
+	}
+	found := false
+	for _, existing := range f.subjects[subject] {
+		found = found || existing == id
+	}
+	if !found {
+		f.subjects[subject] = append(f.subjects[subject], id)
+	}
+	writeJSON(w, map[string]int{"id": id})
+}
+
+func (f *Fake) versions(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	ids, ok := f.subjects[r.PathValue("subject")]
+	f.mu.Unlock()
+	if !ok {
+		writeError(w, http.StatusNotFound, 40401, "Subject not found")
+		return
+	}
+	versions := make([]int, len(ids))
+	for i := range ids {
+		versions[i] = i + 1
+	}
+	writeJSON(w, versions)
+}
+
+func (f *Fake) listSubjects(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	subjects := make([]string, 0, len(f.subjects))
+	for s := range f.subjects {
+		subjects = append(subjects, s)
+	}
+	f.mu.Unlock()
+	sort.Strings(subjects)
+	writeJSON(w, subjects)
+}
+
+func (f *Fake) schemaByID(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err != nil || id < 1 || id > len(f.schemas) {
+		writeError(w, http.StatusNotFound, 40403, "Schema not found")
+		return
+	}
+	writeJSON(w, f.schemas[id-1])
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", contentType)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, code int, message string) {
+	w.Header().Set("Content-Type", contentType)
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(errorResponse{ErrorCode: code, Message: message})
+}
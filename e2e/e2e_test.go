@@ -0,0 +1,226 @@
+// Package e2e follows orders through the built services: the producer and consumer binaries run
+// against one in-process Kafka broker, an in-process Redis and a shared PostgreSQL database, and
+// an order posted to the producer's API has to show up in its analytics
+package e2e
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	"contracts/kafkatest"
+	"contracts/pgtest"
+
+	"github.com/alicebob/miniredis/v2"
+)
+
+// money is an amount as the APIs return it
+type money struct {
+	Amount   int64  `json:"amount"`
+	Currency string `json:"currency"`
+}
+
+func TestOrderReachesAnalytics(t *testing.T) {
+	if testing.Short() {
+		t.Skip("end-to-end test")
+	}
+	pool := pgtest.Start(t)
+	conn := kafkatest.Start(t, 3, "orders", "order-events", "orders-dlq")
+	redis := miniredis.RunT(t)
+	bin := t.TempDir()
+	consumerBin, producerBin := build(t, bin, "consumer"), build(t, bin, "producer")
+
+	shared := []string{
+		"KAFKA_BROKERS=" + strings.Join(conn.Brokers, ","),
+		"STORAGE_BACKEND=postgres",
+		"POSTGRES_URL=" + pgtest.URL(pool),
+		"LOG_FORMAT=text",
+	}
+	// the consumer migrates and loads the demo restaurants before it listens
+	consumer := start(t, consumerBin, append(shared, "MIGRATE_ON_START=true", "SEED_ON_START=true", "KAFKA_BATCH_WAIT=20ms")...)
+	producer := start(t, producerBin, append(shared, "REDIS_ADDR="+redis.Addr())...)
+	waitReady(t, consumer)
+	waitReady(t, producer)
+
+	var restaurants []struct {
+		ID   string `json:"id"`
+		Name string `json:"name"`
+	}
+	get(t, producer+"/restaurants", "", &restaurants)
+	var restaurantID string
+	for _, r := range restaurants {
+		if r.Name == "Sunset Diner" {
+			restaurantID = r.ID
+		}
+	}
+	if restaurantID == "" {
+		t.Fatalf("Sunset Diner not among the restaurants %+v", restaurants)
+	}
+	var itemID string
+	if err := pool.QueryRow(context.Background(), "SELECT id FROM items WHERE restaurant_id = $1 AND name = 'Sunset Burger'", restaurantID).Scan(&itemID); err != nil {
+		t.Fatal(err)
+	}
+
+	body := fmt.Sprintf(`{"items":[{"id":%q,"quantity":2}],"tip":150}`, itemID)
+	req, _ := http.NewRequest(http.MethodPost, producer+"/orders", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("x-org", restaurantID)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusAccepted {
+		t.Fatalf("POST /orders = %d", resp.StatusCode)
+	}
+
+	// aggregates are kept per UTC day
+	today := time.Now().UTC()
+	days := fmt.Sprintf("from=%s&to=%s", today.AddDate(0, 0, -1).Format("01/02/2006"), today.AddDate(0, 0, 1).Format("01/02/2006"))
+	var aggregates []struct {
+		TotalOrders int64 `json:"totalOrders"`
+		Revenue     money `json:"revenue"`
+		Tips        money `json:"tips"`
+	}
+	eventually(t, "the order to be counted", func() bool {
+		get(t, producer+"/analytics/daily-aggregates?"+days, restaurantID, &aggregates)
+		return len(aggregates) > 0
+	})
+	// two burgers at 12.50, before tax
+	if got := aggregates[0]; len(aggregates) != 1 || got.TotalOrders != 1 || got.Revenue != (money{2500, "USD"}) || got.Tips != (money{150, "USD"}) {
+		t.Errorf("daily aggregates %+v, want one order of 2500 USD with a 150 USD tip", aggregates)
+	}
+
+	var popular []struct {
+		ItemID   string `json:"itemId"`
+		Quantity int64  `json:"quantity"`
+		Revenue  money  `json:"revenue"`
+	}
+	get(t, producer+"/analytics/popular-items?"+days, "", &popular)
+	if len(popular) != 1 || popular[0].ItemID != itemID || popular[0].Quantity != 2 || popular[0].Revenue != (money{2500, "USD"}) {
+		t.Errorf("popular items %+v, want 2 of %s for 2500 USD", popular, itemID)
+	}
+}
+
+// build compiles the service of the sibling module name into dir
+func build(t *testing.T, dir, name string) string {
+	t.Helper()
+	bin := filepath.Join(dir, name)
+	cmd := exec.Command("go", "build", "-o", bin, ".")
+	cmd.Dir = filepath.Join("..", name)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("building %s: %v\n%s", name, err, out)
+	}
+	return bin
+}
+
+// start runs bin on a free port with env added to the test's, and returns its base URL. It is
+// stopped with SIGTERM when the test ends, and its output is logged if the test failed.
+func start(t *testing.T, bin string, env ...string) string {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	port := l.Addr().(*net.TCPAddr).Port
+	_ = l.Close()
+
+	output := &syncBuffer{}
+	cmd := exec.Command(bin, "serve")
+	cmd.Env = append(append(os.Environ(), env...), fmt.Sprintf("PORT=%d", port))
+	cmd.Stdout, cmd.Stderr = output, output
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	exited := make(chan struct{})
+	go func() {
+		_ = cmd.Wait()
+		close(exited)
+	}()
+	t.Cleanup(func() {
+		_ = cmd.Process.Signal(syscall.SIGTERM)
+		select {
+		case <-exited:
+		case <-time.After(30 * time.Second):
+			_ = cmd.Process.Kill()
+			<-exited
+		}
+		if t.Failed() {
+			t.Logf("%s output:\n%s", filepath.Base(bin), output.String())
+		}
+	})
+	return fmt.Sprintf("http://127.0.0.1:%d", port)
+}
+
+func waitReady(t *testing.T, service string) {
+	t.Helper()
+	eventually(t, service+" to be ready", func() bool {
+		resp, err := http.Get(service + "/readyz")
+		if err != nil {
+			return false
+		}
+		resp.Body.Close()
+		return resp.StatusCode == http.StatusOK
+	})
+}
+
+// get decodes the JSON body of a 200 response into v, as the restaurant org when set
+func get(t *testing.T, url, org string, v any) {
+	t.Helper()
+	req, _ := http.NewRequest(http.MethodGet, url, nil)
+	if org != "" {
+		req.Header.Set("x-org", org)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("GET %s = %d", url, resp.StatusCode)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// eventually retries check until it returns true or a minute has passed
+func eventually(t *testing.T, what string, check func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(time.Minute)
+	for !check() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
+
+// syncBuffer collects a process's output while it runs
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
@@ -0,0 +1,141 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"contracts/configload"
+	"contracts/events"
+	"contracts/kafkaconn"
+	"contracts/mongoconn"
+)
+
+// Config is read by Load from, in increasing order of precedence: the defaults below, a YAML or
+// TOML file (--config or CONFIG_FILE), environment variables and flags (--load.rate etc.)
+type Config struct {
+	Load       LoadConfig       `yaml:"load"`
+	Completion CompletionConfig `yaml:"completion"`
+	HTTP       HTTPConfig       `yaml:"http"`
+	Mongo      mongoconn.Config `yaml:"mongo"`
+	Kafka      KafkaConfig      `yaml:"kafka"`
+	Events     EventsConfig     `yaml:"events"`
+	Log        LogConfig        `yaml:"log"`
+}
+
+// LoadConfig is the traffic: orders submitted at Rate per second for Duration, to the
+// producer's POST /orders ("http") or straight onto the orders topic ("kafka")
+type LoadConfig struct {
+	Target   string        `yaml:"target" env:"LOAD_TARGET" usage:"where orders are submitted: http or kafka"`
+	Rate     float64       `yaml:"rate" env:"LOAD_RATE" usage:"orders submitted per second"`
+	Duration time.Duration `yaml:"duration" env:"LOAD_DURATION" usage:"how long orders are submitted"`
+	// Concurrency bounds the submissions in flight; orders due while all are busy are skipped
+	// and counted, so that a slow target shows up instead of lowering the rate
+	Concurrency int `yaml:"concurrency" env:"LOAD_CONCURRENCY" usage:"most submissions in flight"`
+	// Restaurants limits the restaurants orders go to, the first ones by name; 0 for all
+	Restaurants int   `yaml:"restaurants" env:"LOAD_RESTAURANTS" usage:"restaurants orders are spread over, 0 for all"`
+	RandomSeed  int64 `yaml:"randomSeed" env:"LOAD_RANDOM_SEED" usage:"seed of the order contents"`
+}
+
+// CompletionConfig is how an order is seen persisted: by its order.created lifecycle event
+// ("events"), or by polling MongoDB for its request ID ("poll")
+type CompletionConfig struct {
+	Mode         string        `yaml:"mode" env:"LOAD_COMPLETION" usage:"how persisted orders are detected: events or poll"`
+	PollInterval time.Duration `yaml:"pollInterval" env:"LOAD_POLL_INTERVAL" usage:"how often MongoDB is polled in poll mode"`
+	// Timeout is how long an order may take to be persisted before it's counted as lost
+	Timeout time.Duration `yaml:"timeout" env:"LOAD_COMPLETION_TIMEOUT" usage:"time after which an order not yet persisted is lost"`
+}
+
+type HTTPConfig struct {
+	URL     string        `yaml:"url" env:"PRODUCER_URL" usage:"base URL of the producer API"`
+	Timeout time.Duration `yaml:"timeout" env:"HTTP_TIMEOUT" usage:"deadline of each POST /orders"`
+}
+
+type KafkaConfig struct {
+	// brokers, tls and sasl
+	kafkaconn.Config `yaml:",inline"`
+	OrdersTopic      string `yaml:"ordersTopic" env:"KAFKA_ORDERS_TOPIC" usage:"topic order events are written to with the kafka target"`
+	LifecycleTopic   string `yaml:"lifecycleTopic" env:"KAFKA_LIFECYCLE_TOPIC" usage:"topic of the consumer's order lifecycle events"`
+}
+
+type EventsConfig struct {
+	Format            string `yaml:"format" env:"EVENT_FORMAT" usage:"order event encoding with the kafka target: json, protobuf or avro"`
+	SchemaRegistryURL string `yaml:"schemaRegistryUrl" env:"SCHEMA_REGISTRY_URL" usage:"schema registry URL, required by binary formats"`
+}
+
+type LogConfig struct {
+	Format string `yaml:"format" env:"LOG_FORMAT" usage:"log format: json or text"`
+	Level  string `yaml:"level" env:"LOG_LEVEL" usage:"minimum log level: debug, info, warn or error"`
+}
+
+// Default drives the services of docker compose from the host for a minute
+func Default() Config {
+	cfg := Config{
+		Load:       LoadConfig{Target: "http", Rate: 50, Duration: time.Minute, Concurrency: 64, RandomSeed: 1},
+		Completion: CompletionConfig{Mode: "events", PollInterval: 100 * time.Millisecond, Timeout: 30 * time.Second},
+		HTTP:       HTTPConfig{URL: "http://localhost:8081", Timeout: 5 * time.Second},
+		Mongo:      mongoconn.Default("restaurantdb"),
+		Kafka: KafkaConfig{
+			Config:         kafkaconn.Default("localhost:9094"),
+			OrdersTopic:    "orders",
+			LifecycleTopic: "order-events",
+		},
+		Events: EventsConfig{Format: "json"},
+		Log:    LogConfig{Format: "text", Level: "info"},
+	}
+	cfg.Mongo.AppName = "loadgen"
+	return cfg
+}
+
+// Read reads the configuration from its sources and the flags in args, without validating it
+func Read(name string, args []string) (Config, error) {
+	cfg := Default()
+	err := configload.Load(&cfg, name, args)
+	return cfg, err
+}
+
+// Load reads the configuration and validates it
+func Load(name string, args []string) (Config, error) {
+	cfg, err := Read(name, args)
+	if err != nil {
+		return cfg, err
+	}
+	return cfg, cfg.Validate()
+}
+
+// Validate reports every invalid setting, by its key in config files
+func (c Config) Validate() error {
+	var errs configload.Errors
+	errs.Check("load.target", configload.OneOf(c.Load.Target, "http", "kafka"))
+	if c.Load.Rate <= 0 {
+		errs.Check("load.rate", fmt.Errorf("%g is not a positive rate", c.Load.Rate))
+	}
+	errs.Check("load.duration", configload.Positive(c.Load.Duration))
+	errs.Check("load.concurrency", configload.AtLeast(c.Load.Concurrency, 1))
+	errs.Check("load.restaurants", configload.AtLeast(c.Load.Restaurants, 0))
+	errs.Check("completion.mode", configload.OneOf(c.Completion.Mode, "events", "poll"))
+	errs.Check("completion.pollInterval", configload.Positive(c.Completion.PollInterval))
+	errs.Check("completion.timeout", configload.Positive(c.Completion.Timeout))
+	if c.Load.Target == "http" {
+		errs.Check("http.url", configload.URL(c.HTTP.URL, "http", "https"))
+		errs.Check("http.timeout", configload.Positive(c.HTTP.Timeout))
+	}
+	c.Mongo.Validate(&errs, "mongo.")
+	if c.Load.Target == "kafka" || c.Completion.Mode == "events" {
+		c.Kafka.Validate(&errs, "kafka.")
+	}
+	if c.Load.Target == "kafka" {
+		errs.Check("kafka.ordersTopic", configload.Required(c.Kafka.OrdersTopic))
+		if format, err := events.ParseFormat(c.Events.Format); err != nil {
+			errs.Check("events.format", err)
+		} else if format != events.FormatJSON && c.Events.SchemaRegistryURL == "" {
+			errs.Check("events.schemaRegistryUrl", fmt.Errorf("required by the %s format", format))
+		}
+	}
+	if c.Completion.Mode == "events" {
+		errs.Check("kafka.lifecycleTopic", configload.Required(c.Kafka.LifecycleTopic))
+	}
+	errs.Check("log.format", configload.OneOf(c.Log.Format, "json", "text"))
+	errs.Check("log.level", configload.OneOf(strings.ToLower(c.Log.Level), "debug", "info", "warn", "error"))
+	return errs.Err()
+}
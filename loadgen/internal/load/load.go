@@ -0,0 +1,169 @@
+// Package load paces order submissions at a target rate and reports what came of them
+package load
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"math/rand"
+	"sort"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"contracts/correlation"
+	"loadgen/internal/menu"
+	"loadgen/internal/submit"
+	"loadgen/internal/track"
+)
+
+type Options struct {
+	Rate        float64
+	Duration    time.Duration
+	Concurrency int
+	RandomSeed  int64
+	// Timeout is how long to wait for the last orders to be persisted
+	Timeout time.Duration
+}
+
+// Report sums up a run. Submit latencies are how long the target took to accept an order,
+// end to end latencies how long from its submission until it was persisted.
+type Report struct {
+	Elapsed   time.Duration
+	Submitted int
+	// Skipped orders were due while Concurrency submissions were in flight
+	Skipped   int
+	Failed    int
+	Persisted int
+	Lost      int
+	// Pending orders were still awaited when the run was interrupted
+	Pending int
+	Errors  map[string]int
+
+	Submit, EndToEnd track.Latencies
+}
+
+// Run submits orders for the restaurants at opts.Rate for opts.Duration, spread evenly over
+// time rather than in bursts, then waits up to opts.Timeout for the tracker to see them
+// persisted. Cancelling ctx stops the submissions early and still reports.
+func Run(ctx context.Context, opts Options, restaurants []menu.Restaurant, submitter submit.Submitter, tracker *track.Tracker, logger *slog.Logger) Report {
+	rng := rand.New(rand.NewSource(opts.RandomSeed))
+	report := Report{Errors: make(map[string]int)}
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	slots := make(chan struct{}, opts.Concurrency)
+
+	interval := time.Duration(float64(time.Second) / opts.Rate)
+	start := time.Now()
+	total := int(opts.Rate * opts.Duration.Seconds())
+	stopProgress := logProgress(logger, 10*time.Second, func() []any {
+		mu.Lock()
+		defer mu.Unlock()
+		return []any{"submitted", report.Submitted, "skipped", report.Skipped, "failed", report.Failed, "pending", len(tracker.Pending())}
+	})
+submitting:
+	for i := 0; i < total; i++ {
+		select {
+		case <-ctx.Done():
+			break submitting
+		case <-time.After(time.Until(start.Add(time.Duration(i) * interval))):
+		}
+		order := restaurants[rng.Intn(len(restaurants))].Order(rng)
+		select {
+		case slots <- struct{}{}:
+		default:
+			mu.Lock()
+			report.Skipped++
+			mu.Unlock()
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-slots }()
+			requestID := correlation.NewRequestID()
+			submitted := time.Now()
+			tracker.Submitting(requestID, submitted)
+			err := submitter.Submit(ctx, requestID, order)
+			took := time.Since(submitted)
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				tracker.Failed(requestID)
+				report.Failed++
+				report.Errors[err.Error()]++
+				return
+			}
+			report.Submitted++
+			report.Submit = append(report.Submit, took)
+		}()
+	}
+	wg.Wait()
+	report.Elapsed = time.Since(start)
+
+	// wait for the last orders, giving up on each one Timeout after its submission
+	logger.Info("waiting for orders to be persisted", "pending", len(tracker.Pending()), "timeout", opts.Timeout)
+	for tracker.Expire(time.Now().Add(-opts.Timeout)) > 0 && ctx.Err() == nil {
+		time.Sleep(50 * time.Millisecond)
+	}
+	stopProgress()
+	report.Pending = len(tracker.Pending())
+
+	sort.Slice(report.Submit, func(i, j int) bool { return report.Submit[i] < report.Submit[j] })
+	report.EndToEnd, report.Lost = tracker.Result()
+	report.Persisted = len(report.EndToEnd)
+	return report
+}
+
+// logProgress logs the fields returned by progress every interval, until the returned
+// function is called
+func logProgress(logger *slog.Logger, interval time.Duration, progress func() []any) func() {
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				logger.Info("load running", progress()...)
+			}
+		}
+	}()
+	return func() { close(done) }
+}
+
+// Print writes the report as a table
+func (r Report) Print(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(tw, "submitted\t%d\t(%.1f/s over %s)\n", r.Submitted, float64(r.Submitted)/r.Elapsed.Seconds(), r.Elapsed.Round(time.Millisecond))
+	fmt.Fprintf(tw, "skipped\t%d\t(all submissions in flight when due)\n", r.Skipped)
+	fmt.Fprintf(tw, "failed\t%d\t\n", r.Failed)
+	fmt.Fprintf(tw, "persisted\t%d\t\n", r.Persisted)
+	fmt.Fprintf(tw, "lost\t%d\t(not persisted within the timeout)\n", r.Lost)
+	if r.Pending > 0 {
+		fmt.Fprintf(tw, "pending\t%d\t(interrupted before they were persisted)\n", r.Pending)
+	}
+	fmt.Fprintln(tw)
+	fmt.Fprintln(tw, "latency\tp50\tp90\tp95\tp99\tmax")
+	for _, l := range []struct {
+		name string
+		l    track.Latencies
+	}{{"submit", r.Submit}, {"end to end", r.EndToEnd}} {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\n", l.name, ms(l.l.Percentile(50)), ms(l.l.Percentile(90)), ms(l.l.Percentile(95)), ms(l.l.Percentile(99)), ms(l.l.Max()))
+	}
+	if len(r.Errors) > 0 {
+		fmt.Fprintln(tw)
+		fmt.Fprintln(tw, "errors\tcount")
+		for msg, n := range r.Errors {
+			fmt.Fprintf(tw, "%s\t%d\n", msg, n)
+		}
+	}
+	return tw.Flush()
+}
+
+func ms(d time.Duration) string {
+	return fmt.Sprintf("%.1fms", float64(d)/float64(time.Millisecond))
+}
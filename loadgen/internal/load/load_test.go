@@ -0,0 +1,104 @@
+package load
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"contracts/events"
+	"loadgen/internal/menu"
+	"loadgen/internal/track"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// fakeTarget accepts orders after delay and persists them persistAfter later; orders of
+// failRestaurant are refused
+type fakeTarget struct {
+	tracker        *track.Tracker
+	delay          time.Duration
+	persistAfter   time.Duration
+	failRestaurant string
+
+	mu     sync.Mutex
+	orders []events.OrderCreate
+}
+
+func (f *fakeTarget) Submit(ctx context.Context, requestID string, order events.OrderCreate) error {
+	time.Sleep(f.delay)
+	if order.RestaurantID == f.failRestaurant {
+		return errors.New("refused")
+	}
+	f.mu.Lock()
+	f.orders = append(f.orders, order)
+	f.mu.Unlock()
+	time.AfterFunc(f.persistAfter, func() { f.tracker.Persisted(requestID, time.Now()) })
+	return nil
+}
+
+func (f *fakeTarget) Close() error { return nil }
+
+func restaurants(n int) []menu.Restaurant {
+	var out []menu.Restaurant
+	for i := 0; i < n; i++ {
+		r := menu.Restaurant{ID: primitive.NewObjectID()}
+		r.Items = append(r.Items, menu.Item{ID: primitive.NewObjectID(), RestaurantID: r.ID}, menu.Item{ID: primitive.NewObjectID(), RestaurantID: r.ID})
+		out = append(out, r)
+	}
+	return out
+}
+
+var logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+
+func TestRun(t *testing.T) {
+	rs := restaurants(3)
+	tracker := track.NewTracker()
+	target := &fakeTarget{tracker: tracker, persistAfter: 20 * time.Millisecond, failRestaurant: rs[2].ID.Hex()}
+	report := Run(context.Background(), Options{Rate: 200, Duration: 250 * time.Millisecond, Concurrency: 8, RandomSeed: 1, Timeout: time.Second}, rs, target, tracker, logger)
+
+	if total := report.Submitted + report.Failed; total != 50 || report.Failed == 0 || report.Skipped != 0 {
+		t.Fatalf("submitted %d, failed %d, skipped %d", report.Submitted, report.Failed, report.Skipped)
+	}
+	if report.Persisted != report.Submitted || report.Lost != 0 {
+		t.Errorf("persisted %d of %d, lost %d", report.Persisted, report.Submitted, report.Lost)
+	}
+	if report.Elapsed < 240*time.Millisecond {
+		t.Errorf("submitted in %s instead of spreading over the duration", report.Elapsed)
+	}
+	if p50 := report.EndToEnd.Percentile(50); p50 < 20*time.Millisecond || p50 > 200*time.Millisecond {
+		t.Errorf("end to end p50 %s", p50)
+	}
+	if report.Errors["refused"] != report.Failed {
+		t.Errorf("errors %v", report.Errors)
+	}
+	for _, order := range target.orders {
+		if len(order.Items) == 0 || len(order.Items) > 2 {
+			t.Errorf("order of %d items", len(order.Items))
+		}
+	}
+
+	var out strings.Builder
+	if err := report.Print(&out); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), "end to end") {
+		t.Errorf("report %s", out.String())
+	}
+}
+
+func TestRunSkipsWhenSaturated(t *testing.T) {
+	tracker := track.NewTracker()
+	target := &fakeTarget{tracker: tracker, delay: 100 * time.Millisecond, persistAfter: time.Hour}
+	report := Run(context.Background(), Options{Rate: 100, Duration: 200 * time.Millisecond, Concurrency: 2, Timeout: 50 * time.Millisecond}, restaurants(1), target, tracker, logger)
+	if report.Skipped == 0 || report.Submitted+report.Skipped != 20 {
+		t.Errorf("submitted %d, skipped %d", report.Submitted, report.Skipped)
+	}
+	if report.Lost != report.Submitted || report.Persisted != 0 {
+		t.Errorf("lost %d of %d", report.Lost, report.Submitted)
+	}
+}
@@ -0,0 +1,105 @@
+// Package menu reads the restaurants and items orders are placed for, and makes up orders
+// the consumer accepts: real item IDs with their required modifiers selected
+package menu
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+
+	"contracts/events"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var ErrNoItems = errors.New("no restaurant has items; seed the database first")
+
+type Restaurant struct {
+	ID    primitive.ObjectID `bson:"_id"`
+	Name  string             `bson:"name"`
+	Items []Item             `bson:"-"`
+}
+
+type Item struct {
+	ID             primitive.ObjectID `bson:"_id"`
+	RestaurantID   primitive.ObjectID `bson:"restaurantId"`
+	ModifierGroups []ModifierGroup    `bson:"modifierGroups"`
+}
+
+type ModifierGroup struct {
+	ID            string           `bson:"id"`
+	Required      bool             `bson:"required"`
+	MinSelections int              `bson:"minSelections"`
+	Options       []ModifierOption `bson:"options"`
+}
+
+type ModifierOption struct {
+	ID string `bson:"id"`
+}
+
+// Load reads the first limit restaurants by name, or all of them when limit is 0, with their
+// items; restaurants without items are left out
+func Load(ctx context.Context, db *mongo.Database, limit int) ([]Restaurant, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "name", Value: 1}, {Key: "_id", Value: 1}}).SetProjection(bson.M{"name": 1})
+	if limit > 0 {
+		opts.SetLimit(int64(limit))
+	}
+	cursor, err := db.Collection("restaurants").Find(ctx, bson.M{}, opts)
+	if err != nil {
+		return nil, err
+	}
+	var restaurants []Restaurant
+	if err := cursor.All(ctx, &restaurants); err != nil {
+		return nil, err
+	}
+	ids := make([]primitive.ObjectID, len(restaurants))
+	for i, r := range restaurants {
+		ids[i] = r.ID
+	}
+
+	cursor, err = db.Collection("items").Find(ctx, bson.M{"restaurantId": bson.M{"$in": ids}},
+		options.Find().SetProjection(bson.M{"restaurantId": 1, "modifierGroups": 1}))
+	if err != nil {
+		return nil, err
+	}
+	var items []Item
+	if err := cursor.All(ctx, &items); err != nil {
+		return nil, err
+	}
+	byRestaurant := make(map[primitive.ObjectID][]Item, len(restaurants))
+	for _, it := range items {
+		byRestaurant[it.RestaurantID] = append(byRestaurant[it.RestaurantID], it)
+	}
+	withItems := restaurants[:0]
+	for _, r := range restaurants {
+		if r.Items = byRestaurant[r.ID]; len(r.Items) > 0 {
+			withItems = append(withItems, r)
+		}
+	}
+	if len(withItems) == 0 {
+		return nil, ErrNoItems
+	}
+	return withItems, nil
+}
+
+// Order makes up an order of one to three of the restaurant's items
+func (r Restaurant) Order(rng *rand.Rand) events.OrderCreate {
+	order := events.OrderCreate{RestaurantID: r.ID.Hex()}
+	for _, i := range rng.Perm(len(r.Items))[:min(1+rng.Intn(3), len(r.Items))] {
+		it := r.Items[i]
+		line := events.OrderItem{ID: it.ID.Hex(), Quantity: 1 + rng.Intn(2)}
+		for _, g := range it.ModifierGroups {
+			if !g.Required {
+				continue
+			}
+			for _, o := range rng.Perm(len(g.Options))[:min(max(g.MinSelections, 1), len(g.Options))] {
+				line.Modifiers = append(line.Modifiers, events.Modifier{GroupID: g.ID, OptionID: g.Options[o].ID})
+			}
+		}
+		order.Items = append(order.Items, line)
+	}
+	return order
+}
@@ -0,0 +1,35 @@
+package menu
+
+import (
+	"math/rand"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestOrderSelectsRequiredModifiers(t *testing.T) {
+	r := Restaurant{ID: primitive.NewObjectID()}
+	r.Items = []Item{
+		{ID: primitive.NewObjectID(), ModifierGroups: []ModifierGroup{
+			{ID: "size", Required: true, MinSelections: 1, Options: []ModifierOption{{ID: "regular"}, {ID: "large"}}},
+			{ID: "extras", Options: []ModifierOption{{ID: "bacon"}}},
+		}},
+		{ID: primitive.NewObjectID()},
+	}
+	rng := rand.New(rand.NewSource(1))
+	for i := 0; i < 50; i++ {
+		order := r.Order(rng)
+		if order.RestaurantID != r.ID.Hex() || len(order.Items) == 0 || len(order.Items) > 2 {
+			t.Fatalf("unexpected order %+v", order)
+		}
+		for _, line := range order.Items {
+			want := 0
+			if line.ID == r.Items[0].ID.Hex() {
+				want = 1
+			}
+			if len(line.Modifiers) != want || (want == 1 && line.Modifiers[0].GroupID != "size") {
+				t.Fatalf("line %+v", line)
+			}
+		}
+	}
+}
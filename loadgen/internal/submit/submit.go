@@ -0,0 +1,118 @@
+// Package submit places orders the way clients do: through the producer's POST /orders, or
+// as order.create events written straight onto the orders topic
+package submit
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"contracts/correlation"
+	"contracts/events"
+	"contracts/kafkaconn"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// Submitter places an order under requestID, which the consumer stores on the order and
+// carries on its lifecycle events
+type Submitter interface {
+	Submit(ctx context.Context, requestID string, order events.OrderCreate) error
+	Close() error
+}
+
+// HTTP posts orders to the producer, which queues them
+type HTTP struct {
+	url    string
+	client *http.Client
+}
+
+func NewHTTP(baseURL string, timeout time.Duration) *HTTP {
+	return &HTTP{
+		url: baseURL + "/orders",
+		client: &http.Client{
+			Timeout: timeout,
+			// keep a connection per submission in flight instead of the default two
+			Transport: &http.Transport{MaxIdleConnsPerHost: 1024},
+		},
+	}
+}
+
+func (h *HTTP) Submit(ctx context.Context, requestID string, order events.OrderCreate) error {
+	body, err := json.Marshal(struct {
+		Items     []events.OrderItem `json:"items"`
+		PromoCode string             `json:"promoCode,omitempty"`
+		Tip       int64              `json:"tip,omitempty"`
+	}{order.Items, order.PromoCode, order.Tip})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, h.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("x-org", order.RestaurantID)
+	req.Header.Set(correlation.HeaderRequestID, requestID)
+	res, err := h.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusAccepted {
+		msg, _ := io.ReadAll(io.LimitReader(res.Body, 512))
+		return fmt.Errorf("POST /orders: %s: %s", res.Status, bytes.TrimSpace(msg))
+	}
+	_, _ = io.Copy(io.Discard, res.Body)
+	return nil
+}
+
+func (h *HTTP) Close() error {
+	h.client.CloseIdleConnections()
+	return nil
+}
+
+// source identifies the events written by the load generator
+const source = "loadgen"
+
+// Kafka writes order.create events keyed by restaurant, as the producer does
+type Kafka struct {
+	writer *kafka.Writer
+	codec  *events.Codec
+}
+
+func NewKafka(conn *kafkaconn.Conn, topic string, codec *events.Codec) *Kafka {
+	return &Kafka{
+		writer: &kafka.Writer{
+			Addr:                   conn.Addr(),
+			Transport:              conn.Transport(),
+			Topic:                  topic,
+			Balancer:               &kafka.Hash{},
+			AllowAutoTopicCreation: true,
+			BatchTimeout:           10 * time.Millisecond,
+		},
+		codec: codec,
+	}
+}
+
+func (k *Kafka) Submit(ctx context.Context, requestID string, order events.OrderCreate) error {
+	env, err := events.New(source, events.TypeOrderCreate, order)
+	if err != nil {
+		return err
+	}
+	ctx = correlation.NewContext(ctx, correlation.IDs{RequestID: requestID, Trace: correlation.NewTrace()})
+	payload, headers, err := k.codec.Marshal(ctx, env)
+	if err != nil {
+		return err
+	}
+	headers = append(headers, correlation.KafkaHeaders(ctx)...)
+	return k.writer.WriteMessages(ctx, kafka.Message{Key: []byte(order.RestaurantID), Value: payload, Headers: headers})
+}
+
+func (k *Kafka) Close() error {
+	return k.writer.Close()
+}
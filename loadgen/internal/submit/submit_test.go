@@ -0,0 +1,51 @@
+package submit
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"contracts/events"
+)
+
+func TestHTTP(t *testing.T) {
+	var got struct {
+		org, requestID string
+		body           map[string]any
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/orders" {
+			http.NotFound(w, r)
+			return
+		}
+		got.org, got.requestID = r.Header.Get("x-org"), r.Header.Get("x-request-id")
+		_ = json.NewDecoder(r.Body).Decode(&got.body)
+		if got.org == "bad" {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(`{"error":"invalid x-org header format"}`))
+			return
+		}
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer srv.Close()
+
+	h := NewHTTP(srv.URL, time.Second)
+	defer h.Close()
+	order := events.OrderCreate{RestaurantID: "r1", Items: []events.OrderItem{{ID: "i1", Quantity: 2}}, Tip: 150}
+	if err := h.Submit(context.Background(), "req-1", order); err != nil {
+		t.Fatal(err)
+	}
+	if got.org != "r1" || got.requestID != "req-1" || got.body["tip"] != 150.0 || got.body["restaurantId"] != nil {
+		t.Errorf("unexpected request %+v", got)
+	}
+
+	order.RestaurantID = "bad"
+	err := h.Submit(context.Background(), "req-2", order)
+	if err == nil || !strings.Contains(err.Error(), "400 Bad Request") || !strings.Contains(err.Error(), "invalid x-org") {
+		t.Errorf("got error %v", err)
+	}
+}
@@ -0,0 +1,104 @@
+// Package track follows submitted orders until they're persisted, by request ID, and records
+// how long each took end to end
+package track
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// Tracker holds the orders submitted and not yet persisted. Orders are added before they're
+// submitted, so that one persisted before its submission returns is still matched.
+type Tracker struct {
+	mu        sync.Mutex
+	pending   map[string]time.Time
+	latencies []time.Duration
+	lost      int
+}
+
+func NewTracker() *Tracker {
+	return &Tracker{pending: make(map[string]time.Time)}
+}
+
+// Submitting records that the order of requestID is submitted at at
+func (t *Tracker) Submitting(requestID string, at time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.pending[requestID] = at
+}
+
+// Failed forgets an order whose submission failed
+func (t *Tracker) Failed(requestID string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.pending, requestID)
+}
+
+// Persisted records the latency of the order of requestID; orders that aren't pending, e.g.
+// other clients' or delivered twice, are ignored
+func (t *Tracker) Persisted(requestID string, at time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	submitted, ok := t.pending[requestID]
+	if !ok {
+		return
+	}
+	delete(t.pending, requestID)
+	t.latencies = append(t.latencies, at.Sub(submitted))
+}
+
+// Pending returns the request IDs of the orders not yet persisted
+func (t *Tracker) Pending() []string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	ids := make([]string, 0, len(t.pending))
+	for id := range t.pending {
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+// Expire counts the orders submitted before deadline as lost and returns how many are left
+func (t *Tracker) Expire(deadline time.Time) int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for id, submitted := range t.pending {
+		if submitted.Before(deadline) {
+			delete(t.pending, id)
+			t.lost++
+		}
+	}
+	return len(t.pending)
+}
+
+// Result is the end to end latencies of the persisted orders, shortest first, and how many
+// orders were lost
+func (t *Tracker) Result() (Latencies, int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	l := append(Latencies(nil), t.latencies...)
+	sort.Slice(l, func(i, j int) bool { return l[i] < l[j] })
+	return l, t.lost
+}
+
+// Latencies are sorted durations
+type Latencies []time.Duration
+
+// Percentile returns the duration p percent of the latencies are at most, by the nearest rank
+// method; 0 when there are none
+func (l Latencies) Percentile(p float64) time.Duration {
+	if len(l) == 0 {
+		return 0
+	}
+	rank := int(p / 100 * float64(len(l)))
+	if float64(rank) < p/100*float64(len(l)) {
+		rank++
+	}
+	return l[min(max(rank, 1), len(l))-1]
+}
+
+// Max is the longest latency
+func (l Latencies) Max() time.Duration {
+	return l.Percentile(100)
+}
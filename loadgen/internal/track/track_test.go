@@ -0,0 +1,50 @@
+package track
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPercentile(t *testing.T) {
+	var l Latencies
+	for i := 1; i <= 200; i++ {
+		l = append(l, time.Duration(i)*time.Millisecond)
+	}
+	for p, want := range map[float64]time.Duration{
+		50:   100 * time.Millisecond,
+		90:   180 * time.Millisecond,
+		99:   198 * time.Millisecond,
+		99.9: 200 * time.Millisecond,
+		100:  200 * time.Millisecond,
+	} {
+		if got := l.Percentile(p); got != want {
+			t.Errorf("p%g = %s, want %s", p, got, want)
+		}
+	}
+	if got := (Latencies{time.Second}).Percentile(1); got != time.Second {
+		t.Errorf("p1 of one latency = %s", got)
+	}
+	if got := Latencies(nil).Max(); got != 0 {
+		t.Errorf("max of none = %s", got)
+	}
+}
+
+func TestTracker(t *testing.T) {
+	tr := NewTracker()
+	start := time.Now()
+	tr.Submitting("a", start)
+	tr.Submitting("b", start.Add(time.Second))
+	tr.Submitting("c", start.Add(2*time.Second))
+	tr.Failed("c")
+
+	tr.Persisted("b", start.Add(1300*time.Millisecond))
+	tr.Persisted("b", start.Add(5*time.Second))
+	tr.Persisted("other", start)
+	if left := tr.Expire(start.Add(time.Millisecond)); left != 0 {
+		t.Errorf("%d orders left", left)
+	}
+	latencies, lost := tr.Result()
+	if len(latencies) != 1 || latencies[0] != 300*time.Millisecond || lost != 1 {
+		t.Errorf("got latencies %v and %d lost", latencies, lost)
+	}
+}
@@ -0,0 +1,159 @@
+package track
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"contracts/correlation"
+	"contracts/kafkaconn"
+
+	"github.com/segmentio/kafka-go"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// orderCreated is the lifecycle event the consumer publishes once it has stored an order
+const orderCreated = "order.created"
+
+// lifecycleEvent is the part of the consumer's lifecycle events used to match orders
+type lifecycleEvent struct {
+	Type  string `json:"type"`
+	Order struct {
+		RequestID string `json:"requestId"`
+	} `json:"order"`
+}
+
+// WatchEvents reads the lifecycle topic from its current end, one reader per partition, and
+// marks the orders of order.created events persisted when they're received. The end offsets are
+// looked up before it returns, so that no event of an order submitted afterwards is missed.
+// The returned function stops the readers.
+func WatchEvents(ctx context.Context, conn *kafkaconn.Conn, topic string, tracker *Tracker, logger *slog.Logger) (func(), error) {
+	client := &kafka.Client{Addr: conn.Addr(), Transport: conn.Transport()}
+	meta, err := client.Metadata(ctx, &kafka.MetadataRequest{Topics: []string{topic}})
+	if err != nil {
+		return nil, err
+	}
+	if len(meta.Topics) != 1 || meta.Topics[0].Error != nil {
+		var topicErr error
+		if len(meta.Topics) == 1 {
+			topicErr = meta.Topics[0].Error
+		}
+		return nil, fmt.Errorf("lifecycle topic %s: %v; has the consumer published any event yet?", topic, topicErr)
+	}
+	requests := make([]kafka.OffsetRequest, len(meta.Topics[0].Partitions))
+	for i, p := range meta.Topics[0].Partitions {
+		requests[i] = kafka.LastOffsetOf(p.ID)
+	}
+	offsets, err := client.ListOffsets(ctx, &kafka.ListOffsetsRequest{Topics: map[string][]kafka.OffsetRequest{topic: requests}})
+	if err != nil {
+		return nil, err
+	}
+
+	runCtx, cancel := context.WithCancel(ctx)
+	var wg sync.WaitGroup
+	for _, p := range offsets.Topics[topic] {
+		if p.Error != nil {
+			cancel()
+			return nil, fmt.Errorf("lifecycle topic %s partition %d: %w", topic, p.Partition, p.Error)
+		}
+		r := kafka.NewReader(kafka.ReaderConfig{
+			Brokers:   conn.Brokers,
+			Dialer:    conn.Dialer(),
+			Topic:     topic,
+			Partition: p.Partition,
+			MinBytes:  1,
+			MaxBytes:  10e6,
+			MaxWait:   100 * time.Millisecond,
+		})
+		if err := r.SetOffset(p.LastOffset); err != nil {
+			_ = r.Close()
+			cancel()
+			return nil, err
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer r.Close()
+			for {
+				message, err := r.ReadMessage(runCtx)
+				if err != nil {
+					if runCtx.Err() != nil {
+						return
+					}
+					logger.Warn("lifecycle read error", "partition", p.Partition, "error", err)
+					continue
+				}
+				received := time.Now()
+				var evt lifecycleEvent
+				if err := json.Unmarshal(message.Value, &evt); err != nil || evt.Type != orderCreated {
+					continue
+				}
+				tracker.Persisted(requestID(message, evt), received)
+			}
+		}()
+	}
+	return func() {
+		cancel()
+		wg.Wait()
+	}, nil
+}
+
+// requestID is the one the consumer forwarded in the event's headers, or else the order's
+func requestID(message kafka.Message, evt lifecycleEvent) string {
+	for _, h := range message.Headers {
+		if h.Key == correlation.HeaderRequestID {
+			return string(h.Value)
+		}
+	}
+	return evt.Order.RequestID
+}
+
+// maxPollIDs bounds the request IDs looked up by one query
+const maxPollIDs = 1000
+
+// Poll looks the pending orders up in MongoDB by request ID every interval, until ctx is done.
+// An order is taken as persisted when the poll that finds it started, so latencies are only
+// as precise as the interval.
+func Poll(ctx context.Context, db *mongo.Database, interval time.Duration, tracker *Tracker, logger *slog.Logger) {
+	orders := db.Collection("orders")
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		pending := tracker.Pending()
+		polled := time.Now()
+		for len(pending) > 0 {
+			ids := pending[:min(len(pending), maxPollIDs)]
+			pending = pending[len(ids):]
+			if err := poll(ctx, orders, ids, polled, tracker); err != nil && ctx.Err() == nil {
+				logger.Warn("polling orders failed", "error", err)
+			}
+		}
+	}
+}
+
+func poll(ctx context.Context, orders *mongo.Collection, ids []string, polled time.Time, tracker *Tracker) error {
+	cursor, err := orders.Find(ctx, bson.M{"requestId": bson.M{"$in": ids}}, options.Find().SetProjection(bson.M{"requestId": 1, "_id": 0}))
+	if err != nil {
+		return err
+	}
+	var found []struct {
+		RequestID string `bson:"requestId"`
+	}
+	if err := cursor.All(ctx, &found); err != nil {
+		return err
+	}
+	for _, f := range found {
+		tracker.Persisted(f.RequestID, polled)
+	}
+	return nil
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+
+	"contracts/events"
+	"contracts/kafkaconn"
+	"contracts/mongoconn"
+	"contracts/registry"
+	"loadgen/internal/config"
+	"loadgen/internal/load"
+	"loadgen/internal/menu"
+	"loadgen/internal/submit"
+	"loadgen/internal/track"
+)
+
+func main() {
+	args := os.Args[1:]
+	command := "run"
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		command, args = args[0], args[1:]
+	}
+	switch command {
+	case "run":
+		run(args)
+	case "config":
+		configCommand(args)
+	default:
+		fmt.Fprintf(os.Stderr, "unknown command %q\n%s", command, usage)
+		os.Exit(2)
+	}
+}
+
+const usage = `usage:
+  loadgen [run] [flags]        submit orders at a target rate and report their latencies
+  loadgen config print [flags] print the effective configuration, secrets redacted
+run with -h for the flags
+`
+
+// run drives the pipeline until the load is over or SIGINT, then prints the report to stdout
+func run(args []string) {
+	cfg := loadConfig("loadgen run", args)
+	var level slog.Level
+	_ = level.UnmarshalText([]byte(cfg.Log.Level))
+	handler := slog.Handler(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: level}))
+	if cfg.Log.Format == "json" {
+		handler = slog.NewJSONHandler(os.Stderr, &slog.HandlerOptions{Level: level})
+	}
+	logger := slog.New(handler)
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	report, err := drive(ctx, cfg, logger)
+	if err != nil {
+		logger.Error("load failed", "error", err)
+		os.Exit(1)
+	}
+	if err := report.Print(os.Stdout); err != nil {
+		logger.Error("printing the report failed", "error", err)
+		os.Exit(1)
+	}
+	if report.Persisted == 0 {
+		os.Exit(1)
+	}
+}
+
+func drive(ctx context.Context, cfg config.Config, logger *slog.Logger) (load.Report, error) {
+	client, db, err := mongoconn.Connect(ctx, cfg.Mongo, logger)
+	if err != nil {
+		return load.Report{}, err
+	}
+	defer func() { _ = client.Disconnect(context.Background()) }()
+	restaurants, err := menu.Load(ctx, db, cfg.Load.Restaurants)
+	if err != nil {
+		return load.Report{}, err
+	}
+
+	var conn *kafkaconn.Conn
+	if cfg.Load.Target == "kafka" || cfg.Completion.Mode == "events" {
+		if conn, err = kafkaconn.New(cfg.Kafka.Config); err != nil {
+			return load.Report{}, err
+		}
+		defer conn.Close()
+	}
+
+	tracker := track.NewTracker()
+	watchCtx, stopWatching := context.WithCancel(ctx)
+	defer stopWatching()
+	if cfg.Completion.Mode == "events" {
+		stopEvents, err := track.WatchEvents(watchCtx, conn, cfg.Kafka.LifecycleTopic, tracker, logger)
+		if err != nil {
+			return load.Report{}, err
+		}
+		defer stopEvents()
+	} else {
+		go track.Poll(watchCtx, db, cfg.Completion.PollInterval, tracker, logger)
+	}
+
+	var submitter submit.Submitter
+	if cfg.Load.Target == "kafka" {
+		codec, err := newEventCodec(cfg.Events)
+		if err != nil {
+			return load.Report{}, err
+		}
+		submitter = submit.NewKafka(conn, cfg.Kafka.OrdersTopic, codec)
+	} else {
+		submitter = submit.NewHTTP(cfg.HTTP.URL, cfg.HTTP.Timeout)
+	}
+	defer submitter.Close()
+
+	logger.Info("starting load", "target", cfg.Load.Target, "rate", cfg.Load.Rate, "duration", cfg.Load.Duration,
+		"restaurants", len(restaurants), "completion", cfg.Completion.Mode)
+	return load.Run(ctx, load.Options{
+		Rate:        cfg.Load.Rate,
+		Duration:    cfg.Load.Duration,
+		Concurrency: cfg.Load.Concurrency,
+		RandomSeed:  cfg.Load.RandomSeed,
+		Timeout:     cfg.Completion.Timeout,
+	}, restaurants, submitter, tracker, logger), nil
+}
+
+// newEventCodec picks the wire format of the order events written with the kafka target
+func newEventCodec(cfg config.EventsConfig) (*events.Codec, error) {
+	format, err := events.ParseFormat(cfg.Format)
+	if err != nil {
+		return nil, err
+	}
+	var reg *registry.Client
+	if cfg.SchemaRegistryURL != "" {
+		if reg, err = registry.NewClient(cfg.SchemaRegistryURL); err != nil {
+			return nil, err
+		}
+	}
+	return events.NewCodec(format, reg)
+}
@@ -9,7 +9,20 @@ import (
 
 // GetOrgID reads the x-org header and returns both the ObjectID and its hex string
 func GetOrgID(ctx *gin.Context) (primitive.ObjectID, string, error) {
+	return parseOrgID(ctx.GetHeader("x-org"))
+}
+
+// GetStreamOrgID behaves like GetOrgID but also accepts an org query parameter,
+// since browser EventSource and WebSocket clients cannot set custom headers
+func GetStreamOrgID(ctx *gin.Context) (primitive.ObjectID, string, error) {
 	org := ctx.GetHeader("x-org")
+	if org == "" {
+		org = ctx.Query("org")
+	}
+	return parseOrgID(org)
+}
+
+func parseOrgID(org string) (primitive.ObjectID, string, error) {
 	if org == "" {
 		return primitive.NilObjectID, "", errors.New("missing x-org header")
 	}
@@ -1,28 +1,190 @@
 package config
 
-import "os"
+import (
+	"fmt"
+	"strings"
+	"time"
 
+	"contracts/configload"
+	"contracts/events"
+	"contracts/kafkaconn"
+	"contracts/money"
+	"contracts/mongoconn"
+	"contracts/pgconn"
+)
+
+// Config is read by Load from, in increasing order of precedence: the defaults below, a YAML or
+// TOML file (--config or CONFIG_FILE), environment variables and flags (--kafka.brokers etc.)
 type Config struct {
-	Port          string
-	KafkaBroker   string
-	RedisAddr     string
-	MongoURI      string
-	MongoDatabase string
+	HTTP     HTTPConfig       `yaml:"http"`
+	Storage  StorageConfig    `yaml:"storage"`
+	Mongo    mongoconn.Config `yaml:"mongo"`
+	Postgres pgconn.Config    `yaml:"postgres"`
+	Redis    RedisConfig      `yaml:"redis"`
+	Kafka    KafkaConfig      `yaml:"kafka"`
+	Events   EventsConfig     `yaml:"events"`
+	Orders   OrdersConfig     `yaml:"orders"`
+	FX       FXConfig         `yaml:"fx"`
+	Tracing  TracingConfig    `yaml:"tracing"`
+	Log      LogConfig        `yaml:"log"`
+	Health   HealthConfig     `yaml:"health"`
+
+	// ShutdownTimeout bounds the graceful shutdown that follows SIGTERM or SIGINT
+	ShutdownTimeout time.Duration `yaml:"shutdownTimeout" env:"SHUTDOWN_TIMEOUT" usage:"graceful shutdown deadline"`
+}
+
+type HTTPConfig struct {
+	Port string `yaml:"port" env:"PORT" usage:"HTTP listen port"`
+}
+
+// Storage backends
+const (
+	BackendMongo    = "mongo"
+	BackendPostgres = "postgres"
+)
+
+type StorageConfig struct {
+	// Backend is the database the consumer keeps the orders, menus and daily aggregates in
+	Backend string `yaml:"backend" env:"STORAGE_BACKEND" usage:"database orders are read from: mongo or postgres"`
+}
+
+type RedisConfig struct {
+	Addr     string `yaml:"addr" env:"REDIS_ADDR" usage:"Redis host:port"`
+	Password string `yaml:"password" env:"REDIS_PASSWORD" secret:"true" usage:"Redis password"`
+}
+
+type KafkaConfig struct {
+	// brokers, tls and sasl
+	kafkaconn.Config `yaml:",inline"`
+	// Balancer partitions order events by their restaurant key, see orders.ParseBalancer
+	Balancer       string `yaml:"balancer" env:"KAFKA_BALANCER" usage:"order event partitioner: hash, murmur2, crc32, round-robin or least-bytes"`
+	OrdersTopic    string `yaml:"ordersTopic" env:"KAFKA_ORDERS_TOPIC" usage:"topic order events are written to"`
+	LifecycleTopic string `yaml:"lifecycleTopic" env:"KAFKA_LIFECYCLE_TOPIC" usage:"topic of the consumer's order lifecycle events, fanned out to live streams"`
+}
+
+type EventsConfig struct {
+	// Format is how order events are written to Kafka: json, protobuf or avro.
+	// Binary formats need SchemaRegistryURL.
+	Format            string `yaml:"format" env:"EVENT_FORMAT" usage:"order event encoding: json, protobuf or avro"`
+	SchemaRegistryURL string `yaml:"schemaRegistryUrl" env:"SCHEMA_REGISTRY_URL" usage:"schema registry URL, required by binary formats"`
+}
+
+type OrdersConfig struct {
+	// RecentWindow is how far back RecentOrders looks; its result is cached in Redis for RecentCacheTTL
+	RecentWindow   time.Duration `yaml:"recentWindow" env:"ORDERS_RECENT_WINDOW" usage:"age of the orders listed by /orders/recent"`
+	RecentCacheTTL time.Duration `yaml:"recentCacheTtl" env:"ORDERS_RECENT_CACHE_TTL" usage:"how long /orders/recent results are cached"`
+	// StreamOrigins are the origins browsers may open WebSocket order streams from, besides the
+	// producer's own
+	StreamOrigins []string `yaml:"streamOrigins" env:"ORDERS_STREAM_ORIGINS" usage:"other origins allowed to open WebSocket order streams, as scheme://host[:port],...; * for any"`
+}
+
+// FXConfig is the exchange rate table analytics use to convert between restaurant currencies,
+// e.g. FX_RATES="EUR:1.08,GBP:1.27" against USD. There are no default rates, which go stale:
+// until they're configured, converting to another currency fails with money.ErrNoRate.
+type FXConfig struct {
+	Base  string `yaml:"base" env:"FX_BASE" usage:"currency the rates are quoted against"`
+	Rates string `yaml:"rates" env:"FX_RATES" usage:"exchange rates as CUR:rate,CUR:rate"`
+}
+
+type TracingConfig struct {
+	// Exporter sends spans with OTLP ("otlp"), prints them ("stdout") or drops them ("none");
+	// SampleRatio is the share of new traces recorded, from 0 to 1
+	Exporter    string  `yaml:"exporter" env:"OTEL_TRACES_EXPORTER" usage:"span exporter: none, otlp or stdout"`
+	SampleRatio float64 `yaml:"sampleRatio" env:"OTEL_TRACES_SAMPLER_ARG" usage:"share of new traces recorded, 0 to 1"`
+}
+
+type LogConfig struct {
+	Format string `yaml:"format" env:"LOG_FORMAT" usage:"log format: json or text"`
+	Level  string `yaml:"level" env:"LOG_LEVEL" usage:"minimum log level: debug, info, warn or error"`
+}
+
+type HealthConfig struct {
+	// CheckTimeout bounds each run of the health checks
+	CheckTimeout time.Duration `yaml:"checkTimeout" env:"HEALTH_CHECK_TIMEOUT" usage:"deadline of the health checks"`
+}
+
+// Default is the configuration of a producer running on the host next to docker compose
+func Default() Config {
+	cfg := Config{
+		HTTP:     HTTPConfig{Port: "8081"},
+		Storage:  StorageConfig{Backend: BackendMongo},
+		Mongo:    mongoconn.Default("restaurantdb"),
+		Postgres: pgconn.Default("restaurantdb"),
+		Redis:    RedisConfig{Addr: "localhost:6379"},
+		Kafka: KafkaConfig{
+			Config:         kafkaconn.Default("localhost:9094"),
+			Balancer:       "hash",
+			OrdersTopic:    "orders",
+			LifecycleTopic: "order-events",
+		},
+		Events:          EventsConfig{Format: "json"},
+		Orders:          OrdersConfig{RecentWindow: 15 * time.Minute, RecentCacheTTL: 5 * time.Minute},
+		FX:              FXConfig{Base: "USD"},
+		Tracing:         TracingConfig{Exporter: "none", SampleRatio: 1},
+		Log:             LogConfig{Format: "json", Level: "info"},
+		Health:          HealthConfig{CheckTimeout: 2 * time.Second},
+		ShutdownTimeout: 30 * time.Second,
+	}
+	cfg.Mongo.AppName = "producer"
+	cfg.Postgres.AppName = "producer"
+	return cfg
+}
+
+// Read reads the configuration from its sources and the flags in args, without validating it
+func Read(name string, args []string) (Config, error) {
+	cfg := Default()
+	err := configload.Load(&cfg, name, args)
+	return cfg, err
 }
 
-func getEnv(key, fallback string) string {
-	if v := os.Getenv(key); v != "" {
-		return v
+// Load reads the configuration and validates it
+func Load(name string, args []string) (Config, error) {
+	cfg, err := Read(name, args)
+	if err != nil {
+		return cfg, err
 	}
-	return fallback
+	return cfg, cfg.Validate()
 }
 
-func Load() Config {
-	return Config{
-		Port:          getEnv("PORT", "8081"),
-		KafkaBroker:   getEnv("KAFKA_BROKER", "localhost:9094"),
-		RedisAddr:     getEnv("REDIS_ADDR", "localhost:6379"),
-		MongoURI:      getEnv("MONGODB_URI", "mongodb://localhost:27017"),
-		MongoDatabase: getEnv("MONGODB_DATABASE", "restaurantdb"),
+// Validate reports every invalid setting, by its key in config files
+func (c Config) Validate() error {
+	var errs configload.Errors
+	errs.Check("http.port", configload.Port(c.HTTP.Port))
+	errs.Check("storage.backend", configload.OneOf(c.Storage.Backend, BackendMongo, BackendPostgres))
+	// only the backend in use is connected to
+	switch c.Storage.Backend {
+	case BackendMongo:
+		c.Mongo.Validate(&errs, "mongo.")
+	case BackendPostgres:
+		c.Postgres.Validate(&errs, "postgres.")
+	}
+	errs.Check("redis.addr", configload.HostPort(c.Redis.Addr))
+	c.Kafka.Validate(&errs, "kafka.")
+	errs.Check("kafka.balancer", configload.OneOf(c.Kafka.Balancer, "hash", "murmur2", "crc32", "round-robin", "least-bytes"))
+	errs.Check("kafka.ordersTopic", configload.Required(c.Kafka.OrdersTopic))
+	errs.Check("kafka.lifecycleTopic", configload.Required(c.Kafka.LifecycleTopic))
+	if format, err := events.ParseFormat(c.Events.Format); err != nil {
+		errs.Check("events.format", err)
+	} else if format != events.FormatJSON && c.Events.SchemaRegistryURL == "" {
+		errs.Check("events.schemaRegistryUrl", fmt.Errorf("required by the %s format", format))
+	}
+	errs.Check("orders.recentWindow", configload.Positive(c.Orders.RecentWindow))
+	errs.Check("orders.recentCacheTtl", configload.Positive(c.Orders.RecentCacheTTL))
+	for _, origin := range c.Orders.StreamOrigins {
+		if origin != "*" {
+			errs.Check("orders.streamOrigins", configload.URL(origin, "http", "https"))
+		}
+	}
+	if _, err := money.ParseRates(c.FX.Base, c.FX.Rates); err != nil {
+		errs.Check("fx", err)
+	}
+	errs.Check("tracing.exporter", configload.OneOf(c.Tracing.Exporter, "none", "otlp", "stdout"))
+	if c.Tracing.SampleRatio < 0 || c.Tracing.SampleRatio > 1 {
+		errs.Check("tracing.sampleRatio", fmt.Errorf("%g is not between 0 and 1", c.Tracing.SampleRatio))
 	}
+	errs.Check("log.format", configload.OneOf(c.Log.Format, "json", "text"))
+	errs.Check("log.level", configload.OneOf(strings.ToLower(c.Log.Level), "debug", "info", "warn", "error"))
+	errs.Check("health.checkTimeout", configload.Positive(c.Health.CheckTimeout))
+	errs.Check("shutdownTimeout", configload.Positive(c.ShutdownTimeout))
+	return errs.Err()
 }
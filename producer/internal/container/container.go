@@ -2,58 +2,197 @@ package container
 
 import (
 	"context"
+	"errors"
+	"log/slog"
+	"os"
 
+	"contracts/events"
+	"contracts/health"
+	"contracts/kafkaconn"
+	"contracts/logging"
+	"contracts/money"
+	"contracts/registry"
+	"contracts/telemetry"
 	"producer/internal/config"
 	dbconn "producer/internal/db"
 	analytics "producer/internal/features/analytics"
 	"producer/internal/features/orders"
 	rests "producer/internal/features/restaurants"
+	"producer/internal/pgstore"
 
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/redis/go-redis/extra/redisotel/v9"
 	"github.com/redis/go-redis/v9"
 	"go.mongodb.org/mongo-driver/mongo"
 )
 
 type Container struct {
 	Config   config.Config
+	Logger   *slog.Logger
 	Redis    *redis.Client
 	DBClient *mongo.Client
 	DB       *mongo.Database
+	Postgres *pgxpool.Pool // with the postgres storage backend, DBClient and DB with mongo
+	// Kafka connects every Kafka reader and writer
+	Kafka *kafkaconn.Conn
 
 	Orders      *orders.Service
 	Restaurants *rests.Service
 	Analytics   *analytics.Service
+
+	// OrderStream fans out order lifecycle events to live subscribers
+	OrderStream *orders.Hub
+
+	Health *health.Service
+
+	// shutdown functions, run by Close in reverse order within its context's deadline
+	ShutdownFns []func(ctx context.Context)
 }
 
 func New(ctx context.Context, cfg config.Config) (*Container, error) {
-	c := &Container{Config: cfg}
+	// the default logger too, so that libraries logging with log or slog write the same format
+	logger, err := logging.New(os.Stdout, cfg.Log.Format, cfg.Log.Level)
+	if err != nil {
+		return nil, err
+	}
+	slog.SetDefault(logger)
+	c := &Container{Config: cfg, Logger: logger}
+
+	// Tracing first, so that the clients below report to it; flushed last on shutdown
+	shutdownTracing, err := telemetry.Setup(ctx, "producer", cfg.Tracing.Exporter, cfg.Tracing.SampleRatio)
+	if err != nil {
+		return nil, err
+	}
+	c.ShutdownFns = append(c.ShutdownFns, func(ctx context.Context) { _ = shutdownTracing(ctx) })
 
 	// Redis client
-	c.Redis = redis.NewClient(&redis.Options{Addr: cfg.RedisAddr})
+	c.Redis = redis.NewClient(&redis.Options{Addr: cfg.Redis.Addr, Password: cfg.Redis.Password})
+	if err := redisotel.InstrumentTracing(c.Redis); err != nil {
+		return nil, err
+	}
 	if err := c.Redis.Ping(ctx).Err(); err != nil {
 		return nil, err
 	}
 
-	// MongoDB
-	client, database, err := dbconn.Connect(ctx, cfg.MongoURI, cfg.MongoDatabase)
+	// The database the consumer writes
+	stores, err := c.openStorage(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	rates, err := money.ParseRates(cfg.FX.Base, cfg.FX.Rates)
 	if err != nil {
 		return nil, err
 	}
-	c.DBClient, c.DB = client, database
+
+	codec, err := newEventCodec(cfg)
+	if err != nil {
+		return nil, err
+	}
+	balancer, err := orders.ParseBalancer(cfg.Kafka.Balancer)
+	if err != nil {
+		return nil, err
+	}
+
+	if c.Kafka, err = kafkaconn.New(cfg.Kafka.Config); err != nil {
+		return nil, err
+	}
+	// closed after the order writer below
+	c.ShutdownFns = append(c.ShutdownFns, func(context.Context) { c.Kafka.Close() })
 
 	// Services
-	c.Orders = orders.NewService(c.DB, cfg.KafkaBroker, c.Redis)
-	c.Restaurants = rests.NewService(c.DB)
-	c.Analytics = analytics.NewService(c.DB)
+	c.OrderStream = orders.NewHub()
+	c.Orders = orders.NewService(stores.orders, orders.ServiceConfig{
+		Kafka:          c.Kafka,
+		Topic:          cfg.Kafka.OrdersTopic,
+		Balancer:       balancer,
+		RecentWindow:   cfg.Orders.RecentWindow,
+		RecentCacheTTL: cfg.Orders.RecentCacheTTL,
+		StreamOrigins:  cfg.Orders.StreamOrigins,
+	}, orders.NewRedisCache(c.Redis), c.OrderStream, codec)
+	c.ShutdownFns = append(c.ShutdownFns, func(context.Context) { _ = c.Orders.Close() })
+	c.Restaurants = rests.NewService(stores.restaurants)
+	c.Analytics = analytics.NewService(stores.analytics, rates)
+
+	// Requests are served by this process alone, so liveness has no checks of its own
+	c.Health = health.NewService(cfg.Health.CheckTimeout)
+	c.Health.AddReadiness(cfg.Storage.Backend, stores.check)
+	c.Health.AddReadiness("redis", health.RedisCheck(c.Redis))
+	c.Health.AddReadiness("kafka", health.KafkaCheck(c.Kafka))
 
 	return c, nil
 }
 
-func (c *Container) Close(_ context.Context) error {
+// storage is what the services read from the backend
+type storage struct {
+	orders      orders.Store
+	restaurants rests.Stores
+	analytics   analytics.Stores
+	check       health.Check
+}
+
+// openStorage connects to the database of storage.backend
+func (c *Container) openStorage(ctx context.Context) (storage, error) {
+	if c.Config.Storage.Backend == config.BackendPostgres {
+		pool, err := dbconn.ConnectPostgres(ctx, c.Config.Postgres, c.Logger)
+		if err != nil {
+			return storage{}, err
+		}
+		c.Postgres = pool
+		db := pgstore.New(pool)
+		return storage{
+			orders:      db.Orders,
+			restaurants: db.RestaurantStores(),
+			analytics:   db.AnalyticsStores(),
+			check:       health.PostgresCheck(pool),
+		}, nil
+	}
+
+	client, database, err := dbconn.Connect(ctx, c.Config.Mongo, c.Logger)
+	if err != nil {
+		return storage{}, err
+	}
+	c.DBClient, c.DB = client, database
+	return storage{
+		orders:      orders.NewMongoStore(database),
+		restaurants: rests.MongoStores(database),
+		analytics:   analytics.MongoStores(database),
+		check:       health.MongoCheck(client),
+	}, nil
+}
+
+// newEventCodec picks the wire format of order events; binary formats register their schemas
+func newEventCodec(cfg config.Config) (*events.Codec, error) {
+	format, err := events.ParseFormat(cfg.Events.Format)
+	if err != nil {
+		return nil, err
+	}
+	var reg *registry.Client
+	if cfg.Events.SchemaRegistryURL != "" {
+		if reg, err = registry.NewClient(cfg.Events.SchemaRegistryURL); err != nil {
+			return nil, err
+		}
+	}
+	return events.NewCodec(format, reg)
+}
+
+// Close stops what was started last first: the lifecycle consumer, then the order writer,
+// which flushes its pending messages, then tracing, and disconnects Redis and the database last
+func (c *Container) Close(ctx context.Context) error {
+	for i := len(c.ShutdownFns) - 1; i >= 0; i-- {
+		if c.ShutdownFns[i] != nil {
+			c.ShutdownFns[i](ctx)
+		}
+	}
+	var errs []error
 	if c.Redis != nil {
-		_ = c.Redis.Close()
+		errs = append(errs, c.Redis.Close())
 	}
 	if c.DBClient != nil {
-		_ = c.DBClient.Disconnect(context.Background())
+		errs = append(errs, c.DBClient.Disconnect(ctx))
+	}
+	if c.Postgres != nil {
+		c.Postgres.Close()
 	}
-	return nil
+	return errors.Join(errs...)
 }
@@ -2,22 +2,17 @@ package db
 
 import (
 	"context"
-	"time"
+	"log/slog"
+
+	"contracts/metrics"
+	"contracts/mongoconn"
 
 	"go.mongodb.org/mongo-driver/mongo"
-	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.opentelemetry.io/contrib/instrumentation/go.mongodb.org/mongo-driver/mongo/otelmongo"
 )
 
-func Connect(ctx context.Context, uri, database string) (*mongo.Client, *mongo.Database, error) {
-	clientOpts := options.Client().ApplyURI(uri)
-	client, err := mongo.NewClient(clientOpts)
-	if err != nil {
-		return nil, nil, err
-	}
-	c, cancel := context.WithTimeout(ctx, 10*time.Second)
-	defer cancel()
-	if err := client.Connect(c); err != nil {
-		return nil, nil, err
-	}
-	return client, client.Database(database), nil
+// Connect waits for MongoDB as configured; every command is timed and becomes a span of the
+// operation that issued it
+func Connect(ctx context.Context, cfg mongoconn.Config, logger *slog.Logger) (*mongo.Client, *mongo.Database, error) {
+	return mongoconn.Connect(ctx, cfg, logger, metrics.MongoMonitor(), otelmongo.NewMonitor())
 }
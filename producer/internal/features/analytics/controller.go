@@ -1,9 +1,12 @@
 package analytics
 
 import (
+	"errors"
 	"net/http"
+	"strings"
 	"time"
 
+	"contracts/money"
 	"producer/internal/auth"
 
 	"github.com/gin-gonic/gin"
@@ -21,6 +24,24 @@ func (c *Controller) RegisterRoutes(r *gin.Engine) {
 	g.GET("/popular-items", c.GetPopularItems)
 }
 
+// parseCurrency validates the optional currency param used to convert amounts
+func parseCurrency(ctx *gin.Context) (string, bool) {
+	currency := strings.ToUpper(ctx.Query("currency"))
+	if currency != "" && !money.ValidCurrency(currency) {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "currency must be an ISO 4217 code"})
+		return "", false
+	}
+	return currency, true
+}
+
+// errorStatus maps currency problems to 422 since the request was well formed
+func errorStatus(err error) int {
+	if errors.Is(err, ErrMixedCurrencies) || errors.Is(err, money.ErrNoRate) {
+		return http.StatusUnprocessableEntity
+	}
+	return http.StatusInternalServerError
+}
+
 func parseDate(ctx *gin.Context, key string) (time.Time, bool) {
 	s := ctx.Query(key)
 	if s == "" {
@@ -52,12 +73,17 @@ func (c *Controller) GetDailyAggregates(ctx *gin.Context) {
 	}
 	// Build params map for service
 	params := ctx.Request.URL.Query()
+	currency, ok := parseCurrency(ctx)
+	if !ok {
+		return
+	}
 	params.Set("restaurantId", ridHex)
 	params.Set("from", from.Format("01/02/2006"))
 	params.Set("to", to.Format("01/02/2006"))
+	params.Set("currency", currency)
 	data, err := c.service.DailyAggregates(ctx, params)
 	if err != nil {
-		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		ctx.JSON(errorStatus(err), gin.H{"error": err.Error()})
 		return
 	}
 	ctx.JSON(http.StatusOK, data)
@@ -72,12 +98,17 @@ func (c *Controller) GetPopularItems(ctx *gin.Context) {
 	if !ok {
 		return
 	}
+	currency, ok := parseCurrency(ctx)
+	if !ok {
+		return
+	}
 	params := ctx.Request.URL.Query()
 	params.Set("from", from.Format("01/02/2006"))
 	params.Set("to", to.Format("01/02/2006"))
+	params.Set("currency", currency)
 	data, err := c.service.MostPopularItems(ctx, params)
 	if err != nil {
-		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		ctx.JSON(errorStatus(err), gin.H{"error": err.Error()})
 		return
 	}
 	ctx.JSON(http.StatusOK, data)
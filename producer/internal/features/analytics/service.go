@@ -1,39 +1,53 @@
 package analytics
 
 import (
+	"context"
 	"errors"
 	"net/url"
+	"sort"
 	"time"
 
-	"github.com/gin-gonic/gin"
-	"go.mongodb.org/mongo-driver/bson"
+	"contracts/money"
+
 	"go.mongodb.org/mongo-driver/bson/primitive"
-	"go.mongodb.org/mongo-driver/mongo"
 )
 
 type Service struct {
-	db        *mongo.Database
-	orders    *mongo.Collection
-	items     *mongo.Collection
-	dailyAggs *mongo.Collection
+	aggregates AggregateStore
+	orders     OrderStore
+	items      ItemStore
+	rates      *money.Rates
 }
 
-func NewService(database *mongo.Database) *Service {
+func NewService(stores Stores, rates *money.Rates) *Service {
 	return &Service{
-		db:        database,
-		orders:    database.Collection("orders"),
-		items:     database.Collection("items"),
-		dailyAggs: database.Collection("daily_aggregates"),
+		aggregates: stores.Aggregates,
+		orders:     stores.Orders,
+		items:      stores.Items,
+		rates:      rates,
 	}
 }
 
+// ErrMixedCurrencies is returned when results span currencies and no target currency was requested
+var ErrMixedCurrencies = errors.New("results are in more than one currency; pass currency to convert")
+
+// DailyAggregate revenue is net sales (after discounts, before tax and tips); revenue, cost,
+// tax and tips are net of cancellations and refunds
 type DailyAggregate struct {
-	Day         time.Time `bson:"day" json:"day"`
-	TotalOrders int64     `bson:"totalOrders" json:"totalOrders"`
-	Revenue     float64   `bson:"revenue" json:"revenue"`
+	Day             time.Time   `json:"day"`
+	TotalOrders     int64       `json:"totalOrders"`
+	CancelledOrders int64       `json:"cancelledOrders"`
+	Revenue         money.Money `json:"revenue"`
+	Discounts       money.Money `json:"discounts"`
+	Tax             money.Money `json:"tax"`
+	Tips            money.Money `json:"tips"`
+	Cost            money.Money `json:"cost"`
+	Refunds         money.Money `json:"refunds"`
 }
 
-func (s *Service) DailyAggregates(ctx *gin.Context, params url.Values) ([]DailyAggregate, error) {
+// DailyAggregates returns the restaurant's totals per day. The optional currency param converts
+// them with the configured rate table.
+func (s *Service) DailyAggregates(ctx context.Context, params url.Values) ([]DailyAggregate, error) {
 	restaurantIDStr := params.Get("restaurantId")
 	if restaurantIDStr == "" {
 		return nil, errors.New("restaurantId is required")
@@ -46,72 +60,109 @@ func (s *Service) DailyAggregates(ctx *gin.Context, params url.Values) ([]DailyA
 	if err != nil {
 		return nil, err
 	}
-	pipeline := mongo.Pipeline{
-		bson.D{{Key: "$match", Value: bson.D{
-			{Key: "restaurantId", Value: restaurantID},
-			{Key: "day", Value: bson.D{{Key: "$gte", Value: fromInclusive}, {Key: "$lt", Value: toExclusive}}},
-		}}},
-		bson.D{{Key: "$sort", Value: bson.D{{Key: "day", Value: 1}}}},
-	}
-	cursor, err := s.dailyAggs.Aggregate(ctx, pipeline)
+	target := params.Get("currency")
+	totals, err := s.aggregates.DailyTotals(ctx, restaurantID, fromInclusive, toExclusive)
 	if err != nil {
 		return nil, err
 	}
-	defer cursor.Close(ctx)
 	var out []DailyAggregate
-	for cursor.Next(ctx) {
-		var agg DailyAggregate
-		if err := cursor.Decode(&agg); err != nil {
-			return nil, err
+	currencies := map[string]bool{}
+	for _, t := range totals {
+		if t.Currency == "" {
+			t.Currency = money.DefaultCurrency
+		}
+		currencies[t.Currency] = true
+		agg := DailyAggregate{Day: t.Day, TotalOrders: t.TotalOrders, CancelledOrders: t.CancelledOrders}
+		for _, f := range []struct {
+			dst *money.Money
+			src money.Amount
+		}{
+			{&agg.Revenue, t.Revenue},
+			{&agg.Discounts, t.Discounts},
+			{&agg.Tax, t.Tax},
+			{&agg.Tips, t.Tips},
+			{&agg.Cost, t.Cost},
+			{&agg.Refunds, t.Refunds},
+		} {
+			*f.dst, err = s.convert(money.New(f.src, t.Currency), target)
+			if err != nil {
+				return nil, err
+			}
 		}
 		out = append(out, agg)
 	}
-	return out, cursor.Err()
+	if target == "" && len(currencies) > 1 {
+		return nil, ErrMixedCurrencies
+	}
+	return out, nil
+}
+
+// convert leaves m alone when no target currency was requested
+func (s *Service) convert(m money.Money, target string) (money.Money, error) {
+	if target == "" {
+		return m, nil
+	}
+	return s.rates.Convert(m, target)
 }
 
 type PopularItem struct {
-	ItemID   primitive.ObjectID `bson:"itemId" json:"itemId"`
-	Name     string             `bson:"name" json:"name"`
-	Quantity int64              `bson:"quantity" json:"quantity"`
-	Revenue  float64            `bson:"revenue" json:"revenue"`
+	ItemID   primitive.ObjectID `json:"itemId"`
+	Name     string             `json:"name"`
+	Quantity int64              `json:"quantity"`
+	Revenue  money.Money        `json:"revenue"`
 }
 
-func (s *Service) MostPopularItems(ctx *gin.Context, params url.Values) ([]PopularItem, error) {
+// MostPopularItems ranks items across all restaurants by the quantity ordered, revenue being
+// that quantity at the item's current price. Restaurants may price in different currencies, so
+// revenues are only comparable when converted to the currency param; without it, mixed
+// currencies are refused.
+func (s *Service) MostPopularItems(ctx context.Context, params url.Values) ([]PopularItem, error) {
 	fromInclusive, toExclusive, err := parseFromTo(params)
 	if err != nil {
 		return nil, err
 	}
-	pipeline := mongo.Pipeline{
-		// filter by date range
-		bson.D{{Key: "$match", Value: bson.D{{Key: "creationDate", Value: bson.D{{Key: "$gte", Value: fromInclusive}, {Key: "$lt", Value: toExclusive}}}}}},
-		// explode order items
-		bson.D{{Key: "$unwind", Value: "$items"}},
-		// group by itemId and sum quantities from order items
-		bson.D{{Key: "$group", Value: bson.D{{Key: "_id", Value: "$items.itemId"}, {Key: "quantity", Value: bson.D{{Key: "$sum", Value: "$items.quantity"}}}}}},
-		// attach item details for price/name
-		bson.D{{Key: "$lookup", Value: bson.D{{Key: "from", Value: "items"}, {Key: "localField", Value: "_id"}, {Key: "foreignField", Value: "_id"}, {Key: "as", Value: "item"}}}},
-		bson.D{{Key: "$unwind", Value: "$item"}},
-		// compute revenue = price * quantity
-		bson.D{{Key: "$addFields", Value: bson.D{{Key: "revenue", Value: bson.D{{Key: "$multiply", Value: bson.A{"$item.price", "$quantity"}}}}}}},
-		// order by qty, then revenue
-		bson.D{{Key: "$sort", Value: bson.D{{Key: "quantity", Value: -1}, {Key: "revenue", Value: -1}}}},
-		// shape response
-		bson.D{{Key: "$project", Value: bson.D{{Key: "_id", Value: 0}, {Key: "itemId", Value: "$_id"}, {Key: "name", Value: "$item.name"}, {Key: "quantity", Value: 1}, {Key: "revenue", Value: 1}}}},
-	}
-	cursor, err := s.orders.Aggregate(ctx, pipeline)
+	target := params.Get("currency")
+	quantities, err := s.orders.ItemQuantities(ctx, fromInclusive, toExclusive)
+	if err != nil || len(quantities) == 0 {
+		return nil, err
+	}
+	ids := make([]primitive.ObjectID, 0, len(quantities))
+	for id := range quantities {
+		ids = append(ids, id)
+	}
+	items, err := s.items.FindItems(ctx, ids)
 	if err != nil {
 		return nil, err
 	}
-	defer cursor.Close(ctx)
+	// items no longer on the menu are left out
 	var out []PopularItem
-	for cursor.Next(ctx) {
-		var p PopularItem
-		if err := cursor.Decode(&p); err != nil {
+	currencies := map[string]bool{}
+	for _, it := range items {
+		quantity := quantities[it.ID]
+		revenue := money.New(money.Amount(int64(it.Price.Amount)*quantity), it.Price.Currency)
+		if revenue.Currency == "" {
+			revenue.Currency = money.DefaultCurrency
+		}
+		currencies[revenue.Currency] = true
+		if revenue, err = s.convert(revenue, target); err != nil {
 			return nil, err
 		}
-		out = append(out, p)
+		out = append(out, PopularItem{ItemID: it.ID, Name: it.Name, Quantity: quantity, Revenue: revenue})
+	}
+	if target == "" && len(currencies) > 1 {
+		return nil, ErrMixedCurrencies
 	}
-	return out, cursor.Err()
+	// order by qty, then revenue
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Quantity != out[j].Quantity {
+			return out[i].Quantity > out[j].Quantity
+		}
+		if out[i].Revenue.Amount != out[j].Revenue.Amount {
+			return out[i].Revenue.Amount > out[j].Revenue.Amount
+		}
+		return out[i].ItemID.Hex() < out[j].ItemID.Hex()
+	})
+	return out, nil
 }
 
 // parseFromTo parses required from/to in MM/DD/YYYY and converts to [from 00:00, toNext 00:00)
@@ -0,0 +1,125 @@
+package analytics_test
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"testing"
+	"time"
+
+	"contracts/money"
+	"producer/internal/features/analytics"
+	"producer/internal/memstore"
+	"producer/internal/models"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func newService(t *testing.T) (*analytics.Service, *memstore.DB) {
+	t.Helper()
+	rates, err := money.ParseRates("USD", "EUR:2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db := memstore.New()
+	return analytics.NewService(db.AnalyticsStores(), rates), db
+}
+
+func params(kv ...string) url.Values {
+	v := url.Values{}
+	for i := 0; i < len(kv); i += 2 {
+		v.Set(kv[i], kv[i+1])
+	}
+	return v
+}
+
+func day(d int) time.Time {
+	return time.Date(2025, 3, d, 0, 0, 0, 0, time.UTC)
+}
+
+func TestDailyAggregates(t *testing.T) {
+	svc, db := newService(t)
+	rid := primitive.NewObjectID()
+	db.Aggregates.Put(
+		analytics.DailyTotals{RestaurantID: rid, Day: day(3), Currency: "EUR", TotalOrders: 2, Revenue: 500, Tips: 50},
+		analytics.DailyTotals{RestaurantID: rid, Day: day(1), Currency: "EUR", TotalOrders: 1, Revenue: 100},
+		analytics.DailyTotals{RestaurantID: rid, Day: day(5), Currency: "EUR", TotalOrders: 9, Revenue: 900},
+		analytics.DailyTotals{RestaurantID: primitive.NewObjectID(), Day: day(2), Currency: "EUR", TotalOrders: 7},
+	)
+	ctx := context.Background()
+
+	got, err := svc.DailyAggregates(ctx, params("restaurantId", rid.Hex(), "from", "03/01/2025", "to", "03/04/2025"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 || !got[0].Day.Equal(day(1)) || !got[1].Day.Equal(day(3)) {
+		t.Fatalf("got %+v, want the restaurant's days 1 and 3 in order", got)
+	}
+	if got[1].TotalOrders != 2 || got[1].Revenue != money.New(500, "EUR") || got[1].Tips != money.New(50, "EUR") {
+		t.Errorf("day 3 = %+v", got[1])
+	}
+
+	converted, err := svc.DailyAggregates(ctx, params("restaurantId", rid.Hex(), "from", "03/01/2025", "to", "03/04/2025", "currency", "USD"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if converted[1].Revenue != money.New(1000, "USD") {
+		t.Errorf("day 3 revenue in USD = %v", converted[1].Revenue)
+	}
+
+	db.Aggregates.Put(analytics.DailyTotals{RestaurantID: rid, Day: day(2), Currency: "USD", TotalOrders: 1})
+	if _, err := svc.DailyAggregates(ctx, params("restaurantId", rid.Hex(), "from", "03/01/2025", "to", "03/04/2025")); !errors.Is(err, analytics.ErrMixedCurrencies) {
+		t.Errorf("mixed currencies returned %v", err)
+	}
+}
+
+func TestMostPopularItems(t *testing.T) {
+	svc, db := newService(t)
+	rid := primitive.NewObjectID()
+	burger := models.Item{ID: primitive.NewObjectID(), Name: "Burger", RestaurantID: rid, Price: money.New(300, "USD")}
+	fries := models.Item{ID: primitive.NewObjectID(), Name: "Fries", RestaurantID: rid, Price: money.New(100, "USD")}
+	soda := models.Item{ID: primitive.NewObjectID(), Name: "Soda", RestaurantID: rid, Price: money.New(150, "USD")}
+	db.Items.Put(burger, fries, soda)
+	removed := primitive.NewObjectID()
+	order := func(created time.Time, lines ...models.OrderItem) models.Order {
+		return models.Order{ID: primitive.NewObjectID(), RestaurantID: rid, CreationDate: created, Items: lines}
+	}
+	db.Orders.Put(
+		order(day(1).Add(12*time.Hour), models.OrderItem{ItemID: burger.ID, Quantity: 3}, models.OrderItem{ItemID: fries.ID, Quantity: 5}),
+		order(day(2).Add(20*time.Hour), models.OrderItem{ItemID: burger.ID, Quantity: 2}, models.OrderItem{ItemID: soda.ID, Quantity: 1}),
+		order(day(2), models.OrderItem{ItemID: removed, Quantity: 9}),
+		order(day(3), models.OrderItem{ItemID: soda.ID, Quantity: 10}),
+	)
+	ctx := context.Background()
+
+	got, err := svc.MostPopularItems(ctx, params("from", "03/01/2025", "to", "03/02/2025"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// burger and fries tie on quantity, the burger earned more; the removed item is left out
+	want := []analytics.PopularItem{
+		{ItemID: burger.ID, Name: "Burger", Quantity: 5, Revenue: money.New(1500, "USD")},
+		{ItemID: fries.ID, Name: "Fries", Quantity: 5, Revenue: money.New(500, "USD")},
+		{ItemID: soda.ID, Name: "Soda", Quantity: 1, Revenue: money.New(150, "USD")},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("got %+v, want %+v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("#%d = %+v, want %+v", i+1, got[i], want[i])
+		}
+	}
+
+	db.Items.Put(models.Item{ID: removed, Name: "Crêpe", RestaurantID: rid, Price: money.New(100, "EUR")})
+	if _, err := svc.MostPopularItems(ctx, params("from", "03/01/2025", "to", "03/02/2025")); !errors.Is(err, analytics.ErrMixedCurrencies) {
+		t.Errorf("mixed currencies returned %v", err)
+	}
+	converted, err := svc.MostPopularItems(ctx, params("from", "03/01/2025", "to", "03/02/2025", "currency", "USD"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if converted[0].ItemID != removed || converted[0].Revenue != money.New(1800, "USD") {
+		t.Errorf("first = %+v, want the crêpe with 9 × 2 USD", converted[0])
+	}
+}
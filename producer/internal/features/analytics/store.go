@@ -0,0 +1,142 @@
+package analytics
+
+import (
+	"context"
+	"time"
+
+	"contracts/money"
+	"producer/internal/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// AggregateStore keeps the daily aggregates the consumer maintains
+type AggregateStore interface {
+	// DailyTotals returns the restaurant's aggregates of the days in [from, to), by day
+	DailyTotals(ctx context.Context, restaurantID primitive.ObjectID, from, to time.Time) ([]DailyTotals, error)
+}
+
+// DailyTotals is a stored daily aggregate: amounts in minor units of the restaurant currency
+type DailyTotals struct {
+	RestaurantID    primitive.ObjectID `bson:"restaurantId"`
+	Day             time.Time          `bson:"day"`
+	Currency        string             `bson:"currency"`
+	TotalOrders     int64              `bson:"totalOrders"`
+	CancelledOrders int64              `bson:"cancelledOrders"`
+	Revenue         money.Amount       `bson:"revenue"`
+	Discounts       money.Amount       `bson:"discounts"`
+	Tax             money.Amount       `bson:"tax"`
+	Tips            money.Amount       `bson:"tips"`
+	Cost            money.Amount       `bson:"cost"`
+	Refunds         money.Amount       `bson:"refunds"`
+}
+
+// OrderStore sums up the orders
+type OrderStore interface {
+	// ItemQuantities returns the quantity ordered of each item in the orders created in [from, to)
+	ItemQuantities(ctx context.Context, from, to time.Time) (map[primitive.ObjectID]int64, error)
+}
+
+// ItemStore looks up menu items
+type ItemStore interface {
+	// FindItems returns the items with the IDs; unknown IDs are missing from the result
+	FindItems(ctx context.Context, ids []primitive.ObjectID) ([]models.Item, error)
+}
+
+// Stores are what the service reads
+type Stores struct {
+	Aggregates AggregateStore
+	Orders     OrderStore
+	Items      ItemStore
+}
+
+// MongoStores reads everything from the database
+func MongoStores(database *mongo.Database) Stores {
+	return Stores{
+		Aggregates: NewMongoAggregateStore(database),
+		Orders:     NewMongoOrderStore(database),
+		Items:      NewMongoItemStore(database),
+	}
+}
+
+type MongoAggregateStore struct {
+	collection *mongo.Collection
+}
+
+func NewMongoAggregateStore(database *mongo.Database) *MongoAggregateStore {
+	return &MongoAggregateStore{collection: database.Collection("daily_aggregates")}
+}
+
+func (s *MongoAggregateStore) DailyTotals(ctx context.Context, restaurantID primitive.ObjectID, from, to time.Time) ([]DailyTotals, error) {
+	filter := bson.D{
+		{Key: "restaurantId", Value: restaurantID},
+		{Key: "day", Value: bson.D{{Key: "$gte", Value: from}, {Key: "$lt", Value: to}}},
+	}
+	cursor, err := s.collection.Find(ctx, filter, options.Find().SetSort(bson.D{{Key: "day", Value: 1}}))
+	if err != nil {
+		return nil, err
+	}
+	var totals []DailyTotals
+	if err := cursor.All(ctx, &totals); err != nil {
+		return nil, err
+	}
+	return totals, nil
+}
+
+type MongoOrderStore struct {
+	collection *mongo.Collection
+}
+
+func NewMongoOrderStore(database *mongo.Database) *MongoOrderStore {
+	return &MongoOrderStore{collection: database.Collection("orders")}
+}
+
+func (s *MongoOrderStore) ItemQuantities(ctx context.Context, from, to time.Time) (map[primitive.ObjectID]int64, error) {
+	pipeline := mongo.Pipeline{
+		// filter by date range
+		bson.D{{Key: "$match", Value: bson.D{{Key: "creationDate", Value: bson.D{{Key: "$gte", Value: from}, {Key: "$lt", Value: to}}}}}},
+		// explode order items
+		bson.D{{Key: "$unwind", Value: "$items"}},
+		// group by itemId and sum quantities from order items
+		bson.D{{Key: "$group", Value: bson.D{{Key: "_id", Value: "$items.itemId"}, {Key: "quantity", Value: bson.D{{Key: "$sum", Value: "$items.quantity"}}}}}},
+	}
+	cursor, err := s.collection.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+	var rows []struct {
+		ItemID   primitive.ObjectID `bson:"_id"`
+		Quantity int64              `bson:"quantity"`
+	}
+	if err := cursor.All(ctx, &rows); err != nil {
+		return nil, err
+	}
+	quantities := make(map[primitive.ObjectID]int64, len(rows))
+	for _, r := range rows {
+		quantities[r.ItemID] = r.Quantity
+	}
+	return quantities, nil
+}
+
+type MongoItemStore struct {
+	collection *mongo.Collection
+}
+
+func NewMongoItemStore(database *mongo.Database) *MongoItemStore {
+	return &MongoItemStore{collection: database.Collection("items")}
+}
+
+func (s *MongoItemStore) FindItems(ctx context.Context, ids []primitive.ObjectID) ([]models.Item, error) {
+	cursor, err := s.collection.Find(ctx, bson.M{"_id": bson.M{"$in": ids}})
+	if err != nil {
+		return nil, err
+	}
+	var items []models.Item
+	if err := cursor.All(ctx, &items); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
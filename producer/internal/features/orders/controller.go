@@ -1,34 +1,87 @@
 package orders
 
 import (
+	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
 
+	"contracts/correlation"
+	"contracts/events"
+	"contracts/money"
 	"producer/internal/auth"
 
 	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	// streamHeartbeatInterval keeps idle connections open through proxies and detects dead clients
+	streamHeartbeatInterval = 15 * time.Second
+	// streamPongWait is how long a WebSocket client may stay silent before it is considered gone
+	streamPongWait  = 3 * streamHeartbeatInterval
+	streamWriteWait = 10 * time.Second
 )
 
 type Controller struct {
-	service *Service
+	service  *Service
+	upgrader websocket.Upgrader
 }
 
 func NewController(service *Service) *Controller {
-	return &Controller{service: service}
+	c := &Controller{service: service}
+	c.upgrader = websocket.Upgrader{CheckOrigin: c.checkOrigin}
+	return c
+}
+
+// checkOrigin lets browsers open WebSocket streams from the producer's own origin and the
+// configured ones, e.g. kitchen displays served elsewhere. Clients other than browsers send no
+// Origin and are let through, access being scoped by x-org like the rest of the API.
+func (c *Controller) checkOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	if u, err := url.Parse(origin); err == nil && strings.EqualFold(u.Host, r.Host) {
+		return true
+	}
+	for _, allowed := range c.service.streamOrigins {
+		if allowed == "*" || strings.EqualFold(strings.TrimSuffix(allowed, "/"), origin) {
+			return true
+		}
+	}
+	return false
 }
 
 func (c *Controller) RegisterRoutes(router *gin.Engine) {
 	router.POST("/orders", c.CreateOrder)
 	router.GET("/orders", c.ListOrders)
 	router.GET("/orders/recent", c.RecentOrders)
+	router.GET("/orders/stream", c.StreamOrders)
+	router.POST("/orders/:id/cancel", c.CancelOrder)
+	router.POST("/orders/:id/refund", c.RefundOrder)
 }
 
 func (c *Controller) CreateOrder(ctx *gin.Context) {
+	type createOrderModifier struct {
+		GroupID  string `json:"groupId"`
+		OptionID string `json:"optionId"`
+	}
 	type createOrderItem struct {
-		ID       string `json:"id"`
-		Quantity int    `json:"quantity"`
+		ID        string                `json:"id"`
+		Quantity  int                   `json:"quantity"`
+		Modifiers []createOrderModifier `json:"modifiers"`
+		Notes     string                `json:"notes"`
 	}
 	type createOrderBody struct {
-		Items []createOrderItem `json:"items"`
+		Items     []createOrderItem `json:"items"`
+		PromoCode string            `json:"promoCode"`
+		Tip       money.Amount      `json:"tip"`
 	}
 	var body createOrderBody
 	if err := ctx.ShouldBindJSON(&body); err != nil {
@@ -47,20 +100,106 @@ func (c *Controller) CreateOrder(ctx *gin.Context) {
 	}
 
 	// transform to event items with id and quantity
-	items := make([]CreateOrderEventItem, 0, len(body.Items))
+	items := make([]events.OrderItem, 0, len(body.Items))
 	for _, it := range body.Items {
 		if it.ID == "" || it.Quantity <= 0 {
 			ctx.JSON(http.StatusBadRequest, gin.H{"error": "each item requires id and quantity > 0"})
 			return
 		}
-		items = append(items, CreateOrderEventItem{ID: it.ID, Quantity: it.Quantity})
+		item := events.OrderItem{ID: it.ID, Quantity: it.Quantity, Notes: it.Notes}
+		for _, m := range it.Modifiers {
+			if m.GroupID == "" || m.OptionID == "" {
+				ctx.JSON(http.StatusBadRequest, gin.H{"error": "each modifier requires groupId and optionId"})
+				return
+			}
+			item.Modifiers = append(item.Modifiers, events.Modifier{GroupID: m.GroupID, OptionID: m.OptionID})
+		}
+		items = append(items, item)
+	}
+	if body.Tip < 0 {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "tip must not be negative"})
+		return
 	}
-	req := CreateOrderEvent{RestaurantID: org, Items: items}
+	req := events.OrderCreate{RestaurantID: org, Items: items, PromoCode: body.PromoCode, Tip: int64(body.Tip)}
 	if err := c.service.PublishOrder(ctx, req); err != nil {
-		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		ctx.JSON(orderErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	// the request ID ends up on the order, GET /orders?requestId= finds it once it is processed
+	ctx.JSON(http.StatusAccepted, gin.H{"status": "queued", "requestId": correlation.FromContext(ctx).RequestID})
+}
+
+func (c *Controller) CancelOrder(ctx *gin.Context) {
+	var body struct {
+		Reason string `json:"reason"`
+	}
+	// the body is optional
+	if ctx.Request.ContentLength != 0 {
+		if err := ctx.ShouldBindJSON(&body); err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+	_, org, err := auth.GetOrgID(ctx)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	req := events.OrderCancel{RestaurantID: org, OrderID: ctx.Param("id"), Reason: body.Reason}
+	if err := c.service.PublishCancel(ctx, req); err != nil {
+		ctx.JSON(orderErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	ctx.JSON(http.StatusAccepted, gin.H{"status": "queued", "requestId": correlation.FromContext(ctx).RequestID})
+}
+
+// RefundOrder refunds the listed lines, or the whole remaining order when no items are given
+func (c *Controller) RefundOrder(ctx *gin.Context) {
+	var body struct {
+		Reason string `json:"reason"`
+		Items  []struct {
+			Line     *int `json:"line"`
+			Quantity int  `json:"quantity"`
+		} `json:"items"`
+	}
+	if ctx.Request.ContentLength != 0 {
+		if err := ctx.ShouldBindJSON(&body); err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+	_, org, err := auth.GetOrgID(ctx)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
-	ctx.JSON(http.StatusAccepted, gin.H{"status": "queued"})
+	items := make([]events.RefundItem, 0, len(body.Items))
+	for _, it := range body.Items {
+		if it.Line == nil || *it.Line < 0 || it.Quantity <= 0 {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "each item requires line >= 0 and quantity > 0"})
+			return
+		}
+		items = append(items, events.RefundItem{Line: *it.Line, Quantity: it.Quantity})
+	}
+	req := events.OrderRefund{RestaurantID: org, OrderID: ctx.Param("id"), Reason: body.Reason, Items: items}
+	if err := c.service.PublishRefund(ctx, req); err != nil {
+		ctx.JSON(orderErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	ctx.JSON(http.StatusAccepted, gin.H{"status": "queued", "requestId": correlation.FromContext(ctx).RequestID})
+}
+
+func orderErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, ErrOrderNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, ErrOrderClosed):
+		return http.StatusConflict
+	case errors.Is(err, ErrInvalidRefund), errors.Is(err, events.ErrInvalidEvent):
+		return http.StatusBadRequest
+	default:
+		return http.StatusInternalServerError
+	}
 }
 
 func (c *Controller) ListOrders(ctx *gin.Context) {
@@ -69,7 +208,13 @@ func (c *Controller) ListOrders(ctx *gin.Context) {
 		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
-	resp, err := c.service.ListOrders(ctx, orgID)
+	q, err := parseListOrdersQuery(ctx)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	q.RestaurantID = orgID
+	resp, err := c.service.ListOrders(ctx, q)
 	if err != nil {
 		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -77,6 +222,94 @@ func (c *Controller) ListOrders(ctx *gin.Context) {
 	ctx.JSON(http.StatusOK, resp)
 }
 
+// parseListOrdersQuery reads limit, cursor, sort, from/to (MM/DD/YYYY), minTotal/maxTotal, itemId, status, requestId and total
+func parseListOrdersQuery(ctx *gin.Context) (ListOrdersQuery, error) {
+	q := ListOrdersQuery{Limit: DefaultPageSize}
+
+	if s := ctx.Query("limit"); s != "" {
+		limit, err := strconv.Atoi(s)
+		if err != nil || limit <= 0 {
+			return q, errors.New("limit must be a positive integer")
+		}
+		if limit > MaxPageSize {
+			return q, fmt.Errorf("limit must be at most %d", MaxPageSize)
+		}
+		q.Limit = limit
+	}
+
+	switch ctx.DefaultQuery("sort", "-creationDate") {
+	case "-creationDate":
+		q.Ascending = false
+	case "creationDate":
+		q.Ascending = true
+	default:
+		return q, errors.New("sort must be creationDate or -creationDate")
+	}
+
+	if s := ctx.Query("cursor"); s != "" {
+		cursor, err := DecodeCursor(s)
+		if err != nil {
+			return q, err
+		}
+		// a cursor only makes sense in the order it was issued for
+		q.Cursor = cursor
+		q.Ascending = cursor.Ascending
+	}
+
+	if s := ctx.Query("from"); s != "" {
+		t, err := time.Parse("01/02/2006", s)
+		if err != nil {
+			return q, errors.New("from must be MM/DD/YYYY")
+		}
+		q.From = &t
+	}
+	if s := ctx.Query("to"); s != "" {
+		t, err := time.Parse("01/02/2006", s)
+		if err != nil {
+			return q, errors.New("to must be MM/DD/YYYY")
+		}
+		// to is inclusive of the whole day
+		next := t.Add(24 * time.Hour)
+		q.To = &next
+	}
+
+	if s := ctx.Query("minTotal"); s != "" {
+		v, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			return q, errors.New("minTotal must be an integer amount in minor units")
+		}
+		minTotal := money.Amount(v)
+		q.MinTotal = &minTotal
+	}
+	if s := ctx.Query("maxTotal"); s != "" {
+		v, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			return q, errors.New("maxTotal must be an integer amount in minor units")
+		}
+		maxTotal := money.Amount(v)
+		q.MaxTotal = &maxTotal
+	}
+
+	if s := ctx.Query("itemId"); s != "" {
+		id, err := primitive.ObjectIDFromHex(s)
+		if err != nil {
+			return q, errors.New("invalid itemId")
+		}
+		q.ItemID = &id
+	}
+	q.Status = ctx.Query("status")
+	q.RequestID = ctx.Query("requestId")
+
+	if s := ctx.Query("total"); s != "" {
+		total, err := strconv.ParseBool(s)
+		if err != nil {
+			return q, errors.New("total must be true or false")
+		}
+		q.Total = total
+	}
+	return q, nil
+}
+
 func (c *Controller) RecentOrders(ctx *gin.Context) {
 	org := ctx.GetHeader("x-org")
 	if org == "" {
@@ -90,3 +323,129 @@ func (c *Controller) RecentOrders(ctx *gin.Context) {
 	}
 	ctx.JSON(http.StatusOK, resp)
 }
+
+// StreamOrders pushes the restaurant's order lifecycle events as they happen.
+// WebSocket upgrade requests get a WebSocket feed, everything else Server-Sent Events.
+// Clients resume with the Last-Event-ID header or the lastEventId query parameter.
+func (c *Controller) StreamOrders(ctx *gin.Context) {
+	orgID, _, err := auth.GetStreamOrgID(ctx)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	lastEventID := ctx.GetHeader("Last-Event-ID")
+	if lastEventID == "" {
+		lastEventID = ctx.Query("lastEventId")
+	}
+
+	if websocket.IsWebSocketUpgrade(ctx.Request) {
+		c.streamWebSocket(ctx, orgID.Hex(), lastEventID)
+		return
+	}
+	c.streamSSE(ctx, orgID.Hex(), lastEventID)
+}
+
+func (c *Controller) streamSSE(ctx *gin.Context, org string, lastEventID string) {
+	sub, replay := c.service.SubscribeOrders(org, lastEventID)
+	defer sub.Close()
+
+	w := ctx.Writer
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintf(w, "retry: %d\n\n", (3 * time.Second).Milliseconds())
+	for _, evt := range replay {
+		writeSSEEvent(w, evt)
+	}
+	w.Flush()
+
+	heartbeat := time.NewTicker(streamHeartbeatInterval)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-ctx.Request.Context().Done():
+			return
+		case evt, ok := <-sub.Events:
+			if !ok {
+				// dropped for being too slow, the client reconnects with Last-Event-ID
+				return
+			}
+			writeSSEEvent(w, evt)
+			w.Flush()
+		case <-heartbeat.C:
+			fmt.Fprint(w, ": keepalive\n\n")
+			w.Flush()
+		}
+	}
+}
+
+func writeSSEEvent(w gin.ResponseWriter, evt StreamEvent) {
+	fmt.Fprintf(w, "id: %s\nevent: %s\ndata: %s\n\n", evt.ID, evt.Type, evt.Data)
+}
+
+func (c *Controller) streamWebSocket(ctx *gin.Context, org string, lastEventID string) {
+	conn, err := c.upgrader.Upgrade(ctx.Writer, ctx.Request, nil)
+	if err != nil {
+		// the upgrader has already written the error response
+		return
+	}
+	defer conn.Close()
+
+	sub, replay := c.service.SubscribeOrders(org, lastEventID)
+	defer sub.Close()
+
+	// The read loop handles pongs and close frames; it ends when the client goes away
+	closed := make(chan struct{})
+	conn.SetReadLimit(512)
+	_ = conn.SetReadDeadline(time.Now().Add(streamPongWait))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(streamPongWait))
+	})
+	go func() {
+		defer close(closed)
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+
+	send := func(evt StreamEvent) error {
+		payload, err := json.Marshal(evt)
+		if err != nil {
+			return err
+		}
+		_ = conn.SetWriteDeadline(time.Now().Add(streamWriteWait))
+		return conn.WriteMessage(websocket.TextMessage, payload)
+	}
+	for _, evt := range replay {
+		if err := send(evt); err != nil {
+			return
+		}
+	}
+
+	heartbeat := time.NewTicker(streamHeartbeatInterval)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-closed:
+			return
+		case evt, ok := <-sub.Events:
+			if !ok {
+				_ = conn.WriteControl(websocket.CloseMessage,
+					websocket.FormatCloseMessage(websocket.CloseTryAgainLater, "subscriber too slow"),
+					time.Now().Add(streamWriteWait))
+				return
+			}
+			if err := send(evt); err != nil {
+				return
+			}
+		case <-heartbeat.C:
+			if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(streamWriteWait)); err != nil {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,85 @@
+// Package orderstest stands in for the cache and Kafka writer of the orders service, in memory,
+// for tests that run it without Redis and Kafka; internal/memstore stands in for its store
+package orderstest
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+var errMiss = errors.New("not cached")
+
+// Cache is an orders.Cache whose entries expire like Redis keys
+type Cache struct {
+	mu      sync.Mutex
+	entries map[string]entry
+}
+
+type entry struct {
+	value   []byte
+	expires time.Time
+}
+
+func NewCache() *Cache {
+	return &Cache{entries: make(map[string]entry)}
+}
+
+func (c *Cache) Get(_ context.Context, key string) ([]byte, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.entries[key]
+	if !ok || (!e.expires.IsZero() && time.Now().After(e.expires)) {
+		return nil, errMiss
+	}
+	return e.value, nil
+}
+
+func (c *Cache) Set(_ context.Context, key string, value []byte, ttl time.Duration) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e := entry{value: value}
+	if ttl > 0 {
+		e.expires = time.Now().Add(ttl)
+	}
+	c.entries[key] = e
+	return nil
+}
+
+func (c *Cache) Delete(_ context.Context, key string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.entries, key)
+	return nil
+}
+
+// Writer is an orders.MessageWriter keeping the messages written
+type Writer struct {
+	mu       sync.Mutex
+	messages []kafka.Message
+	// Err, when set, fails the writes
+	Err error
+}
+
+func (w *Writer) WriteMessages(_ context.Context, msgs ...kafka.Message) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.Err != nil {
+		return w.Err
+	}
+	w.messages = append(w.messages, msgs...)
+	return nil
+}
+
+func (w *Writer) Close() error {
+	return nil
+}
+
+func (w *Writer) Messages() []kafka.Message {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return append([]kafka.Message(nil), w.messages...)
+}
@@ -0,0 +1,30 @@
+package orders
+
+import (
+	"fmt"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// ParseBalancer maps KAFKA_BALANCER to a partitioner. Order events are keyed by restaurant ID,
+// so the key-hashing balancers keep each restaurant's events on one partition, in order.
+//
+//   - hash: FNV-1a, the same as the consumer's order-events writer (default)
+//   - murmur2: compatible with the Java client's default partitioner
+//   - crc32: compatible with librdkafka's default partitioner
+//   - round-robin, least-bytes: ignore the key and give up per-restaurant ordering
+func ParseBalancer(name string) (kafka.Balancer, error) {
+	switch name {
+	case "", "hash":
+		return &kafka.Hash{}, nil
+	case "murmur2":
+		return kafka.Murmur2Balancer{}, nil
+	case "crc32":
+		return kafka.CRC32Balancer{}, nil
+	case "round-robin":
+		return &kafka.RoundRobin{}, nil
+	case "least-bytes":
+		return &kafka.LeastBytes{}, nil
+	}
+	return nil, fmt.Errorf("unknown kafka balancer %q (hash, murmur2, crc32, round-robin, least-bytes)", name)
+}
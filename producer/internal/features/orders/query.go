@@ -0,0 +1,152 @@
+package orders
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"slices"
+	"time"
+
+	"contracts/money"
+	"producer/internal/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	DefaultPageSize = 50
+	MaxPageSize     = 200
+)
+
+// ListOrdersQuery holds the filters, sort and page of a GET /orders request
+type ListOrdersQuery struct {
+	RestaurantID primitive.ObjectID
+	From         *time.Time    // inclusive
+	To           *time.Time    // exclusive
+	MinTotal     *money.Amount // minor units of the restaurant currency
+	MaxTotal     *money.Amount
+	ItemID       *primitive.ObjectID
+	Status       string
+	RequestID    string // the request that created the order
+	Ascending    bool
+	Limit        int
+	Cursor       *Cursor
+	Total        bool // also count the orders of all pages
+}
+
+// Cursor points at the last order of a page; the next page starts right after it
+type Cursor struct {
+	CreationDate time.Time          `json:"t"`
+	ID           primitive.ObjectID `json:"id"`
+	Ascending    bool               `json:"asc"`
+}
+
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// Encode returns the opaque string handed to clients
+func (c Cursor) Encode() string {
+	b, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func DecodeCursor(s string) (*Cursor, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	var c Cursor
+	if err := json.Unmarshal(b, &c); err != nil || c.ID.IsZero() || c.CreationDate.IsZero() {
+		return nil, ErrInvalidCursor
+	}
+	return &c, nil
+}
+
+// filter builds the Mongo filter; restaurantId+creationDate lead so the compound index is used
+func (q ListOrdersQuery) filter() bson.D {
+	filter := bson.D{{Key: "restaurantId", Value: q.RestaurantID}}
+
+	dateRange := bson.D{}
+	if q.From != nil {
+		dateRange = append(dateRange, bson.E{Key: "$gte", Value: *q.From})
+	}
+	if q.To != nil {
+		dateRange = append(dateRange, bson.E{Key: "$lt", Value: *q.To})
+	}
+	if len(dateRange) > 0 {
+		filter = append(filter, bson.E{Key: "creationDate", Value: dateRange})
+	}
+
+	totalRange := bson.D{}
+	if q.MinTotal != nil {
+		totalRange = append(totalRange, bson.E{Key: "$gte", Value: *q.MinTotal})
+	}
+	if q.MaxTotal != nil {
+		totalRange = append(totalRange, bson.E{Key: "$lte", Value: *q.MaxTotal})
+	}
+	if len(totalRange) > 0 {
+		filter = append(filter, bson.E{Key: "totalPrice.amount", Value: totalRange})
+	}
+
+	if q.ItemID != nil {
+		filter = append(filter, bson.E{Key: "items.itemId", Value: *q.ItemID})
+	}
+	if q.Status != "" {
+		filter = append(filter, bson.E{Key: "status", Value: q.Status})
+	}
+	if q.RequestID != "" {
+		filter = append(filter, bson.E{Key: "requestId", Value: q.RequestID})
+	}
+
+	// Keyset pagination: continue strictly after the cursor in (creationDate, _id) order
+	if q.Cursor != nil {
+		op := "$lt"
+		if q.Ascending {
+			op = "$gt"
+		}
+		filter = append(filter, bson.E{Key: "$or", Value: bson.A{
+			bson.D{{Key: "creationDate", Value: bson.D{{Key: op, Value: q.Cursor.CreationDate}}}},
+			bson.D{
+				{Key: "creationDate", Value: q.Cursor.CreationDate},
+				{Key: "_id", Value: bson.D{{Key: op, Value: q.Cursor.ID}}},
+			},
+		}})
+	}
+	return filter
+}
+
+// Matches reports whether filter selects the order, for stores that can't run the Mongo filter
+func (q ListOrdersQuery) Matches(o models.Order) bool {
+	switch {
+	case o.RestaurantID != q.RestaurantID,
+		q.From != nil && o.CreationDate.Before(*q.From),
+		q.To != nil && !o.CreationDate.Before(*q.To),
+		q.MinTotal != nil && o.TotalPrice.Amount < *q.MinTotal,
+		q.MaxTotal != nil && o.TotalPrice.Amount > *q.MaxTotal,
+		q.Status != "" && o.Status != q.Status,
+		q.RequestID != "" && o.RequestID != q.RequestID:
+		return false
+	}
+	if q.ItemID != nil && !slices.ContainsFunc(o.Items, func(it models.OrderItem) bool { return it.ItemID == *q.ItemID }) {
+		return false
+	}
+	return q.Cursor == nil || q.Less(models.Order{CreationDate: q.Cursor.CreationDate, ID: q.Cursor.ID}, o)
+}
+
+// Less reports whether a comes before b in sort's order
+func (q ListOrdersQuery) Less(a, b models.Order) bool {
+	if !a.CreationDate.Equal(b.CreationDate) {
+		return a.CreationDate.Before(b.CreationDate) == q.Ascending
+	}
+	c := bytes.Compare(a.ID[:], b.ID[:])
+	return c != 0 && (c < 0) == q.Ascending
+}
+
+func (q ListOrdersQuery) sort() bson.D {
+	dir := -1
+	if q.Ascending {
+		dir = 1
+	}
+	return bson.D{{Key: "creationDate", Value: dir}, {Key: "_id", Value: dir}}
+}
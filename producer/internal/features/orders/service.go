@@ -7,145 +7,281 @@ import (
 	"fmt"
 	"time"
 
+	"contracts/correlation"
+	"contracts/events"
+	"contracts/kafkaconn"
+	"contracts/metrics"
 	"producer/internal/models"
 
-	"github.com/gin-gonic/gin"
-	"github.com/redis/go-redis/v9"
 	"github.com/segmentio/kafka-go"
-	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
-	"go.mongodb.org/mongo-driver/mongo"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
 )
 
+// eventSource identifies this service in event envelopes
+const eventSource = "producer"
+
+var tracer = otel.Tracer("producer/internal/features/orders")
+
 type Service struct {
-	broker     string
-	topic      string
-	db         *mongo.Database
-	collection *mongo.Collection
-	redis      *redis.Client
+	writer MessageWriter
+	topic  string
+	orders Store
+	cache  Cache
+	hub    *Hub
+	codec  *events.Codec
+
+	recentWindow   time.Duration
+	recentCacheTTL time.Duration
+	streamOrigins  []string
+}
+
+// ServiceConfig configures NewService
+type ServiceConfig struct {
+	Kafka *kafkaconn.Conn
+	Topic string
+	// Balancer partitions order events, which are keyed by restaurant ID
+	Balancer kafka.Balancer
+	// Writer, when set, writes the events instead of a writer on Kafka, e.g. in tests
+	Writer MessageWriter
+	// RecentWindow is how far back RecentOrders looks; its result is cached for RecentCacheTTL
+	RecentWindow   time.Duration
+	RecentCacheTTL time.Duration
+	// StreamOrigins are the origins besides the producer's own that browsers may open WebSocket
+	// order streams from, as scheme://host[:port]; "*" allows any
+	StreamOrigins []string
+}
+
+// MessageWriter writes to the orders topic, like a *kafka.Writer
+type MessageWriter interface {
+	WriteMessages(ctx context.Context, msgs ...kafka.Message) error
+	Close() error
 }
 
-// NewService preserves old signature (no DB) for flexibility
-func NewService(database *mongo.Database, broker string, redisClient *redis.Client) *Service {
+// NewService writes order events to cfg.Topic. Without a cache, RecentOrders always queries
+// the store.
+func NewService(store Store, cfg ServiceConfig, cache Cache, hub *Hub, codec *events.Codec) *Service {
+	writer := cfg.Writer
+	if writer == nil {
+		writer = &kafka.Writer{
+			Addr:                   cfg.Kafka.Addr(),
+			Transport:              cfg.Kafka.Transport(),
+			Topic:                  cfg.Topic,
+			Balancer:               cfg.Balancer,
+			AllowAutoTopicCreation: true,
+			BatchTimeout:           10 * time.Millisecond,
+		}
+	}
 	return &Service{
-		broker:     broker,
-		topic:      "orders",
-		db:         database,
-		collection: database.Collection("orders"),
-		redis:      redisClient,
+		writer: writer,
+		topic:  cfg.Topic,
+		orders: store,
+		cache:  cache,
+		hub:    hub,
+		codec:  codec,
+
+		recentWindow:   cfg.RecentWindow,
+		recentCacheTTL: cfg.RecentCacheTTL,
+		streamOrigins:  cfg.StreamOrigins,
 	}
 }
 
-type CreateOrderEventItem struct {
-	ID       string `json:"id"`
-	Quantity int    `json:"quantity"`
+// Close flushes pending order events
+func (s *Service) Close() error {
+	return s.writer.Close()
 }
 
-type CreateOrderEvent struct {
-	RestaurantID string                 `json:"restaurantId"`
-	Items        []CreateOrderEventItem `json:"items"`
+var (
+	ErrOrderNotFound = errors.New("order not found")
+	ErrOrderClosed   = errors.New("order is already cancelled or fully refunded")
+	ErrInvalidRefund = errors.New("invalid refund")
+)
+
+func (s *Service) PublishOrder(ctx context.Context, req events.OrderCreate) error {
+	return s.publish(ctx, req.RestaurantID, events.TypeOrderCreate, req)
 }
 
-func (s *Service) PublishOrder(ctx context.Context, req CreateOrderEvent) error {
-	w := &kafka.Writer{
-		Addr:                   kafka.TCP(s.broker),
-		Topic:                  s.topic,
-		AllowAutoTopicCreation: true,
-		BatchTimeout:           100 * time.Millisecond,
+// PublishCancel checks the order can still be cancelled and queues the cancellation
+func (s *Service) PublishCancel(ctx context.Context, req events.OrderCancel) error {
+	if _, err := s.openOrder(ctx, req.RestaurantID, req.OrderID); err != nil {
+		return err
 	}
-	defer w.Close()
-	payload, err := json.Marshal(req)
+	return s.publish(ctx, req.RestaurantID, events.TypeOrderCancel, req)
+}
+
+// PublishRefund checks the requested lines against what is left to refund and queues the refund
+func (s *Service) PublishRefund(ctx context.Context, req events.OrderRefund) error {
+	order, err := s.openOrder(ctx, req.RestaurantID, req.OrderID)
 	if err != nil {
 		return err
 	}
-	if err := w.WriteMessages(ctx, kafka.Message{Value: payload}); err != nil {
+	remaining := make([]int, len(order.Items))
+	for i, it := range order.Items {
+		remaining[i] = it.RemainingQuantity()
+	}
+	for _, it := range req.Items {
+		if it.Line < 0 || it.Line >= len(remaining) {
+			return fmt.Errorf("%w: the order has no line %d", ErrInvalidRefund, it.Line)
+		}
+		if it.Quantity > remaining[it.Line] {
+			return fmt.Errorf("%w: only %d of line %d can be refunded", ErrInvalidRefund, remaining[it.Line], it.Line)
+		}
+		remaining[it.Line] -= it.Quantity
+	}
+	return s.publish(ctx, req.RestaurantID, events.TypeOrderRefund, req)
+}
+
+// openOrder loads the restaurant's order and fails if it can no longer be cancelled or refunded.
+// The consumer re-checks when applying the event; this gives callers an immediate answer.
+func (s *Service) openOrder(ctx context.Context, restaurantID string, orderID string) (*models.Order, error) {
+	rid, err := primitive.ObjectIDFromHex(restaurantID)
+	if err != nil {
+		return nil, errors.New("invalid x-org header format")
+	}
+	oid, err := primitive.ObjectIDFromHex(orderID)
+	if err != nil {
+		return nil, ErrOrderNotFound
+	}
+	order, err := s.orders.FindOrder(ctx, rid, oid)
+	if err != nil {
+		return nil, err
+	}
+	if order.Status == models.OrderStatusCancelled || order.Status == models.OrderStatusRefunded {
+		return nil, ErrOrderClosed
+	}
+	return order, nil
+}
+
+// publish wraps the payload in a versioned envelope, validated against the event contract,
+// and writes it in the configured format. The write is traced as a producer span, which the
+// message's traceparent header makes the parent of the consumer's work.
+func (s *Service) publish(ctx context.Context, restaurantID string, eventType string, data any) (err error) {
+	ctx, span := tracer.Start(ctx, s.topic+" publish",
+		trace.WithSpanKind(trace.SpanKindProducer),
+		trace.WithAttributes(
+			semconv.MessagingSystemKafka,
+			semconv.MessagingOperationTypePublish,
+			semconv.MessagingDestinationName(s.topic),
+			semconv.MessagingKafkaMessageKey(restaurantID),
+			attribute.String("event.type", eventType),
+		))
+	defer func() {
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+		span.End()
+	}()
+
+	env, err := events.New(eventSource, eventType, data)
+	if err != nil {
 		return err
 	}
-	if s.redis != nil && req.RestaurantID != "" {
-		_ = s.redis.Del(ctx, recentCacheKey(req.RestaurantID)).Err()
+	span.SetAttributes(semconv.MessagingMessageID(env.ID))
+	payload, headers, err := s.codec.Marshal(ctx, env)
+	if err != nil {
+		return err
+	}
+	// the key keeps a restaurant's events on one partition, so they are applied in order
+	headers = append(headers, correlation.KafkaHeaders(ctx)...)
+	message := kafka.Message{Key: []byte(restaurantID), Value: payload, Headers: headers}
+	start := time.Now()
+	err = s.writer.WriteMessages(ctx, message)
+	metrics.ObservePublish(s.topic, start, err)
+	if err != nil {
+		return err
+	}
+	if s.cache != nil && restaurantID != "" {
+		_ = s.cache.Delete(ctx, recentCacheKey(restaurantID))
 	}
 	return nil
 }
 
+// SubscribeOrders opens a live feed of the restaurant's order lifecycle events,
+// replaying buffered events that came after lastEventID
+func (s *Service) SubscribeOrders(org string, lastEventID string) (*Subscription, []StreamEvent) {
+	return s.hub.Subscribe(org, lastEventID)
+}
+
 type ListOrdersResponse struct {
-	From    string         `json:"from"`
-	Count   int64          `json:"count"`
-	Results []models.Order `json:"results"`
+	From string `json:"from"`
+	// Count is the number of orders of all pages, only when it was asked for
+	Count      *int64         `json:"count,omitempty"`
+	PageCount  int            `json:"pageCount"`
+	Results    []models.Order `json:"results"`
+	NextCursor string         `json:"nextCursor,omitempty"`
 }
 
-func (s *Service) ListOrders(ctx *gin.Context, restaurantID primitive.ObjectID) (ListOrdersResponse, error) {
-	filter := bson.D{{Key: "restaurantId", Value: restaurantID}}
-	reqCtx := ctx.Request.Context()
-	count, err := s.collection.CountDocuments(reqCtx, filter)
-	if err != nil {
-		return ListOrdersResponse{}, err
+// ListOrders returns one page of the restaurant's orders; NextCursor is set when more remain
+// and Count when q.Total asks for it
+func (s *Service) ListOrders(ctx context.Context, q ListOrdersQuery) (ListOrdersResponse, error) {
+	if q.Limit <= 0 || q.Limit > MaxPageSize {
+		q.Limit = DefaultPageSize
 	}
-	cursor, err := s.collection.Find(reqCtx, filter)
+	// Fetch one extra order to know whether there is a next page
+	orders, err := s.orders.FindOrders(ctx, q, q.Limit+1)
 	if err != nil {
 		return ListOrdersResponse{}, err
 	}
-	defer cursor.Close(reqCtx)
-	var orders []models.Order
-	for cursor.Next(reqCtx) {
-		var o models.Order
-		if err := cursor.Decode(&o); err != nil {
+	if orders == nil {
+		orders = []models.Order{}
+	}
+	resp := ListOrdersResponse{From: "database"}
+	if len(orders) > q.Limit {
+		orders = orders[:q.Limit]
+		last := orders[len(orders)-1]
+		resp.NextCursor = Cursor{CreationDate: last.CreationDate, ID: last.ID, Ascending: q.Ascending}.Encode()
+	}
+	resp.Results = orders
+	resp.PageCount = len(orders)
+	if q.Total {
+		total, err := s.orders.CountOrders(ctx, q)
+		if err != nil {
 			return ListOrdersResponse{}, err
 		}
-		orders = append(orders, o)
-	}
-	if err := cursor.Err(); err != nil {
-		return ListOrdersResponse{}, err
+		resp.Count = &total
 	}
-	return ListOrdersResponse{Count: count, Results: orders}, nil
+	return resp, nil
 }
 
-const recentWindow = 15 * time.Minute
-const recentCacheTTL = 5 * time.Minute
+// recentCacheName labels the RecentOrders cache in metrics
+const recentCacheName = "recent_orders"
 
 func recentCacheKey(restaurantID string) string {
 	return fmt.Sprintf("recent_orders:%s", restaurantID)
 }
 
-func (s *Service) RecentOrders(ctx *gin.Context, org string) (ListOrdersResponse, error) {
-	if s.redis != nil {
-		if cached, err := s.redis.Get(ctx, recentCacheKey(org)).Bytes(); err == nil && len(cached) > 0 {
+func (s *Service) RecentOrders(ctx context.Context, org string) (ListOrdersResponse, error) {
+	if s.cache != nil {
+		if cached, err := s.cache.Get(ctx, recentCacheKey(org)); err == nil && len(cached) > 0 {
 			var data ListOrdersResponse
 			if unmarshalErr := json.Unmarshal(cached, &data); unmarshalErr == nil {
+				cacheLookup(recentCacheName, true)
 				data.From = "redis"
 				return data, unmarshalErr
 			}
 		}
+		cacheLookup(recentCacheName, false)
 	}
 	rid, err := primitive.ObjectIDFromHex(org)
 	if err != nil {
 		return ListOrdersResponse{}, errors.New("invalid x-org header format")
 	}
 	// This should be today's orders, maybe "pending" orders
-	since := time.Now().Add(-recentWindow)
-	filter := bson.D{
-		{Key: "restaurantId", Value: rid},
-		{Key: "creationDate", Value: bson.M{"$gte": since}},
-	}
-	reqCtx := ctx.Request.Context()
-	cursor, err := s.collection.Find(reqCtx, filter)
+	since := time.Now().Add(-s.recentWindow)
+	orders, err := s.orders.FindOrders(ctx, ListOrdersQuery{RestaurantID: rid, From: &since}, 0)
 	if err != nil {
 		return ListOrdersResponse{}, err
 	}
-	defer cursor.Close(reqCtx)
-	var orders []models.Order
-	for cursor.Next(reqCtx) {
-		var o models.Order
-		if err := cursor.Decode(&o); err != nil {
-			return ListOrdersResponse{}, err
-		}
-		orders = append(orders, o)
-	}
-	if err := cursor.Err(); err != nil {
-		return ListOrdersResponse{}, err
-	}
-	data := ListOrdersResponse{Results: orders, Count: int64(len(orders)), From: "database"}
-	if b, err := json.Marshal(data); err == nil {
-		_ = s.redis.Set(ctx, recentCacheKey(org), b, recentCacheTTL).Err()
+	// recent orders come in one page, so the page length is the total
+	count := int64(len(orders))
+	data := ListOrdersResponse{Results: orders, Count: &count, PageCount: len(orders), From: "database"}
+	if b, err := json.Marshal(data); err == nil && s.cache != nil {
+		_ = s.cache.Set(ctx, recentCacheKey(org), b, s.recentCacheTTL)
 	}
 	return data, nil
 }
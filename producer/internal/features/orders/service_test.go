@@ -0,0 +1,240 @@
+package orders_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"contracts/events"
+	"producer/internal/features/orders"
+	"producer/internal/features/orders/orderstest"
+	"producer/internal/memstore"
+	"producer/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func newService(t *testing.T, store *memstore.Orders) (*orders.Service, *orderstest.Writer, *events.Codec) {
+	t.Helper()
+	codec, err := events.NewCodec(events.FormatJSON, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writer := &orderstest.Writer{}
+	cfg := orders.ServiceConfig{Topic: "orders", Writer: writer, RecentWindow: time.Hour, RecentCacheTTL: time.Minute}
+	return orders.NewService(store, cfg, orderstest.NewCache(), orders.NewHub(), codec), writer, codec
+}
+
+func testContext() *gin.Context {
+	ctx, _ := gin.CreateTestContext(httptest.NewRecorder())
+	ctx.Request = httptest.NewRequest("GET", "/orders", nil)
+	return ctx
+}
+
+func order(restaurantID primitive.ObjectID, created time.Time, status string) models.Order {
+	return models.Order{
+		ID:           primitive.NewObjectID(),
+		RestaurantID: restaurantID,
+		Status:       status,
+		CreationDate: created,
+		Items:        []models.OrderItem{{ItemID: primitive.NewObjectID(), Quantity: 2}},
+	}
+}
+
+func TestRecentOrdersCachedUntilNextEvent(t *testing.T) {
+	rid := primitive.NewObjectID()
+	now := time.Now().UTC().Truncate(time.Millisecond)
+	store := memstore.NewOrders(order(rid, now.Add(-time.Minute), models.OrderStatusPending), order(rid, now.Add(-2*time.Hour), models.OrderStatusPending))
+	svc, writer, codec := newService(t, store)
+
+	first, err := svc.RecentOrders(testContext(), rid.Hex())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first.From != "database" || first.PageCount != 1 {
+		t.Errorf("first lookup from %s with %d orders, want database with 1", first.From, first.PageCount)
+	}
+	store.Put(order(rid, now, models.OrderStatusPending))
+	second, err := svc.RecentOrders(testContext(), rid.Hex())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if second.From != "redis" || second.PageCount != 1 {
+		t.Errorf("second lookup from %s with %d orders, want the cached 1", second.From, second.PageCount)
+	}
+
+	// publishing an event for the restaurant drops its cached orders
+	req := events.OrderCreate{RestaurantID: rid.Hex(), Items: []events.OrderItem{{ID: primitive.NewObjectID().Hex(), Quantity: 1}}}
+	if err := svc.PublishOrder(context.Background(), req); err != nil {
+		t.Fatal(err)
+	}
+	third, err := svc.RecentOrders(testContext(), rid.Hex())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if third.From != "database" || third.PageCount != 2 {
+		t.Errorf("lookup after publishing from %s with %d orders, want database with 2", third.From, third.PageCount)
+	}
+
+	messages := writer.Messages()
+	if len(messages) != 1 || string(messages[0].Key) != rid.Hex() {
+		t.Fatalf("wrote %d messages, want one keyed by the restaurant", len(messages))
+	}
+	env, err := codec.Unmarshal(context.Background(), messages[0].Value, messages[0].Headers)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got events.OrderCreate
+	if err := env.Decode(&got); err != nil {
+		t.Fatal(err)
+	}
+	if env.Type != events.TypeOrderCreate || got.RestaurantID != rid.Hex() || len(got.Items) != 1 {
+		t.Errorf("wrote %s %+v", env.Type, got)
+	}
+}
+
+func TestPublishChecksTheOrder(t *testing.T) {
+	rid := primitive.NewObjectID()
+	open := order(rid, time.Now(), models.OrderStatusPending)
+	cancelled := order(rid, time.Now(), models.OrderStatusCancelled)
+	svc, writer, _ := newService(t, memstore.NewOrders(open, cancelled))
+	ctx := context.Background()
+
+	cases := []struct {
+		name string
+		err  error
+		call func() error
+	}{
+		{"unknown order", orders.ErrOrderNotFound, func() error {
+			return svc.PublishCancel(ctx, events.OrderCancel{RestaurantID: rid.Hex(), OrderID: primitive.NewObjectID().Hex()})
+		}},
+		{"other restaurant's order", orders.ErrOrderNotFound, func() error {
+			return svc.PublishCancel(ctx, events.OrderCancel{RestaurantID: primitive.NewObjectID().Hex(), OrderID: open.ID.Hex()})
+		}},
+		{"cancelled order", orders.ErrOrderClosed, func() error {
+			return svc.PublishRefund(ctx, events.OrderRefund{RestaurantID: rid.Hex(), OrderID: cancelled.ID.Hex()})
+		}},
+		{"too many units", orders.ErrInvalidRefund, func() error {
+			return svc.PublishRefund(ctx, events.OrderRefund{RestaurantID: rid.Hex(), OrderID: open.ID.Hex(), Items: []events.RefundItem{{Line: 0, Quantity: 3}}})
+		}},
+		{"line not in the order", orders.ErrInvalidRefund, func() error {
+			return svc.PublishRefund(ctx, events.OrderRefund{RestaurantID: rid.Hex(), OrderID: open.ID.Hex(), Items: []events.RefundItem{{Line: len(open.Items), Quantity: 1}}})
+		}},
+		{"partial refund", nil, func() error {
+			return svc.PublishRefund(ctx, events.OrderRefund{RestaurantID: rid.Hex(), OrderID: open.ID.Hex(), Items: []events.RefundItem{{Line: 0, Quantity: 2}}})
+		}},
+		{"cancel", nil, func() error {
+			return svc.PublishCancel(ctx, events.OrderCancel{RestaurantID: rid.Hex(), OrderID: open.ID.Hex()})
+		}},
+	}
+	for _, c := range cases {
+		if err := c.call(); !errors.Is(err, c.err) {
+			t.Errorf("%s: got %v, want %v", c.name, err, c.err)
+		}
+	}
+	if n := len(writer.Messages()); n != 2 {
+		t.Errorf("wrote %d events, want the 2 accepted ones", n)
+	}
+
+	writer.Err = errors.New("broker down")
+	if err := svc.PublishCancel(ctx, events.OrderCancel{RestaurantID: rid.Hex(), OrderID: open.ID.Hex()}); !errors.Is(err, writer.Err) {
+		t.Errorf("failed write returned %v", err)
+	}
+}
+
+func TestListOrdersPages(t *testing.T) {
+	rid := primitive.NewObjectID()
+	start := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+	store := memstore.NewOrders()
+	for i := 0; i < 5; i++ {
+		store.Put(order(rid, start.Add(time.Duration(i)*time.Minute), models.OrderStatusPending))
+	}
+	store.Put(order(primitive.NewObjectID(), start, models.OrderStatusPending))
+	svc, _, _ := newService(t, store)
+
+	var seen []time.Time
+	q := orders.ListOrdersQuery{RestaurantID: rid, Limit: 2, Total: true}
+	for pages := 1; ; pages++ {
+		resp, err := svc.ListOrders(testContext(), q)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// the total covers every page, whichever the cursor points at
+		if resp.PageCount != len(resp.Results) || resp.Count == nil || *resp.Count != 5 {
+			t.Errorf("page %d: pageCount %d of %d results, count %v, want a total of 5", pages, resp.PageCount, len(resp.Results), resp.Count)
+		}
+		for _, o := range resp.Results {
+			seen = append(seen, o.CreationDate)
+		}
+		if resp.NextCursor == "" {
+			if pages != 3 {
+				t.Errorf("%d pages, want 3", pages)
+			}
+			break
+		}
+		if q.Cursor, err = orders.DecodeCursor(resp.NextCursor); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if resp, _ := svc.ListOrders(testContext(), orders.ListOrdersQuery{RestaurantID: rid}); resp.Count != nil {
+		t.Errorf("count %d without asking for the total", *resp.Count)
+	}
+	if len(seen) != 5 {
+		t.Fatalf("listed %d orders, want the restaurant's 5", len(seen))
+	}
+	for i := 1; i < len(seen); i++ {
+		if !seen[i].Before(seen[i-1]) {
+			t.Errorf("orders not newest first: %v", seen)
+		}
+	}
+}
+
+func TestStreamOrigins(t *testing.T) {
+	codec, err := events.NewCodec(events.FormatJSON, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := orders.ServiceConfig{Topic: "orders", Writer: &orderstest.Writer{}, StreamOrigins: []string{"https://kitchen.example.com"}}
+	hub := orders.NewHub()
+	defer hub.Close()
+	svc := orders.NewService(memstore.NewOrders(), cfg, orderstest.NewCache(), hub, codec)
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	orders.NewController(svc).RegisterRoutes(router)
+	server := httptest.NewServer(router)
+	defer server.Close()
+	stream := "ws" + strings.TrimPrefix(server.URL, "http") + "/orders/stream?org=" + primitive.NewObjectID().Hex()
+
+	cases := []struct {
+		origin string
+		status int
+	}{
+		{"", http.StatusSwitchingProtocols},
+		{server.URL, http.StatusSwitchingProtocols},
+		{"https://KITCHEN.example.com", http.StatusSwitchingProtocols},
+		{"https://kitchen.example.com:8443", http.StatusForbidden},
+		{"https://elsewhere.example.com", http.StatusForbidden},
+	}
+	for _, c := range cases {
+		header := http.Header{}
+		if c.origin != "" {
+			header.Set("Origin", c.origin)
+		}
+		conn, resp, err := websocket.DefaultDialer.Dial(stream, header)
+		if conn != nil {
+			conn.Close()
+		}
+		if resp == nil {
+			t.Fatalf("origin %q: %v", c.origin, err)
+		}
+		if resp.StatusCode != c.status {
+			t.Errorf("origin %q: status %d, want %d", c.origin, resp.StatusCode, c.status)
+		}
+	}
+}
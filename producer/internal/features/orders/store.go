@@ -0,0 +1,94 @@
+package orders
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"producer/internal/models"
+
+	"github.com/redis/go-redis/v9"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Store reads the orders the consumer persisted
+type Store interface {
+	// FindOrder returns ErrOrderNotFound unless the restaurant has the order
+	FindOrder(ctx context.Context, restaurantID, orderID primitive.ObjectID) (*models.Order, error)
+	// FindOrders returns the first limit orders q selects, in q's order, or all of them when
+	// limit is 0; q.Limit is ignored
+	FindOrders(ctx context.Context, q ListOrdersQuery, limit int) ([]models.Order, error)
+	// CountOrders returns how many orders q selects over all pages; q.Cursor is ignored
+	CountOrders(ctx context.Context, q ListOrdersQuery) (int64, error)
+}
+
+// Cache keeps query results for a while; Get fails for keys it doesn't have
+type Cache interface {
+	Get(ctx context.Context, key string) ([]byte, error)
+	Set(ctx context.Context, key string, value []byte, ttl time.Duration) error
+	Delete(ctx context.Context, key string) error
+}
+
+type MongoStore struct {
+	collection *mongo.Collection
+}
+
+func NewMongoStore(database *mongo.Database) *MongoStore {
+	return &MongoStore{collection: database.Collection("orders")}
+}
+
+func (s *MongoStore) FindOrder(ctx context.Context, restaurantID, orderID primitive.ObjectID) (*models.Order, error) {
+	var order models.Order
+	err := s.collection.FindOne(ctx, bson.M{"_id": orderID, "restaurantId": restaurantID}).Decode(&order)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, ErrOrderNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &order, nil
+}
+
+func (s *MongoStore) FindOrders(ctx context.Context, q ListOrdersQuery, limit int) ([]models.Order, error) {
+	opts := options.Find().SetSort(q.sort())
+	if limit > 0 {
+		opts.SetLimit(int64(limit))
+	}
+	cursor, err := s.collection.Find(ctx, q.filter(), opts)
+	if err != nil {
+		return nil, err
+	}
+	var orders []models.Order
+	if err := cursor.All(ctx, &orders); err != nil {
+		return nil, err
+	}
+	return orders, nil
+}
+
+func (s *MongoStore) CountOrders(ctx context.Context, q ListOrdersQuery) (int64, error) {
+	q.Cursor = nil
+	return s.collection.CountDocuments(ctx, q.filter())
+}
+
+type RedisCache struct {
+	client *redis.Client
+}
+
+func NewRedisCache(client *redis.Client) *RedisCache {
+	return &RedisCache{client: client}
+}
+
+func (c *RedisCache) Get(ctx context.Context, key string) ([]byte, error) {
+	return c.client.Get(ctx, key).Bytes()
+}
+
+func (c *RedisCache) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	return c.client.Set(ctx, key, value, ttl).Err()
+}
+
+func (c *RedisCache) Delete(ctx context.Context, key string) error {
+	return c.client.Del(ctx, key).Err()
+}
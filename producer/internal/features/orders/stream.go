@@ -0,0 +1,329 @@
+package orders
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"contracts/correlation"
+	"contracts/kafkaconn"
+	"contracts/logging"
+
+	"github.com/segmentio/kafka-go"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	// streamBacklogSize is how many events per restaurant are kept for Last-Event-ID resume
+	streamBacklogSize = 256
+	// subscriberBufferSize is how many undelivered events a slow subscriber may queue before it is dropped
+	subscriberBufferSize = 64
+)
+
+// StreamEvent is an order lifecycle event as delivered to stream subscribers.
+// The ID is "<partition>-<offset>" of the Kafka message it came from; lifecycle
+// events are keyed by restaurant so offsets only grow for a given restaurant.
+type StreamEvent struct {
+	ID           string          `json:"id"`
+	Type         string          `json:"type"`
+	RestaurantID string          `json:"restaurantId"`
+	Data         json.RawMessage `json:"data"`
+	partition    int
+	offset       int64
+}
+
+// after reports whether the event comes later in the restaurant's stream than lastEventID
+func (e StreamEvent) after(lastEventID string) bool {
+	partition, offset, ok := parseStreamEventID(lastEventID)
+	if !ok || partition != e.partition {
+		return true
+	}
+	return e.offset > offset
+}
+
+func parseStreamEventID(id string) (int, int64, bool) {
+	p, o, found := strings.Cut(id, "-")
+	if !found {
+		return 0, 0, false
+	}
+	partition, err := strconv.Atoi(p)
+	if err != nil {
+		return 0, 0, false
+	}
+	offset, err := strconv.ParseInt(o, 10, 64)
+	if err != nil {
+		return 0, 0, false
+	}
+	return partition, offset, true
+}
+
+// Subscription receives the live events for one restaurant until it is closed
+type Subscription struct {
+	Events <-chan StreamEvent
+	events chan StreamEvent
+	hub    *Hub
+	org    string
+	once   sync.Once
+}
+
+func (s *Subscription) Close() {
+	s.once.Do(func() {
+		s.hub.unsubscribe(s)
+	})
+}
+
+// Hub fans order lifecycle events out to the subscribers of each restaurant
+type Hub struct {
+	mu          sync.Mutex
+	subscribers map[string]map[*Subscription]struct{}
+	backlog     map[string][]StreamEvent
+	closed      bool
+}
+
+func NewHub() *Hub {
+	return &Hub{
+		subscribers: make(map[string]map[*Subscription]struct{}),
+		backlog:     make(map[string][]StreamEvent),
+	}
+}
+
+// Subscribe registers a subscriber for the restaurant and returns the buffered
+// events that came after lastEventID, so a reconnecting client misses nothing
+func (h *Hub) Subscribe(org string, lastEventID string) (*Subscription, []StreamEvent) {
+	ch := make(chan StreamEvent, subscriberBufferSize)
+	sub := &Subscription{Events: ch, events: ch, hub: h, org: org}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.closed {
+		close(ch)
+		return sub, nil
+	}
+	if h.subscribers[org] == nil {
+		h.subscribers[org] = make(map[*Subscription]struct{})
+	}
+	h.subscribers[org][sub] = struct{}{}
+
+	var replay []StreamEvent
+	if lastEventID != "" {
+		for _, evt := range h.backlog[org] {
+			if evt.after(lastEventID) {
+				replay = append(replay, evt)
+			}
+		}
+	}
+	return sub, replay
+}
+
+// Close ends every subscription, and those made afterwards at once, as the service shuts down;
+// clients reconnect to another instance with Last-Event-ID
+func (h *Hub) Close() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.closed = true
+	for org, subs := range h.subscribers {
+		for sub := range subs {
+			close(sub.events)
+		}
+		delete(h.subscribers, org)
+	}
+}
+
+func (h *Hub) unsubscribe(sub *Subscription) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if subs, ok := h.subscribers[sub.org]; ok {
+		if _, ok := subs[sub]; ok {
+			delete(subs, sub)
+			close(sub.events)
+		}
+		if len(subs) == 0 {
+			delete(h.subscribers, sub.org)
+		}
+	}
+}
+
+// Broadcast records the event in the restaurant backlog and delivers it to its subscribers.
+// Subscribers that cannot keep up are disconnected and expected to resume with Last-Event-ID.
+func (h *Hub) Broadcast(evt StreamEvent) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	backlog := append(h.backlog[evt.RestaurantID], evt)
+	if len(backlog) > streamBacklogSize {
+		backlog = backlog[len(backlog)-streamBacklogSize:]
+	}
+	h.backlog[evt.RestaurantID] = backlog
+
+	for sub := range h.subscribers[evt.RestaurantID] {
+		select {
+		case sub.events <- evt:
+		default:
+			delete(h.subscribers[evt.RestaurantID], sub)
+			close(sub.events)
+		}
+	}
+}
+
+type lifecycleEvent struct {
+	Type         string `json:"type"`
+	RestaurantID string `json:"restaurantId"`
+}
+
+// StartLifecycleConsumer feeds the hub from the order lifecycle topic published by the consumer.
+// Every producer instance needs every event, so each one reads every partition itself, without
+// a consumer group, from the end offsets it finds at startup. The lookup is retried until the
+// topic exists. Partitions added afterwards are not read until a restart.
+func StartLifecycleConsumer(ctx context.Context, conn *kafkaconn.Conn, topic string, hub *Hub, logger *slog.Logger) func(context.Context) {
+	runCtx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		offsets, err := lifecycleEndOffsets(runCtx, conn, topic, logger)
+		if err != nil {
+			return
+		}
+		var wg sync.WaitGroup
+		for _, p := range offsets {
+			r := kafka.NewReader(kafka.ReaderConfig{
+				Brokers:   conn.Brokers,
+				Dialer:    conn.Dialer(),
+				Topic:     topic,
+				Partition: p.Partition,
+				MinBytes:  1,
+				MaxBytes:  10e6,
+				MaxWait:   500 * time.Millisecond,
+			})
+			if err := r.SetOffset(p.LastOffset); err != nil {
+				logger.ErrorContext(runCtx, "order stream: partition not read", logging.KeyPartition, p.Partition, "error", err)
+				_ = r.Close()
+				continue
+			}
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				defer r.Close()
+				readLifecycle(runCtx, r, topic, hub, logger)
+			}()
+		}
+		wg.Wait()
+	}()
+
+	return func(ctx context.Context) {
+		cancel()
+		select {
+		case <-done:
+		case <-ctx.Done():
+		}
+	}
+}
+
+const (
+	firstLookupBackoff = 250 * time.Millisecond
+	maxLookupBackoff   = 5 * time.Second
+)
+
+// lifecycleEndOffsets returns the end offset of each of the topic's partitions, retrying with
+// a growing backoff until they are known or ctx is done
+func lifecycleEndOffsets(ctx context.Context, conn *kafkaconn.Conn, topic string, logger *slog.Logger) ([]kafka.PartitionOffsets, error) {
+	client := &kafka.Client{Addr: conn.Addr(), Transport: conn.Transport()}
+	backoff := firstLookupBackoff
+	for {
+		offsets, err := endOffsets(ctx, client, topic)
+		if err == nil {
+			return offsets, nil
+		}
+		logger.WarnContext(ctx, "order stream: lifecycle topic not available, retrying", "topic", topic, "retryIn", backoff, "error", err)
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(backoff):
+		}
+		backoff = min(2*backoff, maxLookupBackoff)
+	}
+}
+
+func endOffsets(ctx context.Context, client *kafka.Client, topic string) ([]kafka.PartitionOffsets, error) {
+	meta, err := client.Metadata(ctx, &kafka.MetadataRequest{Topics: []string{topic}})
+	if err != nil {
+		return nil, err
+	}
+	if len(meta.Topics) != 1 || meta.Topics[0].Error != nil || len(meta.Topics[0].Partitions) == 0 {
+		var topicErr error = errors.New("no partitions")
+		if len(meta.Topics) == 1 && meta.Topics[0].Error != nil {
+			topicErr = meta.Topics[0].Error
+		}
+		return nil, topicErr
+	}
+	requests := make([]kafka.OffsetRequest, len(meta.Topics[0].Partitions))
+	for i, p := range meta.Topics[0].Partitions {
+		requests[i] = kafka.LastOffsetOf(p.ID)
+	}
+	resp, err := client.ListOffsets(ctx, &kafka.ListOffsetsRequest{Topics: map[string][]kafka.OffsetRequest{topic: requests}})
+	if err != nil {
+		return nil, err
+	}
+	for _, p := range resp.Topics[topic] {
+		if p.Error != nil {
+			return nil, fmt.Errorf("partition %d: %w", p.Partition, p.Error)
+		}
+	}
+	return resp.Topics[topic], nil
+}
+
+// readLifecycle broadcasts the events of one partition until ctx is done, backing off like
+// lifecycleEndOffsets while reads fail
+func readLifecycle(ctx context.Context, r *kafka.Reader, topic string, hub *Hub, logger *slog.Logger) {
+	backoff := firstLookupBackoff
+	for {
+		message, err := r.ReadMessage(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			logger.ErrorContext(ctx, "order stream read error", "retryIn", backoff, "error", err)
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(backoff):
+			}
+			backoff = min(2*backoff, maxLookupBackoff)
+			continue
+		}
+		backoff = firstLookupBackoff
+		// the consumer forwards the trace of the order, which ends with this fan-out
+		msgCtx, span := tracer.Start(correlation.FromKafkaHeaders(ctx, message.Headers), topic+" process",
+			trace.WithSpanKind(trace.SpanKindConsumer),
+			trace.WithAttributes(
+				semconv.MessagingSystemKafka,
+				semconv.MessagingOperationTypeDeliver,
+				semconv.MessagingDestinationName(topic),
+				semconv.MessagingDestinationPartitionID(strconv.Itoa(message.Partition)),
+				semconv.MessagingKafkaMessageOffset(int(message.Offset)),
+			))
+		var evt lifecycleEvent
+		if err := json.Unmarshal(message.Value, &evt); err != nil || evt.RestaurantID == "" {
+			logger.WarnContext(msgCtx, "order stream: skipping malformed lifecycle event",
+				logging.KeyPartition, message.Partition, logging.KeyOffset, message.Offset)
+			span.SetStatus(codes.Error, "malformed lifecycle event")
+			span.End()
+			continue
+		}
+		hub.Broadcast(StreamEvent{
+			ID:           fmt.Sprintf("%d-%d", message.Partition, message.Offset),
+			Type:         evt.Type,
+			RestaurantID: evt.RestaurantID,
+			Data:         json.RawMessage(message.Value),
+			partition:    message.Partition,
+			offset:       message.Offset,
+		})
+		span.End()
+	}
+}
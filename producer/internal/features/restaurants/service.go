@@ -1,20 +1,20 @@
 package restaurants
 
 import (
+	"context"
+
 	"producer/internal/models"
 
-	"github.com/gin-gonic/gin"
-	"go.mongodb.org/mongo-driver/bson"
-	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
 type Service struct {
-	db             *mongo.Database
-	restaurantsCol *mongo.Collection
+	restaurants RestaurantStore
+	items       ItemStore
 }
 
-func NewService(database *mongo.Database) *Service {
-	return &Service{db: database, restaurantsCol: database.Collection("restaurants")}
+func NewService(stores Stores) *Service {
+	return &Service{restaurants: stores.Restaurants, items: stores.Items}
 }
 
 type RestaurantWithItems struct {
@@ -22,27 +22,30 @@ type RestaurantWithItems struct {
 	Items             []models.Item `bson:"items" json:"items"`
 }
 
-func (s *Service) ListRestaurants(ctx *gin.Context) ([]RestaurantWithItems, error) {
-	pipeline := mongo.Pipeline{
-		bson.D{{Key: "$lookup", Value: bson.D{
-			{Key: "from", Value: "items"},
-			{Key: "localField", Value: "_id"},
-			{Key: "foreignField", Value: "restaurantId"},
-			{Key: "as", Value: "items"},
-		}}},
+// ListRestaurants returns every restaurant with its menu items
+func (s *Service) ListRestaurants(ctx context.Context) ([]RestaurantWithItems, error) {
+	restaurants, err := s.restaurants.ListRestaurants(ctx)
+	if err != nil || len(restaurants) == 0 {
+		return nil, err
 	}
-	cursor, err := s.restaurantsCol.Aggregate(ctx, pipeline)
+	ids := make([]primitive.ObjectID, len(restaurants))
+	for i, r := range restaurants {
+		ids[i] = r.ID
+	}
+	items, err := s.items.ListItemsOf(ctx, ids)
 	if err != nil {
 		return nil, err
 	}
-	defer cursor.Close(ctx)
-	var out []RestaurantWithItems
-	for cursor.Next(ctx) {
-		var r RestaurantWithItems
-		if err := cursor.Decode(&r); err != nil {
-			return nil, err
+	byRestaurant := make(map[primitive.ObjectID][]models.Item, len(restaurants))
+	for _, it := range items {
+		byRestaurant[it.RestaurantID] = append(byRestaurant[it.RestaurantID], it)
+	}
+	out := make([]RestaurantWithItems, len(restaurants))
+	for i, r := range restaurants {
+		out[i] = RestaurantWithItems{Restaurant: r, Items: byRestaurant[r.ID]}
+		if out[i].Items == nil {
+			out[i].Items = []models.Item{}
 		}
-		out = append(out, r)
 	}
-	return out, cursor.Err()
+	return out, nil
 }
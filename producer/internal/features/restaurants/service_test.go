@@ -0,0 +1,49 @@
+package restaurants_test
+
+import (
+	"context"
+	"testing"
+
+	"producer/internal/features/restaurants"
+	"producer/internal/memstore"
+	"producer/internal/models"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestListRestaurantsWithTheirItems(t *testing.T) {
+	db := memstore.New()
+	svc := restaurants.NewService(db.RestaurantStores())
+	if got, err := svc.ListRestaurants(context.Background()); err != nil || len(got) != 0 {
+		t.Fatalf("without restaurants got %v, %v", got, err)
+	}
+
+	diner := models.Restaurant{ID: primitive.NewObjectID(), Name: "Diner"}
+	cafe := models.Restaurant{ID: primitive.NewObjectID(), Name: "Café"}
+	db.Restaurants.Put(diner, cafe)
+	db.Items.Put(
+		models.Item{ID: primitive.NewObjectID(), Name: "Burger", RestaurantID: diner.ID},
+		models.Item{ID: primitive.NewObjectID(), Name: "Fries", RestaurantID: diner.ID},
+		models.Item{ID: primitive.NewObjectID(), Name: "Elsewhere", RestaurantID: primitive.NewObjectID()},
+	)
+
+	got, err := svc.ListRestaurants(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 || got[0].ID != diner.ID || got[1].ID != cafe.ID {
+		t.Fatalf("got %+v, want the diner and the café", got)
+	}
+	if len(got[0].Items) != 2 {
+		t.Errorf("diner has %d items, want 2", len(got[0].Items))
+	}
+	for _, it := range got[0].Items {
+		if it.RestaurantID != diner.ID {
+			t.Errorf("diner lists %s", it.Name)
+		}
+	}
+	// an empty menu is an empty list, not null
+	if got[1].Items == nil || len(got[1].Items) != 0 {
+		t.Errorf("café items = %#v, want empty", got[1].Items)
+	}
+}
@@ -0,0 +1,73 @@
+package restaurants
+
+import (
+	"context"
+
+	"producer/internal/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// RestaurantStore keeps the restaurants
+type RestaurantStore interface {
+	ListRestaurants(ctx context.Context) ([]models.Restaurant, error)
+}
+
+// ItemStore keeps the restaurants' menu items
+type ItemStore interface {
+	// ListItemsOf returns the items of the restaurants
+	ListItemsOf(ctx context.Context, restaurantIDs []primitive.ObjectID) ([]models.Item, error)
+}
+
+// Stores are what the service reads
+type Stores struct {
+	Restaurants RestaurantStore
+	Items       ItemStore
+}
+
+// MongoStores reads everything from the database
+func MongoStores(database *mongo.Database) Stores {
+	return Stores{Restaurants: NewMongoRestaurantStore(database), Items: NewMongoItemStore(database)}
+}
+
+type MongoRestaurantStore struct {
+	collection *mongo.Collection
+}
+
+func NewMongoRestaurantStore(database *mongo.Database) *MongoRestaurantStore {
+	return &MongoRestaurantStore{collection: database.Collection("restaurants")}
+}
+
+func (s *MongoRestaurantStore) ListRestaurants(ctx context.Context) ([]models.Restaurant, error) {
+	cursor, err := s.collection.Find(ctx, bson.D{})
+	if err != nil {
+		return nil, err
+	}
+	var restaurants []models.Restaurant
+	if err := cursor.All(ctx, &restaurants); err != nil {
+		return nil, err
+	}
+	return restaurants, nil
+}
+
+type MongoItemStore struct {
+	collection *mongo.Collection
+}
+
+func NewMongoItemStore(database *mongo.Database) *MongoItemStore {
+	return &MongoItemStore{collection: database.Collection("items")}
+}
+
+func (s *MongoItemStore) ListItemsOf(ctx context.Context, restaurantIDs []primitive.ObjectID) ([]models.Item, error) {
+	cursor, err := s.collection.Find(ctx, bson.M{"restaurantId": bson.M{"$in": restaurantIDs}})
+	if err != nil {
+		return nil, err
+	}
+	var items []models.Item
+	if err := cursor.All(ctx, &items); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
@@ -0,0 +1,214 @@
+package integration
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"contracts/correlation"
+	"contracts/events"
+	"contracts/kafkaconn"
+	"contracts/kafkatest"
+	"contracts/middleware"
+	"producer/internal/features/orders"
+	"producer/internal/memstore"
+	"producer/internal/models"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+	"github.com/segmentio/kafka-go"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	ordersTopic    = "orders"
+	lifecycleTopic = "order-events"
+)
+
+// api is the producer's orders API wired to the broker, Redis and an in-memory store
+type api struct {
+	conn    *kafkaconn.Conn
+	codec   *events.Codec
+	redis   *miniredis.Miniredis
+	store   *memstore.Orders
+	service *orders.Service
+	router  *gin.Engine
+}
+
+func startAPI(t *testing.T) *api {
+	if testing.Short() {
+		t.Skip("integration test")
+	}
+	conn := kafkatest.Start(t, 3, ordersTopic, lifecycleTopic)
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { _ = client.Close() })
+	codec, err := events.NewCodec(events.FormatJSON, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	a := &api{conn: conn, codec: codec, redis: mr, store: memstore.NewOrders()}
+	hub := orders.NewHub()
+	a.service = orders.NewService(a.store, orders.ServiceConfig{
+		Kafka:          conn,
+		Topic:          ordersTopic,
+		Balancer:       &kafka.Hash{},
+		RecentWindow:   time.Hour,
+		RecentCacheTTL: time.Minute,
+	}, orders.NewRedisCache(client), hub, codec)
+	stop := orders.StartLifecycleConsumer(context.Background(), conn, lifecycleTopic, hub, slog.Default())
+	t.Cleanup(func() {
+		stop(context.Background())
+		hub.Close()
+		_ = a.service.Close()
+	})
+
+	gin.SetMode(gin.TestMode)
+	a.router = gin.New()
+	a.router.ContextWithFallback = true
+	a.router.Use(middleware.Correlation())
+	orders.NewController(a.service).RegisterRoutes(a.router)
+	return a
+}
+
+func (a *api) do(t *testing.T, method, path, org, requestID, body string) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("x-org", org)
+	if requestID != "" {
+		req.Header.Set(correlation.HeaderRequestID, requestID)
+	}
+	rec := httptest.NewRecorder()
+	a.router.ServeHTTP(rec, req)
+	return rec
+}
+
+func header(m kafka.Message, key string) string {
+	for _, h := range m.Headers {
+		if h.Key == key {
+			return string(h.Value)
+		}
+	}
+	return ""
+}
+
+func TestOrderReachesKafka(t *testing.T) {
+	a := startAPI(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+	defer cancel()
+	org := primitive.NewObjectID().Hex()
+	item := primitive.NewObjectID().Hex()
+
+	requestID := correlation.NewRequestID()
+	rec := a.do(t, http.MethodPost, "/orders", org, requestID, `{"items":[{"id":"`+item+`","quantity":2}],"tip":150}`)
+	if rec.Code != http.StatusAccepted {
+		t.Fatalf("POST /orders = %d %s", rec.Code, rec.Body)
+	}
+	if got := rec.Header().Get(correlation.HeaderRequestID); got != requestID {
+		t.Errorf("response request ID %q, want %q", got, requestID)
+	}
+
+	r := kafka.NewReader(kafka.ReaderConfig{Brokers: a.conn.Brokers, Dialer: a.conn.Dialer(), Topic: ordersTopic, GroupID: "test", MaxWait: 100 * time.Millisecond})
+	defer r.Close()
+	m, err := r.ReadMessage(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(m.Key) != org || header(m, correlation.HeaderRequestID) != requestID {
+		t.Errorf("message keyed %q with request ID %q", m.Key, header(m, correlation.HeaderRequestID))
+	}
+	env, err := a.codec.Unmarshal(ctx, m.Value, m.Headers)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got events.OrderCreate
+	if err := env.Decode(&got); err != nil {
+		t.Fatal(err)
+	}
+	if env.Type != events.TypeOrderCreate || got.RestaurantID != org || got.Tip != 150 || len(got.Items) != 1 || got.Items[0].ID != item || got.Items[0].Quantity != 2 {
+		t.Errorf("published %s %+v", env.Type, got)
+	}
+
+	// an invalid order is rejected before it reaches the broker
+	if rec := a.do(t, http.MethodPost, "/orders", org, "", `{"items":[]}`); rec.Code != http.StatusBadRequest {
+		t.Errorf("POST /orders without items = %d", rec.Code)
+	}
+}
+
+func TestRecentOrdersCachedInRedis(t *testing.T) {
+	a := startAPI(t)
+	rid := primitive.NewObjectID()
+	order := models.Order{ID: primitive.NewObjectID(), RestaurantID: rid, Status: models.OrderStatusPending, CreationDate: time.Now().UTC()}
+	a.store.Put(order)
+
+	recent := func() orders.ListOrdersResponse {
+		t.Helper()
+		rec := a.do(t, http.MethodGet, "/orders/recent", rid.Hex(), "", "")
+		if rec.Code != http.StatusOK {
+			t.Fatalf("GET /orders/recent = %d %s", rec.Code, rec.Body)
+		}
+		var resp orders.ListOrdersResponse
+		if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+			t.Fatal(err)
+		}
+		return resp
+	}
+	if resp := recent(); resp.From != "database" || resp.PageCount != 1 {
+		t.Errorf("first lookup from %s with %d orders", resp.From, resp.PageCount)
+	}
+	key := "recent_orders:" + rid.Hex()
+	if !a.redis.Exists(key) || a.redis.TTL(key) <= 0 {
+		t.Fatalf("%s not cached with a TTL", key)
+	}
+	if resp := recent(); resp.From != "redis" || resp.PageCount != 1 {
+		t.Errorf("second lookup from %s with %d orders", resp.From, resp.PageCount)
+	}
+
+	// cancelling one of the restaurant's orders drops the cached list
+	if rec := a.do(t, http.MethodPost, "/orders/"+order.ID.Hex()+"/cancel", rid.Hex(), "", ""); rec.Code != http.StatusAccepted {
+		t.Fatalf("cancel = %d %s", rec.Code, rec.Body)
+	}
+	if a.redis.Exists(key) {
+		t.Errorf("%s still cached after the cancellation", key)
+	}
+}
+
+func TestLifecycleEventsReachStreams(t *testing.T) {
+	a := startAPI(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+	defer cancel()
+	org := primitive.NewObjectID().Hex()
+	sub, _ := a.service.SubscribeOrders(org, "")
+	defer sub.Close()
+
+	w := &kafka.Writer{Addr: a.conn.Addr(), Transport: a.conn.Transport(), Topic: lifecycleTopic, Balancer: &kafka.Hash{}, BatchTimeout: 10 * time.Millisecond}
+	defer w.Close()
+	value := []byte(`{"type":"order.created","restaurantId":"` + org + `"}`)
+	// the stream readers start at the end offsets they look up in the background, so events
+	// written before then are missed; keep writing until one arrives
+	tick := time.NewTicker(100 * time.Millisecond)
+	defer tick.Stop()
+	for {
+		if err := w.WriteMessages(ctx, kafka.Message{Key: []byte(org), Value: value}); err != nil {
+			t.Fatal(err)
+		}
+		select {
+		case evt := <-sub.Events:
+			if evt.Type != "order.created" || evt.RestaurantID != org || evt.ID == "" {
+				t.Errorf("streamed %+v", evt)
+			}
+			return
+		case <-tick.C:
+		case <-ctx.Done():
+			t.Fatal("no lifecycle event reached the stream")
+		}
+	}
+}
@@ -0,0 +1,5 @@
+// Package integration runs the producer's side of the pipeline in process: orders posted to the
+// HTTP API are written to an in-process Kafka-compatible broker, recent orders are cached in an
+// in-process Redis, and lifecycle events on the broker reach the live order streams. Skipped
+// with -short.
+package integration
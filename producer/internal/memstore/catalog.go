@@ -0,0 +1,83 @@
+package memstore
+
+import (
+	"context"
+	"slices"
+	"sync"
+
+	"producer/internal/models"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Items is a restaurants.ItemStore and analytics.ItemStore of the items put in it
+type Items struct {
+	mu    sync.Mutex
+	items map[primitive.ObjectID]models.Item
+}
+
+func NewItems() *Items {
+	return &Items{items: make(map[primitive.ObjectID]models.Item)}
+}
+
+// Put adds or replaces items
+func (s *Items) Put(items ...models.Item) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, it := range items {
+		s.items[it.ID] = it
+	}
+}
+
+func (s *Items) ListItemsOf(_ context.Context, restaurantIDs []primitive.ObjectID) ([]models.Item, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	of := make(map[primitive.ObjectID]bool, len(restaurantIDs))
+	for _, id := range restaurantIDs {
+		of[id] = true
+	}
+	var out []models.Item
+	for _, it := range s.items {
+		if of[it.RestaurantID] {
+			out = append(out, it)
+		}
+	}
+	return out, nil
+}
+
+func (s *Items) FindItems(_ context.Context, ids []primitive.ObjectID) ([]models.Item, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var out []models.Item
+	for _, id := range ids {
+		if it, ok := s.items[id]; ok {
+			out = append(out, it)
+		}
+	}
+	return out, nil
+}
+
+// Restaurants is a restaurants.RestaurantStore listing restaurants in the order they were put
+type Restaurants struct {
+	mu          sync.Mutex
+	restaurants []models.Restaurant
+}
+
+// Put adds restaurants, replacing those with the same ID
+func (s *Restaurants) Put(restaurants ...models.Restaurant) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, r := range restaurants {
+		if i := slices.IndexFunc(s.restaurants, func(x models.Restaurant) bool { return x.ID == r.ID }); i >= 0 {
+			s.restaurants[i] = r
+		} else {
+			s.restaurants = append(s.restaurants, r)
+		}
+	}
+}
+
+func (s *Restaurants) ListRestaurants(context.Context) ([]models.Restaurant, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]models.Restaurant(nil), s.restaurants...), nil
+}
@@ -0,0 +1,35 @@
+// Package memstore keeps orders, items, restaurants and daily aggregates in memory. It implements
+// the stores of the services, to run them without MongoDB in tests and tools.
+package memstore
+
+import (
+	"producer/internal/features/analytics"
+	"producer/internal/features/restaurants"
+)
+
+// DB holds one store of each kind
+type DB struct {
+	Orders      *Orders
+	Items       *Items
+	Restaurants *Restaurants
+	Aggregates  *Aggregates
+}
+
+func New() *DB {
+	return &DB{
+		Orders:      NewOrders(),
+		Items:       NewItems(),
+		Restaurants: &Restaurants{},
+		Aggregates:  &Aggregates{},
+	}
+}
+
+// RestaurantStores returns the stores of the restaurants service
+func (db *DB) RestaurantStores() restaurants.Stores {
+	return restaurants.Stores{Restaurants: db.Restaurants, Items: db.Items}
+}
+
+// AnalyticsStores returns the stores of the analytics service
+func (db *DB) AnalyticsStores() analytics.Stores {
+	return analytics.Stores{Aggregates: db.Aggregates, Orders: db.Orders, Items: db.Items}
+}
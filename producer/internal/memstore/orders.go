@@ -0,0 +1,108 @@
+package memstore
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"producer/internal/features/analytics"
+	"producer/internal/features/orders"
+	"producer/internal/models"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Orders is an orders.Store and analytics.OrderStore of the orders put in it
+type Orders struct {
+	mu     sync.Mutex
+	orders map[primitive.ObjectID]models.Order
+}
+
+func NewOrders(orders ...models.Order) *Orders {
+	s := &Orders{orders: make(map[primitive.ObjectID]models.Order)}
+	s.Put(orders...)
+	return s
+}
+
+// Put adds or replaces orders, the way the consumer stores them
+func (s *Orders) Put(orders ...models.Order) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, o := range orders {
+		s.orders[o.ID] = o
+	}
+}
+
+func (s *Orders) FindOrder(_ context.Context, restaurantID, orderID primitive.ObjectID) (*models.Order, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	o, ok := s.orders[orderID]
+	if !ok || o.RestaurantID != restaurantID {
+		return nil, orders.ErrOrderNotFound
+	}
+	return &o, nil
+}
+
+func (s *Orders) FindOrders(_ context.Context, q orders.ListOrdersQuery, limit int) ([]models.Order, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var out []models.Order
+	for _, o := range s.orders {
+		if q.Matches(o) {
+			out = append(out, o)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return q.Less(out[i], out[j]) })
+	if limit > 0 && len(out) > limit {
+		out = out[:limit]
+	}
+	return out, nil
+}
+
+func (s *Orders) CountOrders(ctx context.Context, q orders.ListOrdersQuery) (int64, error) {
+	q.Cursor = nil
+	found, err := s.FindOrders(ctx, q, 0)
+	return int64(len(found)), err
+}
+
+func (s *Orders) ItemQuantities(_ context.Context, from, to time.Time) (map[primitive.ObjectID]int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	quantities := make(map[primitive.ObjectID]int64)
+	for _, o := range s.orders {
+		if o.CreationDate.Before(from) || !o.CreationDate.Before(to) {
+			continue
+		}
+		for _, it := range o.Items {
+			quantities[it.ItemID] += int64(it.Quantity)
+		}
+	}
+	return quantities, nil
+}
+
+// Aggregates is an analytics.AggregateStore of the daily totals put in it
+type Aggregates struct {
+	mu     sync.Mutex
+	totals []analytics.DailyTotals
+}
+
+// Put adds daily aggregates, as the consumer would have maintained them
+func (s *Aggregates) Put(totals ...analytics.DailyTotals) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.totals = append(s.totals, totals...)
+}
+
+func (s *Aggregates) DailyTotals(_ context.Context, restaurantID primitive.ObjectID, from, to time.Time) ([]analytics.DailyTotals, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var out []analytics.DailyTotals
+	for _, t := range s.totals {
+		if t.RestaurantID == restaurantID && !t.Day.Before(from) && t.Day.Before(to) {
+			out = append(out, t)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Day.Before(out[j].Day) })
+	return out, nil
+}
@@ -0,0 +1,74 @@
+package pgstore
+
+import (
+	"context"
+
+	"producer/internal/models"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Items is a restaurants.ItemStore and analytics.ItemStore of the items table
+type Items struct {
+	pool *pgxpool.Pool
+}
+
+const itemColumns = `id, restaurant_id, name, price, price_currency, cost, cost_currency, quantity, modifier_groups`
+
+func scanItem(row pgx.CollectableRow) (models.Item, error) {
+	var it models.Item
+	var id, restaurantID string
+	err := row.Scan(&id, &restaurantID, &it.Name, &it.Price.Amount, &it.Price.Currency, &it.Cost.Amount, &it.Cost.Currency, &it.Quantity, &it.ModifierGroups)
+	if err != nil {
+		return it, err
+	}
+	if len(it.ModifierGroups) == 0 {
+		it.ModifierGroups = nil
+	}
+	if it.ID, err = objectID(id); err != nil {
+		return it, err
+	}
+	it.RestaurantID, err = objectID(restaurantID)
+	return it, err
+}
+
+func (s *Items) ListItemsOf(ctx context.Context, restaurantIDs []primitive.ObjectID) ([]models.Item, error) {
+	rows, err := s.pool.Query(ctx, `SELECT `+itemColumns+` FROM items WHERE restaurant_id = ANY($1) ORDER BY id`, hexes(restaurantIDs))
+	if err != nil {
+		return nil, err
+	}
+	return pgx.CollectRows(rows, scanItem)
+}
+
+func (s *Items) FindItems(ctx context.Context, ids []primitive.ObjectID) ([]models.Item, error) {
+	rows, err := s.pool.Query(ctx, `SELECT `+itemColumns+` FROM items WHERE id = ANY($1)`, hexes(ids))
+	if err != nil {
+		return nil, err
+	}
+	return pgx.CollectRows(rows, scanItem)
+}
+
+// Restaurants is the restaurants.RestaurantStore of the restaurants table
+type Restaurants struct {
+	pool *pgxpool.Pool
+}
+
+// ListRestaurants returns them in ID order, which is creation order as with MongoDB
+func (s *Restaurants) ListRestaurants(ctx context.Context) ([]models.Restaurant, error) {
+	rows, err := s.pool.Query(ctx, `SELECT id, name, currency, tax_rate_bps, service_charge_bps FROM restaurants ORDER BY id`)
+	if err != nil {
+		return nil, err
+	}
+	return pgx.CollectRows(rows, func(row pgx.CollectableRow) (models.Restaurant, error) {
+		var r models.Restaurant
+		var id string
+		if err := row.Scan(&id, &r.Name, &r.Currency, &r.TaxRateBps, &r.ServiceChargeBps); err != nil {
+			return r, err
+		}
+		var err error
+		r.ID, err = objectID(id)
+		return r, err
+	})
+}
@@ -0,0 +1,187 @@
+package pgstore
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"contracts/money"
+	"producer/internal/features/analytics"
+	"producer/internal/features/orders"
+	"producer/internal/models"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Orders is an orders.Store and analytics.OrderStore of the orders table
+type Orders struct {
+	pool *pgxpool.Pool
+}
+
+const orderColumns = `id, restaurant_id, currency, total_price, total_cost, status, creation_date, items,
+	promo_code, tip, pricing, refunded_total, cancelled_at, cancellation_reason, request_id, trace_id`
+
+func scanOrder(row pgx.Row) (models.Order, error) {
+	var o models.Order
+	var id, restaurantID string
+	var totalPrice, totalCost, refundedTotal money.Amount
+	err := row.Scan(&id, &restaurantID, &o.Currency, &totalPrice, &totalCost, &o.Status, &o.CreationDate, &o.Items,
+		&o.PromoCode, &o.Tip, &o.Pricing, &refundedTotal, &o.CancelledAt, &o.CancellationReason, &o.RequestID, &o.TraceID)
+	if err != nil {
+		return o, err
+	}
+	if o.ID, err = objectID(id); err != nil {
+		return o, err
+	}
+	if o.RestaurantID, err = objectID(restaurantID); err != nil {
+		return o, err
+	}
+	o.TotalPrice = money.Money{Amount: totalPrice, Currency: o.Currency}
+	o.TotalCost = money.Money{Amount: totalCost, Currency: o.Currency}
+	if refundedTotal != 0 {
+		o.RefundedTotal = money.Money{Amount: refundedTotal, Currency: o.Currency}
+	}
+	o.CreationDate = o.CreationDate.UTC()
+	o.CancelledAt = utc(o.CancelledAt)
+	return o, nil
+}
+
+func (s *Orders) FindOrder(ctx context.Context, restaurantID, orderID primitive.ObjectID) (*models.Order, error) {
+	row := s.pool.QueryRow(ctx, `SELECT `+orderColumns+` FROM orders WHERE id = $1 AND restaurant_id = $2`, orderID.Hex(), restaurantID.Hex())
+	order, err := scanOrder(row)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, orders.ErrOrderNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &order, nil
+}
+
+func (s *Orders) FindOrders(ctx context.Context, q orders.ListOrdersQuery, limit int) ([]models.Order, error) {
+	sql, args := listQuery(q, limit)
+	rows, err := s.pool.Query(ctx, sql, args...)
+	if err != nil {
+		return nil, err
+	}
+	return pgx.CollectRows(rows, func(row pgx.CollectableRow) (models.Order, error) { return scanOrder(row) })
+}
+
+func (s *Orders) CountOrders(ctx context.Context, q orders.ListOrdersQuery) (int64, error) {
+	q.Cursor = nil
+	where, args := listWhere(q)
+	var n int64
+	err := s.pool.QueryRow(ctx, `SELECT count(*) FROM orders WHERE `+where, args...).Scan(&n)
+	return n, err
+}
+
+// listQuery is the SELECT of q; restaurant_id and creation_date lead so that the
+// (restaurant_id, creation_date, id) index is used, as with MongoDB
+func listQuery(q orders.ListOrdersQuery, limit int) (string, []any) {
+	where, args := listWhere(q)
+	dir := "DESC"
+	if q.Ascending {
+		dir = "ASC"
+	}
+	sql := `SELECT ` + orderColumns + ` FROM orders WHERE ` + where +
+		` ORDER BY creation_date ` + dir + `, id ` + dir
+	if limit > 0 {
+		args = append(args, limit)
+		sql += " LIMIT $" + strconv.Itoa(len(args))
+	}
+	return sql, args
+}
+
+// listWhere is the condition of q and its arguments
+func listWhere(q orders.ListOrdersQuery) (string, []any) {
+	var where []string
+	var args []any
+	arg := func(v any) string {
+		args = append(args, v)
+		return "$" + strconv.Itoa(len(args))
+	}
+
+	where = append(where, "restaurant_id = "+arg(q.RestaurantID.Hex()))
+	if q.From != nil {
+		where = append(where, "creation_date >= "+arg(*q.From))
+	}
+	if q.To != nil {
+		where = append(where, "creation_date < "+arg(*q.To))
+	}
+	if q.MinTotal != nil {
+		where = append(where, "total_price >= "+arg(*q.MinTotal))
+	}
+	if q.MaxTotal != nil {
+		where = append(where, "total_price <= "+arg(*q.MaxTotal))
+	}
+	// containment is answered by the GIN index on the lines
+	if q.ItemID != nil {
+		where = append(where, "items @> jsonb_build_array(jsonb_build_object('id', "+arg(q.ItemID.Hex())+"::text))")
+	}
+	if q.Status != "" {
+		where = append(where, "status = "+arg(q.Status))
+	}
+	if q.RequestID != "" {
+		where = append(where, "request_id = "+arg(q.RequestID))
+	}
+
+	// Keyset pagination: continue strictly after the cursor in (creation_date, id) order
+	if q.Cursor != nil {
+		op := "<"
+		if q.Ascending {
+			op = ">"
+		}
+		where = append(where, "(creation_date, id) "+op+" ("+arg(q.Cursor.CreationDate)+", "+arg(q.Cursor.ID.Hex())+")")
+	}
+	return strings.Join(where, " AND "), args
+}
+
+func (s *Orders) ItemQuantities(ctx context.Context, from, to time.Time) (map[primitive.ObjectID]int64, error) {
+	rows, err := s.pool.Query(ctx, `SELECT line->>'id', SUM((line->>'quantity')::bigint)
+		FROM orders, jsonb_array_elements(items) AS line
+		WHERE creation_date >= $1 AND creation_date < $2
+		GROUP BY 1`, from, to)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	quantities := make(map[primitive.ObjectID]int64)
+	for rows.Next() {
+		var hex string
+		var quantity int64
+		if err := rows.Scan(&hex, &quantity); err != nil {
+			return nil, err
+		}
+		id, err := objectID(hex)
+		if err != nil {
+			return nil, err
+		}
+		quantities[id] = quantity
+	}
+	return quantities, rows.Err()
+}
+
+// Aggregates is the analytics.AggregateStore of the daily_aggregates table
+type Aggregates struct {
+	pool *pgxpool.Pool
+}
+
+// DailyTotals compares the days with from and to as midnights of UTC, as MongoDB stores them
+func (s *Aggregates) DailyTotals(ctx context.Context, restaurantID primitive.ObjectID, from, to time.Time) ([]analytics.DailyTotals, error) {
+	rows, err := s.pool.Query(ctx, `SELECT day, currency, total_orders, cancelled_orders, revenue, discounts, tax, tips, cost, refunds
+		FROM daily_aggregates WHERE restaurant_id = $1 AND day >= $2::timestamp AND day < $3::timestamp
+		ORDER BY day`, restaurantID.Hex(), from.UTC(), to.UTC())
+	if err != nil {
+		return nil, err
+	}
+	return pgx.CollectRows(rows, func(row pgx.CollectableRow) (analytics.DailyTotals, error) {
+		t := analytics.DailyTotals{RestaurantID: restaurantID}
+		err := row.Scan(&t.Day, &t.Currency, &t.TotalOrders, &t.CancelledOrders, &t.Revenue, &t.Discounts, &t.Tax, &t.Tips, &t.Cost, &t.Refunds)
+		t.Day = t.Day.UTC()
+		return t, err
+	})
+}
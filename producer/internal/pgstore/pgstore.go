@@ -0,0 +1,67 @@
+// Package pgstore reads orders, items, restaurants and daily aggregates from PostgreSQL, in the
+// tables of contracts/pgschema the consumer writes. It implements the stores of the services.
+package pgstore
+
+import (
+	"fmt"
+	"time"
+
+	"producer/internal/features/analytics"
+	"producer/internal/features/restaurants"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// DB holds one store of each kind, sharing the pool
+type DB struct {
+	Orders      *Orders
+	Items       *Items
+	Restaurants *Restaurants
+	Aggregates  *Aggregates
+}
+
+func New(pool *pgxpool.Pool) *DB {
+	return &DB{
+		Orders:      &Orders{pool: pool},
+		Items:       &Items{pool: pool},
+		Restaurants: &Restaurants{pool: pool},
+		Aggregates:  &Aggregates{pool: pool},
+	}
+}
+
+// RestaurantStores returns the stores of the restaurants service
+func (db *DB) RestaurantStores() restaurants.Stores {
+	return restaurants.Stores{Restaurants: db.Restaurants, Items: db.Items}
+}
+
+// AnalyticsStores returns the stores of the analytics service
+func (db *DB) AnalyticsStores() analytics.Stores {
+	return analytics.Stores{Aggregates: db.Aggregates, Orders: db.Orders, Items: db.Items}
+}
+
+// hexes are the IDs as stored
+func hexes(ids []primitive.ObjectID) []string {
+	out := make([]string, len(ids))
+	for i, id := range ids {
+		out[i] = id.Hex()
+	}
+	return out
+}
+
+// utc is t in UTC, as the MongoDB driver decodes times
+func utc(t *time.Time) *time.Time {
+	if t == nil {
+		return nil
+	}
+	u := t.UTC()
+	return &u
+}
+
+func objectID(hex string) (primitive.ObjectID, error) {
+	id, err := primitive.ObjectIDFromHex(hex)
+	if err != nil {
+		return id, fmt.Errorf("stored ID %q: %w", hex, err)
+	}
+	return id, nil
+}
@@ -0,0 +1,277 @@
+package pgstore_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"contracts/money"
+	"contracts/pgtest"
+	"producer/internal/features/analytics"
+	"producer/internal/features/orders"
+	"producer/internal/memstore"
+	"producer/internal/models"
+	"producer/internal/pgstore"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// data is stored both in PostgreSQL, the way the consumer writes it, and in a memstore, whose
+// answers the pgstore's must match
+type data struct {
+	restaurants []models.Restaurant
+	items       []models.Item
+	orders      []models.Order
+	aggregates  []analytics.DailyTotals
+}
+
+var start = time.Date(2024, 5, 1, 9, 30, 0, 0, time.UTC)
+
+func newData() data {
+	var d data
+	for i, currency := range []string{"USD", "EUR"} {
+		d.restaurants = append(d.restaurants, models.Restaurant{ID: primitive.NewObjectID(), Name: fmt.Sprintf("Diner %d", i), Currency: currency, TaxRateBps: 800})
+	}
+	for _, r := range d.restaurants {
+		for j := 0; j < 3; j++ {
+			d.items = append(d.items, models.Item{
+				ID: primitive.NewObjectID(), Name: fmt.Sprintf("Dish %d", j), RestaurantID: r.ID,
+				Price: money.New(money.Amount(500+100*j), r.Currency), Cost: money.New(200, r.Currency), Quantity: 10,
+			})
+		}
+	}
+	statuses := []string{models.OrderStatusPending, models.OrderStatusCancelled, models.OrderStatusRefunded}
+	for i := 0; i < 24; i++ {
+		r := d.restaurants[i%2]
+		item := d.items[(i%2)*3+i%3]
+		// pairs of orders share a creation date, so that pages split them by ID
+		created := start.Add(time.Duration(i/2) * 7 * time.Hour)
+		o := models.Order{
+			ID: primitive.NewObjectID(), RestaurantID: r.ID, Currency: r.Currency,
+			TotalPrice: money.New(item.Price.Amount*money.Amount(1+i%4), r.Currency), TotalCost: money.New(item.Cost.Amount*money.Amount(1+i%4), r.Currency),
+			Status: statuses[i%3], CreationDate: created,
+			Items:     []models.OrderItem{{ItemID: item.ID, Quantity: 1 + i%4, UnitPrice: item.Price.Amount, UnitCost: item.Cost.Amount}},
+			RequestID: fmt.Sprintf("request-%d", i%5),
+		}
+		if o.Status == models.OrderStatusCancelled {
+			cancelled := created.Add(time.Hour)
+			o.CancelledAt, o.CancellationReason = &cancelled, "closed"
+		}
+		d.orders = append(d.orders, o)
+	}
+	for _, r := range d.restaurants {
+		for day := 0; day < 5; day++ {
+			d.aggregates = append(d.aggregates, analytics.DailyTotals{
+				RestaurantID: r.ID, Day: time.Date(2024, 5, 1+day, 0, 0, 0, 0, time.UTC), Currency: r.Currency,
+				TotalOrders: int64(day + 1), Revenue: money.Amount(1000 * (day + 1)), Tax: 80, Cost: 400,
+			})
+		}
+	}
+	return d
+}
+
+func (d data) memstore() *memstore.DB {
+	db := memstore.New()
+	db.Restaurants.Put(d.restaurants...)
+	db.Items.Put(d.items...)
+	db.Orders.Put(d.orders...)
+	db.Aggregates.Put(d.aggregates...)
+	return db
+}
+
+func (d data) store(t *testing.T, pool *pgxpool.Pool) {
+	t.Helper()
+	for _, r := range d.restaurants {
+		exec(t, pool, `INSERT INTO restaurants (id, name, currency, tax_rate_bps, service_charge_bps) VALUES ($1, $2, $3, $4, $5)`,
+			r.ID.Hex(), r.Name, r.Currency, r.TaxRateBps, r.ServiceChargeBps)
+	}
+	for _, it := range d.items {
+		exec(t, pool, `INSERT INTO items (id, restaurant_id, name, price, price_currency, cost, cost_currency, quantity)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`,
+			it.ID.Hex(), it.RestaurantID.Hex(), it.Name, it.Price.Amount, it.Price.Currency, it.Cost.Amount, it.Cost.Currency, it.Quantity)
+	}
+	for _, o := range d.orders {
+		exec(t, pool, `INSERT INTO orders (id, restaurant_id, currency, total_price, total_cost, status, creation_date, items,
+			cancelled_at, cancellation_reason, request_id)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)`,
+			o.ID.Hex(), o.RestaurantID.Hex(), o.Currency, o.TotalPrice.Amount, o.TotalCost.Amount, o.Status, o.CreationDate, o.Items,
+			o.CancelledAt, o.CancellationReason, o.RequestID)
+	}
+	for _, a := range d.aggregates {
+		exec(t, pool, `INSERT INTO daily_aggregates (restaurant_id, day, currency, total_orders, revenue, tax, cost)
+			VALUES ($1, $2, $3, $4, $5, $6, $7)`,
+			a.RestaurantID.Hex(), a.Day.Format(time.DateOnly), a.Currency, a.TotalOrders, a.Revenue, a.Tax, a.Cost)
+	}
+}
+
+func exec(t *testing.T, pool *pgxpool.Pool, sql string, args ...any) {
+	t.Helper()
+	if _, err := pool.Exec(context.Background(), sql, args...); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func setup(t *testing.T) (data, *pgstore.DB, *memstore.DB) {
+	pool := pgtest.Start(t)
+	d := newData()
+	d.store(t, pool)
+	return d, pgstore.New(pool), d.memstore()
+}
+
+func ptr[T any](v T) *T { return &v }
+
+func TestFindOrders(t *testing.T) {
+	d, pg, mem := setup(t)
+	ctx := context.Background()
+	rid := d.restaurants[0].ID
+	queries := map[string]orders.ListOrdersQuery{
+		"all":        {RestaurantID: rid},
+		"ascending":  {RestaurantID: rid, Ascending: true},
+		"dates":      {RestaurantID: rid, From: ptr(start.Add(14 * time.Hour)), To: ptr(start.Add(49 * time.Hour))},
+		"totals":     {RestaurantID: rid, MinTotal: ptr(money.Amount(1000)), MaxTotal: ptr(money.Amount(1400))},
+		"item":       {RestaurantID: rid, ItemID: &d.items[1].ID},
+		"status":     {RestaurantID: rid, Status: models.OrderStatusCancelled},
+		"request":    {RestaurantID: d.restaurants[1].ID, RequestID: "request-3"},
+		"other item": {RestaurantID: rid, ItemID: &d.items[4].ID},
+	}
+	for name, q := range queries {
+		t.Run(name, func(t *testing.T) {
+			got, err := pg.Orders.FindOrders(ctx, q, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			want, _ := mem.Orders.FindOrders(ctx, q, 0)
+			if !equalIDs(got, want) {
+				t.Errorf("got %v, want %v", ids(got), ids(want))
+			}
+			if len(got) > 0 && !same(got[0], want[0]) {
+				t.Errorf("got %+v, want %+v", got[0], want[0])
+			}
+			if n, err := pg.Orders.CountOrders(ctx, q); err != nil || n != int64(len(want)) {
+				t.Errorf("count = %d, %v, want %d", n, err, len(want))
+			}
+		})
+	}
+
+	// the pages of both directions follow each other without gaps or repeats
+	for _, ascending := range []bool{false, true} {
+		q := orders.ListOrdersQuery{RestaurantID: rid, Ascending: ascending}
+		all, _ := mem.Orders.FindOrders(ctx, q, 0)
+		var paged []models.Order
+		for {
+			page, err := pg.Orders.FindOrders(ctx, q, 5)
+			if err != nil {
+				t.Fatal(err)
+			}
+			paged = append(paged, page...)
+			if len(page) < 5 {
+				break
+			}
+			last := page[len(page)-1]
+			q.Cursor = &orders.Cursor{CreationDate: last.CreationDate, ID: last.ID, Ascending: ascending}
+		}
+		if !equalIDs(paged, all) {
+			t.Errorf("ascending %v: pages %v, want %v", ascending, ids(paged), ids(all))
+		}
+	}
+}
+
+func TestFindOrder(t *testing.T) {
+	d, pg, _ := setup(t)
+	ctx := context.Background()
+	want := d.orders[1]
+	got, err := pg.Orders.FindOrder(ctx, want.RestaurantID, want.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !same(*got, want) {
+		t.Errorf("got %+v, want %+v", *got, want)
+	}
+	if _, err := pg.Orders.FindOrder(ctx, d.restaurants[1].ID, want.ID); !errors.Is(err, orders.ErrOrderNotFound) {
+		t.Errorf("another restaurant's order: %v, want ErrOrderNotFound", err)
+	}
+}
+
+func TestAnalytics(t *testing.T) {
+	d, pg, mem := setup(t)
+	ctx := context.Background()
+	from, to := time.Date(2024, 5, 2, 0, 0, 0, 0, time.UTC), time.Date(2024, 5, 4, 0, 0, 0, 0, time.UTC)
+
+	totals, err := pg.Aggregates.DailyTotals(ctx, d.restaurants[1].ID, from, to)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, _ := mem.Aggregates.DailyTotals(ctx, d.restaurants[1].ID, from, to)
+	if len(want) != 2 || !same(totals, want) {
+		t.Errorf("daily totals = %+v, want %+v", totals, want)
+	}
+
+	quantities, err := pg.Orders.ItemQuantities(ctx, start, start.Add(48*time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantQuantities, _ := mem.Orders.ItemQuantities(ctx, start, start.Add(48*time.Hour))
+	if len(wantQuantities) == 0 || !reflect.DeepEqual(quantities, wantQuantities) {
+		t.Errorf("item quantities = %v, want %v", quantities, wantQuantities)
+	}
+
+	items, err := pg.Items.FindItems(ctx, []primitive.ObjectID{d.items[2].ID, primitive.NewObjectID()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(items) != 1 || !same(items[0], d.items[2]) {
+		t.Errorf("items = %+v, want %+v", items, d.items[2])
+	}
+}
+
+func TestRestaurants(t *testing.T) {
+	d, pg, mem := setup(t)
+	ctx := context.Background()
+
+	restaurants, err := pg.Restaurants.ListRestaurants(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !same(restaurants, d.restaurants) {
+		t.Errorf("restaurants = %+v, want %+v", restaurants, d.restaurants)
+	}
+	items, err := pg.Items.ListItemsOf(ctx, []primitive.ObjectID{d.restaurants[1].ID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, _ := mem.Items.ListItemsOf(ctx, []primitive.ObjectID{d.restaurants[1].ID})
+	if len(items) != 3 || len(items) != len(want) {
+		t.Errorf("items = %+v, want %+v", items, want)
+	}
+}
+
+// same compares as the API would show the values, times by instant
+func same(a, b any) bool {
+	ja, err := json.Marshal(a)
+	if err != nil {
+		panic(err)
+	}
+	jb, err := json.Marshal(b)
+	if err != nil {
+		panic(err)
+	}
+	return bytes.Equal(ja, jb)
+}
+
+func ids(orders []models.Order) []string {
+	out := make([]string, len(orders))
+	for i, o := range orders {
+		out[i] = o.ID.Hex()[18:]
+	}
+	return out
+}
+
+func equalIDs(a, b []models.Order) bool {
+	return reflect.DeepEqual(ids(a), ids(b))
+}
@@ -2,12 +2,23 @@ package main
 
 import (
 	"context"
-	"log"
+	"errors"
+	"fmt"
+	"log/slog"
 	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/gin-gonic/gin/otelgin"
 
+	"contracts/configload"
+	"contracts/health"
+	"contracts/metrics"
+	"contracts/middleware"
 	"producer/internal/config"
 	"producer/internal/container"
 	analytics "producer/internal/features/analytics"
@@ -16,18 +27,55 @@ import (
 )
 
 func main() {
-	cfg := config.Load()
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
+	args := os.Args[1:]
+	command := "serve"
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		command, args = args[0], args[1:]
+	}
+	switch command {
+	case "serve":
+		serve(args)
+	case "config":
+		configload.ConfigCommand(config.Read, "producer config", args, usage)
+	default:
+		fmt.Fprintf(os.Stderr, "unknown command %q\n%s", command, usage)
+		os.Exit(2)
+	}
+}
 
-	c, err := container.New(ctx, cfg)
+const usage = `usage:
+  producer [serve] [flags]      run the API
+  producer config print [flags] print the effective configuration, secrets redacted
+run with -h for the flags
+`
+
+// serve runs the API until SIGTERM or SIGINT
+func serve(args []string) {
+	cfg := configload.MustLoad(config.Load, "producer serve", args)
+	// SIGTERM and SIGINT start a graceful shutdown, see shutdown
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	initCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	c, err := container.New(initCtx, cfg)
 	if err != nil {
-		log.Fatalf("failed to init container: %v", err)
+		slog.Error("failed to init container", "error", err)
+		os.Exit(1)
 	}
-	defer c.Close(context.Background())
 
-	r := gin.Default()
+	// Feed live order streams from the consumer's lifecycle events
+	stopStream := orders.StartLifecycleConsumer(context.Background(), c.Kafka, cfg.Kafka.LifecycleTopic, c.OrderStream, c.Logger)
+	c.ShutdownFns = append(c.ShutdownFns, stopStream)
+
+	r := gin.New()
+	// handlers pass the gin context on as a context.Context; let it see the request's values
+	r.ContextWithFallback = true
+	r.Use(otelgin.Middleware("producer"), middleware.Correlation(), middleware.Logger(c.Logger), metrics.HTTP(), gin.Recovery())
+	r.GET("/metrics", gin.WrapH(metrics.Handler()))
 
+	healthController := health.NewController(c.Health)
+	healthController.RegisterRoutes(r)
 	ordersController := orders.NewController(c.Orders)
 	ordersController.RegisterRoutes(r)
 	restaurantsController := rests.NewController(c.Restaurants)
@@ -35,8 +83,49 @@ func main() {
 	analyticsController := analytics.NewController(c.Analytics)
 	analyticsController.RegisterRoutes(r)
 
-	srv := &http.Server{Addr: ":" + cfg.Port, Handler: r}
-	if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-		log.Fatalf("server error: %v", err)
+	srv := &http.Server{Addr: ":" + cfg.HTTP.Port, Handler: r}
+	// live order streams never end on their own; closing the hub ends them so they don't hold up the drain
+	srv.RegisterOnShutdown(c.OrderStream.Close)
+	serveErr := make(chan error, 1)
+	go func() {
+		c.Logger.Info("listening", "addr", srv.Addr)
+		serveErr <- srv.ListenAndServe()
+	}()
+
+	exitCode := 0
+	select {
+	case <-ctx.Done():
+		c.Logger.Info("shutting down", "timeout", cfg.ShutdownTimeout)
+	case err := <-serveErr:
+		c.Logger.Error("server error", "error", err)
+		exitCode = 1
+	}
+	// from here a second signal kills the process
+	stop()
+	if err := shutdown(c, srv, cfg.ShutdownTimeout); err != nil {
+		c.Logger.Error("shutdown failed", "error", err)
+		exitCode = 1
+	} else {
+		c.Logger.Info("shut down")
+	}
+	os.Exit(exitCode)
+}
+
+// shutdown stops accepting requests and waits for those in flight, then closes the container,
+// all within timeout
+func shutdown(c *container.Container, srv *http.Server, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	httpErr := srv.Shutdown(ctx)
+
+	closed := make(chan error, 1)
+	go func() {
+		closed <- c.Close(ctx)
+	}()
+	select {
+	case err := <-closed:
+		return errors.Join(httpErr, err)
+	case <-ctx.Done():
+		return fmt.Errorf("shutdown did not finish within %s", timeout)
 	}
 }